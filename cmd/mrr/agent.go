@@ -0,0 +1,106 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "syscall"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Background agent
+// ------------------------------------------
+
+// 'mrr agent' starts 'mrr hook' as a process of its own, without a
+// console, with the tray icon, and returns. Its output goes to agent.log
+// in the data folder unless --log-file says otherwise; 'mrr ctl' drives it
+// and 'mrr ctl quit' stops it.
+//
+// It is not a Windows service on purpose: services run in session 0,
+// whose desktop nobody sees, and input injected there never reaches the
+// user's applications. The agent runs in the session of whoever starts
+// it, and refuses replays while that session's desktop can't take input.
+
+const (
+    // agentEnv is set for the agent process itself.
+    agentEnv = "MRR_AGENT"
+
+    agentLogName = "agent.log"
+
+    DETACHED_PROCESS         = 0x00000008
+    CREATE_NEW_PROCESS_GROUP = 0x00000200
+)
+
+var (
+    procGetCurrentProcessId  = kernel32.MustFindProc("GetCurrentProcessId")
+    procProcessIdToSessionId = kernel32.MustFindProc("ProcessIdToSessionId")
+)
+
+// sessionID is the Terminal Services session MRR runs in; 0 is the
+// services' session.
+func sessionID() uint32 {
+    pid, _, _ := procGetCurrentProcessId.Call()
+    var id uint32
+    procProcessIdToSessionId.Call(pid, uintptr(unsafe.Pointer(&id)))
+    return id
+}
+
+// runAgent implements `mrr agent [flags]`.
+func runAgent(args []string) int {
+    if os.Getenv(agentEnv) == "1" {
+        if sessionID() == 0 {
+            fmt.Println("[ERROR]", msg("The agent runs in session 0 (as a service), where input can't reach anyone's desktop"))
+            return exitUsage
+        }
+        trayMode = true
+        return runHook(args)
+    }
+
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err == nil && encryptRecordings && keyFile == "" {
+        err = fmt.Errorf("the agent has no console to ask for a passphrase; use --key-file with --encrypt")
+    }
+    if err == nil && sessionID() == 0 {
+        err = fmt.Errorf("session 0 (a service) can't inject input into a desktop; start the agent from the user's session")
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitUsage
+    }
+    if instanceRunning() {
+        return alreadyRunning()
+    }
+
+    exe, err := os.Executable()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not start the agent:"), err)
+        return exitReplayFailed
+    }
+
+    // The agent reads the config itself, so it gets the command line
+    // without the config's flags.
+    childArgs := append([]string{"agent"}, cliArgs...)
+    logPath := logFilePath
+    if logPath == "" {
+        logPath = filepath.Join(dataDir(), agentLogName)
+        childArgs = append(childArgs, "--log-file", logPath)
+    }
+    cmd := exec.Command(exe, childArgs...)
+    cmd.Env = append(os.Environ(), agentEnv+"=1")
+    cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: DETACHED_PROCESS | CREATE_NEW_PROCESS_GROUP}
+    if err := cmd.Start(); err != nil {
+        fmt.Println("[ERROR]", msg("Could not start the agent:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Agent started (pid %d), logging to %s", cmd.Process.Pid, logPath))
+    fmt.Println("[INFO]", msg("Use 'mrr ctl status' to talk to it and 'mrr ctl quit' to stop it."))
+    cmd.Process.Release()
+    return exitOK
+}
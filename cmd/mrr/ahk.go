@@ -0,0 +1,153 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     AutoHotkey export
+// ------------------------------------------
+
+// ahkButtons maps button events to AutoHotkey v2 Click options.
+var ahkButtons = map[string]string{
+    "LeftButtonDown":   "Left Down",
+    "LeftButtonUp":     "Left Up",
+    "RightButtonDown":  "Right Down",
+    "RightButtonUp":    "Right Up",
+    "MiddleButtonDown": "Middle Down",
+    "MiddleButtonUp":   "Middle Up",
+    "Mouse4Down":       "X1 Down",
+    "Mouse4Up":         "X1 Up",
+    "Mouse5Down":       "X2 Down",
+    "Mouse5Up":         "X2 Up",
+}
+
+// ahkString quotes s as an AutoHotkey v2 string.
+func ahkString(s string) string {
+    r := strings.NewReplacer("`", "``", `"`, "`\"", "\n", "`n", "\r", "`r", "\t", "`t")
+    return `"` + r.Replace(s) + `"`
+}
+
+// ahkKey names a key record's key for Send, e.g. {vk41sc01E down}.
+func ahkKey(k *KeyStroke, down bool) string {
+    var name string
+    if k.VK != 0 {
+        name += fmt.Sprintf("vk%02X", k.VK)
+    }
+    if k.Scan != 0 {
+        sc := int(k.Scan)
+        if k.Extended {
+            sc |= 0x100
+        }
+        name += fmt.Sprintf("sc%03X", sc)
+    }
+    if down {
+        return "{" + name + " down}"
+    }
+    return "{" + name + " up}"
+}
+
+// writeAHK writes recording as an AutoHotkey v2 script. Esc stops the
+// script. Wait steps become WinWait and PixelGetColor loops; checks and
+// unknown events are left as comments.
+func writeAHK(w io.Writer, recording *Recording, opts ExportOptions) error {
+    ox, oy, err := exportOrigin(recording, opts)
+    if err != nil {
+        return err
+    }
+    bw := bufio.NewWriter(w)
+    line := func(format string, a ...interface{}) {
+        fmt.Fprintf(bw, format+"\n", a...)
+    }
+
+    line("; Exported by MRR, %d records.", len(recording.Records))
+    line("#Requires AutoHotkey v2.0")
+    line("SendMode \"Input\"")
+    line("SetMouseDelay -1")
+    line("SetKeyDelay -1")
+    line("SetTitleMatchMode 2")
+    line("Esc::ExitApp")
+    line("")
+    if opts.Coords == CoordsClient {
+        title := ahkString(recording.Metadata.Window.Title)
+        line("CoordMode \"Mouse\", \"Client\"")
+        line("CoordMode \"Pixel\", \"Client\"")
+        line("WinActivate %s", title)
+        line("WinWaitActive %s,, 10", title)
+    } else {
+        line("CoordMode \"Mouse\", \"Screen\"")
+        line("CoordMode \"Pixel\", \"Screen\"")
+    }
+
+    clock := newExportClock(opts.Speed)
+    for i, rec := range recording.Records {
+        if i > 0 {
+            if d := clock.sleep(rec.DeltaMS); d > 0 {
+                line("Sleep %d", d)
+            }
+        }
+        x, y := rec.X-ox, rec.Y-oy
+
+        if click, ok := ahkButtons[rec.Event]; ok {
+            line("Click \"%d %d %s\"", x, y, click)
+            continue
+        }
+        switch rec.Event {
+        case "MouseMove":
+            line("MouseMove %d, %d, 0", x, y)
+        case "MouseWheel", "MouseHWheel":
+            delta := wheelDelta(rec.Data)
+            dir := "WheelDown"
+            switch {
+            case rec.Event == "MouseHWheel" && delta > 0:
+                dir = "WheelRight"
+            case rec.Event == "MouseHWheel":
+                dir = "WheelLeft"
+            case delta > 0:
+                dir = "WheelUp"
+            }
+            line("Click \"%d %d %s %d\"", x, y, dir, wheelClicks(delta))
+        case EventKeyDown, EventKeyUp:
+            if rec.Key == nil {
+                line("; record %d: %s without Key", i, rec.Event)
+                continue
+            }
+            line("Send %s", ahkString(ahkKey(rec.Key, rec.Event == EventKeyDown)))
+        case EventText:
+            if rec.Key != nil {
+                line("SendText %s", ahkString(rec.Key.Text))
+            }
+        case EventWaitWindow:
+            if rec.Wait != nil {
+                line("if !WinWait(%s,, %g)", ahkString(rec.Wait.Title), rec.Wait.Timeout().Seconds())
+                line("    ExitApp 1")
+            }
+        case EventWaitPixel:
+            if rec.Wait == nil {
+                continue
+            }
+            r, g, b, err := format.ParseColor(rec.Wait.Color)
+            if err != nil {
+                return fmt.Errorf("record %d: %v", i, err)
+            }
+            // PixelSearch over a single pixel honours the tolerance.
+            line("deadline := A_TickCount + %d", rec.Wait.Timeout().Milliseconds())
+            line("while !PixelSearch(&_, &_, %d, %d, %d, %d, 0x%02X%02X%02X, %d) {", x, y, x, y, r, g, b, rec.Wait.Tolerance)
+            line("    if A_TickCount > deadline")
+            line("        ExitApp 1")
+            line("    Sleep 50")
+            line("}")
+        default:
+            line("; record %d: %s is not exported", i, rec.Event)
+        }
+    }
+    line("ExitApp")
+    return bw.Flush()
+}
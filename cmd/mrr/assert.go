@@ -0,0 +1,60 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     Pixel checkpoints with retry
+// ------------------------------------------
+
+// Check steps assert that the screen looks as expected at that point of
+// the replay; package player replays the records before a failed check
+// again. See format.CheckStep.
+const (
+    EventAssertPixel  = format.EventAssertPixel
+    EventAssertRegion = format.EventAssertRegion
+)
+
+// CheckStep holds the parameters of a check record.
+type CheckStep = format.CheckStep
+
+// VK_F8 inserts a pixel check at the cursor while recording.
+const VK_F8 = 0x77
+
+// recordPixelCheck appends an AssertPixel step for the pixel under the
+// cursor, with its current color, to the running recording.
+func recordPixelCheck() error {
+    pos, err := desktop.CursorPos()
+    if err != nil {
+        return err
+    }
+    r, g, b, err := desktop.PixelAt(pos.X, pos.Y)
+    if err != nil {
+        return err
+    }
+    rec := MouseRecord{
+        X:     pos.X,
+        Y:     pos.Y,
+        Event: EventAssertPixel,
+        Check: &CheckStep{Color: fmt.Sprintf("#%02X%02X%02X", r, g, b), Tolerance: 8, Retries: 2},
+    }
+
+    var kept []MouseRecord
+    mtx.Lock()
+    if isRecording {
+        kept = keepRecords(timedRecord{rec, time.Now()})
+    }
+    mtx.Unlock()
+    for _, rec := range kept {
+        fireEventRecorded(rec)
+    }
+    fmt.Println("[INFO]", msgf("Check added: pixel (%d,%d) must be %s", rec.X, rec.Y, rec.Check.Color))
+    return nil
+}
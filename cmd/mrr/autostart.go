@@ -0,0 +1,74 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+// ------------------------------------------
+//     Starting at login
+// ------------------------------------------
+
+// 'mrr install-autostart' starts the agent, with its tray icon, whenever
+// the user logs in, from the Run key of the current user, so the hotkeys
+// are always there. No administrator rights are needed, and the agent runs
+// in the session logged into, where its input reaches the desktop.
+
+const (
+    runKey       = `Software\Microsoft\Windows\CurrentVersion\Run`
+    runValueName = "MRR"
+)
+
+// runInstallAutostart implements `mrr install-autostart [flags]`. The flags
+// are the agent's.
+func runInstallAutostart(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err == nil && encryptRecordings && keyFile == "" {
+        err = fmt.Errorf("the agent has no console to ask for a passphrase; use --key-file with --encrypt")
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr install-autostart [flags]")
+        return exitUsage
+    }
+    exe, err := os.Executable()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not register MRR to start at login:"), err)
+        return exitInvalid
+    }
+    // The agent reads the config at every login, so only the command
+    // line's own flags are kept. It doesn't start in this folder.
+    command := commandLine(exe, append([]string{"agent"}, absolutePathArgs(cliArgs)...))
+    if err := regSetString(runKey, runValueName, command); err != nil {
+        fmt.Println("[ERROR]", msg("Could not register MRR to start at login:"), err)
+        return exitInvalid
+    }
+    fmt.Println("[INFO]", msgf("MRR now starts at login with %s", command))
+    if !instanceRunning() {
+        fmt.Println("[INFO]", msg("Run 'mrr agent' to start it now as well."))
+    }
+    return exitOK
+}
+
+// runUninstallAutostart implements `mrr uninstall-autostart`.
+func runUninstallAutostart(args []string) int {
+    if len(args) > 0 {
+        fmt.Println("usage: mrr uninstall-autostart")
+        return exitUsage
+    }
+    if _, ok := regGetString(runKey, runValueName); !ok {
+        fmt.Println("[INFO]", msg("MRR wasn't set to start at login"))
+        return exitOK
+    }
+    if err := regDeleteValue(runKey, runValueName); err != nil {
+        fmt.Println("[ERROR]", msg("Could not stop MRR starting at login:"), err)
+        return exitInvalid
+    }
+    fmt.Println("[INFO]", msg("MRR no longer starts at login; a running agent keeps running until 'mrr ctl quit'"))
+    return exitOK
+}
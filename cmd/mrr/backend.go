@@ -0,0 +1,58 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Injection backends
+// ------------------------------------------
+
+// DefaultBackend is the injection backend used unless --backend picks
+// another.
+const DefaultBackend = "sendinput"
+
+// backends maps the --backend names to constructors. A constructor fails
+// when its backend can't be used on this machine.
+var backends = map[string]func() (playback.Injector, error){
+    "sendinput":    func() (playback.Injector, error) { return playback.SendInput, nil },
+    "interception": newInterceptionInjector,
+}
+
+func backendNames() string {
+    var names []string
+    for name := range backends {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return strings.Join(names, ", ")
+}
+
+// parseBackend checks that name is a known backend.
+func parseBackend(name string) (string, error) {
+    name = strings.ToLower(name)
+    if _, ok := backends[name]; !ok {
+        return "", fmt.Errorf("unknown backend %q (want %s)", name, backendNames())
+    }
+    return name, nil
+}
+
+// openBackend returns the named backend's injector, falling back to
+// SendInput when it isn't available.
+func openBackend(name string) playback.Injector {
+    if name == "" {
+        name = DefaultBackend
+    }
+    inj, err := backends[name]()
+    if err != nil {
+        fmt.Println("[WARN]", msgf("%s backend unavailable, using SendInput: %v", name, err))
+        return playback.SendInput
+    }
+    return inj
+}
@@ -0,0 +1,153 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// ------------------------------------------
+//     Atomic saves and backups
+// ------------------------------------------
+
+// Saves go to a temporary file next to the target, which is renamed over
+// it once everything is written, so a crash mid-save leaves the old file
+// whole. Before that the old file is kept as name.bak, the one before it
+// as name.bak.2 and so on, up to backupCount.
+
+// backupExt is appended to a recording's file name for its backups.
+const backupExt = ".bak"
+
+// backupCount is how many backups to keep of each file (--backups).
+var backupCount = 1
+
+// backedUp holds files whose previous contents were already backed up by
+// the NDJSON stream writing over them, so the final save doesn't back up
+// the half-written stream in their place.
+var (
+    backedUpMu sync.Mutex
+    backedUp   = make(map[string]bool)
+)
+
+// backupPath names the n-th backup of filename, from 1.
+func backupPath(filename string, n int) string {
+    if n == 1 {
+        return filename + backupExt
+    }
+    return fmt.Sprintf("%s%s.%d", filename, backupExt, n)
+}
+
+// isBackupName tells whether name is a backup, which isn't a recording of
+// its own.
+func isBackupName(name string) bool {
+    i := strings.LastIndex(name, backupExt)
+    if i < 0 {
+        return false
+    }
+    rest := name[i+len(backupExt):]
+    if rest == "" {
+        return true
+    }
+    n, err := strconv.Atoi(strings.TrimPrefix(rest, "."))
+    return strings.HasPrefix(rest, ".") && err == nil && n > 1
+}
+
+// backupFile moves filename's backups along and makes its current contents
+// the newest. A missing file needs no backup.
+func backupFile(filename string) error {
+    if backupCount <= 0 {
+        return nil
+    }
+    if _, err := os.Stat(filename); os.IsNotExist(err) {
+        return nil
+    }
+    for n := backupCount; n > 1; n-- {
+        err := os.Rename(backupPath(filename, n-1), backupPath(filename, n))
+        if err != nil && !os.IsNotExist(err) {
+            return err
+        }
+    }
+    // A hard link keeps the old contents without copying them; the save
+    // then replaces filename with a new file. FAT and some network drives
+    // can't link.
+    bak := backupPath(filename, 1)
+    os.Remove(bak)
+    if os.Link(filename, bak) == nil {
+        return nil
+    }
+    return copyFile(filename, bak)
+}
+
+func copyFile(from, to string) error {
+    in, err := os.Open(from)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+    out, err := os.Create(to)
+    if err != nil {
+        return err
+    }
+    _, err = io.Copy(out, in)
+    if cerr := out.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+// markBackedUp notes that filename was backed up before being written
+// over; the next writeAtomic to it skips the backup.
+func markBackedUp(filename string) {
+    backedUpMu.Lock()
+    backedUp[filename] = true
+    backedUpMu.Unlock()
+}
+
+func takeBackedUp(filename string) bool {
+    backedUpMu.Lock()
+    defer backedUpMu.Unlock()
+    ok := backedUp[filename]
+    delete(backedUp, filename)
+    return ok
+}
+
+// writeAtomic replaces filename with what write writes, backing up the old
+// file first. If write fails filename is left as it was. The temporary
+// file starts with a dot, so the library doesn't list it.
+func writeAtomic(filename string, write func(f *os.File) error) error {
+    dir, base := filepath.Split(filename)
+    if dir == "" {
+        dir = "."
+    }
+    f, err := ioutil.TempFile(dir, "."+base+".*.tmp")
+    if err != nil {
+        return err
+    }
+    tmp := f.Name()
+    err = write(f)
+    if err == nil {
+        err = f.Sync()
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err == nil && !takeBackedUp(filename) {
+        if berr := backupFile(filename); berr != nil {
+            fmt.Println("[WARN]", msgf("Could not back up %s: %v", filename, berr))
+        }
+    }
+    if err == nil {
+        err = os.Rename(tmp, filename)
+    }
+    if err != nil {
+        os.Remove(tmp)
+    }
+    return err
+}
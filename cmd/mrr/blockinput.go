@@ -0,0 +1,88 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "sync/atomic"
+)
+
+// ------------------------------------------
+//     Blocking user input during replay
+// ------------------------------------------
+
+var (
+    procBlockInput = user32.MustFindProc("BlockInput")
+
+    // inputBlocked makes the hooks swallow every real mouse and keyboard
+    // event. The replay hotkeys still act on the replay, and Esc aborts it
+    // and lifts the block.
+    inputBlocked atomic.Bool
+)
+
+// blockUserInput stops real input from reaching other applications and
+// returns the function that lifts the block again.
+//
+// With the hooks installed they swallow the input themselves, so Esc keeps
+// working. Without them (mrr play) it falls back to BlockInput, which
+// needs administrator rights, can only be escaped with Ctrl+Alt+Del and
+// must be lifted from the same OS thread: callers lock theirs. BlockInput
+// would block the Interception driver's strokes too, so a replay through
+// it (driver set) is only blocked by the hooks.
+func blockUserInput(driver bool) (func(), error) {
+    if hooks.Load() != nil {
+        inputBlocked.Store(true)
+        return func() { inputBlocked.Store(false) }, nil
+    }
+    if driver {
+        return nil, fmt.Errorf("BlockInput would block the interception backend's strokes too; replay through the running MRR to block input")
+    }
+
+    r, _, err := procBlockInput.Call(1)
+    if r == 0 {
+        return nil, fmt.Errorf("BlockInput failed, it needs administrator rights: %v", err)
+    }
+    return func() { procBlockInput.Call(0) }, nil
+}
+
+// swallowBlockedKey is called by the keyboard hook for real key events
+// while input is blocked. The abort hotkey aborts the replay and unblocks
+// right away; pause, step and the speed hotkeys still control the replay.
+// Every key is swallowed.
+func swallowBlockedKey(wparam uintptr, vk uint32) {
+    if wparam != WM_KEYDOWN && wparam != WM_SYSKEYDOWN {
+        return
+    }
+    action := hotkeyFor(vk)
+    if action == actionAbort {
+        inputBlocked.Store(false)
+        if abortReplay() {
+            fmt.Println("[INFO]", msgf("%s pressed -> Aborting replay, input unblocked", hotkeyName(action)))
+        }
+        return
+    }
+
+    p := replayingPlayer()
+    if p == nil {
+        return
+    }
+    switch action {
+    case actionPause:
+        if p.Resume() {
+            fmt.Println("[INFO]", msgf("%s pressed -> Resuming replay", hotkeyName(action)))
+        } else {
+            p.Pause()
+            fmt.Println("[INFO]", msgf("%s pressed -> Pausing replay", hotkeyName(action)))
+        }
+
+    case actionStep:
+        if p.opts.Step {
+            p.Step()
+        }
+
+    case actionFaster, actionSlower, actionResetSpeed:
+        speed := adjustSpeed(p.Speed(), action)
+        p.SetSpeed(speed)
+        fmt.Println("[INFO]", msgf("Replay speed %gx", speed))
+    }
+}
@@ -0,0 +1,71 @@
+// +build windows
+
+package main
+
+import "sync"
+
+// ------------------------------------------
+//     Callbacks for embedding applications
+// ------------------------------------------
+
+// Callbacks lets a host application follow recording and replay without
+// scraping stdout. Every field is optional.
+//
+// OnEventRecorded runs on the hook thread and must return quickly, or
+// Windows will start dropping the low-level hooks.
+type Callbacks struct {
+    OnRecordStart    func()
+    OnRecordStop     func(records []MouseRecord)
+    OnEventRecorded  func(rec MouseRecord)
+    OnReplayProgress func(progress ReplayProgress)
+    OnError          func(err error)
+}
+
+var (
+    cbMtx     sync.RWMutex
+    callbacks Callbacks
+)
+
+// SetCallbacks replaces the registered callbacks. Pass a zero Callbacks to
+// remove them all.
+func SetCallbacks(cb Callbacks) {
+    cbMtx.Lock()
+    callbacks = cb
+    cbMtx.Unlock()
+}
+
+func currentCallbacks() Callbacks {
+    cbMtx.RLock()
+    defer cbMtx.RUnlock()
+    return callbacks
+}
+
+func fireRecordStart() {
+    if f := currentCallbacks().OnRecordStart; f != nil {
+        f()
+    }
+}
+
+func fireRecordStop(records []MouseRecord) {
+    if f := currentCallbacks().OnRecordStop; f != nil {
+        f(records)
+    }
+}
+
+func fireEventRecorded(rec MouseRecord) {
+    if f := currentCallbacks().OnEventRecorded; f != nil {
+        f(rec)
+    }
+}
+
+func fireReplayProgress(progress ReplayProgress) {
+    if f := currentCallbacks().OnReplayProgress; f != nil {
+        f(progress)
+    }
+}
+
+func fireError(err error) {
+    if f := currentCallbacks().OnError; f != nil && err != nil {
+        f(err)
+    }
+}
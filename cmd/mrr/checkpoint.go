@@ -0,0 +1,125 @@
+// +build windows
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "time"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Resume checkpoints
+// ------------------------------------------
+
+// checkpointExt is appended to a recording's file name for its checkpoint.
+const checkpointExt = ".checkpoint"
+
+// Checkpoint remembers where an interrupted replay of a recording stopped.
+type Checkpoint struct {
+    // Index is the first record, in the recording's own numbering, that
+    // wasn't played.
+    Index int `json:"Index"`
+    // Records guards against resuming into a recording that has since
+    // been re-recorded.
+    Records int       `json:"Records"`
+    Reason  string    `json:"Reason,omitempty"`
+    SavedAt time.Time `json:"SavedAt"`
+}
+
+func checkpointPath(filename string) string {
+    return filename + checkpointExt
+}
+
+func saveCheckpoint(filename string, cp Checkpoint) error {
+    b, err := json.MarshalIndent(cp, "", "  ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(checkpointPath(filename), b, 0644)
+}
+
+// loadCheckpoint returns the checkpoint saved for filename, or nil if
+// there is none.
+func loadCheckpoint(filename string) (*Checkpoint, error) {
+    b, err := ioutil.ReadFile(checkpointPath(filename))
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var cp Checkpoint
+    if err := json.Unmarshal(b, &cp); err != nil {
+        return nil, fmt.Errorf("%s: %v", checkpointPath(filename), err)
+    }
+    return &cp, nil
+}
+
+func clearCheckpoint(filename string) {
+    if err := os.Remove(checkpointPath(filename)); err != nil && !os.IsNotExist(err) {
+        debugPrintln("[DEBUG] could not remove checkpoint:", err)
+    }
+}
+
+// resumeFrom returns a copy of p whose replay starts at filename's
+// checkpoint, or p itself when there is nothing to resume.
+func (p *Player) resumeFrom(filename string, recording *Recording) *Player {
+    cp, err := loadCheckpoint(filename)
+    if err != nil {
+        fmt.Println("[WARN]", msg("Ignoring checkpoint:"), err)
+        return p
+    }
+    if cp == nil {
+        return p
+    }
+    if cp.Records != len(recording.Records) {
+        fmt.Println("[WARN]", msgf("Ignoring checkpoint: it was saved for %d records, the recording has %d",
+            cp.Records, len(recording.Records)))
+        return p
+    }
+
+    fmt.Println("[INFO]", msgf("Resuming at record %d of %d", cp.Index, cp.Records))
+    opts := p.opts
+    opts.Speed = 1
+    if cp.Index > opts.Slice.First {
+        opts.Slice.First = cp.Index
+    }
+    // The checkpoint finishes the interrupted pass only.
+    opts.Loop = 1
+    return p.derive(opts)
+}
+
+// checkpoint saves or clears filename's checkpoint after a replay.
+// Reversed replays play indexes out of order, so they never save one, and
+// neither do replays that failed before injecting anything.
+func (p *Player) checkpoint(filename string, recording *Recording, result *ReplayResult, err error) {
+    if p.opts.DryRun {
+        return
+    }
+    // A replay that only failed verification did play to the end.
+    if err == nil || errors.Is(err, playback.ErrVerifyFailed) {
+        clearCheckpoint(filename)
+        return
+    }
+    if p.opts.Reverse || result.EventsInjected == 0 {
+        return
+    }
+
+    cp := Checkpoint{
+        Index:   result.ResumeIndex,
+        Records: len(recording.Records),
+        Reason:  err.Error(),
+        SavedAt: time.Now(),
+    }
+    if serr := saveCheckpoint(filename, cp); serr != nil {
+        fmt.Println("[WARN]", msg("Could not save checkpoint:"), serr)
+        return
+    }
+    fmt.Println("[INFO]", msgf("Stopped at record %d; run with --resume to continue from there", cp.Index))
+}
@@ -0,0 +1,38 @@
+// +build windows
+
+package main
+
+import (
+    "errors"
+    "fmt"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     Recording checksums
+// ------------------------------------------
+
+// JSON and binary recordings carry a SHA-256 of their records (see
+// format.Checksum), checked on load so a file that was cut short or
+// damaged is refused up front instead of failing halfway through a replay.
+// NDJSON and CSV recordings are meant to be appended to and edited, so
+// they carry none; neither do files from before checksums.
+
+// ignoreChecksum loads recordings whose checksum doesn't match with a
+// warning instead of an error (--ignore-checksum).
+var ignoreChecksum bool
+
+// verifyChecksum checks a freshly loaded recording against its checksum.
+func verifyChecksum(recording *Recording) error {
+    err := format.VerifyChecksum(recording)
+    if !errors.Is(err, format.ErrChecksumMismatch) {
+        return err
+    }
+    err = fmt.Errorf("%v. if you edited it, remove its Checksum or load it with --ignore-checksum", err)
+    if ignoreChecksum {
+        fmt.Println("[WARN]", err)
+        return nil
+    }
+    return err
+}
@@ -0,0 +1,343 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// ------------------------------------------
+//     Command line
+// ------------------------------------------
+
+// mrr <command> [flags] [args]. Without a command MRR runs in the
+// background as before, driven by hotkeys ('mrr hook'). Flags are parsed
+// by parseArgs for every command, but each command only accepts the
+// groups of flags that mean something to it.
+
+// flagGroup is a set of parseArgs flags.
+type flagGroup int
+
+const (
+    // flagsCommon apply to every command.
+    flagsCommon flagGroup = 1 << iota
+    // flagsSave choose how recordings are written.
+    flagsSave
+    // flagsRecord shape new recordings.
+    flagsRecord
+    // flagsReplay shape replays.
+    flagsReplay
+    // flagsSpeed is --speed for commands that write timed output.
+    flagsSpeed
+    // flagsHook only mean something while MRR runs in the background.
+    flagsHook
+    // flagsUpdate are for mrr update alone.
+    flagsUpdate
+
+    flagsAll = flagsCommon | flagsSave | flagsRecord | flagsReplay | flagsSpeed | flagsHook
+)
+
+// flagGroups tells which groups each parseArgs flag belongs to.
+var flagGroups = map[string]flagGroup{
+    "--config":          flagsCommon,
+    "--debug":           flagsCommon,
+    "--data-dir":        flagsCommon,
+    "--library":         flagsCommon,
+    "--key-file":        flagsCommon,
+    "--ignore-checksum": flagsCommon,
+    "--profile":         flagsCommon,
+    "--lang":            flagsCommon,
+
+    "--format":   flagsSave,
+    "--compress": flagsSave,
+    "--encrypt":  flagsSave,
+    "--backups":  flagsSave,
+
+    "--simplify":      flagsRecord,
+    "--device":        flagsRecord,
+    "--save-as":       flagsRecord,
+    "--output":        flagsRecord | flagsReplay,
+    "--target-window": flagsRecord | flagsReplay,
+
+    "--json":              flagsReplay,
+    "--speed":             flagsReplay | flagsSpeed,
+    "--no-dpi-scale":      flagsReplay,
+    "--loop":              flagsReplay,
+    "--loop-step":         flagsReplay,
+    "--loop-delay":        flagsReplay,
+    "--ramp":              flagsReplay,
+    "--speed-map":         flagsReplay,
+    "--countdown":         flagsReplay,
+    "--interpolate":       flagsReplay,
+    "--humanize":          flagsReplay,
+    "--humanize-jitter":   flagsReplay,
+    "--humanize-curve":    flagsReplay,
+    "--delay-jitter":      flagsReplay,
+    "--delay-range":       flagsReplay,
+    "--seed":              flagsReplay,
+    "--rescale":           flagsReplay,
+    "--anchor":            flagsReplay,
+    "--from":              flagsReplay,
+    "--to":                flagsReplay,
+    "--events":            flagsReplay,
+    "--no-failsafe":       flagsReplay,
+    "--mirror":            flagsReplay,
+    "--mirror-axis":       flagsReplay,
+    "--offset":            flagsReplay,
+    "--verify":            flagsReplay,
+    "--verify-tolerance":  flagsReplay,
+    "--step":              flagsReplay,
+    "--backend":           flagsReplay,
+    "--block-input":       flagsReplay,
+    "--teleport":          flagsReplay,
+    "--resume":            flagsReplay,
+    "--progress":          flagsReplay,
+    "--dry-run":           flagsReplay,
+    "--reverse":           flagsReplay,
+    "--playlist":          flagsReplay,
+    "--background-window": flagsReplay,
+    "--foreground":        flagsReplay,
+    "--restore-cursor":    flagsReplay,
+    "--park":              flagsReplay,
+
+    "--hotkey":       flagsRecord | flagsHook,
+    "--result-json":  flagsRecord | flagsReplay | flagsHook,
+    "--log-format":   flagsRecord | flagsReplay | flagsHook,
+    "--log-file":     flagsRecord | flagsReplay | flagsHook,
+    "--log-max-size": flagsRecord | flagsReplay | flagsHook,
+    "--log-rotate":   flagsRecord | flagsReplay | flagsHook,
+    "--log-keep":     flagsRecord | flagsReplay | flagsHook,
+
+    "--schedule": flagsHook,
+    "--tray":     flagsHook,
+    "--notify":   flagsHook,
+
+    "--update-url": flagsUpdate,
+}
+
+// activeFlags are the groups the running command accepts.
+var activeFlags = flagsAll
+
+// activeCommand names the running command, for error messages.
+var activeCommand = "hook"
+
+// checkFlag returns an error unless flag is in the accepted groups of
+// command's flags.
+func checkFlag(flag, command string, accepted flagGroup) error {
+    g, ok := flagGroups[flag]
+    if !ok {
+        names := make([]string, 0, len(flagGroups))
+        for name := range flagGroups {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        return fmt.Errorf("unknown flag %s%s", flag, suggest(flag, names))
+    }
+    if g&accepted == 0 {
+        return fmt.Errorf("%s doesn't apply to mrr %s", flag, command)
+    }
+    return nil
+}
+
+// pathFlags are the flags that take a file or folder, relative to the
+// working directory.
+var pathFlags = map[string]bool{
+    "--key-file":    true,
+    "--config":      true,
+    "--data-dir":    true,
+    "--library":     true,
+    "--output":      true,
+    "--playlist":    true,
+    "--result-json": true,
+    "--log-file":    true,
+    "--schedule":    true,
+}
+
+// absolutePathArgs returns args with the values of the path flags made
+// absolute, for a command line that runs from another working directory.
+// A --playlist that isn't there is left as is, it names one in the
+// library.
+func absolutePathArgs(args []string) []string {
+    out := append([]string(nil), args...)
+    for i := 0; i+1 < len(out); i++ {
+        if !pathFlags[out[i]] {
+            continue
+        }
+        i++
+        if out[i-1] == "--playlist" {
+            if _, err := os.Stat(out[i]); err != nil {
+                continue
+            }
+        }
+        if abs, err := filepath.Abs(out[i]); err == nil {
+            out[i] = abs
+        }
+    }
+    return out
+}
+
+// command is one of mrr's subcommands.
+type command struct {
+    name string
+    // args follows the name in the usage line.
+    args    string
+    summary string
+    flags   flagGroup
+    run     func(args []string) int
+}
+
+// commands are listed by 'mrr help' in this order.
+var commands []command
+
+func init() {
+    commands = []command{
+        {"hook", "[flags]", "run in the background and record and replay with hotkeys (the default)", flagsAll, runHook},
+        {"agent", "[flags]", "start 'mrr hook' in the background, with a tray icon and no console", flagsAll, runAgent},
+        {"setup", "[flags]", "choose the hotkeys, the library folder and how monitors are handled, and save them to the config", flagsCommon, runSetup},
+        {"record", "[flags] [out] [--duration 30s]", "record until Insert, Ctrl+C or --duration, without hotkeys", flagsCommon | flagsSave | flagsRecord, runRecord},
+        {"tui", "[flags]", "browse, record and replay recordings in a full-screen console UI", flagsCommon | flagsSave | flagsRecord | flagsReplay, runTUI},
+        {"shell", "[flags]", "record, replay and manage the library from an interactive prompt", flagsCommon | flagsSave | flagsRecord | flagsReplay, runShell},
+        {"play", "[flags] <file>", "replay a recording or playlist once and exit", flagsCommon | flagsReplay, runPlay},
+        {"devices", "", "list the mice, keyboards and other input devices attached", flagsCommon, runDevices},
+        {"list", "[--longer-than 5m] [--window title]", "list the recording library", flagsCommon, runList},
+        {"info", "<name>", "show the details of a recording", flagsCommon, runInfo},
+        {"use", "<name>", "make a library recording the one End replays", flagsCommon, runUse},
+        {"rm", "<name>...", "delete library recordings", flagsCommon, runRemove},
+        {"import", "<file>...", "copy recordings into the library", flagsCommon | flagsSave, runImport},
+        {"convert", "[--from fmt] [--to fmt] [--coords screen|client] <in> <out>", "change a recording's format or export it as a script", flagsCommon | flagsSave | flagsSpeed, runConvert},
+        {"edit", "<op> [options] <file> [-o out]", "trim, retime, move or thin out a recording", flagsCommon | flagsSave, runEdit},
+        {"editor", "<file> [-o out] [--port 8080]", "edit a recording's events on a timeline in the browser", flagsCommon | flagsSave, runEditor},
+        {"split", "<in> --at [hh:]mm:ss...", "cut a recording into parts", flagsCommon | flagsSave, runSplit},
+        {"merge", "<a> <b>... -o <out> [--gap 500ms]", "join recordings one after another", flagsCommon | flagsSave, runMerge},
+        {"visualize", "<in> -o <out.svg|out.png>", "draw a recording's path", flagsCommon, runVisualize},
+        {"render", "<in> -o <out.gif|out.mp4> [--fps 10] [--width 960] [--background image|screen]", "animate a recording without replaying it", flagsCommon | flagsSpeed, runRender},
+        {"install-autostart", "[flags]", "start the agent, with the hotkeys and the tray icon, whenever you log in", flagsAll, runInstallAutostart},
+        {"uninstall-autostart", "", "stop starting the agent at login", 0, runUninstallAutostart},
+        {"install-shell", "[replay flags]", "make double-clicking a recording or playlist replay it with 'mrr play'", flagsCommon | flagsReplay, runInstallShell},
+        {"uninstall-shell", "", "stop double-clicking recordings from running MRR", 0, runUninstallShell},
+        {"open", "", "open the recordings folder in Explorer", flagsCommon, runOpen},
+        {"update", "[--check] [--force]", "download the latest release and replace this mrr.exe with it", flagsCommon | flagsUpdate, runUpdate},
+        {"completion", "bash|powershell", "print a script that completes mrr's commands, flags and recordings", 0, runCompletion},
+        {"ctl", "record-start|record-stop|replay|replay-abort|pause|resume|status|reload|quit|use <name>|play [flags] <file>|profile [name]", "drive a running 'mrr hook' from another console", 0, runCtl},
+        {"help", "[command]", "show this list, or a command's usage and flags", 0, runHelp},
+    }
+}
+
+func findCommand(name string) *command {
+    for i := range commands {
+        if commands[i].name == name {
+            return &commands[i]
+        }
+    }
+    return nil
+}
+
+func isHelpFlag(arg string) bool {
+    return arg == "-h" || arg == "--help" || arg == "/?"
+}
+
+// runCLI runs the command args name and returns its exit code.
+func runCLI(args []string) int {
+    name := "hook"
+    if len(args) > 0 && isHelpFlag(args[0]) {
+        return runHelp(nil)
+    }
+    if len(args) > 0 && args[0] == "--list-devices" {
+        args[0] = "devices"
+    }
+    if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+        name, args = args[0], args[1:]
+    }
+    cmd := findCommand(name)
+    if cmd == nil {
+        names := make([]string, len(commands))
+        for i, c := range commands {
+            names[i] = c.name
+        }
+        fmt.Println("[ERROR]", msgf("Unknown command %q%s", name, suggest(name, names)))
+        fmt.Println(msg("Run 'mrr help' for the list."))
+        return exitUsage
+    }
+    for _, a := range args {
+        if isHelpFlag(a) {
+            commandHelp(cmd)
+            return exitOK
+        }
+    }
+    activeCommand, activeFlags = cmd.name, cmd.flags
+    defaultFlags, cliArgs = currentFlagSettings(), args
+    if cmd.flags != 0 {
+        var err error
+        if args, err = withConfig(cmd, args); err != nil {
+            fmt.Println("[ERROR]", msg("Could not read the config:"), err)
+            return exitUsage
+        }
+    }
+    code := cmd.run(args)
+    if resultJSONPath != "" {
+        writeRunResult(cmd.name, code)
+    }
+    return code
+}
+
+// runHelp implements `mrr help [command]`.
+func runHelp(args []string) int {
+    if len(args) > 0 {
+        cmd := findCommand(args[0])
+        if cmd == nil {
+            fmt.Println("[ERROR]", msgf("Unknown command %q", args[0]))
+            return exitUsage
+        }
+        commandHelp(cmd)
+        return exitOK
+    }
+    fmt.Println("usage: mrr [command] [flags] [args]")
+    fmt.Println()
+    width := 0
+    for _, c := range commands {
+        if len(c.name) > width {
+            width = len(c.name)
+        }
+    }
+    for _, c := range commands {
+        fmt.Printf("  %-*s %s\n", width, c.name, msg(c.summary))
+    }
+    fmt.Println()
+    fmt.Println(msg("Run 'mrr help <command>' for a command's flags."))
+    return exitOK
+}
+
+// commandHelp prints cmd's usage and the flags it takes.
+func commandHelp(cmd *command) {
+    fmt.Printf("usage: mrr %s %s\n", cmd.name, cmd.args)
+    fmt.Println()
+    summary := msg(cmd.summary)
+    fmt.Println(" ", strings.ToUpper(summary[:1])+summary[1:]+".")
+    var names []string
+    for name, g := range flagGroups {
+        if g&cmd.flags != 0 {
+            names = append(names, name)
+        }
+    }
+    if len(names) == 0 {
+        return
+    }
+    sort.Strings(names)
+    fmt.Println()
+    fmt.Println(msg("flags:"))
+    line := " "
+    for _, name := range names {
+        if len(line)+len(name) > 76 {
+            fmt.Println(line)
+            line = " "
+        }
+        line += " " + name
+    }
+    fmt.Println(line)
+    fmt.Println()
+    fmt.Println(msg("See the README for what each flag does."))
+}
@@ -0,0 +1,40 @@
+// +build windows
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestAbsolutePathArgs(t *testing.T) {
+    dir := t.TempDir()
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(dir); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Chdir(wd)
+    if err := os.WriteFile("daily.mrrlist", nil, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    args := []string{"--key-file", "key.txt", "--speed", "2", "--log-file", `logs\mrr.log`,
+        "--playlist", "daily.mrrlist", "--config", filepath.Join(dir, "mrr.toml")}
+    want := []string{"--key-file", filepath.Join(dir, "key.txt"), "--speed", "2",
+        "--log-file", filepath.Join(dir, "logs", "mrr.log"),
+        "--playlist", filepath.Join(dir, "daily.mrrlist"), "--config", filepath.Join(dir, "mrr.toml")}
+    if got := absolutePathArgs(args); !reflect.DeepEqual(got, want) {
+        t.Errorf("absolutePathArgs = %q, want %q", got, want)
+    }
+
+    // A playlist that isn't here is one in the library.
+    args = []string{"--playlist", "weekly.mrrlist"}
+    if got := absolutePathArgs(args); !reflect.DeepEqual(got, args) {
+        t.Errorf("absolutePathArgs = %q, want %q", got, args)
+    }
+}
@@ -0,0 +1,192 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strings"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     Codecs
+// ------------------------------------------
+
+// codec reads and/or writes one file format. MRR's own recording formats
+// do both; importers only decode and script exporters only encode.
+// Compression and encryption are layered around any recording format by
+// dumpToFile and readRecording, not by the codecs.
+type codec interface {
+    // Name is what --format, --from and --to call the format.
+    Name() string
+    // Extensions are file name extensions that imply the format.
+    Extensions() []string
+    // Sniff reports whether br starts like this format, without
+    // consuming anything. Formats that can't be told apart by their
+    // contents never match and are only picked by name or extension.
+    Sniff(br *bufio.Reader) bool
+    // Decode reads a whole recording.
+    Decode(r io.Reader) (*Recording, error)
+    // Encode writes recording; opts only matter to script exporters.
+    Encode(w io.Writer, recording *Recording, opts ExportOptions) error
+    // Native is true for MRR's own formats, which new recordings can be
+    // saved in.
+    Native() bool
+    // Checksummed is true for formats that store the records' checksum.
+    Checksummed() bool
+}
+
+// formatCodec is a codec built from functions; a nil decode or encode makes
+// it write- or read-only.
+type formatCodec struct {
+    name        string
+    exts        []string
+    sniff       func(br *bufio.Reader) bool
+    decode      func(r io.Reader) (*Recording, error)
+    encode      func(w io.Writer, recording *Recording, opts ExportOptions) error
+    native      bool
+    checksummed bool
+}
+
+func (c *formatCodec) Name() string         { return c.name }
+func (c *formatCodec) Extensions() []string { return c.exts }
+func (c *formatCodec) Native() bool         { return c.native }
+func (c *formatCodec) Checksummed() bool    { return c.checksummed }
+
+func (c *formatCodec) Sniff(br *bufio.Reader) bool {
+    return c.sniff != nil && c.sniff(br)
+}
+
+func (c *formatCodec) Decode(r io.Reader) (*Recording, error) {
+    if c.decode == nil {
+        return nil, fmt.Errorf("%s files can only be written", c.name)
+    }
+    return c.decode(r)
+}
+
+func (c *formatCodec) Encode(w io.Writer, recording *Recording, opts ExportOptions) error {
+    if c.encode == nil {
+        return fmt.Errorf("%s files can only be read", c.name)
+    }
+    return c.encode(w, recording, opts)
+}
+
+// recordingOnly adapts a recording format's writer to codec.Encode.
+func recordingOnly(write func(io.Writer, *Recording) error) func(io.Writer, *Recording, ExportOptions) error {
+    return func(w io.Writer, recording *Recording, _ ExportOptions) error {
+        return write(w, recording)
+    }
+}
+
+// jsonCodec is the fallback when no other format recognises a file.
+var jsonCodec = &formatCodec{
+    name:        format.FormatJSON,
+    exts:        []string{".json"},
+    decode:      format.DecodeJSON,
+    encode:      recordingOnly(format.EncodeJSON),
+    native:      true,
+    checksummed: true,
+}
+
+// codecs lists every format, in the order files are sniffed.
+var codecs = []codec{
+    &formatCodec{
+        name:        format.FormatBinary,
+        exts:        []string{".bin", ".mrr"},
+        sniff:       format.IsBinary,
+        decode:      format.DecodeBinary,
+        encode:      recordingOnly(format.EncodeBinary),
+        native:      true,
+        checksummed: true,
+    },
+    &formatCodec{
+        name:   format.FormatNDJSON,
+        exts:   []string{".ndjson", ".jsonl"},
+        sniff:  format.IsNDJSON,
+        decode: format.DecodeNDJSON,
+        encode: recordingOnly(format.EncodeNDJSON),
+        native: true,
+    },
+    &formatCodec{
+        name:   format.FormatCSV,
+        exts:   []string{".csv"},
+        sniff:  format.IsCSV,
+        decode: format.DecodeCSV,
+        encode: recordingOnly(format.EncodeCSV),
+        native: true,
+    },
+    jsonCodec,
+    &formatCodec{name: "tinytask", exts: []string{".rec"}, decode: readTinyTask},
+    &formatCodec{name: "pmc", exts: []string{".pmc"}, decode: readPMC},
+    &formatCodec{name: "ahk", exts: []string{".ahk"}, encode: writeAHK},
+    &formatCodec{name: "ps1", exts: []string{".ps1"}, encode: writePS1},
+    &formatCodec{name: "xdotool", exts: []string{".sh"}, encode: writeXdotool},
+    &formatCodec{name: "ydotool", encode: writeYdotool},
+    &formatCodec{name: "svg", exts: []string{".svg"}, encode: writeSVG},
+    &formatCodec{name: "png", exts: []string{".png"}, encode: writePNG},
+}
+
+// recordFormat is how new recordings are saved (--format).
+var recordFormat = format.FormatJSON
+
+func codecByName(name string) (codec, error) {
+    name = strings.ToLower(name)
+    var names []string
+    for _, c := range codecs {
+        if c.Name() == name {
+            return c, nil
+        }
+        names = append(names, c.Name())
+    }
+    return nil, fmt.Errorf("unknown format %q (want %s)", name, strings.Join(names, ", "))
+}
+
+// codecForFile picks the codec a file name's extension implies, ignoring a
+// trailing .gz. It returns nil for .cfg and unknown extensions.
+func codecForFile(name string) codec {
+    ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(strings.ToLower(name), ".gz")))
+    for _, c := range codecs {
+        for _, e := range c.Extensions() {
+            if e == ext {
+                return c
+            }
+        }
+    }
+    return nil
+}
+
+// recordingCodec is the codec new recordings are saved with.
+func recordingCodec() codec {
+    c, err := codecByName(recordFormat)
+    if err != nil {
+        return jsonCodec
+    }
+    return c
+}
+
+// parseFormat checks a --format value, which must be one of MRR's own
+// formats.
+func parseFormat(s string) (string, error) {
+    c, err := codecByName(s)
+    if err != nil {
+        return "", err
+    }
+    if !c.Native() {
+        return "", fmt.Errorf("new recordings can't be saved as %s, use mrr convert", c.Name())
+    }
+    return c.Name(), nil
+}
+
+// sniffCodec returns the format br is in, falling back to JSON.
+func sniffCodec(br *bufio.Reader) codec {
+    for _, c := range codecs {
+        if c.Sniff(br) {
+            return c
+        }
+    }
+    return jsonCodec
+}
@@ -0,0 +1,191 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "io/ioutil"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// ------------------------------------------
+//     Shell completion
+// ------------------------------------------
+
+// 'mrr completion bash|powershell' prints a script that completes mrr's
+// commands, flags and library recordings. The scripts only pass the
+// command line back to 'mrr completion __complete', which knows the
+// commands, reads the config and lists the library, so the completions
+// stay in step with the binary.
+
+const completeCurrent = "--current="
+
+// completionTakesRecording are the commands whose arguments are
+// recordings.
+var completionTakesRecording = map[string]bool{
+    "play": true, "info": true, "use": true, "rm": true, "convert": true, "edit": true, "editor": true,
+    "split": true, "merge": true, "visualize": true, "render": true,
+}
+
+// usageFlag finds the flags a command's usage line names, which parseArgs
+// doesn't know: --duration, --longer-than, -o and so on.
+var usageFlag = regexp.MustCompile(`(^|[\s\[|])(--?[a-z][a-z-]*)`)
+
+const bashCompletion = `# bash completion for mrr. Load it with
+#     source <(mrr completion bash)
+# or save it to a file in /etc/bash_completion.d or your ~/.bashrc.
+_mrr() {
+    local IFS=$'\n'
+    COMPREPLY=($(mrr completion __complete "--current=${COMP_WORDS[COMP_CWORD]}" "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null | tr -d '\r'))
+}
+complete -o default -F _mrr mrr mrr.exe
+`
+
+const powershellCompletion = `# PowerShell completion for mrr. Load it with
+#     mrr completion powershell | Out-String | Invoke-Expression
+# or add that line to your $PROFILE.
+Register-ArgumentCompleter -Native -CommandName mrr, mrr.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+        Where-Object { $_.Extent.EndOffset -lt $cursorPosition } |
+        ForEach-Object { $_.ToString() })
+    & $commandAst.CommandElements[0].ToString() completion __complete "--current=$wordToComplete" @words 2>$null |
+        ForEach-Object {
+            $text = if ($_ -match '[\s'']') { "'" + ($_ -replace "'", "''") + "'" } else { $_ }
+            [System.Management.Automation.CompletionResult]::new($text, $_, 'ParameterValue', $_)
+        }
+}
+`
+
+// runCompletion implements `mrr completion bash|powershell`.
+func runCompletion(args []string) int {
+    if len(args) > 0 && args[0] == "__complete" {
+        return runComplete(args[1:])
+    }
+    if len(args) != 1 {
+        fmt.Println("usage: mrr completion bash|powershell")
+        return exitUsage
+    }
+    switch args[0] {
+    case "bash":
+        fmt.Print(bashCompletion)
+    case "powershell", "pwsh":
+        fmt.Print(powershellCompletion)
+    default:
+        fmt.Println("[ERROR]", msgf("No completion for %q%s", args[0], suggest(args[0], []string{"bash", "powershell"})))
+        return exitUsage
+    }
+    return exitOK
+}
+
+// runComplete prints the completions for the word being typed, given as
+// --current=word, after the words before it, one per line.
+func runComplete(args []string) int {
+    if len(args) == 0 || !strings.HasPrefix(args[0], completeCurrent) {
+        return exitUsage
+    }
+    cur := strings.TrimPrefix(args[0], completeCurrent)
+    words := args[1:]
+    // List the library the config and those words point at, as 'mrr
+    // list' would.
+    var libraryArgs []string
+    for i := 0; i+1 < len(words); i++ {
+        switch words[i] {
+        case "--config", "--data-dir", "--library", "--profile":
+            libraryArgs = append(libraryArgs, words[i], words[i+1])
+        }
+    }
+    list := findCommand("list")
+    activeCommand, activeFlags = list.name, list.flags
+    if all, err := withConfig(list, libraryArgs); err == nil {
+        parseArgs(all)
+    }
+
+    var candidates []string
+    var cmd *command
+    if len(words) > 0 {
+        cmd = findCommand(words[0])
+    }
+    switch {
+    case len(words) == 0:
+        for _, c := range commands {
+            candidates = append(candidates, c.name)
+        }
+    case cmd == nil:
+    case strings.HasPrefix(cur, "-"):
+        candidates = commandFlags(cmd)
+    case words[len(words)-1] == "--profile",
+        cmd.name == "ctl" && words[len(words)-1] == "profile":
+        _, candidates, _ = readArgsConfig(libraryArgs)
+    case cmd.name == "help":
+        for _, c := range commands {
+            candidates = append(candidates, c.name)
+        }
+    case cmd.name == "completion":
+        candidates = []string{"bash", "powershell"}
+    case cmd.name == "ctl" && len(words) == 1:
+        for _, op := range strings.Split(cmd.args, "|") {
+            candidates = append(candidates, strings.Fields(op)[0])
+        }
+    case cmd.name == "ctl" && (words[len(words)-1] == "use" || words[len(words)-1] == "play"),
+        completionTakesRecording[cmd.name] && !strings.HasPrefix(words[len(words)-1], "-"):
+        candidates = libraryNames()
+    }
+
+    lower := strings.ToLower(cur)
+    for _, c := range candidates {
+        if strings.HasPrefix(strings.ToLower(c), lower) {
+            fmt.Println(c)
+        }
+    }
+    return exitOK
+}
+
+// commandFlags lists the flags cmd takes, sorted.
+func commandFlags(cmd *command) []string {
+    seen := make(map[string]bool)
+    for name, g := range flagGroups {
+        if g&cmd.flags != 0 {
+            seen[name] = true
+        }
+    }
+    for _, m := range usageFlag.FindAllStringSubmatch(cmd.args, -1) {
+        seen[m[2]] = true
+    }
+    var flags []string
+    for name := range seen {
+        flags = append(flags, name)
+    }
+    sort.Strings(flags)
+    return flags
+}
+
+// libraryNames lists the library's recordings by the names 'mrr play'
+// and the others take, without opening them.
+func libraryNames() []string {
+    var names []string
+    if libraryIsStore() {
+        entries, _ := libraryEntries(storeQuery{})
+        for _, e := range entries {
+            names = append(names, e.Name)
+        }
+        return names
+    }
+    files, _ := ioutil.ReadDir(libraryDir())
+    for _, fi := range files {
+        name := fi.Name()
+        if fi.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, checkpointExt) || isBackupName(name) {
+            continue
+        }
+        for _, ext := range libraryExts {
+            if strings.HasSuffix(strings.ToLower(name), ext) {
+                name = name[:len(name)-len(ext)]
+                break
+            }
+        }
+        names = append(names, name)
+    }
+    return names
+}
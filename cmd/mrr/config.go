@@ -0,0 +1,602 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// ------------------------------------------
+//     Config file
+// ------------------------------------------
+
+// config.toml in the data folder (or --config) sets defaults for the
+// command line flags, one `flag = value` per line without the dashes, and
+// the hotkeys in a [hotkeys] table:
+//
+//     speed = 1.5
+//     simplify = 2
+//     debug = true
+//     library = 'D:\macros'
+//
+//     [hotkeys]
+//     record = "ctrl+f9"
+//
+//     [profile.gaming]
+//     speed = 2
+//     [profile.gaming.hotkeys]
+//     replay = "f10"
+//
+// It's a small subset of TOML: strings, numbers and booleans. The settings
+// are turned into flags and parsed ahead of the command line, so the
+// command line wins. A [profile.NAME] table holds settings that apply on
+// top of the others when --profile NAME (or profile = "NAME") picks it.
+
+const configFileName = "config.toml"
+
+// configSetting is one line of the config, as a flag.
+type configSetting struct {
+    Flag  string
+    Value string
+    // Bool settings are flags without a value. Off is a false one, which
+    // drops the flag where an earlier setting gave it.
+    Bool bool
+    Off  bool
+    // Profile is the [profile.NAME] table the setting is in, or "".
+    Profile string
+}
+
+// profileName is the --profile in use, or "".
+var profileName string
+
+// configPath is the --config file in args or MRR_CONFIG, else config.toml
+// in the data folder, which --data-dir in args or MRR_DATA_DIR moves.
+func configPath(args []string) string {
+    dir := dataDir()
+    if v, ok := envFlag("--data-dir"); ok {
+        dir = v
+    }
+    path, _ := envFlag("--config")
+    for i := 0; i+1 < len(args); i++ {
+        switch args[i] {
+        case "--config":
+            return args[i+1]
+        case "--data-dir":
+            dir = args[i+1]
+        }
+    }
+    if path != "" {
+        return path
+    }
+    return filepath.Join(dir, configFileName)
+}
+
+// readConfig reads the config at path and the names of its profiles. A
+// missing file is an empty config, unless it was named with --config.
+func readConfig(path string, named bool) ([]configSetting, []string, error) {
+    f, err := os.Open(path)
+    if os.IsNotExist(err) && !named {
+        return nil, nil, nil
+    }
+    if err != nil {
+        return nil, nil, err
+    }
+    defer f.Close()
+
+    var settings []configSetting
+    var profiles []string
+    profile, hotkeys := "", false
+    sc := bufio.NewScanner(f)
+    for n := 1; sc.Scan(); n++ {
+        line := strings.TrimSpace(stripConfigComment(sc.Text()))
+        if line == "" {
+            continue
+        }
+        if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+            table := strings.TrimSpace(line[1 : len(line)-1])
+            var ok bool
+            if profile, hotkeys, ok = parseConfigTable(table); !ok {
+                return nil, nil, fmt.Errorf("%s: line %d: unknown table [%s]", path, n, table)
+            }
+            if profile != "" && !containsString(profiles, profile) {
+                profiles = append(profiles, profile)
+            }
+            continue
+        }
+        kv := strings.SplitN(line, "=", 2)
+        if len(kv) != 2 {
+            return nil, nil, fmt.Errorf("%s: line %d: expected key = value", path, n)
+        }
+        key := strings.TrimSpace(kv[0])
+        value, isBool, err := parseConfigValue(strings.TrimSpace(kv[1]))
+        if err != nil {
+            return nil, nil, fmt.Errorf("%s: line %d: %v", path, n, err)
+        }
+
+        if hotkeys {
+            settings = append(settings, configSetting{Flag: "--hotkey", Value: key + "=" + value, Profile: profile})
+            continue
+        }
+        flag := "--" + key
+        if _, ok := flagGroups[flag]; !ok || flag == "--config" {
+            names := make([]string, 0, len(flagGroups))
+            for name := range flagGroups {
+                names = append(names, strings.TrimPrefix(name, "--"))
+            }
+            sort.Strings(names)
+            return nil, nil, fmt.Errorf("%s: line %d: unknown setting %q%s", path, n, key, suggest(key, names))
+        }
+        if flag == "--profile" && profile != "" {
+            return nil, nil, fmt.Errorf("%s: line %d: a profile can't pick another profile", path, n)
+        }
+        if isBool {
+            settings = append(settings, configSetting{Flag: flag, Bool: true, Off: value == "false", Profile: profile})
+            continue
+        }
+        settings = append(settings, configSetting{Flag: flag, Value: value, Profile: profile})
+    }
+    return settings, profiles, sc.Err()
+}
+
+// parseConfigTable parses a table name: [hotkeys], [profile.NAME] or
+// [profile.NAME.hotkeys].
+func parseConfigTable(table string) (profile string, hotkeys, ok bool) {
+    if table == "hotkeys" {
+        return "", true, true
+    }
+    if !strings.HasPrefix(table, "profile.") {
+        return "", false, false
+    }
+    profile = strings.TrimPrefix(table, "profile.")
+    if strings.HasSuffix(profile, ".hotkeys") {
+        profile, hotkeys = strings.TrimSuffix(profile, ".hotkeys"), true
+    }
+    return profile, hotkeys, profile != "" && !strings.ContainsAny(profile, ". \t\"'")
+}
+
+func containsString(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+// stripConfigComment cuts a # comment off line, outside of strings.
+func stripConfigComment(line string) string {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quote != 0 && c == '\\' && quote == '"':
+            i++
+        case quote != 0 && c == quote:
+            quote = 0
+        case quote == 0 && (c == '"' || c == '\''):
+            quote = c
+        case quote == 0 && c == '#':
+            return line[:i]
+        }
+    }
+    return line
+}
+
+// parseConfigValue parses a TOML string, number or boolean.
+func parseConfigValue(s string) (value string, isBool bool, err error) {
+    switch {
+    case s == "true" || s == "false":
+        return s, true, nil
+    case strings.HasPrefix(s, `"`):
+        v, err := strconv.Unquote(s)
+        if err != nil {
+            return "", false, fmt.Errorf("bad string %s", s)
+        }
+        return v, false, nil
+    case strings.HasPrefix(s, "'"):
+        if len(s) < 2 || !strings.HasSuffix(s, "'") || strings.Contains(s[1:len(s)-1], "'") {
+            return "", false, fmt.Errorf("bad string %s", s)
+        }
+        return s[1 : len(s)-1], false, nil
+    }
+    if _, err := strconv.ParseFloat(strings.Replace(s, "_", "", -1), 64); err != nil {
+        return "", false, fmt.Errorf("%s is not a string, number or boolean; strings need quotes", s)
+    }
+    return strings.Replace(s, "_", "", -1), false, nil
+}
+
+// configArgs turns settings into flags for a command that takes groups;
+// settings for other commands are left out. A configured speed is a replay
+// speed; it doesn't retime exports and renders.
+func configArgs(settings []configSetting, groups flagGroup) []string {
+    // A false boolean, from a profile or the environment, turns off what
+    // the settings before it turned on.
+    var on []configSetting
+    for _, s := range settings {
+        if !s.Off {
+            on = append(on, s)
+            continue
+        }
+        kept := on[:0]
+        for _, o := range on {
+            if o.Flag != s.Flag {
+                kept = append(kept, o)
+            }
+        }
+        on = kept
+    }
+
+    var args []string
+    for _, s := range on {
+        if flagGroups[s.Flag]&(groups&^flagsSpeed) == 0 {
+            continue
+        }
+        args = append(args, s.Flag)
+        if !s.Bool {
+            args = append(args, s.Value)
+        }
+    }
+    return args
+}
+
+// withConfig puts the config's flags ahead of args, for cmd, with those
+// of the profile args or the config pick after the rest, and then the
+// MRR_ environment variables.
+func withConfig(cmd *command, args []string) ([]string, error) {
+    settings, profiles, err := readArgsConfig(args)
+    if err != nil {
+        return nil, err
+    }
+    env, err := envSettings()
+    if err != nil {
+        return nil, err
+    }
+    if settings, err = withProfile(settings, profiles, chosenProfile(append(settings, env...), args)); err != nil {
+        return nil, err
+    }
+    return append(configArgs(append(settings, env...), cmd.flags), args...), nil
+}
+
+// readArgsConfig reads the config args point at.
+func readArgsConfig(args []string) ([]configSetting, []string, error) {
+    _, named := envFlag("--config")
+    for _, a := range args {
+        named = named || a == "--config"
+    }
+    return readConfig(configPath(args), named)
+}
+
+// ------------------------------------------
+//     Environment variables
+// ------------------------------------------
+
+// MRR_<FLAG> environment variables set flags as the config does, on top of
+// it and under the command line, for test agents set up from outside:
+// MRR_SPEED=1.5, MRR_LOOP_DELAY=500ms, MRR_DEBUG=true and the hotkeys as
+// MRR_HOTKEY_RECORD=ctrl+f9. MRR_CONFIG picks the config file.
+
+const envPrefix = "MRR_"
+
+// envAliases are variables named otherwise than their flag.
+var envAliases = map[string]string{
+    // The folder recordings are saved to unless named elsewhere.
+    "MRR_OUTPUT_DIR": "--data-dir",
+}
+
+// envIgnored are MRR_ variables that aren't settings.
+var envIgnored = map[string]bool{
+    agentEnv: true,
+}
+
+// envName is the variable for flag.
+func envName(flag string) string {
+    return envPrefix + strings.ToUpper(strings.Replace(strings.TrimPrefix(flag, "--"), "-", "_", -1))
+}
+
+// envFlag looks up the variable for flag, or an alias of it.
+func envFlag(flag string) (string, bool) {
+    if v, ok := os.LookupEnv(envName(flag)); ok {
+        return v, true
+    }
+    for name, f := range envAliases {
+        if f == flag {
+            if v, ok := os.LookupEnv(name); ok {
+                return v, true
+            }
+        }
+    }
+    return "", false
+}
+
+// envSettings reads the MRR_ variables as settings, in name order. true
+// and false are booleans, as in the config.
+func envSettings() ([]configSetting, error) {
+    var settings []configSetting
+    env := os.Environ()
+    sort.Strings(env)
+    for _, kv := range env {
+        eq := strings.Index(kv, "=")
+        // Windows keeps per-drive folders in variables named =C: and so on.
+        if eq <= 0 {
+            continue
+        }
+        name, value := strings.ToUpper(kv[:eq]), kv[eq+1:]
+        if !strings.HasPrefix(name, envPrefix) || envIgnored[name] {
+            continue
+        }
+        if action := strings.TrimPrefix(name, envPrefix+"HOTKEY_"); action != name {
+            action = strings.ToLower(strings.Replace(action, "_", "-", -1))
+            settings = append(settings, configSetting{Flag: "--hotkey", Value: action + "=" + value})
+            continue
+        }
+        flag, ok := envAliases[name]
+        if !ok {
+            flag = "--" + strings.ToLower(strings.Replace(strings.TrimPrefix(name, envPrefix), "_", "-", -1))
+        }
+        if flag == "--config" {
+            // Read by configPath.
+            continue
+        }
+        if _, known := flagGroups[flag]; !known {
+            names := []string{envPrefix + "HOTKEY_RECORD"}
+            for f := range flagGroups {
+                names = append(names, envName(f))
+            }
+            for alias := range envAliases {
+                names = append(names, alias)
+            }
+            sort.Strings(names)
+            return nil, fmt.Errorf("environment variable %s: unknown setting%s", name, suggest(name, names))
+        }
+        switch value {
+        case "true", "false":
+            settings = append(settings, configSetting{Flag: flag, Bool: true, Off: value == "false"})
+        default:
+            settings = append(settings, configSetting{Flag: flag, Value: value})
+        }
+    }
+    return settings, nil
+}
+
+// ------------------------------------------
+//     Profiles
+// ------------------------------------------
+
+// chosenProfile is the last --profile in args, else the config's profile
+// setting, else "".
+func chosenProfile(settings []configSetting, args []string) string {
+    for i := len(args) - 2; i >= 0; i-- {
+        if args[i] == "--profile" {
+            return args[i+1]
+        }
+    }
+    name := ""
+    for _, s := range settings {
+        if s.Flag == "--profile" {
+            name = s.Value
+        }
+    }
+    return name
+}
+
+// withProfile keeps the settings outside profiles, then profile name's,
+// so the profile's win.
+func withProfile(settings []configSetting, profiles []string, name string) ([]configSetting, error) {
+    if name != "" && !containsString(profiles, name) {
+        if len(profiles) == 0 {
+            return nil, fmt.Errorf("unknown profile %q; the config has no [profile.NAME] tables", name)
+        }
+        return nil, fmt.Errorf("unknown profile %q%s", name, suggest(name, profiles))
+    }
+    var base, chosen []configSetting
+    for _, s := range settings {
+        switch s.Profile {
+        case "":
+            base = append(base, s)
+        case name:
+            chosen = append(chosen, s)
+        }
+    }
+    return append(base, chosen...), nil
+}
+
+// withoutProfile drops the --profile flags from args.
+func withoutProfile(args []string) []string {
+    var out []string
+    for i := 0; i < len(args); i++ {
+        if args[i] == "--profile" && i+1 < len(args) {
+            i++
+            continue
+        }
+        out = append(out, args[i])
+    }
+    return out
+}
+
+// configProfiles lists the profiles in the running command's config.
+func configProfiles() ([]string, error) {
+    _, profiles, err := readArgsConfig(cliArgs)
+    return profiles, err
+}
+
+// profileSummary names the profile in use and those to switch to.
+func profileSummary() (string, error) {
+    profiles, err := configProfiles()
+    if err != nil {
+        return "", err
+    }
+    current := profileName
+    if current == "" {
+        current = "none"
+    }
+    if len(profiles) == 0 {
+        return "profile " + current + "; the config has no profiles", nil
+    }
+    return fmt.Sprintf("profile %s (of %s)", current, strings.Join(profiles, ", ")), nil
+}
+
+// ------------------------------------------
+//     Reloading
+// ------------------------------------------
+
+// flagSettings holds everything parseArgs sets, so a reload can start
+// over from the defaults and flags can be parsed without applying them.
+type flagSettings struct {
+    debug, json, compress, encrypt, ignoreChecksum bool
+    backups                                        int
+    format                                         string
+    simplify                                       float64
+    keyFile, library, data, output, saveAs, device string
+    profile, lang                                  string
+    player                                         PlayerOptions
+    hotkeys                                        map[hotkeyAction]hotkey
+    // playlist is the --playlist to replay, if one was given.
+    playlist                      string
+    tray, notify                  bool
+    updateURL, resultJSON         string
+    logFormat, logFile, logRotate string
+    logMaxSize                    int64
+    logKeep                       int
+    schedule                      string
+}
+
+// flagsMtx keeps a reload from changing the settings while another
+// goroutine copies them.
+var flagsMtx sync.Mutex
+
+func currentFlagSettings() flagSettings {
+    flagsMtx.Lock()
+    defer flagsMtx.Unlock()
+    return flagSettings{
+        debug:          debugMode,
+        json:           jsonOutput,
+        compress:       compressRecordings,
+        encrypt:        encryptRecordings,
+        ignoreChecksum: ignoreChecksum,
+        backups:        backupCount,
+        format:         recordFormat,
+        simplify:       simplifyTolerance,
+        keyFile:        keyFile,
+        library:        libraryPath,
+        data:           dataPath,
+        output:         outputPath,
+        saveAs:         saveAsName,
+        device:         deviceFilter,
+        profile:        profileName,
+        lang:           langFlag,
+        player:         playerOpts,
+        hotkeys:        copyHotkeys(),
+        tray:           trayMode,
+        notify:         notifyMode,
+        updateURL:      updateURL,
+        resultJSON:     resultJSONPath,
+        logFormat:      logFormat,
+        logFile:        logFilePath,
+        logRotate:      logRotate,
+        logMaxSize:     logMaxSize,
+        logKeep:        logKeep,
+        schedule:       scheduleFile,
+    }
+}
+
+func (s flagSettings) restore() {
+    flagsMtx.Lock()
+    defer flagsMtx.Unlock()
+    debugMode = s.debug
+    jsonOutput = s.json
+    compressRecordings = s.compress
+    encryptRecordings = s.encrypt
+    ignoreChecksum = s.ignoreChecksum
+    backupCount = s.backups
+    recordFormat = s.format
+    simplifyTolerance = s.simplify
+    keyFile = s.keyFile
+    libraryPath = s.library
+    dataPath = s.data
+    outputPath = s.output
+    saveAsName = s.saveAs
+    deviceFilter = s.device
+    profileName = s.profile
+    langFlag = s.lang
+    playerOpts = s.player
+    setHotkeys(s.hotkeys)
+    if s.playlist != "" {
+        setReplayTarget(s.playlist)
+    }
+    trayMode = s.tray
+    notifyMode = s.notify
+    updateURL = s.updateURL
+    resultJSONPath = s.resultJSON
+    logFormat = s.logFormat
+    logFilePath = s.logFile
+    logRotate = s.logRotate
+    logMaxSize = s.logMaxSize
+    logKeep = s.logKeep
+    scheduleFile = s.schedule
+}
+
+var (
+    // defaultFlags are the settings before any flag was parsed.
+    defaultFlags flagSettings
+    // cliArgs are the command's own arguments, without the config's.
+    cliArgs []string
+)
+
+// reloadConfig re-reads the config for 'mrr hook' and applies it with the
+// command line on top, as at startup. On error the settings are left as
+// they were. The schedule and the control pipe aren't restarted.
+func reloadConfig() error {
+    if err := applyConfig(cliArgs); err != nil {
+        return err
+    }
+    logEvent("info", "config_reloaded", nil)
+    return nil
+}
+
+// switchProfile reloads the config with profile name in place of the one
+// in use, which later reloads keep.
+func switchProfile(name string) error {
+    args := append(withoutProfile(cliArgs), "--profile", name)
+    if err := applyConfig(args); err != nil {
+        return err
+    }
+    cliArgs = args
+    logEvent("info", "profile_switched", map[string]interface{}{"profile": name})
+    return nil
+}
+
+// applyConfig starts over from the default settings and applies the
+// config with args on top. It may run on any goroutine: the config is
+// parsed aside, then applied while no replay or recording can start.
+func applyConfig(args []string) error {
+    if replayActive() || recordingActive() {
+        return fmt.Errorf("can't reload while recording or replaying")
+    }
+    all, err := withConfig(findCommand("hook"), args)
+    if err != nil {
+        return err
+    }
+    settings := defaultFlags
+    if _, err := parseFlags(&settings, all, activeCommand, activeFlags); err != nil {
+        logError("config_reload_failed", "config_invalid", err, nil)
+        return err
+    }
+
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+    mtx.Lock()
+    defer mtx.Unlock()
+    if replayCancel != nil || recordingStarted {
+        return fmt.Errorf("can't reload while recording or replaying")
+    }
+    settings.restore()
+    player = NewPlayer(settings.player)
+    return nil
+}
@@ -0,0 +1,43 @@
+// +build windows
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestConfigFalseOverrides(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "config.toml")
+    config := "debug = true\nblock-input = true\nhumanize = true\n\n[profile.quiet]\ndebug = false\n"
+    if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("MRR_BLOCK_INPUT", "false")
+
+    settings, profiles, err := readConfig(path, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    env, err := envSettings()
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, c := range []struct {
+        profile string
+        want    []string
+    }{
+        {"", []string{"--debug", "--humanize"}},
+        {"quiet", []string{"--humanize"}},
+    } {
+        s, err := withProfile(settings, profiles, c.profile)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := configArgs(append(s, env...), flagsCommon|flagsReplay); !reflect.DeepEqual(got, c.want) {
+            t.Errorf("profile %q: configArgs = %q, want %q", c.profile, got, c.want)
+        }
+    }
+}
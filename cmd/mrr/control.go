@@ -0,0 +1,345 @@
+// +build windows
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/signal"
+    "strings"
+    "syscall"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     External control over a named pipe
+// ------------------------------------------
+
+const (
+    controlPipeName = `\\.\pipe\mrr-control`
+
+    PIPE_ACCESS_DUPLEX         = 0x00000003
+    PIPE_TYPE_MESSAGE          = 0x00000004
+    PIPE_READMODE_MESSAGE      = 0x00000002
+    PIPE_WAIT                  = 0x00000000
+    PIPE_REJECT_REMOTE_CLIENTS = 0x00000008
+    PIPE_UNLIMITED_INSTANCES   = 255
+
+    ERROR_PIPE_CONNECTED = 535
+
+    controlBufSize = 4096
+)
+
+var (
+    procCreateNamedPipeW    = kernel32.MustFindProc("CreateNamedPipeW")
+    procConnectNamedPipe    = kernel32.MustFindProc("ConnectNamedPipe")
+    procDisconnectNamedPipe = kernel32.MustFindProc("DisconnectNamedPipe")
+    procFlushFileBuffers    = kernel32.MustFindProc("FlushFileBuffers")
+)
+
+// serveControlPipe accepts clients on controlPipeName and runs the command
+// each sends, several at once, so a replay-abort gets through while a
+// replay or play waits for its replay. It runs for the lifetime of the hook
+// loop.
+func serveControlPipe() {
+    name, _ := syscall.UTF16PtrFromString(controlPipeName)
+
+    for {
+        h, _, err := procCreateNamedPipeW.Call(
+            uintptr(unsafe.Pointer(name)),
+            PIPE_ACCESS_DUPLEX,
+            PIPE_TYPE_MESSAGE|PIPE_READMODE_MESSAGE|PIPE_WAIT|PIPE_REJECT_REMOTE_CLIENTS,
+            PIPE_UNLIMITED_INSTANCES,
+            controlBufSize,
+            controlBufSize,
+            0,
+            0,
+        )
+        if syscall.Handle(h) == syscall.InvalidHandle {
+            fmt.Println("[ERROR]", msg("Could not create control pipe:"), err)
+            fireError(fmt.Errorf("CreateNamedPipeW failed: %v", err))
+            return
+        }
+
+        r, _, err := procConnectNamedPipe.Call(h, 0)
+        go func() {
+            if r != 0 || err == syscall.Errno(ERROR_PIPE_CONNECTED) {
+                handleControlClient(syscall.Handle(h))
+            }
+            procDisconnectNamedPipe.Call(h)
+            syscall.CloseHandle(syscall.Handle(h))
+        }()
+    }
+}
+
+func handleControlClient(h syscall.Handle) {
+    buf := make([]byte, controlBufSize)
+    var n uint32
+    if err := syscall.ReadFile(h, buf, &n, nil); err != nil {
+        debugPrintln("[DEBUG] control pipe read failed:", err)
+        return
+    }
+
+    reply := runControlCommand(strings.TrimSpace(string(buf[:n])))
+    var written uint32
+    syscall.WriteFile(h, []byte(reply), &written, nil)
+    procFlushFileBuffers.Call(uintptr(h))
+}
+
+// runControlCommand executes one control command and returns the reply,
+// which starts with "ok" or "error".
+func runControlCommand(cmd string) string {
+    debugPrintln("[DEBUG] control command:", cmd)
+
+    if name := strings.TrimPrefix(cmd, "use "); name != cmd {
+        path, err := resolveRecording(strings.TrimSpace(name))
+        if err != nil {
+            return "error: " + err.Error()
+        }
+        setReplayTarget(path)
+        fmt.Println("[INFO]", msgf("Control pipe -> Replaying %s from now on", path))
+        return "ok: replaying " + path
+    }
+
+    if args := strings.TrimPrefix(cmd, "play "); args != cmd {
+        return controlPlay(args)
+    }
+
+    if name := strings.TrimPrefix(cmd, "profile "); name != cmd {
+        name = strings.TrimSpace(name)
+        if err := switchProfile(name); err != nil {
+            return "error: " + err.Error()
+        }
+        fmt.Println("[INFO]", msgf("Control pipe -> Switched to profile %s", name))
+        return "ok: profile " + name
+    }
+
+    switch cmd {
+    case "profile":
+        summary, err := profileSummary()
+        if err != nil {
+            return "error: " + err.Error()
+        }
+        return "ok: " + summary
+
+    case "record-start":
+        if !startRecording() {
+            return "error: a recording is already in progress"
+        }
+        fmt.Println("[INFO]", msg("Control pipe -> Start recording"))
+        return "ok: recording started"
+
+    case "record-stop":
+        if !recordingActive() {
+            return "error: no recording in progress"
+        }
+        fmt.Println("[INFO]", msg("Control pipe -> Stop recording"))
+        if _, err := finishRecording(); err != nil {
+            return "error: could not save the recording: " + err.Error()
+        }
+        return "ok: recording saved to " + recordingSavePath()
+
+    case "replay":
+        fmt.Println("[INFO]", msg("Control pipe -> Replaying recorded movements"))
+        done := beginReplay(nil, replayTarget())
+        if done == nil {
+            return "error: a replay is already in progress"
+        }
+        outcome := <-done
+        b, _ := json.Marshal(outcome.result)
+        if outcome.err != nil {
+            return "error: " + string(b)
+        }
+        return "ok: " + string(b)
+
+    case "replay-abort":
+        if !abortReplay() {
+            return "error: no replay in progress"
+        }
+        fmt.Println("[INFO]", msg("Control pipe -> Aborting replay"))
+        return "ok: replay aborted"
+
+    case "pause", "resume":
+        p := replayingPlayer()
+        if p == nil {
+            return "error: no replay in progress"
+        }
+        if cmd == "pause" && p.Pause() {
+            fmt.Println("[INFO]", msg("Control pipe -> Pausing replay"))
+        } else if cmd == "resume" && p.Resume() {
+            fmt.Println("[INFO]", msg("Control pipe -> Resuming replay"))
+        }
+        return "ok: " + cmd + "d"
+
+    case "status":
+        if recordingActive() {
+            return "ok: recording"
+        }
+        p := activePlayer()
+        if rp := p.Progress(); rp != nil {
+            if p.Paused() {
+                return "ok: paused " + formatProgress(*rp)
+            }
+            return "ok: replaying " + formatProgress(*rp)
+        }
+        return "ok: idle"
+
+    case "reload":
+        if err := reloadConfig(); err != nil {
+            return "error: " + err.Error()
+        }
+        fmt.Println("[INFO]", msg("Control pipe -> Reloaded the config"))
+        return "ok: reloaded"
+
+    case "quit":
+        if hookThread == 0 {
+            return "error: this instance can't be stopped from here"
+        }
+        fmt.Println("[INFO]", msg("Control pipe -> Exit"))
+        // A recording in progress is saved rather than lost.
+        quitThread(hookThread)
+        return "ok: quitting"
+    }
+
+    return fmt.Sprintf("error: unknown command %q", cmd)
+}
+
+// controlPlay runs `play [flags] <file>` from the control pipe: it replays
+// file with the replay flags given on top of this instance's and waits for
+// it. A failure is "error: <exit status>: <result or message>", for 'mrr
+// play' to exit with the code it would have.
+func controlPlay(line string) string {
+    args, err := splitCommandLine(line)
+    if err != nil {
+        return "error: usage: " + err.Error()
+    }
+    // Parsed on top of a copy, so this instance's settings stay as they
+    // are.
+    settings := currentFlagSettings()
+    files, err := parseFlags(&settings, args, "play", flagsCommon|flagsReplay)
+    if err == nil && len(files) != 1 {
+        err = fmt.Errorf("play takes one recording")
+    }
+    if err != nil {
+        return "error: usage: " + err.Error()
+    }
+    target := files[0]
+    if path, err := resolveRecording(target); err == nil {
+        target = path
+    }
+    if _, err := os.Stat(target); err != nil {
+        return "error: not_found: " + err.Error()
+    }
+    if replayActive() {
+        return "error: replay_failed: a replay is already in progress"
+    }
+
+    fmt.Println("[INFO]", msgf("Control pipe -> Replaying %s", displayName(target)))
+    // The replay gets a player of its own; the hotkeys' replays, and any
+    // queued behind this one, keep player.
+    done := beginReplay(NewPlayer(settings.player), target)
+    if done == nil {
+        return "error: replay_failed: a replay is already in progress"
+    }
+    outcome := <-done
+    b, _ := json.Marshal(outcome.result)
+    if outcome.err != nil {
+        return "error: " + exitStatus[replayExitCode(outcome.err)] + ": " + string(b)
+    }
+    return "ok: " + string(b)
+}
+
+// controlRequest sends cmd to the running instance and returns its reply.
+func controlRequest(cmd string) (string, error) {
+    h, err := openControlPipe()
+    if err != nil {
+        return "", err
+    }
+    defer syscall.CloseHandle(h)
+    return exchangeControl(h, cmd)
+}
+
+// exchangeReplayControl sends cmd, which waits for a replay, over h and
+// returns the reply. Ctrl+C meanwhile sends replay-abort over a second
+// connection; the aborted replay then answers cmd.
+func exchangeReplayControl(h syscall.Handle, cmd string) (string, error) {
+    type answer struct {
+        reply string
+        err   error
+    }
+    answered := make(chan answer, 1)
+    go func() {
+        reply, err := exchangeControl(h, cmd)
+        answered <- answer{reply, err}
+    }()
+    interrupted := make(chan os.Signal, 1)
+    signal.Notify(interrupted, os.Interrupt)
+    defer signal.Stop(interrupted)
+    var a answer
+    select {
+    case a = <-answered:
+    case <-interrupted:
+        controlRequest("replay-abort")
+        a = <-answered
+    }
+    return a.reply, a.err
+}
+
+func openControlPipe() (syscall.Handle, error) {
+    name, _ := syscall.UTF16PtrFromString(controlPipeName)
+    return syscall.CreateFile(
+        name,
+        syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+        0,
+        nil,
+        syscall.OPEN_EXISTING,
+        0,
+        0,
+    )
+}
+
+// exchangeControl writes cmd to the pipe and reads the reply.
+func exchangeControl(h syscall.Handle, cmd string) (string, error) {
+    var n uint32
+    if err := syscall.WriteFile(h, []byte(cmd), &n, nil); err != nil {
+        return "", fmt.Errorf("%s %v", msg("Could not send command:"), err)
+    }
+    buf := make([]byte, controlBufSize)
+    if err := syscall.ReadFile(h, buf, &n, nil); err != nil {
+        return "", fmt.Errorf("%s %v", msg("Could not read reply:"), err)
+    }
+    return string(buf[:n]), nil
+}
+
+// runCtl is the client side: `mrr ctl <command>` sends command to the
+// running instance and prints its reply. It returns the process exit code.
+func runCtl(args []string) int {
+    if len(args) == 0 {
+        fmt.Println("usage: mrr ctl record-start|record-stop|replay|replay-abort|pause|resume|status|reload|quit|use <name>|play [flags] <file>|profile [name]")
+        return 2
+    }
+    cmd := strings.Join(args, " ")
+
+    h, err := openControlPipe()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not reach a running MRR instance:"), err)
+        return 1
+    }
+    defer syscall.CloseHandle(h)
+
+    exchange := exchangeControl
+    if cmd == "replay" || strings.HasPrefix(cmd, "play ") {
+        exchange = exchangeReplayControl
+    }
+    reply, err := exchange(h, cmd)
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return 1
+    }
+    fmt.Println(reply)
+    if strings.HasPrefix(reply, "ok") {
+        return 0
+    }
+    return 1
+}
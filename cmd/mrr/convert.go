@@ -0,0 +1,88 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+)
+
+// ------------------------------------------
+//     mrr convert: change a recording's format
+// ------------------------------------------
+
+// runConvert implements `mrr convert [--from fmt] [--to fmt] <in> <out>`.
+// in's format is --from, else the one its extension implies for formats
+// that can't be recognised by content, else detected. out's format is --to,
+// else implied by its extension, else --format.
+func runConvert(args []string) int {
+    var from, to codec
+    exportOpts := ExportOptions{Coords: CoordsScreen}
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        switch args[i] {
+        case "--from", "--to":
+            if i+1 >= len(args) {
+                fmt.Println("[ERROR]", msgf("%s needs a format", args[i]))
+                return exitUsage
+            }
+            c, err := codecByName(args[i+1])
+            if err != nil {
+                fmt.Println("[ERROR]", err)
+                return exitUsage
+            }
+            if args[i] == "--from" {
+                from = c
+            } else {
+                to = c
+            }
+            i++
+        case "--coords":
+            if i+1 >= len(args) {
+                fmt.Println("[ERROR]", msg("--coords needs screen or client"))
+                return exitUsage
+            }
+            i++
+            c, err := parseCoords(args[i])
+            if err != nil {
+                fmt.Println("[ERROR]", err)
+                return exitUsage
+            }
+            exportOpts.Coords = c
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    files, err := parseArgs(rest)
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitUsage
+    }
+    if len(files) != 2 {
+        fmt.Println("usage: mrr convert [--from fmt] [--to fmt] [--compress] [--coords screen|client] [--speed x] <in> <out>")
+        return exitUsage
+    }
+    in, out := files[0], files[1]
+
+    if c := codecForFile(in); from == nil && c != nil && !c.Native() {
+        from = c
+    }
+    recording, err := loadAs(in, from)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+        return loadExitCode(err)
+    }
+
+    if to == nil {
+        to = codecForFile(out)
+    }
+    if to == nil {
+        to = recordingCodec()
+    }
+    exportOpts.Speed = playerOpts.Speed
+    if err := saveAs(out, recording, to, exportOpts); err != nil {
+        fmt.Println("[ERROR]", msg("Could not save recording:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Wrote %d records to %s as %s", len(recording.Records), out, to.Name()))
+    return exitOK
+}
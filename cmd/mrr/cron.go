@@ -0,0 +1,193 @@
+// +build windows
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ------------------------------------------
+//     Cron-like replay scheduling
+// ------------------------------------------
+
+// ScheduleFile is the --schedule config: a list of jobs.
+type ScheduleFile struct {
+    Jobs []ScheduleJob `json:"Jobs"`
+}
+
+// ScheduleJob replays File (a recording or playlist, relative to the
+// schedule file) whenever Cron matches. Cron uses the classic five fields:
+// minute hour day-of-month month day-of-week, e.g. "0 9 * * 1-5".
+type ScheduleJob struct {
+    Name string `json:"Name"`
+    File string `json:"File"`
+    Cron string `json:"Cron"`
+
+    spec *cronSpec
+}
+
+// cronSpec is a parsed cron expression; each field is a set of allowed
+// values.
+type cronSpec struct {
+    minute, hour, dom, month, dow map[int]bool
+    // domAny/dowAny record a literal "*", for the usual rule that a day
+    // matches if either restricted day field matches.
+    domAny, dowAny bool
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+    fields := strings.Fields(expr)
+    if len(fields) != 5 {
+        return nil, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(fields))
+    }
+
+    var spec cronSpec
+    var err error
+    parsers := []struct {
+        dst      *map[int]bool
+        min, max int
+    }{
+        {&spec.minute, 0, 59},
+        {&spec.hour, 0, 23},
+        {&spec.dom, 1, 31},
+        {&spec.month, 1, 12},
+        {&spec.dow, 0, 7},
+    }
+    for i, p := range parsers {
+        if *p.dst, err = parseCronField(fields[i], p.min, p.max); err != nil {
+            return nil, fmt.Errorf("cron %q: %v", expr, err)
+        }
+    }
+    // 7 is Sunday too.
+    if spec.dow[7] {
+        spec.dow[0] = true
+    }
+    spec.domAny = fields[2] == "*"
+    spec.dowAny = fields[4] == "*"
+    return &spec, nil
+}
+
+// parseCronField handles "*", "n", "a-b", "*/s", "a-b/s" and comma lists.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+    set := make(map[int]bool)
+    for _, part := range strings.Split(field, ",") {
+        step := 1
+        if i := strings.Index(part, "/"); i >= 0 {
+            s, err := strconv.Atoi(part[i+1:])
+            if err != nil || s < 1 {
+                return nil, fmt.Errorf("bad step in %q", part)
+            }
+            step = s
+            part = part[:i]
+        }
+
+        lo, hi := min, max
+        switch {
+        case part == "*":
+        case strings.Contains(part, "-"):
+            bounds := strings.SplitN(part, "-", 2)
+            a, err1 := strconv.Atoi(bounds[0])
+            b, err2 := strconv.Atoi(bounds[1])
+            if err1 != nil || err2 != nil {
+                return nil, fmt.Errorf("bad range %q", part)
+            }
+            lo, hi = a, b
+        default:
+            v, err := strconv.Atoi(part)
+            if err != nil {
+                return nil, fmt.Errorf("bad value %q", part)
+            }
+            lo, hi = v, v
+        }
+        if lo < min || hi > max || lo > hi {
+            return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+        }
+        for v := lo; v <= hi; v += step {
+            set[v] = true
+        }
+    }
+    return set, nil
+}
+
+// matches reports whether t (truncated to the minute) fires the spec.
+func (c *cronSpec) matches(t time.Time) bool {
+    if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+        return false
+    }
+    domOK := c.dom[t.Day()]
+    dowOK := c.dow[int(t.Weekday())]
+    if c.domAny || c.dowAny {
+        return domOK && dowOK
+    }
+    return domOK || dowOK
+}
+
+func loadSchedule(filename string) (*ScheduleFile, error) {
+    b, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    var sf ScheduleFile
+    if err := json.Unmarshal(b, &sf); err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+
+    dir := filepath.Dir(filename)
+    for i := range sf.Jobs {
+        job := &sf.Jobs[i]
+        if job.Name == "" {
+            job.Name = fmt.Sprintf("job%d", i+1)
+        }
+        if job.File == "" {
+            return nil, fmt.Errorf("%s: job %q has no File", filename, job.Name)
+        }
+        if !filepath.IsAbs(job.File) {
+            job.File = filepath.Join(dir, job.File)
+        }
+        if job.spec, err = parseCron(job.Cron); err != nil {
+            return nil, fmt.Errorf("%s: job %q: %v", filename, job.Name, err)
+        }
+    }
+    return &sf, nil
+}
+
+// runScheduler wakes at the start of every minute and starts the jobs
+// whose cron matches. It runs beside the hook message loop; replays go
+// through beginReplay, so a job that fires while another replay is
+// running is skipped and logged.
+func runScheduler(sf *ScheduleFile) {
+    for {
+        now := time.Now()
+        next := now.Truncate(time.Minute).Add(time.Minute)
+        time.Sleep(time.Until(next))
+
+        for _, job := range sf.Jobs {
+            if job.spec.matches(next) {
+                go runScheduledJob(job)
+            }
+        }
+    }
+}
+
+func runScheduledJob(job ScheduleJob) {
+    fmt.Println("[INFO]", msgf("Schedule -> running %q (%s)", job.Name, job.File))
+    done := beginReplay(nil, job.File)
+    if done == nil {
+        fmt.Println("[WARN]", msgf("Schedule -> skipped %q: a replay is already in progress", job.Name))
+        return
+    }
+
+    outcome := <-done
+    if outcome.err != nil {
+        fmt.Println("[ERROR]", msgf("Schedule -> %q failed: %v", job.Name, outcome.err))
+        return
+    }
+    fmt.Println("[INFO]", msgf("Schedule -> %q finished: %d events in %.2fs",
+        job.Name, outcome.result.EventsInjected, float64(outcome.result.DurationMS)/1000))
+}
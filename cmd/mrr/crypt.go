@@ -0,0 +1,249 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strings"
+    "sync"
+    "syscall"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Encrypted recordings
+// ------------------------------------------
+
+// An encrypted recording is
+//        "MRRE" version, uint32 PBKDF2 iterations, 16-byte salt, 12-byte nonce
+// followed by the AES-256-GCM sealed bytes of the recording as it would
+// otherwise have been saved (any format, compressed or not). The header is
+// authenticated too. The key is derived from a passphrase, or from the
+// contents of --key-file, with PBKDF2-HMAC-SHA256.
+var encryptedMagic = []byte("MRRE")
+
+const (
+    encryptedVersion = 1
+    kdfIterations    = 600000
+    saltSize         = 16
+    encryptedHeader  = 4 + 1 + 4 + saltSize + 12
+)
+
+var (
+    // encryptRecordings encrypts saved recordings (--encrypt).
+    encryptRecordings bool
+    // keyFile is used instead of a passphrase when set (--key-file).
+    keyFile string
+
+    secretMtx sync.Mutex
+    // secret is the last passphrase that worked, so replays don't prompt
+    // every time.
+    secret []byte
+
+    sealMtx sync.Mutex
+    // sealCache is the key new recordings are sealed with, see sealingKey.
+    sealCache *sealKey
+)
+
+// sealKey is a key derived for sealing, with the salt it was derived with.
+type sealKey struct {
+    secret []byte
+    salt   []byte
+    gcm    cipher.AEAD
+}
+
+var errWrongKey = errors.New("wrong passphrase or key file, or the recording is corrupted")
+
+var (
+    procGetConsoleMode = kernel32.MustFindProc("GetConsoleMode")
+    procSetConsoleMode = kernel32.MustFindProc("SetConsoleMode")
+)
+
+const ENABLE_ECHO_INPUT = 0x0004
+
+// readPassphrase prompts on the console without echoing what is typed.
+func readPassphrase(prompt string) ([]byte, error) {
+    printPrompt("%s", prompt)
+    h := syscall.Handle(os.Stdin.Fd())
+    var mode uint32
+    if r, _, _ := procGetConsoleMode.Call(uintptr(h), uintptr(unsafe.Pointer(&mode))); r != 0 {
+        procSetConsoleMode.Call(uintptr(h), uintptr(mode&^ENABLE_ECHO_INPUT))
+        defer procSetConsoleMode.Call(uintptr(h), uintptr(mode))
+    }
+    line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    printPrompt("\n")
+    line = strings.TrimRight(line, "\r\n")
+    if line == "" {
+        if err != nil {
+            return nil, fmt.Errorf("no passphrase: %v", err)
+        }
+        return nil, fmt.Errorf("empty passphrase")
+    }
+    return []byte(line), nil
+}
+
+// sealingSecret returns what new recordings are encrypted with, asking for
+// a passphrase (twice) the first time.
+func sealingSecret() ([]byte, error) {
+    if keyFile != "" {
+        return ioutil.ReadFile(keyFile)
+    }
+    secretMtx.Lock()
+    defer secretMtx.Unlock()
+    if secret != nil {
+        return secret, nil
+    }
+    pass, err := readPassphrase("Passphrase for new recordings: ")
+    if err != nil {
+        return nil, err
+    }
+    again, err := readPassphrase("Repeat passphrase: ")
+    if err != nil {
+        return nil, err
+    }
+    if string(pass) != string(again) {
+        return nil, fmt.Errorf("passphrases don't match")
+    }
+    secret = pass
+    return secret, nil
+}
+
+// pbkdf2 derives a key of keyLen bytes (at most one SHA-256 block) with
+// PBKDF2-HMAC-SHA256.
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+    prf := hmac.New(sha256.New, password)
+    prf.Write(salt)
+    prf.Write([]byte{0, 0, 0, 1})
+    u := prf.Sum(nil)
+    t := append([]byte(nil), u...)
+    for n := 1; n < iterations; n++ {
+        prf.Reset()
+        prf.Write(u)
+        u = prf.Sum(u[:0])
+        for i := range t {
+            t[i] ^= u[i]
+        }
+    }
+    return t[:keyLen]
+}
+
+func newGCM(pass, salt []byte, iterations int) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(pbkdf2(pass, salt, iterations, 32))
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// sealingKey returns the key new recordings are sealed with, deriving it
+// the first time and again only when the secret changes. Deriving takes a
+// good part of a second, longer than the hook thread that saves
+// recordings may be held up, so the commands that record call this before
+// installing their hooks. Every recording sealed with the key shares its
+// salt; each still gets a nonce of its own.
+func sealingKey() (*sealKey, error) {
+    pass, err := sealingSecret()
+    if err != nil {
+        return nil, err
+    }
+    sealMtx.Lock()
+    defer sealMtx.Unlock()
+    if sealCache != nil && string(sealCache.secret) == string(pass) {
+        return sealCache, nil
+    }
+    salt := make([]byte, saltSize)
+    if _, err := rand.Read(salt); err != nil {
+        return nil, err
+    }
+    gcm, err := newGCM(pass, salt, kdfIterations)
+    if err != nil {
+        return nil, err
+    }
+    sealCache = &sealKey{secret: pass, salt: salt, gcm: gcm}
+    return sealCache, nil
+}
+
+// seal encrypts an encoded recording.
+func seal(plain []byte) ([]byte, error) {
+    key, err := sealingKey()
+    if err != nil {
+        return nil, err
+    }
+    header := make([]byte, encryptedHeader)
+    copy(header, encryptedMagic)
+    header[4] = encryptedVersion
+    binary.BigEndian.PutUint32(header[5:], kdfIterations)
+    copy(header[9:], key.salt)
+    if _, err := rand.Read(header[9+saltSize:]); err != nil {
+        return nil, err
+    }
+    return key.gcm.Seal(header, header[9+saltSize:], plain, header), nil
+}
+
+// unseal decrypts an encrypted recording, trying the key file, the last
+// passphrase that worked and then asking for one.
+func unseal(sealed []byte) ([]byte, error) {
+    if len(sealed) < encryptedHeader {
+        return nil, fmt.Errorf("truncated encrypted recording")
+    }
+    header := sealed[:encryptedHeader]
+    if header[4] != encryptedVersion {
+        return nil, fmt.Errorf("encrypted recording version %d is not supported (want %d)", header[4], encryptedVersion)
+    }
+    iterations := int(binary.BigEndian.Uint32(header[5:]))
+    if iterations < 1 || iterations > 10*kdfIterations {
+        return nil, fmt.Errorf("invalid key derivation parameters")
+    }
+    salt, nonce := header[9:9+saltSize], header[9+saltSize:]
+
+    try := func(pass []byte) ([]byte, error) {
+        gcm, err := newGCM(pass, salt, iterations)
+        if err != nil {
+            return nil, err
+        }
+        plain, err := gcm.Open(nil, nonce, sealed[encryptedHeader:], header)
+        if err != nil {
+            return nil, errWrongKey
+        }
+        return plain, nil
+    }
+
+    if keyFile != "" {
+        pass, err := ioutil.ReadFile(keyFile)
+        if err != nil {
+            return nil, err
+        }
+        return try(pass)
+    }
+
+    secretMtx.Lock()
+    defer secretMtx.Unlock()
+    if secret != nil {
+        if plain, err := try(secret); err == nil {
+            return plain, nil
+        }
+    }
+    for attempt := 0; attempt < 3; attempt++ {
+        pass, err := readPassphrase("Passphrase for the recording: ")
+        if err != nil {
+            return nil, err
+        }
+        plain, err := try(pass)
+        if err == nil {
+            secret = pass
+            return plain, nil
+        }
+        fmt.Println("[WARN]", err)
+    }
+    return nil, errWrongKey
+}
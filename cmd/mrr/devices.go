@@ -0,0 +1,461 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "syscall"
+    "text/tabwriter"
+    "time"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Input devices
+// ------------------------------------------
+
+// The low-level mouse hook doesn't say which device an event came from.
+// Raw Input does, but reports the device's own movement rather than where
+// the cursor went. With --device MRR listens to both and pairs them up:
+// whichever of a hook event and its raw report comes first waits for the
+// other, then the event is recorded tagged with the report's device, or
+// dropped when that isn't the device asked for.
+
+const (
+    RIM_TYPEMOUSE    = 0
+    RIM_TYPEKEYBOARD = 1
+    RIM_TYPEHID      = 2
+
+    RIDI_DEVICENAME = 0x20000007
+    RID_INPUT       = 0x10000003
+
+    RIDEV_REMOVE    = 0x00000001
+    RIDEV_INPUTSINK = 0x00000100
+
+    HID_USAGE_PAGE_GENERIC  = 0x01
+    HID_USAGE_GENERIC_MOUSE = 0x02
+
+    WM_INPUT = 0x00FF
+
+    MOUSE_MOVE_ABSOLUTE = 0x01
+
+    FILE_SHARE_READ  = 0x00000001
+    FILE_SHARE_WRITE = 0x00000002
+    OPEN_EXISTING    = 3
+
+    // deviceMatchWait is how long a hook event and a raw report wait for
+    // each other before the event is taken to come from no known device.
+    deviceMatchWait = 100 * time.Millisecond
+)
+
+// HWND_MESSAGE is the parent of message-only windows, (HWND)-3.
+const HWND_MESSAGE = ^uintptr(2)
+
+var (
+    procGetRawInputDeviceList   = user32.MustFindProc("GetRawInputDeviceList")
+    procGetRawInputDeviceInfoW  = user32.MustFindProc("GetRawInputDeviceInfoW")
+    procRegisterRawInputDevices = user32.MustFindProc("RegisterRawInputDevices")
+    procGetRawInputData         = user32.MustFindProc("GetRawInputData")
+
+    hid                       = syscall.NewLazyDLL("hid.dll")
+    procHidD_GetProductString = hid.NewProc("HidD_GetProductString")
+)
+
+type RAWINPUTDEVICELIST struct {
+    HDevice uintptr
+    DwType  uint32
+}
+
+type RAWINPUTDEVICE struct {
+    UsUsagePage uint16
+    UsUsage     uint16
+    DwFlags     uint32
+    HwndTarget  uintptr
+}
+
+type RAWINPUTHEADER struct {
+    DwType  uint32
+    DwSize  uint32
+    HDevice uintptr
+    WParam  uintptr
+}
+
+type RAWMOUSE struct {
+    UsFlags            uint16
+    _                  uint16
+    UsButtonFlags      uint16
+    UsButtonData       uint16
+    UlRawButtons       uint32
+    LLastX             int32
+    LLastY             int32
+    UlExtraInformation uint32
+}
+
+// RAWINPUT holding a mouse report.
+type RAWINPUTMOUSE struct {
+    Header RAWINPUTHEADER
+    Mouse  RAWMOUSE
+}
+
+// rawButtonEvents map RAWMOUSE button flags to events.
+var rawButtonEvents = []struct {
+    flag  uint16
+    event string
+}{
+    {0x0001, "LeftButtonDown"},
+    {0x0002, "LeftButtonUp"},
+    {0x0004, "RightButtonDown"},
+    {0x0008, "RightButtonUp"},
+    {0x0010, "MiddleButtonDown"},
+    {0x0020, "MiddleButtonUp"},
+    {0x0040, "Mouse4Down"},
+    {0x0080, "Mouse4Up"},
+    {0x0100, "Mouse5Down"},
+    {0x0200, "Mouse5Up"},
+    {0x0400, "MouseWheel"},
+    {0x0800, "MouseHWheel"},
+}
+
+// inputDevice is a device Raw Input knows.
+type inputDevice struct {
+    handle uintptr
+    kind   string
+    // id is the hardware ID from the device path, e.g.
+    // VID_046D&PID_C077; it is what recordings are tagged with.
+    id   string
+    name string
+    path string
+}
+
+// deviceFilter is --device: the mice to record from, matched against
+// their ID and name, or "all" to record from every one and tag it.
+var deviceFilter string
+
+var (
+    rawInputWindow uintptr
+
+    // rawDevices caches the devices reports came from, by handle. heldMice
+    // are mouse events waiting for their raw report and rawEvents reports
+    // waiting for their event. mtx guards all three.
+    rawDevices = make(map[uintptr]*inputDevice)
+    heldMice   []timedRecord
+    rawEvents  []rawEvent
+)
+
+// timedRecord is a captured record with the time it was captured at, for
+// recorder.Recorder.Add once its device is known.
+type timedRecord struct {
+    rec MouseRecord
+    at  time.Time
+}
+
+// rawEvent is one event out of a raw mouse report.
+type rawEvent struct {
+    event  string
+    device uintptr
+    at     time.Time
+}
+
+// listInputDevices enumerates the devices attached now.
+func listInputDevices() ([]inputDevice, error) {
+    var n uint32
+    size := unsafe.Sizeof(RAWINPUTDEVICELIST{})
+    r, _, err := procGetRawInputDeviceList.Call(0, uintptr(unsafe.Pointer(&n)), size)
+    if int32(r) == -1 {
+        return nil, fmt.Errorf("GetRawInputDeviceList failed: %v", err)
+    }
+    if n == 0 {
+        return nil, nil
+    }
+    list := make([]RAWINPUTDEVICELIST, n)
+    r, _, err = procGetRawInputDeviceList.Call(uintptr(unsafe.Pointer(&list[0])), uintptr(unsafe.Pointer(&n)), size)
+    if int32(r) == -1 {
+        return nil, fmt.Errorf("GetRawInputDeviceList failed: %v", err)
+    }
+    devices := make([]inputDevice, 0, r)
+    for _, d := range list[:r] {
+        devices = append(devices, deviceInfo(d.HDevice, d.DwType))
+    }
+    return devices, nil
+}
+
+// deviceInfo describes the device with handle h of Raw Input type typ.
+func deviceInfo(h uintptr, typ uint32) inputDevice {
+    d := inputDevice{handle: h, kind: "hid"}
+    switch typ {
+    case RIM_TYPEMOUSE:
+        d.kind = "mouse"
+    case RIM_TYPEKEYBOARD:
+        d.kind = "keyboard"
+    }
+    var n uint32
+    procGetRawInputDeviceInfoW.Call(h, RIDI_DEVICENAME, 0, uintptr(unsafe.Pointer(&n)))
+    if n == 0 {
+        return d
+    }
+    buf := make([]uint16, n+1)
+    if r, _, _ := procGetRawInputDeviceInfoW.Call(h, RIDI_DEVICENAME, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n))); int32(r) <= 0 {
+        return d
+    }
+    d.path = syscall.UTF16ToString(buf)
+    d.id = deviceID(d.path)
+    d.name = productName(d.path)
+    return d
+}
+
+// deviceID picks the hardware ID out of a device path such as
+// \\?\HID#VID_046D&PID_C077#7&1a2b3c4d&0&0000#{378de44c-...}.
+func deviceID(path string) string {
+    trimmed := strings.TrimPrefix(strings.TrimPrefix(path, `\\?\`), `\??\`)
+    if parts := strings.Split(trimmed, "#"); len(parts) >= 2 {
+        return parts[1]
+    }
+    return trimmed
+}
+
+// productName asks a HID device for its product string; other devices,
+// or ones that won't open, have none.
+func productName(path string) string {
+    if procHidD_GetProductString.Find() != nil {
+        return ""
+    }
+    p, err := syscall.UTF16PtrFromString(path)
+    if err != nil {
+        return ""
+    }
+    // No access is needed to query the device's strings.
+    h, err := syscall.CreateFile(p, 0, FILE_SHARE_READ|FILE_SHARE_WRITE, nil, OPEN_EXISTING, 0, 0)
+    if err != nil {
+        return ""
+    }
+    defer syscall.CloseHandle(h)
+    var buf [127]uint16
+    if r, _, _ := procHidD_GetProductString.Call(uintptr(h), uintptr(unsafe.Pointer(&buf[0])), unsafe.Sizeof(buf)); r == 0 {
+        return ""
+    }
+    return strings.TrimSpace(syscall.UTF16ToString(buf[:]))
+}
+
+// matchesDevice tells whether d is one of the devices filter names.
+func matchesDevice(d *inputDevice, filter string) bool {
+    if strings.EqualFold(filter, "all") {
+        return true
+    }
+    f := strings.ToLower(filter)
+    return d.id != "" && strings.Contains(strings.ToLower(d.id), f) ||
+        d.name != "" && strings.Contains(strings.ToLower(d.name), f)
+}
+
+// runDevices implements `mrr devices`.
+func runDevices(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitUsage
+    }
+    devices, err := listInputDevices()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not list the input devices:"), err)
+        return exitReplayFailed
+    }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(tw, "TYPE\tID\tNAME")
+    for _, d := range devices {
+        id := d.id
+        if id == "" {
+            id = "-"
+        }
+        fmt.Fprintf(tw, "%s\t%s\t%s\n", d.kind, id, d.name)
+        debugPrintln("[DEBUG]  ", d.path)
+    }
+    tw.Flush()
+    fmt.Printf("\n%s\n", msgf("%d device(s); record one mouse with --device <id or name>", len(devices)))
+    return exitOK
+}
+
+// startRawInput listens for raw mouse reports on the calling thread, which
+// must be the one pumping messages for the hooks.
+func startRawInput() error {
+    instance, _, _ := procGetModuleHandleW.Call(0)
+    className, _ := syscall.UTF16PtrFromString("MRRRawInput")
+    wc := WNDCLASSEXW{
+        LpfnWndProc:   syscall.NewCallback(rawInputWndProc),
+        HInstance:     instance,
+        LpszClassName: className,
+    }
+    wc.CbSize = uint32(unsafe.Sizeof(wc))
+    if r, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+        return fmt.Errorf("RegisterClassExW failed: %v", err)
+    }
+    hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), 0,
+        0, 0, 0, 0, 0, HWND_MESSAGE, 0, instance, 0)
+    if hwnd == 0 {
+        return fmt.Errorf("CreateWindowExW failed: %v", err)
+    }
+    // INPUTSINK gets the reports whichever window has the focus.
+    rid := RAWINPUTDEVICE{HID_USAGE_PAGE_GENERIC, HID_USAGE_GENERIC_MOUSE, RIDEV_INPUTSINK, hwnd}
+    if r, _, err := procRegisterRawInputDevices.Call(uintptr(unsafe.Pointer(&rid)), 1, unsafe.Sizeof(rid)); r == 0 {
+        procDestroyWindow.Call(hwnd)
+        return fmt.Errorf("RegisterRawInputDevices failed: %v", err)
+    }
+    rawInputWindow = hwnd
+    reportDeviceFilter()
+    return nil
+}
+
+// reportDeviceFilter says which attached mice --device picks.
+func reportDeviceFilter() {
+    devices, err := listInputDevices()
+    if err != nil {
+        return
+    }
+    var names []string
+    for i := range devices {
+        d := &devices[i]
+        if d.kind == "mouse" && matchesDevice(d, deviceFilter) {
+            name := d.id
+            if d.name != "" {
+                name = d.name + " (" + d.id + ")"
+            }
+            names = append(names, name)
+        }
+    }
+    switch {
+    case strings.EqualFold(deviceFilter, "all"):
+        fmt.Println("[INFO]", msg("Tagging mouse events with their device"))
+    case len(names) == 0:
+        fmt.Println("[WARN]", msgf("No attached mouse matches --device %q, see 'mrr devices'", deviceFilter))
+    default:
+        fmt.Println("[INFO]", msgf("Recording the mouse only from %s", strings.Join(names, ", ")))
+    }
+}
+
+func stopRawInput() {
+    if rawInputWindow == 0 {
+        return
+    }
+    rid := RAWINPUTDEVICE{HID_USAGE_PAGE_GENERIC, HID_USAGE_GENERIC_MOUSE, RIDEV_REMOVE, 0}
+    procRegisterRawInputDevices.Call(uintptr(unsafe.Pointer(&rid)), 1, unsafe.Sizeof(rid))
+    procDestroyWindow.Call(rawInputWindow)
+    rawInputWindow = 0
+}
+
+// trackingDevices tells whether mouse events wait for their device.
+func trackingDevices() bool {
+    return rawInputWindow != 0 && deviceFilter != ""
+}
+
+func rawInputWndProc(hwnd uintptr, msg uint32, wparam, lparam uintptr) uintptr {
+    if msg == WM_INPUT {
+        readRawInput(lparam)
+    }
+    // DefWindowProc frees the report.
+    r, _, _ := procDefWindowProcW.Call(hwnd, uintptr(msg), wparam, lparam)
+    return r
+}
+
+func readRawInput(h uintptr) {
+    var ri RAWINPUTMOUSE
+    size := uint32(unsafe.Sizeof(ri))
+    r, _, _ := procGetRawInputData.Call(h, RID_INPUT, uintptr(unsafe.Pointer(&ri)),
+        uintptr(unsafe.Pointer(&size)), unsafe.Sizeof(ri.Header))
+    if int32(r) <= 0 || ri.Header.DwType != RIM_TYPEMOUSE {
+        return
+    }
+    now := time.Now()
+
+    var kept []MouseRecord
+    mtx.Lock()
+    if isRecording && trackingDevices() {
+        m := ri.Mouse
+        if m.LLastX != 0 || m.LLastY != 0 || m.UsFlags&MOUSE_MOVE_ABSOLUTE != 0 {
+            rawEvents = append(rawEvents, rawEvent{"MouseMove", ri.Header.HDevice, now})
+        }
+        for _, b := range rawButtonEvents {
+            if m.UsButtonFlags&b.flag != 0 {
+                rawEvents = append(rawEvents, rawEvent{b.event, ri.Header.HDevice, now})
+            }
+        }
+        kept = keepRecords(pairDevices(now)...)
+    }
+    mtx.Unlock()
+
+    for _, rec := range kept {
+        fireEventRecorded(rec)
+    }
+}
+
+// holdForDevice queues a mouse event until its device is known and returns
+// the events that are ready to record. mtx must be held.
+func holdForDevice(tr timedRecord) []timedRecord {
+    heldMice = append(heldMice, tr)
+    return pairDevices(tr.at)
+}
+
+// flushDevices settles every held event, for the end of a recording. mtx
+// must be held.
+func flushDevices() []timedRecord {
+    kept := pairDevices(time.Now().Add(deviceMatchWait))
+    heldMice, rawEvents = nil, nil
+    return kept
+}
+
+// pairDevices matches held events with raw reports in order, and gives up
+// on events whose report hasn't come within deviceMatchWait: they were
+// injected or came from a device Raw Input doesn't report. It returns what
+// is to be recorded. mtx must be held.
+func pairDevices(now time.Time) []timedRecord {
+    var out []timedRecord
+    for len(heldMice) > 0 {
+        tr := heldMice[0]
+        match := -1
+        for i, e := range rawEvents {
+            if e.event == tr.rec.Event {
+                match = i
+                break
+            }
+        }
+        if match < 0 && now.Sub(tr.at) < deviceMatchWait {
+            break
+        }
+        heldMice = heldMice[1:]
+        var device uintptr
+        if match >= 0 {
+            // Reports before the match had no event of their own.
+            device = rawEvents[match].device
+            rawEvents = rawEvents[match+1:]
+        }
+        if tr, ok := tagDevice(tr, device); ok {
+            out = append(out, tr)
+        }
+    }
+    for len(rawEvents) > 0 && now.Sub(rawEvents[0].at) > deviceMatchWait {
+        rawEvents = rawEvents[1:]
+    }
+    return out
+}
+
+// tagDevice tags tr with the device that produced it, with ok false if
+// --device doesn't pick that device.
+func tagDevice(tr timedRecord, device uintptr) (timedRecord, bool) {
+    var d *inputDevice
+    if device != 0 {
+        if d = rawDevices[device]; d == nil {
+            info := deviceInfo(device, RIM_TYPEMOUSE)
+            d = &info
+            rawDevices[device] = d
+        }
+    }
+    switch {
+    case d != nil && matchesDevice(d, deviceFilter):
+        tr.rec.Device = d.id
+    case !strings.EqualFold(deviceFilter, "all"):
+        return tr, false
+    }
+    return tr, true
+}
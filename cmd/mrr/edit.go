@@ -0,0 +1,619 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "math"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+    playback "github.com/onixldlc/MRR/player"
+    "github.com/onixldlc/MRR/recorder"
+)
+
+// ------------------------------------------
+//     mrr edit: rewrite a recording
+// ------------------------------------------
+
+// editFunc changes a recording and says what it did.
+type editFunc func(r *Recording) (string, error)
+
+// editOp is one 'mrr edit' operation. parse takes the operation's own
+// options out of args and returns the edit and the arguments left.
+type editOp struct {
+    usage string
+    parse func(args []string) (editFunc, []string, error)
+}
+
+var editOps = map[string]editOp{
+    "trim":        {"trim [--head 2s] [--tail 5s] [--idle 3s]", parseTrim},
+    "scale-time":  {"scale-time <factor> [--min-delay 10ms]", parseScaleTime},
+    "transform":   {"transform [--offset x,y] [--scale s|sx,sy] [--clamp-to-screen]", parseTransform},
+    "strip-moves": {"strip-moves [--keep-before-clicks N] [--skip-time]", parseStripMoves},
+    "simplify":    {"simplify [--tolerance 1]", parseSimplify},
+}
+
+// editValue returns the value after the option at args[*i].
+func editValue(args []string, i *int) (string, error) {
+    if *i+1 >= len(args) {
+        return "", fmt.Errorf("%s needs a value", args[*i])
+    }
+    *i++
+    return args[*i], nil
+}
+
+// fileLayers tells how the file at path is stored, so an edit can write it
+// back the same way.
+func fileLayers(path string) (c codec, compressed, encrypted bool) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, false, false
+    }
+    defer f.Close()
+    br := bufio.NewReader(f)
+    if magic, _ := br.Peek(len(encryptedMagic)); bytes.Equal(magic, encryptedMagic) {
+        return nil, false, true
+    }
+    if magic, _ := br.Peek(len(format.GzipMagic)); bytes.Equal(magic, format.GzipMagic) {
+        zr, err := gzip.NewReader(br)
+        if err != nil {
+            return nil, true, false
+        }
+        defer zr.Close()
+        return sniffCodec(bufio.NewReader(zr)), true, false
+    }
+    return sniffCodec(br), false, false
+}
+
+// dropRecords removes the records drop picks from r. A dropped record's
+// wait is added to the next record kept, so everything else happens when it
+// did, unless skipTime is set; DPI segments are moved along.
+func dropRecords(r *Recording, drop func(i int) bool, skipTime bool) int {
+    kept := make([]MouseRecord, 0, len(r.Records))
+    newIndex := make([]int, len(r.Records)+1)
+    var carry int64
+    for i, rec := range r.Records {
+        newIndex[i] = len(kept)
+        if drop(i) {
+            if !skipTime {
+                carry += rec.DeltaMS
+            }
+            continue
+        }
+        rec.DeltaMS += carry
+        carry = 0
+        kept = append(kept, rec)
+    }
+    newIndex[len(r.Records)] = len(kept)
+    dropped := len(r.Records) - len(kept)
+
+    segments := r.DPISegments[:0]
+    for _, seg := range r.DPISegments {
+        if seg.Index >= 0 && seg.Index < len(newIndex) {
+            seg.Index = newIndex[seg.Index]
+        }
+        if n := len(segments); n > 0 && segments[n-1].Index == seg.Index {
+            segments[n-1] = seg
+            continue
+        }
+        segments = append(segments, seg)
+    }
+    r.Records, r.DPISegments = kept, segments
+    return dropped
+}
+
+// saveEdited saves an edited recording. Written back over in, it keeps
+// in's format, compression and encryption.
+func saveEdited(in, out string, r *Recording) error {
+    if _, _, ok := parseStoreRef(out); ok || out != in {
+        return saveRecording(out, r)
+    }
+    c, compressed, encrypted := fileLayers(in)
+    compressRecordings = compressRecordings || compressed
+    encryptRecordings = encryptRecordings || encrypted
+    if c == nil || !c.Native() {
+        return saveRecording(out, r)
+    }
+    return saveAs(out, r, c, ExportOptions{})
+}
+
+func editUsage() {
+    var ops []string
+    for _, op := range editOps {
+        ops = append(ops, "  mrr edit "+op.usage+" <file> [-o out]")
+    }
+    sort.Strings(ops)
+    fmt.Println("usage:")
+    fmt.Println(strings.Join(ops, "\n"))
+}
+
+// runEdit implements `mrr edit <op> [options] <file> [-o out]`. The file is
+// rewritten in place, in its own format, unless -o names another.
+func runEdit(args []string) int {
+    if len(args) == 0 {
+        editUsage()
+        return exitUsage
+    }
+    op, ok := editOps[args[0]]
+    if !ok {
+        fmt.Println("[ERROR]", msgf("Unknown edit %q", args[0]))
+        editUsage()
+        return exitUsage
+    }
+    edit, rest, err := op.parse(args[1:])
+    var out string
+    var files []string
+    if err == nil {
+        var other []string
+        for i := 0; i < len(rest) && err == nil; i++ {
+            if rest[i] == "-o" || rest[i] == "--out" {
+                out, err = editValue(rest, &i)
+            } else {
+                other = append(other, rest[i])
+            }
+        }
+        if err == nil {
+            files, err = parseArgs(other)
+        }
+    }
+    if err != nil || len(files) != 1 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr edit " + op.usage + " <file> [-o out]")
+        return exitUsage
+    }
+
+    in, err := resolveRecording(files[0])
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    recording, err := loadFromFile(in)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+        return loadExitCode(err)
+    }
+    before := len(recording.Records)
+    report, err := edit(recording)
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitReplayFailed
+    }
+    summary := format.Summarize(recording.Records)
+    recording.Summary = &summary
+
+    if out == "" {
+        out = in
+    }
+    if err := saveEdited(in, out, recording); err != nil {
+        fmt.Println("[ERROR]", msg("Could not save recording:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("%s: %s (%d -> %d records, %s)", displayName(out), report, before, len(recording.Records),
+        formatClock(time.Duration(summary.DurationMS)*time.Millisecond)))
+    return exitOK
+}
+
+// ------------------------------------------
+//     trim
+// ------------------------------------------
+
+func parseTrim(args []string) (editFunc, []string, error) {
+    var head, tail, idle time.Duration
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        var target *time.Duration
+        switch args[i] {
+        case "--head":
+            target = &head
+        case "--tail":
+            target = &tail
+        case "--idle":
+            target = &idle
+        default:
+            rest = append(rest, args[i])
+            continue
+        }
+        v, err := editValue(args, &i)
+        if err != nil {
+            return nil, nil, err
+        }
+        if *target, err = parseClock(v); err != nil {
+            return nil, nil, fmt.Errorf("%s: %v", args[i-1], err)
+        }
+    }
+    if head == 0 && tail == 0 && idle == 0 {
+        return nil, nil, fmt.Errorf("trim needs --head, --tail or --idle")
+    }
+    return func(r *Recording) (string, error) {
+        return trimRecording(r, head, tail, idle), nil
+    }, rest, nil
+}
+
+// trimRecording cuts head off the start and tail off the end of r, and
+// shortens every wait longer than idle to idle. Cutting the start keeps
+// the wait between the cut and the first event left.
+func trimRecording(r *Recording, head, tail, idle time.Duration) string {
+    var did []string
+    before := recordingDuration(r.Records)
+    if head > 0 || tail > 0 {
+        times := recordTimes(r.Records)
+        lo, hi := 0, len(r.Records)
+        for lo < hi && times[lo] < head.Milliseconds() {
+            lo++
+        }
+        if tail > 0 && len(times) > 0 {
+            end := times[len(times)-1] - tail.Milliseconds()
+            for hi > lo && times[hi-1] > end {
+                hi--
+            }
+        }
+        if held := heldAt(r.Records[:lo]); len(held) > 0 {
+            fmt.Println("[WARN]", msgf("%s is held down where the recording now starts", strings.Join(held, ", ")))
+        }
+        if held := heldAt(r.Records[:hi]); hi < len(r.Records) && len(held) > 0 {
+            fmt.Println("[WARN]", msgf("%s is left held down where the recording now ends", strings.Join(held, ", ")))
+        }
+        *r = *sliceRecording(r, lo, hi, head.Milliseconds())
+        did = append(did, fmt.Sprintf("cut %d record(s) from the start and %d from the end", lo, len(times)-hi))
+    }
+    if idle > 0 {
+        n := 0
+        for i := range r.Records {
+            if r.Records[i].DeltaMS > idle.Milliseconds() {
+                r.Records[i].DeltaMS = idle.Milliseconds()
+                n++
+            }
+        }
+        did = append(did, fmt.Sprintf("shortened %d idle wait(s)", n))
+    }
+    saved := before - recordingDuration(r.Records)
+    did = append(did, formatClock(time.Duration(saved)*time.Millisecond)+" shorter")
+    return strings.Join(did, ", ")
+}
+
+// recordingDuration is how long records take to play, in milliseconds.
+func recordingDuration(records []MouseRecord) int64 {
+    var t int64
+    for _, rec := range records {
+        t += rec.DeltaMS
+    }
+    return t
+}
+
+// ------------------------------------------
+//     scale-time
+// ------------------------------------------
+
+func parseScaleTime(args []string) (editFunc, []string, error) {
+    var minDelay time.Duration
+    factor := -1.0
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        switch {
+        case args[i] == "--min-delay":
+            v, err := editValue(args, &i)
+            if err != nil {
+                return nil, nil, err
+            }
+            if minDelay, err = parseClock(v); err != nil {
+                return nil, nil, fmt.Errorf("--min-delay: %v", err)
+            }
+        case factor < 0 && !strings.HasPrefix(args[i], "-"):
+            f, err := strconv.ParseFloat(args[i], 64)
+            if err != nil || f <= 0 || math.IsInf(f, 0) {
+                return nil, nil, fmt.Errorf("expected a time factor above 0 such as 0.5, got %q", args[i])
+            }
+            factor = f
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    if factor < 0 {
+        return nil, nil, fmt.Errorf("scale-time needs a factor: 0.5 halves every wait")
+    }
+    return func(r *Recording) (string, error) {
+        before := recordingDuration(r.Records)
+        clamped := scaleTime(r.Records, factor, minDelay.Milliseconds())
+        report := fmt.Sprintf("waits scaled by %g, %s -> %s", factor,
+            formatClock(time.Duration(before)*time.Millisecond),
+            formatClock(time.Duration(recordingDuration(r.Records))*time.Millisecond))
+        if clamped > 0 {
+            report += fmt.Sprintf(", %d wait(s) raised to %s", clamped, minDelay)
+        }
+        return report, nil
+    }, rest, nil
+}
+
+// scaleTime multiplies every wait by factor. Rounding is carried over so
+// the total comes out right, and waits that weren't 0 are kept at least
+// minMS. It returns how many waits were raised to minMS.
+func scaleTime(records []MouseRecord, factor float64, minMS int64) int {
+    var t, scaled int64
+    clamped := 0
+    for i := range records {
+        d := records[i].DeltaMS
+        t += d
+        next := int64(math.Round(float64(t) * factor))
+        nd := next - scaled
+        if d > 0 && nd < minMS {
+            nd = minMS
+            clamped++
+        }
+        if nd < 0 {
+            nd = 0
+        }
+        records[i].DeltaMS = nd
+        scaled += nd
+    }
+    return clamped
+}
+
+// ------------------------------------------
+//     transform
+// ------------------------------------------
+
+// coordTransform scales positions about Origin, then shifts them.
+type coordTransform struct {
+    Origin         POINT
+    ScaleX, ScaleY float64
+    Offset         POINT
+}
+
+func (t coordTransform) apply(x, y int32) (int32, int32) {
+    nx := float64(t.Origin.X) + float64(x-t.Origin.X)*t.ScaleX + float64(t.Offset.X)
+    ny := float64(t.Origin.Y) + float64(y-t.Origin.Y)*t.ScaleY + float64(t.Offset.Y)
+    return int32(math.Round(nx)), int32(math.Round(ny))
+}
+
+func (t coordTransform) bounds(b ScreenBounds) ScreenBounds {
+    x, y := t.apply(b.X, b.Y)
+    x2, y2 := t.apply(b.X+b.Width, b.Y+b.Height)
+    return ScreenBounds{X: x, Y: y, Width: x2 - x, Height: y2 - y}
+}
+
+// parseScale parses "s" or "sx,sy".
+func parseScale(s string) (float64, float64, error) {
+    parts := strings.Split(s, ",")
+    if len(parts) > 2 {
+        return 0, 0, fmt.Errorf("expected s or sx,sy but got %q", s)
+    }
+    var v [2]float64
+    for i, part := range parts {
+        f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+        if err != nil || f <= 0 || math.IsInf(f, 0) {
+            return 0, 0, fmt.Errorf("expected s or sx,sy above 0 but got %q", s)
+        }
+        v[i] = f
+    }
+    if len(parts) == 1 {
+        v[1] = v[0]
+    }
+    return v[0], v[1], nil
+}
+
+func parseTransform(args []string) (editFunc, []string, error) {
+    t := coordTransform{ScaleX: 1, ScaleY: 1}
+    clamp := false
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        switch args[i] {
+        case "--offset":
+            v, err := editValue(args, &i)
+            if err == nil {
+                t.Offset, err = parsePoint(v)
+            }
+            if err != nil {
+                return nil, nil, fmt.Errorf("--offset: %v", err)
+            }
+        case "--scale":
+            v, err := editValue(args, &i)
+            if err == nil {
+                t.ScaleX, t.ScaleY, err = parseScale(v)
+            }
+            if err != nil {
+                return nil, nil, fmt.Errorf("--scale: %v", err)
+            }
+        case "--clamp-to-screen":
+            clamp = true
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    if t.Offset == (POINT{}) && t.ScaleX == 1 && t.ScaleY == 1 && !clamp {
+        return nil, nil, fmt.Errorf("transform needs --offset, --scale or --clamp-to-screen")
+    }
+    return func(r *Recording) (string, error) {
+        return transformRecording(r, t, clamp), nil
+    }, rest, nil
+}
+
+// transformRecording moves every position in r, and the screen and window
+// it was recorded against with them. Scaling is about the top-left of the
+// recorded screen. With clamp, positions are then kept on this machine's
+// screen.
+func transformRecording(r *Recording, t coordTransform, clamp bool) string {
+    if m := r.Metadata; m != nil {
+        t.Origin = POINT{X: m.Screen.X, Y: m.Screen.Y}
+        m.Screen = t.bounds(m.Screen)
+        if m.Window != nil {
+            m.Window.Client = t.bounds(m.Window.Client)
+        }
+    }
+    for i := range r.DPISegments {
+        seg := &r.DPISegments[i]
+        b := t.bounds(ScreenBounds{X: seg.Monitor.MinX, Y: seg.Monitor.MinY,
+            Width: seg.Monitor.MaxX - seg.Monitor.MinX, Height: seg.Monitor.MaxY - seg.Monitor.MinY})
+        seg.Monitor = Rect{MinX: b.X, MinY: b.Y, MaxX: b.X + b.Width, MaxY: b.Y + b.Height}
+    }
+
+    vs := desktop.VirtualScreen()
+    clamped, regions := 0, 0
+    for i := range r.Records {
+        rec := &r.Records[i]
+        rec.X, rec.Y = t.apply(rec.X, rec.Y)
+        if clamp {
+            x := clampInt32(rec.X, vs.X, vs.X+vs.Width-1)
+            y := clampInt32(rec.Y, vs.Y, vs.Y+vs.Height-1)
+            if x != rec.X || y != rec.Y {
+                clamped++
+            }
+            rec.X, rec.Y = x, y
+        }
+        if rec.Event == EventAssertRegion {
+            regions++
+        }
+    }
+    if regions > 0 && (t.ScaleX != 1 || t.ScaleY != 1) {
+        fmt.Println("[WARN]", msgf("%d region check(s) keep their size and hash; record them again at the new scale", regions))
+    }
+
+    report := fmt.Sprintf("positions scaled by %g,%g and moved by %d,%d", t.ScaleX, t.ScaleY, t.Offset.X, t.Offset.Y)
+    if clamp {
+        report += fmt.Sprintf(", %d clamped to the screen", clamped)
+    }
+    return report
+}
+
+func clampInt32(v, lo, hi int32) int32 {
+    if v < lo {
+        return lo
+    }
+    if v > hi {
+        return hi
+    }
+    return v
+}
+
+// ------------------------------------------
+//     strip-moves
+// ------------------------------------------
+
+func parseStripMoves(args []string) (editFunc, []string, error) {
+    keep := 0
+    skipTime := false
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        switch args[i] {
+        case "--keep-before-clicks":
+            v, err := editValue(args, &i)
+            if err == nil {
+                keep, err = strconv.Atoi(v)
+            }
+            if err != nil || keep < 0 {
+                return nil, nil, fmt.Errorf("--keep-before-clicks needs a number of moves")
+            }
+        case "--skip-time":
+            skipTime = true
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    return func(r *Recording) (string, error) {
+        n := stripMoves(r, keep, skipTime)
+        return fmt.Sprintf("removed %d move(s)", n), nil
+    }, rest, nil
+}
+
+func isButtonDown(event string) bool {
+    for _, b := range playback.Buttons {
+        if event == b.Down {
+            return true
+        }
+    }
+    return false
+}
+
+// stripMoves removes MouseMove records except the keep moves before each
+// button press and moves made while a button is held, so drags still work.
+func stripMoves(r *Recording, keep int, skipTime bool) int {
+    strip := make([]bool, len(r.Records))
+    held := make(playback.HeldButtons)
+    for i, rec := range r.Records {
+        strip[i] = rec.Event == "MouseMove" && len(held) == 0
+        held.Track(rec.Event)
+        if !isButtonDown(rec.Event) {
+            continue
+        }
+        for j, n := i-1, 0; j >= 0 && n < keep && r.Records[j].Event == "MouseMove"; j-- {
+            strip[j] = false
+            n++
+        }
+    }
+    return dropRecords(r, func(i int) bool { return strip[i] }, skipTime)
+}
+
+// ------------------------------------------
+//     simplify
+// ------------------------------------------
+
+func parseSimplify(args []string) (editFunc, []string, error) {
+    tolerance := 1.0
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        if args[i] != "--tolerance" {
+            rest = append(rest, args[i])
+            continue
+        }
+        v, err := editValue(args, &i)
+        if err == nil {
+            tolerance, err = strconv.ParseFloat(v, 64)
+        }
+        if err != nil || tolerance < 0 {
+            return nil, nil, fmt.Errorf("--tolerance needs a distance in pixels")
+        }
+    }
+    return func(r *Recording) (string, error) {
+        return simplifyRecording(r, tolerance), nil
+    }, rest, nil
+}
+
+// simplifyRecording cleans up a noisy capture: moves to where the cursor
+// already is, moves straight away replaced by another at the same moment,
+// and moves within tolerance pixels of a straight path go, the last as
+// --simplify does while recording. Timing is kept.
+func simplifyRecording(r *Recording, tolerance float64) string {
+    var last MouseRecord
+    seen := false
+    dups := dropRecords(r, func(i int) bool {
+        rec := r.Records[i]
+        if !playback.Positional(rec) {
+            return false
+        }
+        dup := seen && rec.Event == "MouseMove" && rec.X == last.X && rec.Y == last.Y
+        last, seen = rec, true
+        return dup
+    }, false)
+
+    records := r.Records
+    merged := dropRecords(r, func(i int) bool {
+        return records[i].Event == "MouseMove" && i+1 < len(records) &&
+            records[i+1].Event == "MouseMove" && records[i+1].DeltaMS == 0
+    }, false)
+
+    straight := 0
+    if tolerance > 0 {
+        records := make([]MouseRecord, len(r.Records))
+        for i, rec := range r.Records {
+            rec.Source = i
+            records[i] = rec
+        }
+        keep := make([]bool, len(r.Records))
+        for _, rec := range recorder.Simplify(records, tolerance) {
+            keep[rec.Source] = true
+        }
+        straight = dropRecords(r, func(i int) bool { return !keep[i] }, false)
+    }
+    return fmt.Sprintf("removed %d repeated position(s), %d superseded move(s) and %d move(s) on straight paths",
+        dups, merged, straight)
+}
@@ -0,0 +1,495 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     mrr editor: edit a recording in the browser
+// ------------------------------------------
+
+// 'mrr editor <file>' serves a page on 127.0.0.1 that draws the recording
+// on a timeline and lists its events, to select, delete, move and retime
+// them, and saves the result back like 'mrr edit' does. The page's address
+// carries a random token, so other pages open in the browser can't reach
+// it.
+
+// editorSave is what the page sends back: the records, and for each the
+// index it had when loaded.
+type editorSave struct {
+    Records []MouseRecord `json:"Records"`
+    Source  []int         `json:"Source"`
+}
+
+// remapSegments moves DPI segments to the records' new indices; a segment
+// whose first record was deleted starts at the next record kept.
+func remapSegments(segments []DPISegment, source []int) []DPISegment {
+    var out []DPISegment
+    for _, seg := range segments {
+        at := -1
+        for i, src := range source {
+            if src >= seg.Index {
+                at = i
+                break
+            }
+        }
+        if at < 0 {
+            continue
+        }
+        seg.Index = at
+        if n := len(out); n > 0 && out[n-1].Index == at {
+            out[n-1] = seg
+            continue
+        }
+        out = append(out, seg)
+    }
+    if len(out) > 0 && len(source) > 0 {
+        out[0].Index = 0
+    }
+    return out
+}
+
+// runEditor implements `mrr editor <file> [-o out] [--port n]`.
+func runEditor(args []string) int {
+    var out, port string
+    var rest []string
+    var err error
+    for i := 0; i < len(args) && err == nil; i++ {
+        switch args[i] {
+        case "-o", "--out":
+            out, err = editValue(args, &i)
+        case "--port":
+            port, err = editValue(args, &i)
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    var files []string
+    if err == nil {
+        files, err = parseArgs(rest)
+    }
+    if err != nil || len(files) != 1 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr editor <file> [-o out] [--port 8080]")
+        return exitUsage
+    }
+    in, err := resolveRecording(files[0])
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    recording, err := loadFromFile(in)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+        return loadExitCode(err)
+    }
+    if out == "" {
+        out = in
+    }
+
+    if port == "" {
+        port = "0"
+    }
+    ln, err := net.Listen("tcp", "127.0.0.1:"+port)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not start the editor:"), err)
+        return exitUsage
+    }
+    token := make([]byte, 16)
+    rand.Read(token)
+    prefix := "/" + hex.EncodeToString(token) + "/"
+
+    var mu sync.Mutex
+    quit := make(chan struct{})
+    var quitOnce sync.Once
+    mux := http.NewServeMux()
+    mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        fmt.Fprint(w, strings.Replace(editorPage, "{{name}}", htmlEscaper.Replace(displayName(out)), -1))
+    })
+    mux.HandleFunc(prefix+"recording", func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        defer mu.Unlock()
+        switch r.Method {
+        case http.MethodGet:
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(recording)
+        case http.MethodPost:
+            var save editorSave
+            if err := json.NewDecoder(r.Body).Decode(&save); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            if len(save.Source) != len(save.Records) {
+                http.Error(w, "Source doesn't match Records", http.StatusBadRequest)
+                return
+            }
+            if err := validateRecords(save.Records); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            edited := *recording
+            edited.Records = save.Records
+            edited.DPISegments = remapSegments(recording.DPISegments, save.Source)
+            summary := format.Summarize(edited.Records)
+            edited.Summary = &summary
+            if err := saveEdited(in, out, &edited); err != nil {
+                fmt.Println("[ERROR]", msg("Could not save recording:"), err)
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            }
+            recording = &edited
+            fmt.Println("[INFO]", msgf("Saved %s (%d records, %s)", displayName(out), len(edited.Records),
+                formatClock(time.Duration(summary.DurationMS)*time.Millisecond)))
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(recording)
+        default:
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        }
+    })
+    mux.HandleFunc(prefix+"quit", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        quitOnce.Do(func() { close(quit) })
+    })
+    srv := &http.Server{Handler: mux}
+    go srv.Serve(ln)
+
+    url := fmt.Sprintf("http://%s%s", ln.Addr(), prefix)
+    fmt.Println("[INFO]", msgf("Editing %s at %s", displayName(in), url))
+    fmt.Println("[INFO]", msg("Quit from the page or press Ctrl+C to stop the editor"))
+    if err := shellOpen(url); err != nil {
+        fmt.Println("[WARN]", msg("Could not open the browser:"), err)
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    select {
+    case <-ctx.Done():
+    case <-quit:
+    }
+    shutdown, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    srv.Shutdown(shutdown)
+    return exitOK
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// editorPage is the editor itself. The timeline has a lane per kind of
+// event; the table only builds the rows in view, so long recordings stay
+// responsive.
+const editorPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MRR - {{name}}</title>
+<style>
+body { font: 13px Segoe UI, sans-serif; margin: 0; display: flex; flex-direction: column; height: 100vh; }
+header { padding: 6px 10px; background: #2d2d30; color: #eee; display: flex; gap: 8px; align-items: center; flex-wrap: wrap; }
+header b { margin-right: 12px; }
+header input { width: 60px; }
+header .sep { width: 1px; height: 20px; background: #666; }
+#info { margin-left: auto; }
+#timeline { height: 120px; width: 100%; border-bottom: 1px solid #ccc; cursor: crosshair; }
+#table { flex: 1; overflow-y: auto; position: relative; font-family: Consolas, monospace; }
+.row { position: absolute; left: 0; right: 0; height: 20px; line-height: 20px; white-space: pre; padding-left: 8px; cursor: default; }
+.row.sel { background: #cce4ff; }
+.head { position: sticky; top: 0; background: #eee; z-index: 1; height: 20px; line-height: 20px; white-space: pre; padding-left: 8px; font-family: Consolas, monospace; border-bottom: 1px solid #ccc; }
+#status { padding: 4px 10px; background: #eee; border-top: 1px solid #ccc; }
+.err { color: #c00; }
+</style>
+</head>
+<body>
+<header>
+<b>{{name}}</b>
+<button id="undo" title="Ctrl+Z">Undo</button>
+<button id="delete" title="Del">Delete</button>
+<span class="sep"></span>
+move by <input id="dx" value="0"> , <input id="dy" value="0"> <button id="move">Move</button>
+<span class="sep"></span>
+delay <input id="delay" placeholder="ms"> <button id="setDelay">Set</button>
+x <input id="factor" placeholder="1.0"> <button id="scale">Scale</button>
+<span class="sep"></span>
+<button id="save" title="Ctrl+S">Save</button>
+<button id="quit">Quit</button>
+<span id="info"></span>
+</header>
+<canvas id="timeline"></canvas>
+<div class="head">     #        time    +delay  event                x      y    data</div>
+<div id="table"><div id="spacer"></div></div>
+<div id="status">Loading...</div>
+<script>
+"use strict";
+const ROW = 20;
+const lanes = [
+    ["moves", e => e === "MouseMove"],
+    ["buttons", e => /Button|Mouse[45]/.test(e)],
+    ["wheel", e => /Wheel/.test(e)],
+    ["keys", e => /^Key|^Text/.test(e)],
+    ["other", e => true],
+];
+const laneColors = ["#9ab", "#d33", "#3a3", "#36c", "#a6c"];
+let records = [], source = [], times = [], selected = new Set(), anchor = -1;
+let undoStack = [], dirty = false;
+const $ = id => document.getElementById(id);
+
+function status(msg, err) {
+    $("status").textContent = msg;
+    $("status").className = err ? "err" : "";
+}
+
+function load(rec) {
+    records = rec.Records || [];
+    source = records.map((_, i) => i);
+    selected.clear();
+    undoStack = [];
+    dirty = false;
+    changed();
+}
+
+function snapshot() {
+    undoStack.push({records: records.map(r => Object.assign({}, r)), source: source.slice()});
+    if (undoStack.length > 100) undoStack.shift();
+    dirty = true;
+}
+
+function changed() {
+    times = [];
+    let t = 0;
+    for (const r of records) { t += r.DeltaMS; times.push(t); }
+    $("spacer").style.height = (records.length * ROW) + "px";
+    $("info").textContent = records.length + " events, " + clock(t) + (dirty ? " (unsaved)" : "");
+    drawTable(true);
+    drawTimeline();
+}
+
+function clock(ms) {
+    const s = ms / 1000;
+    return Math.floor(s / 60) + ":" + (s % 60).toFixed(2).padStart(5, "0");
+}
+
+function pad(v, n) { return String(v).padStart(n); }
+
+function drawTable(force) {
+    const table = $("table");
+    const first = Math.max(0, Math.floor(table.scrollTop / ROW) - 5);
+    const last = Math.min(records.length, first + Math.ceil(table.clientHeight / ROW) + 10);
+    if (!force && table.dataset.first == first && table.dataset.last == last) return;
+    table.dataset.first = first;
+    table.dataset.last = last;
+    for (const el of table.querySelectorAll(".row")) el.remove();
+    const frag = document.createDocumentFragment();
+    for (let i = first; i < last; i++) {
+        const r = records[i];
+        const el = document.createElement("div");
+        el.className = "row" + (selected.has(i) ? " sel" : "");
+        el.style.top = (i * ROW) + "px";
+        el.dataset.i = i;
+        el.textContent = pad(i, 6) + "  " + pad(clock(times[i]), 10) + "  " + pad(r.DeltaMS, 6) + "  " +
+            r.Event.padEnd(18) + pad(r.X, 6) + " " + pad(r.Y, 6) + "  " + pad(r.Data, 6);
+        frag.appendChild(el);
+    }
+    table.appendChild(frag);
+}
+
+function drawTimeline() {
+    const c = $("timeline");
+    c.width = c.clientWidth;
+    c.height = c.clientHeight;
+    const g = c.getContext("2d");
+    const total = Math.max(1, times.length ? times[times.length - 1] : 1);
+    const laneH = (c.height - 14) / lanes.length;
+    g.fillStyle = "#fafafa";
+    g.fillRect(0, 0, c.width, c.height);
+    g.font = "10px sans-serif";
+    for (let l = 0; l < lanes.length; l++) {
+        g.fillStyle = "#888";
+        g.fillText(lanes[l][0], 2, l * laneH + laneH / 2 + 3);
+    }
+    for (let i = 0; i < records.length; i++) {
+        const l = lanes.findIndex(lane => lane[1](records[i].Event));
+        const x = 40 + (c.width - 44) * times[i] / total;
+        g.fillStyle = selected.has(i) ? "#f80" : laneColors[l];
+        g.fillRect(x, l * laneH + 2, selected.has(i) ? 2 : 1, laneH - 4);
+    }
+    g.fillStyle = "#888";
+    for (let k = 0; k <= 10; k++) {
+        const x = 40 + (c.width - 44) * k / 10;
+        g.fillText(clock(total * k / 10), Math.min(x, c.width - 40), c.height - 2);
+    }
+}
+
+// indexAt is the record closest to x on the timeline.
+function indexAt(x) {
+    const c = $("timeline");
+    const total = Math.max(1, times.length ? times[times.length - 1] : 1);
+    const t = (x - 40) / (c.width - 44) * total;
+    let lo = 0, hi = times.length - 1;
+    while (lo < hi) {
+        const mid = (lo + hi) >> 1;
+        if (times[mid] < t) lo = mid + 1; else hi = mid;
+    }
+    return lo;
+}
+
+function select(i, e) {
+    if (e.shiftKey && anchor >= 0) {
+        if (!e.ctrlKey) selected.clear();
+        for (let k = Math.min(anchor, i); k <= Math.max(anchor, i); k++) selected.add(k);
+    } else if (e.ctrlKey) {
+        if (selected.has(i)) selected.delete(i); else selected.add(i);
+        anchor = i;
+    } else {
+        selected.clear();
+        selected.add(i);
+        anchor = i;
+    }
+    selectionChanged();
+}
+
+function selectionChanged() {
+    status(selected.size + " selected");
+    drawTable(true);
+    drawTimeline();
+}
+
+function reveal(i) {
+    const table = $("table");
+    if (i * ROW < table.scrollTop || (i + 1) * ROW > table.scrollTop + table.clientHeight) {
+        table.scrollTop = i * ROW - table.clientHeight / 2;
+    }
+}
+
+function needSelection() {
+    if (selected.size === 0) { status("Select events first", true); return false; }
+    return true;
+}
+
+function number(id, integer) {
+    const v = Number($(id).value);
+    if ($(id).value.trim() === "" || !isFinite(v) || (integer && !Number.isInteger(v))) {
+        status(id + " must be a" + (integer ? "n integer" : " number"), true);
+        return null;
+    }
+    return v;
+}
+
+// remove deletes the selection; a deleted event's delay goes to the
+// next one, so everything after it still happens when it did.
+function remove() {
+    if (!needSelection()) return;
+    snapshot();
+    const kept = [], keptSource = [];
+    let carry = 0;
+    records.forEach((r, i) => {
+        if (selected.has(i)) { carry += r.DeltaMS; return; }
+        kept.push(Object.assign({}, r, {DeltaMS: r.DeltaMS + carry}));
+        keptSource.push(source[i]);
+        carry = 0;
+    });
+    status("Deleted " + selected.size + " event(s)");
+    records = kept;
+    source = keptSource;
+    selected.clear();
+    changed();
+}
+
+function move() {
+    if (!needSelection()) return;
+    const dx = number("dx", true), dy = number("dy", true);
+    if (dx === null || dy === null) return;
+    snapshot();
+    for (const i of selected) { records[i].X += dx; records[i].Y += dy; }
+    status("Moved " + selected.size + " event(s) by " + dx + "," + dy);
+    changed();
+}
+
+function retime(f, what) {
+    if (!needSelection()) return;
+    snapshot();
+    for (const i of selected) records[i].DeltaMS = Math.max(0, Math.round(f(records[i].DeltaMS)));
+    status(what + " " + selected.size + " event(s)");
+    changed();
+}
+
+function undo() {
+    const s = undoStack.pop();
+    if (!s) { status("Nothing to undo"); return; }
+    records = s.records;
+    source = s.source;
+    selected.clear();
+    status("Undone");
+    changed();
+}
+
+async function save() {
+    status("Saving...");
+    const resp = await fetch("recording", {method: "POST", body: JSON.stringify({Records: records, Source: source})});
+    if (!resp.ok) { status("Could not save: " + await resp.text(), true); return; }
+    load(await resp.json());
+    status("Saved");
+}
+
+$("table").addEventListener("scroll", () => drawTable(false));
+$("table").addEventListener("mousedown", e => {
+    const el = e.target.closest(".row");
+    if (el) select(Number(el.dataset.i), e);
+});
+$("timeline").addEventListener("mousedown", e => {
+    if (!records.length) return;
+    const i = indexAt(e.offsetX);
+    select(i, e);
+    reveal(i);
+});
+$("undo").onclick = undo;
+$("delete").onclick = remove;
+$("move").onclick = move;
+$("setDelay").onclick = () => { const v = number("delay", true); if (v !== null) retime(() => v, "Retimed"); };
+$("scale").onclick = () => { const v = number("factor", false); if (v !== null) retime(d => d * v, "Scaled"); };
+$("save").onclick = save;
+$("quit").onclick = async () => {
+    if (dirty && !confirm("Quit without saving?")) return;
+    dirty = false;
+    await fetch("quit", {method: "POST"});
+    document.body.innerHTML = "<p style='padding:20px'>The editor has stopped; you can close this tab.</p>";
+};
+document.addEventListener("keydown", e => {
+    if (e.target.tagName === "INPUT") return;
+    if (e.key === "Delete") remove();
+    else if (e.ctrlKey && e.key === "z") { e.preventDefault(); undo(); }
+    else if (e.ctrlKey && e.key === "s") { e.preventDefault(); save(); }
+    else if (e.ctrlKey && e.key === "a") {
+        e.preventDefault();
+        records.forEach((_, i) => selected.add(i));
+        selectionChanged();
+    }
+});
+window.addEventListener("resize", () => { drawTable(true); drawTimeline(); });
+window.addEventListener("beforeunload", e => { if (dirty) { e.preventDefault(); e.returnValue = ""; } });
+
+fetch("recording").then(r => r.json()).then(rec => { load(rec); status("Click, shift+click or ctrl+click events to select them"); })
+    .catch(err => status("Could not load: " + err, true));
+</script>
+</body>
+</html>
+`
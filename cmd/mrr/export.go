@@ -0,0 +1,91 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "math"
+    "strings"
+)
+
+// ------------------------------------------
+//     Script exporters
+// ------------------------------------------
+
+// ExportOptions tunes the scripts written by the exporters.
+type ExportOptions struct {
+    // Speed divides every delay, like --speed. Zero means 1.
+    Speed float64
+    // Coords is CoordsScreen or CoordsClient.
+    Coords string
+}
+
+// Coordinate modes for exported scripts.
+const (
+    // CoordsScreen keeps the recorded screen positions.
+    CoordsScreen = "screen"
+    // CoordsClient makes positions relative to the client area of the
+    // window the recording was made against.
+    CoordsClient = "client"
+)
+
+func parseCoords(s string) (string, error) {
+    switch c := strings.ToLower(s); c {
+    case CoordsScreen, CoordsClient:
+        return c, nil
+    }
+    return "", fmt.Errorf("unknown coordinate mode %q (want screen or client)", s)
+}
+
+// exportOrigin is subtracted from every position for opts.Coords.
+func exportOrigin(recording *Recording, opts ExportOptions) (x, y int32, err error) {
+    if opts.Coords != CoordsClient {
+        return 0, 0, nil
+    }
+    if recording.Metadata == nil || recording.Metadata.Window == nil {
+        return 0, 0, fmt.Errorf("the recording has no window to make positions relative to, export with screen coordinates")
+    }
+    client := recording.Metadata.Window.Client
+    return client.X, client.Y, nil
+}
+
+// exportClock turns record deltas into whole-millisecond sleeps at the
+// export speed, carrying the rounding over so long scripts don't drift.
+type exportClock struct {
+    speed   float64
+    target  float64
+    emitted int64
+}
+
+func newExportClock(speed float64) *exportClock {
+    if speed <= 0 {
+        speed = 1
+    }
+    return &exportClock{speed: speed}
+}
+
+// sleep returns how long to sleep before a record deltaMS after the last.
+func (c *exportClock) sleep(deltaMS int64) int64 {
+    c.target += float64(deltaMS) / c.speed
+    d := int64(math.Round(c.target)) - c.emitted
+    if d < 1 {
+        return 0
+    }
+    c.emitted += d
+    return d
+}
+
+// wheelDelta sign-extends a wheel record's Data, which holds the raw high
+// word of the hook's mouseData.
+func wheelDelta(data int32) int32 {
+    return int32(int16(uint16(data)))
+}
+
+// wheelClicks is how many notches a wheel delta scrolls.
+func wheelClicks(delta int32) int {
+    n := int(math.Abs(float64(delta)) / 120)
+    if n < 1 {
+        n = 1
+    }
+    return n
+}
@@ -0,0 +1,595 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Command-line flags
+// ------------------------------------------
+
+// parseArgs applies the flags in args and returns the remaining positional
+// arguments. Flags the running command doesn't take are an error, see
+// checkFlag; nothing is applied then.
+func parseArgs(args []string) ([]string, error) {
+    s := currentFlagSettings()
+    positional, err := parseFlags(&s, args, activeCommand, activeFlags)
+    if err != nil {
+        return nil, err
+    }
+    s.restore()
+    return positional, nil
+}
+
+// parseFlags parses the flags in args into s for command, which takes the
+// accepted groups of flags, and returns the remaining positional arguments.
+// It leaves the running settings alone.
+func parseFlags(s *flagSettings, args []string, command string, accepted flagGroup) ([]string, error) {
+    var positional []string
+    for i := 0; i < len(args); i++ {
+        if strings.HasPrefix(args[i], "--") {
+            if err := checkFlag(args[i], command, accepted); err != nil {
+                return nil, err
+            }
+        }
+        switch args[i] {
+        case "--debug":
+            s.debug = true
+        case "--json":
+            s.json = true
+        case "--compress":
+            s.compress = true
+        case "--backups":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--backups needs a count")
+            }
+            i++
+            n, err := strconv.Atoi(args[i])
+            if err != nil || n < 0 {
+                return nil, fmt.Errorf("invalid --backups count %q", args[i])
+            }
+            s.backups = n
+        case "--ignore-checksum":
+            s.ignoreChecksum = true
+        case "--encrypt":
+            s.encrypt = true
+        case "--key-file":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--key-file needs a path")
+            }
+            i++
+            s.keyFile = args[i]
+        case "--format":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--format needs json, binary, ndjson or csv")
+            }
+            i++
+            f, err := parseFormat(args[i])
+            if err != nil {
+                return nil, err
+            }
+            s.format = f
+        case "--device":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--device needs a device ID or name (see 'mrr devices'), or all")
+            }
+            i++
+            s.device = args[i]
+        case "--simplify":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--simplify needs a tolerance in pixels")
+            }
+            i++
+            v, err := strconv.ParseFloat(args[i], 64)
+            if err != nil || v < 0 {
+                return nil, fmt.Errorf("invalid --simplify tolerance %q", args[i])
+            }
+            s.simplify = v
+        case "--no-dpi-scale":
+            s.player.NoDPIScale = true
+        case "--speed":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--speed needs a multiplier like 2.0")
+            }
+            i++
+            v, err := strconv.ParseFloat(args[i], 64)
+            if err != nil || v <= 0 {
+                return nil, fmt.Errorf("invalid --speed multiplier %q", args[i])
+            }
+            s.player.Speed = v
+        case "--loop":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--loop needs a count or 'forever'")
+            }
+            i++
+            if args[i] == "forever" {
+                s.player.Loop = playback.LoopForever
+                break
+            }
+            n, err := strconv.Atoi(args[i])
+            if err != nil || n < 1 {
+                return nil, fmt.Errorf("invalid --loop count %q", args[i])
+            }
+            s.player.Loop = n
+        case "--loop-step":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--loop-step needs a delta like 0,24")
+            }
+            i++
+            pt, err := parsePoint(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --loop-step delta: %v", err)
+            }
+            s.player.LoopStep = pt
+        case "--loop-delay":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--loop-delay needs a duration like 500ms")
+            }
+            i++
+            d, err := time.ParseDuration(args[i])
+            if err != nil || d < 0 {
+                return nil, fmt.Errorf("invalid --loop-delay %q", args[i])
+            }
+            s.player.LoopDelay = d
+        case "--ramp", "--speed-map":
+            flag := args[i]
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("%s needs a value", flag)
+            }
+            i++
+            parse := parseRamp
+            if flag == "--speed-map" {
+                parse = parseSpeedMap
+            }
+            sp, err := parse(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid %s: %v", flag, err)
+            }
+            s.player.SpeedProfile = sp
+        case "--countdown":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--countdown needs a duration like 3s")
+            }
+            i++
+            d, err := time.ParseDuration(args[i])
+            if n, aerr := strconv.Atoi(args[i]); aerr == nil {
+                d, err = time.Duration(n)*time.Second, nil
+            }
+            if err != nil || d < 0 {
+                return nil, fmt.Errorf("invalid --countdown %q", args[i])
+            }
+            s.player.Countdown = d
+        case "--interpolate":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--interpolate needs a rate in moves per second")
+            }
+            i++
+            v, err := strconv.ParseFloat(args[i], 64)
+            if err != nil || v <= 0 {
+                return nil, fmt.Errorf("invalid --interpolate rate %q", args[i])
+            }
+            s.player.InterpolateHz = v
+        case "--humanize":
+            s.player.Humanize = playback.HumanizeOptions{TimingJitter: 0.15, Curve: 0.2}
+        case "--humanize-jitter", "--humanize-curve":
+            flag := args[i]
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("%s needs a fraction like 0.2", flag)
+            }
+            i++
+            v, err := strconv.ParseFloat(args[i], 64)
+            if err != nil || v < 0 || v > 1 {
+                return nil, fmt.Errorf("invalid %s value %q", flag, args[i])
+            }
+            if flag == "--humanize-jitter" {
+                s.player.Humanize.TimingJitter = v
+            } else {
+                s.player.Humanize.Curve = v
+            }
+        case "--delay-jitter":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--delay-jitter needs a percentage like 20%%")
+            }
+            i++
+            v, err := strconv.ParseFloat(strings.TrimSuffix(args[i], "%"), 64)
+            if err != nil || v < 0 || v > 100 {
+                return nil, fmt.Errorf("invalid --delay-jitter %q", args[i])
+            }
+            s.player.Delays = playback.DelayRange{Percent: v}
+        case "--delay-range":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--delay-range needs min:max in milliseconds")
+            }
+            i++
+            parts := strings.Split(args[i], ":")
+            if len(parts) != 2 {
+                return nil, fmt.Errorf("invalid --delay-range %q, want min:max in milliseconds", args[i])
+            }
+            lo, err1 := strconv.Atoi(parts[0])
+            hi, err2 := strconv.Atoi(parts[1])
+            if err1 != nil || err2 != nil || lo < 0 || hi < lo || hi == 0 {
+                return nil, fmt.Errorf("invalid --delay-range %q, want min:max in milliseconds", args[i])
+            }
+            s.player.Delays = playback.DelayRange{
+                Min: time.Duration(lo) * time.Millisecond,
+                Max: time.Duration(hi) * time.Millisecond,
+            }
+        case "--seed":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--seed needs a number")
+            }
+            i++
+            v, err := strconv.ParseInt(args[i], 10, 64)
+            if err != nil {
+                return nil, fmt.Errorf("invalid --seed %q", args[i])
+            }
+            s.player.Seed = v
+        case "--rescale":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--rescale needs fit, stretch or none")
+            }
+            i++
+            mode, err := parseRescaleMode(args[i])
+            if err != nil {
+                return nil, err
+            }
+            s.player.Rescale = mode
+        case "--anchor":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--anchor needs a position like center or topleft")
+            }
+            i++
+            anchor, err := parseAnchor(args[i])
+            if err != nil {
+                return nil, err
+            }
+            s.player.Anchor = anchor
+        case "--from", "--to":
+            flag := args[i]
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("%s needs a time like 00:10", flag)
+            }
+            i++
+            d, err := parseClock(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid %s time: %v", flag, err)
+            }
+            if flag == "--from" {
+                s.player.Slice.From = d
+            } else {
+                s.player.Slice.To = d
+            }
+        case "--events":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--events needs a range like 100:250")
+            }
+            i++
+            first, last, err := parseIndexRange(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --events range: %v", err)
+            }
+            s.player.Slice.First, s.player.Slice.Last = first, last
+        case "--no-failsafe":
+            s.player.NoFailsafe = true
+        case "--mirror":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--mirror needs h, v or hv")
+            }
+            i++
+            axis := s.player.Mirror.Axis
+            m, err := parseMirror(args[i])
+            if err != nil {
+                return nil, err
+            }
+            s.player.Mirror = m
+            s.player.Mirror.Axis = axis
+        case "--mirror-axis":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--mirror-axis needs a position like 960,540")
+            }
+            i++
+            pt, err := parsePoint(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --mirror-axis position: %v", err)
+            }
+            s.player.Mirror.Axis = &pt
+        case "--offset":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--offset needs a delta like 12,-30")
+            }
+            i++
+            pt, err := parsePoint(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --offset delta: %v", err)
+            }
+            s.player.Offset = pt
+        case "--verify":
+            if !s.player.Verify {
+                s.player.Verify = true
+                s.player.VerifyTolerance = 1
+            }
+        case "--verify-tolerance":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--verify-tolerance needs a number of pixels")
+            }
+            i++
+            v, err := strconv.Atoi(args[i])
+            if err != nil || v < 0 {
+                return nil, fmt.Errorf("invalid --verify-tolerance %q", args[i])
+            }
+            s.player.Verify = true
+            s.player.VerifyTolerance = int32(v)
+        case "--step":
+            s.player.Step = true
+        case "--backend":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--backend needs one of %s", backendNames())
+            }
+            i++
+            name, err := parseBackend(args[i])
+            if err != nil {
+                return nil, err
+            }
+            s.player.Backend = name
+        case "--block-input":
+            s.player.BlockInput = true
+        case "--teleport":
+            s.player.Teleport = true
+        case "--resume":
+            s.player.Resume = true
+        case "--progress":
+            s.player.ShowProgress = true
+        case "--dry-run":
+            s.player.DryRun = true
+        case "--reverse":
+            s.player.Reverse = true
+        case "--playlist":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--playlist needs a %s file", playlistExt)
+            }
+            i++
+            if !isPlaylistFile(args[i]) {
+                return nil, fmt.Errorf("playlist %q must end in %s", args[i], playlistExt)
+            }
+            s.playlist = args[i]
+        case "--library":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--library needs a folder")
+            }
+            i++
+            s.library = args[i]
+        case "--config":
+            // Read before parsing, see withConfig.
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--config needs a file")
+            }
+            i++
+        case "--data-dir":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--data-dir needs a folder")
+            }
+            i++
+            s.data = args[i]
+        case "--output":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--output needs a file")
+            }
+            i++
+            s.output = args[i]
+        case "--lang":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--lang needs a language such as de, or auto")
+            }
+            i++
+            lang, err := parseLang(args[i])
+            if err != nil {
+                return nil, err
+            }
+            s.lang = lang
+        case "--profile":
+            // The profile's settings come from withConfig.
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--profile needs a profile name from the config")
+            }
+            i++
+            s.profile = args[i]
+        case "--save-as":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--save-as needs a recording name")
+            }
+            i++
+            if filepath.Base(args[i]) != args[i] {
+                return nil, fmt.Errorf("--save-as takes a name, not a path: %q", args[i])
+            }
+            s.saveAs = args[i]
+        case "--hotkey":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--hotkey needs action=keys, e.g. record=ctrl+f9")
+            }
+            i++
+            keys, err := parseHotkeyFlag(s.hotkeys, args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --hotkey: %v", err)
+            }
+            s.hotkeys = keys
+        case "--tray":
+            s.tray = true
+        case "--notify":
+            s.notify = true
+        case "--update-url":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--update-url needs a URL")
+            }
+            i++
+            s.updateURL = args[i]
+        case "--result-json":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--result-json needs a file name")
+            }
+            i++
+            s.resultJSON = args[i]
+        case "--log-format":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--log-format needs text or json")
+            }
+            i++
+            if args[i] != "text" && args[i] != "json" {
+                return nil, fmt.Errorf("invalid --log-format %q (use text or json)", args[i])
+            }
+            s.logFormat = args[i]
+        case "--log-file":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--log-file needs a file name")
+            }
+            i++
+            s.logFile = args[i]
+        case "--log-max-size":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--log-max-size needs a size such as 10MB")
+            }
+            i++
+            n, err := parseSize(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --log-max-size: %v", err)
+            }
+            s.logMaxSize = n
+        case "--log-rotate":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--log-rotate needs daily, hourly or size")
+            }
+            i++
+            switch args[i] {
+            case "daily", "hourly":
+                s.logRotate = args[i]
+            case "size":
+                s.logRotate = ""
+            default:
+                return nil, fmt.Errorf("invalid --log-rotate %q (use daily, hourly or size)", args[i])
+            }
+        case "--log-keep":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--log-keep needs a count")
+            }
+            i++
+            n, err := strconv.Atoi(args[i])
+            if err != nil || n < 0 {
+                return nil, fmt.Errorf("invalid --log-keep count %q", args[i])
+            }
+            s.logKeep = n
+        case "--schedule":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--schedule needs a schedule file")
+            }
+            i++
+            s.schedule = args[i]
+        case "--target-window":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--target-window needs a window title")
+            }
+            i++
+            s.player.TargetWindow = args[i]
+        case "--background-window":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--background-window needs a window title")
+            }
+            i++
+            s.player.BackgroundWindow = args[i]
+        case "--foreground":
+            s.player.Foreground = true
+        case "--restore-cursor":
+            s.player.CursorEnd = playback.CursorRestore
+        case "--park":
+            if i+1 >= len(args) {
+                return nil, fmt.Errorf("--park needs a position like 100,200")
+            }
+            i++
+            pt, err := parsePoint(args[i])
+            if err != nil {
+                return nil, fmt.Errorf("invalid --park position: %v", err)
+            }
+            s.player.CursorEnd = playback.CursorPark
+            s.player.Park = pt
+        default:
+            positional = append(positional, args[i])
+        }
+    }
+    return positional, nil
+}
+
+// parseClock parses a position on the recorded timeline: "mm:ss",
+// "hh:mm:ss" (seconds may be fractional), plain seconds, or a Go duration
+// such as "1m30s".
+func parseClock(s string) (time.Duration, error) {
+    if d, err := time.ParseDuration(s); err == nil {
+        return d, nil
+    }
+
+    parts := strings.Split(s, ":")
+    if len(parts) > 3 {
+        return 0, fmt.Errorf("expected [hh:]mm:ss but got %q", s)
+    }
+    var total float64
+    for _, part := range parts {
+        v, err := strconv.ParseFloat(part, 64)
+        if err != nil || v < 0 {
+            return 0, fmt.Errorf("expected [hh:]mm:ss but got %q", s)
+        }
+        total = total*60 + v
+    }
+    return time.Duration(total * float64(time.Second)), nil
+}
+
+// parseIndexRange parses "first:last" where either side may be empty.
+func parseIndexRange(s string) (int, int, error) {
+    parts := strings.Split(s, ":")
+    if len(parts) != 2 {
+        return 0, 0, fmt.Errorf("expected first:last but got %q", s)
+    }
+    bound := func(part string) (int, error) {
+        if part == "" {
+            return 0, nil
+        }
+        n, err := strconv.Atoi(part)
+        if err != nil || n < 0 {
+            return 0, fmt.Errorf("invalid index %q", part)
+        }
+        return n, nil
+    }
+    first, err := bound(parts[0])
+    if err != nil {
+        return 0, 0, err
+    }
+    last, err := bound(parts[1])
+    if err != nil {
+        return 0, 0, err
+    }
+    if last != 0 && last <= first {
+        return 0, 0, fmt.Errorf("range %q is empty", s)
+    }
+    return first, last, nil
+}
+
+// parsePoint parses "x,y" into a POINT.
+func parsePoint(s string) (POINT, error) {
+    parts := strings.Split(s, ",")
+    if len(parts) != 2 {
+        return POINT{}, fmt.Errorf("expected x,y but got %q", s)
+    }
+    x, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 32)
+    if err != nil {
+        return POINT{}, err
+    }
+    y, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 32)
+    if err != nil {
+        return POINT{}, err
+    }
+    return POINT{X: int32(x), Y: int32(y)}, nil
+}
@@ -0,0 +1,421 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Hotkeys
+// ------------------------------------------
+
+// Every hotkey can be moved with --hotkey action=keys, e.g.
+// --hotkey record=ctrl+shift+r. Keys are named as in keyNames, or given as
+// a virtual-key code such as 0x2D. A hotkey with modifiers fires only with
+// exactly those modifiers held; one without fires only with none held.
+
+type hotkeyAction int
+
+const (
+    actionNone hotkeyAction = iota
+    actionRecord
+    actionReplay
+    actionClear
+    actionAbort
+    actionPause
+    actionStep
+    actionFaster
+    actionSlower
+    actionResetSpeed
+    actionCycleSpeed
+    actionCheck
+    actionReload
+)
+
+// hotkeyActionNames name the actions for --hotkey.
+var hotkeyActionNames = map[string]hotkeyAction{
+    "record":      actionRecord,
+    "replay":      actionReplay,
+    "clear":       actionClear,
+    "abort":       actionAbort,
+    "pause":       actionPause,
+    "step":        actionStep,
+    "faster":      actionFaster,
+    "slower":      actionSlower,
+    "reset-speed": actionResetSpeed,
+    "cycle-speed": actionCycleSpeed,
+    "check":       actionCheck,
+    "reload":      actionReload,
+}
+
+// modifier bits of a hotkey.
+const (
+    modCtrl = 1 << iota
+    modAlt
+    modShift
+    modWin
+)
+
+// hotkey is a key with the modifiers that must be held with it.
+type hotkey struct {
+    VK   uint16
+    Mods int
+}
+
+// hotkeys are the keys bound to each action. The keyboard hook reads them
+// while a reload may be replacing them, hence hotkeysMu.
+var (
+    hotkeysMu sync.RWMutex
+    hotkeys   = map[hotkeyAction]hotkey{
+        actionRecord:     {VK: VK_INSERT},
+        actionReplay:     {VK: VK_END},
+        actionClear:      {VK: VK_DELETE},
+        actionAbort:      {VK: VK_ESCAPE},
+        actionPause:      {VK: VK_PAUSE},
+        actionStep:       {VK: VK_NEXT},
+        actionFaster:     {VK: VK_ADD},
+        actionSlower:     {VK: VK_SUBTRACT},
+        actionResetSpeed: {VK: VK_MULTIPLY},
+        actionCycleSpeed: {VK: VK_HOME},
+        actionCheck:      {VK: VK_F8},
+        actionReload:     {VK: 'R', Mods: modCtrl | modAlt},
+    }
+)
+
+// modifierKeys are the virtual keys behind each modifier bit.
+var modifierKeys = []struct {
+    mod  int
+    name string
+    vks  []uint16
+}{
+    {modCtrl, "ctrl", []uint16{0x11, 0xA2, 0xA3}},
+    {modAlt, "alt", []uint16{0x12, 0xA4, 0xA5}},
+    {modShift, "shift", []uint16{0x10, 0xA0, 0xA1}},
+    {modWin, "win", []uint16{0x5B, 0x5C}},
+}
+
+// parseHotkey parses keys such as "ctrl+shift+f9", "end" or "0x23".
+func parseHotkey(s string) (hotkey, error) {
+    var h hotkey
+    parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "+")
+    for i, p := range parts {
+        p = strings.TrimSpace(p)
+        if i < len(parts)-1 {
+            found := false
+            for _, m := range modifierKeys {
+                if p == m.name || p == "control" && m.mod == modCtrl {
+                    h.Mods |= m.mod
+                    found = true
+                }
+            }
+            if !found {
+                return h, fmt.Errorf("unknown modifier %q in %q (use ctrl, alt, shift or win)", p, s)
+            }
+            continue
+        }
+        if strings.HasPrefix(p, "0x") {
+            vk, err := strconv.ParseUint(p[2:], 16, 8)
+            if err != nil || vk == 0 {
+                return h, fmt.Errorf("invalid virtual-key code %q", p)
+            }
+            h.VK = uint16(vk)
+            continue
+        }
+        vk, err := vkForName(p)
+        if err != nil {
+            return h, err
+        }
+        h.VK = vk
+    }
+    return h, nil
+}
+
+// keyName is the name the banner shows for vk.
+func keyName(vk uint16) string {
+    switch {
+    case vk >= 0x70 && vk <= 0x87:
+        return fmt.Sprintf("F%d", vk-0x70+1)
+    case vk >= '0' && vk <= '9', vk >= 'A' && vk <= 'Z':
+        return string(rune(vk))
+    }
+    // The longest name is the least cryptic; numpad names only for keys
+    // on the numpad.
+    best := ""
+    for name, v := range keyNames {
+        if v != vk || strings.HasPrefix(name, "numpad") && (vk < 0x60 || vk > 0x6F) {
+            continue
+        }
+        if len(name) > len(best) || len(name) == len(best) && name < best {
+            best = name
+        }
+    }
+    if best == "" {
+        return fmt.Sprintf("0x%02X", vk)
+    }
+    return strings.ToUpper(best)
+}
+
+func (h hotkey) String() string {
+    if h.Mods == 0 {
+        return keyName(h.VK)
+    }
+    return modifierNames(h.Mods) + "+" + keyName(h.VK)
+}
+
+// hotkeyName is what the banner calls action's key.
+func hotkeyName(action hotkeyAction) string {
+    return hotkeyOf(action).String()
+}
+
+func hotkeyOf(action hotkeyAction) hotkey {
+    hotkeysMu.RLock()
+    defer hotkeysMu.RUnlock()
+    return hotkeys[action]
+}
+
+func copyHotkeys() map[hotkeyAction]hotkey {
+    hotkeysMu.RLock()
+    defer hotkeysMu.RUnlock()
+    m := make(map[hotkeyAction]hotkey, len(hotkeys))
+    for a, h := range hotkeys {
+        m[a] = h
+    }
+    return m
+}
+
+func setHotkeys(m map[hotkeyAction]hotkey) {
+    hotkeysMu.Lock()
+    hotkeys = m
+    hotkeysMu.Unlock()
+}
+
+// parseHotkeyFlag returns keys with a --hotkey value applied: action=keys,
+// several separated by commas. keys itself is left alone.
+func parseHotkeyFlag(keys map[hotkeyAction]hotkey, s string) (map[hotkeyAction]hotkey, error) {
+    m := make(map[hotkeyAction]hotkey, len(keys))
+    for a, h := range keys {
+        m[a] = h
+    }
+    for _, binding := range strings.Split(s, ",") {
+        kv := strings.SplitN(binding, "=", 2)
+        if len(kv) != 2 {
+            return nil, fmt.Errorf("expected action=keys but got %q", binding)
+        }
+        name := strings.ToLower(strings.TrimSpace(kv[0]))
+        action, ok := hotkeyActionNames[name]
+        if !ok {
+            names := make([]string, 0, len(hotkeyActionNames))
+            for n := range hotkeyActionNames {
+                names = append(names, n)
+            }
+            sort.Strings(names)
+            return nil, fmt.Errorf("unknown hotkey action %q%s", name, suggest(name, names))
+        }
+        h, err := parseHotkey(kv[1])
+        if err != nil {
+            return nil, err
+        }
+        for other, oh := range m {
+            if other != action && oh == h {
+                return nil, fmt.Errorf("%s is already the %s hotkey", h, actionName(other))
+            }
+        }
+        m[action] = h
+    }
+    return m, nil
+}
+
+func actionName(action hotkeyAction) string {
+    for name, a := range hotkeyActionNames {
+        if a == action {
+            return name
+        }
+    }
+    return "unknown"
+}
+
+// The keyboard hook keeps its own record of the modifiers pressed on the
+// keyboard, as GetAsyncKeyState also counts the ones a replay holds down and
+// misses the ones swallowed while input is blocked. A modifier counts as
+// held while the hook saw it go down and not up, and, unless input is
+// blocked, GetAsyncKeyState agrees, so a release the hook missed (Win+L, a
+// UAC prompt) doesn't leave it stuck.
+
+// pressedModKeys has a bit for each key of modifierKeys the hook saw go
+// down. Only the hook writes it.
+var pressedModKeys atomic.Uint32
+
+// modKeyBit returns vk's bit in pressedModKeys, 0 if it's no modifier.
+func modKeyBit(vk uint16) uint32 {
+    bit := uint32(1)
+    for _, m := range modifierKeys {
+        for _, k := range m.vks {
+            if k == vk {
+                return bit
+            }
+            bit <<= 1
+        }
+    }
+    return 0
+}
+
+// trackModifier notes a modifier going down or up on the keyboard. The
+// keyboard hook calls it for every key event that isn't injected.
+func trackModifier(wparam uintptr, vk uint32) {
+    bit := modKeyBit(uint16(vk))
+    if bit == 0 {
+        return
+    }
+    switch wparam {
+    case WM_KEYDOWN, WM_SYSKEYDOWN:
+        pressedModKeys.Store(pressedModKeys.Load() | bit)
+    case WM_KEYUP, WM_SYSKEYUP:
+        pressedModKeys.Store(pressedModKeys.Load() &^ bit)
+    }
+}
+
+// heldModifiers returns the modifiers held now on the keyboard, leaving out
+// the one vk itself is, so a modifier can be a hotkey of its own.
+func heldModifiers(vk uint16) int {
+    pressed := pressedModKeys.Load()
+    blocked := inputBlocked.Load()
+    mods := 0
+    for _, m := range modifierKeys {
+        own := false
+        for _, k := range m.vks {
+            own = own || k == vk
+        }
+        if own {
+            continue
+        }
+        for _, k := range m.vks {
+            if pressed&modKeyBit(k) == 0 {
+                continue
+            }
+            if state, _, _ := procGetAsyncKeyState.Call(uintptr(k)); blocked || state&0x8000 != 0 {
+                mods |= m.mod
+                break
+            }
+        }
+    }
+    return mods
+}
+
+// VK_MASK_KEY is a virtual key no keyboard has.
+const VK_MASK_KEY = 0xE8
+
+// chordKeyDown is the key of the chord hotkey the hook swallowed last, whose
+// key up it swallows too. Only the hook uses it.
+var chordKeyDown uint32
+
+// swallowChord is called by the keyboard hook as it swallows the key of a
+// chord hotkey. The modifiers still reach the application, and an Alt or Win
+// that goes down and up with nothing in between would open the menu bar or
+// the Start menu, so an unassigned key is typed in between.
+func swallowChord(vk uint32, mods int) {
+    chordKeyDown = vk
+    if mods&(modAlt|modWin) == 0 {
+        return
+    }
+    playback.TapKey(VK_MASK_KEY)
+}
+
+// modifierNames names mods, e.g. "CTRL+SHIFT".
+func modifierNames(mods int) string {
+    var parts []string
+    for _, m := range modifierKeys {
+        if mods&m.mod != 0 {
+            parts = append(parts, strings.ToUpper(m.name))
+        }
+    }
+    return strings.Join(parts, "+")
+}
+
+// waitModifiersReleased waits until no modifier is held on the keyboard, so
+// a replay started with a chord such as Ctrl+Shift+P doesn't replay its
+// clicks as Ctrl+Shift clicks. It returns early when ctx is done.
+func waitModifiersReleased(ctx context.Context) {
+    start := time.Now()
+    told := false
+    for {
+        mods := heldModifiers(0)
+        if mods == 0 {
+            return
+        }
+        if !told && time.Since(start) > time.Second {
+            fmt.Println("[INFO]", msgf("Waiting for %s to be released before replaying", modifierNames(mods)))
+            told = true
+        }
+        if sleepContext(ctx, 10*time.Millisecond) != nil {
+            return
+        }
+    }
+}
+
+// hotkeyFor returns the action bound to vk with the modifiers held now.
+func hotkeyFor(vk uint32) hotkeyAction {
+    hotkeysMu.RLock()
+    defer hotkeysMu.RUnlock()
+    mods := -1
+    for action, h := range hotkeys {
+        if uint32(h.VK) != vk {
+            continue
+        }
+        if mods < 0 {
+            mods = heldModifiers(h.VK)
+        }
+        if h.Mods == mods {
+            return action
+        }
+    }
+    return actionNone
+}
+
+// speedPresets are the speeds the Home hotkey cycles through.
+var speedPresets = []float64{0.5, 1, 2, 3, 5}
+
+// nextSpeedPreset returns the preset after speed, wrapping around.
+func nextSpeedPreset(speed float64) float64 {
+    for _, preset := range speedPresets {
+        if preset > speed {
+            return preset
+        }
+    }
+    return speedPresets[0]
+}
+
+// Limits and step of the numpad speed hotkeys.
+const (
+    minSpeed  = 0.1
+    maxSpeed  = 20
+    speedStep = 1.25
+)
+
+// adjustSpeed returns the speed after numpad + (faster), - (slower) or *
+// (back to the --speed value).
+func adjustSpeed(speed float64, action hotkeyAction) float64 {
+    switch action {
+    case actionFaster:
+        speed *= speedStep
+    case actionSlower:
+        speed /= speedStep
+    case actionResetSpeed:
+        speed = playerOpts.Speed
+        if speed <= 0 {
+            speed = 1
+        }
+    }
+    speed = math.Round(speed*100) / 100
+    return math.Max(minSpeed, math.Min(maxSpeed, speed))
+}
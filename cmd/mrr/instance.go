@@ -0,0 +1,185 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "time"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     One instance at a time
+// ------------------------------------------
+
+// Two MRRs with hooks installed would both act on every hotkey and write
+// the same recordings. The commands that install hooks (hook, agent,
+// record, tui and shell) hold a named mutex while they run, and the next
+// one refuses to start. 'mrr play' and 'mrr record' hand their work to the
+// running instance over the control pipe instead, so double-clicking a
+// recording or a script's 'mrr play' still works while the agent runs.
+
+const (
+    instanceMutexName = `Local\mrr-instance`
+
+    ERROR_ALREADY_EXISTS = 183
+    SYNCHRONIZE          = 0x00100000
+)
+
+var (
+    procCreateMutexW = kernel32.MustFindProc("CreateMutexW")
+    procOpenMutexW   = kernel32.MustFindProc("OpenMutexW")
+)
+
+// claimInstance makes this process the running MRR until release is
+// called or it exits. ok is false when another MRR already is.
+func claimInstance() (release func(), ok bool) {
+    name, _ := syscall.UTF16PtrFromString(instanceMutexName)
+    h, _, err := procCreateMutexW.Call(0, 0, uintptr(unsafe.Pointer(name)))
+    if h == 0 {
+        // Not knowing is no reason not to start.
+        debugPrintln("[DEBUG] CreateMutexW failed:", err)
+        return func() {}, true
+    }
+    if err == syscall.Errno(ERROR_ALREADY_EXISTS) {
+        syscall.CloseHandle(syscall.Handle(h))
+        return nil, false
+    }
+    return func() { syscall.CloseHandle(syscall.Handle(h)) }, true
+}
+
+// instanceRunning tells whether another MRR holds the instance mutex.
+func instanceRunning() bool {
+    name, _ := syscall.UTF16PtrFromString(instanceMutexName)
+    h, _, _ := procOpenMutexW.Call(SYNCHRONIZE, 0, uintptr(unsafe.Pointer(name)))
+    if h == 0 {
+        return false
+    }
+    syscall.CloseHandle(syscall.Handle(h))
+    return true
+}
+
+// alreadyRunning says that another MRR runs and returns the exit code for
+// it.
+func alreadyRunning() int {
+    fmt.Println("[ERROR]", msg("MRR is already running; two instances would fight over the hotkeys and the recordings."))
+    printWrapped(msg("Drive it with 'mrr ctl' or 'mrr play <file>', or stop it with 'mrr ctl quit' and try again."))
+    return exitRunning
+}
+
+// unreachableInstance says that the running MRR takes no commands, being
+// 'mrr record', 'mrr tui' or 'mrr shell', and returns the exit code.
+func unreachableInstance(err error) int {
+    fmt.Println("[ERROR]", msg("MRR is already running, but can't take commands:"), err)
+    printWrapped(msg("Only 'mrr hook' and the agent take commands; stop the 'mrr record', 'mrr tui' or 'mrr shell' running and try again."))
+    return exitRunning
+}
+
+// forwardPlay has the running MRR replay file with the command line's
+// replay flags, waits for it and returns the exit code 'mrr play' would.
+// The running MRR uses its own config; file is made absolute, as it may run
+// in another folder.
+func forwardPlay(file string) int {
+    abs := file
+    if _, err := os.Stat(file); err == nil {
+        abs, _ = filepath.Abs(file)
+    }
+    args := append([]string(nil), cliArgs...)
+    replaced := false
+    for i := len(args) - 1; i >= 0 && !replaced; i-- {
+        if args[i] == file {
+            args[i], replaced = abs, true
+        }
+    }
+    if !replaced {
+        args = append(args, abs)
+    }
+
+    fmt.Println("[INFO]", msgf("Replaying %s in the MRR that is already running", displayName(abs)))
+    h, err := openControlPipe()
+    if err != nil {
+        return unreachableInstance(err)
+    }
+    defer syscall.CloseHandle(h)
+    reply, err := exchangeReplayControl(h, "play "+quoteCommandLine(args))
+    if err != nil {
+        return unreachableInstance(err)
+    }
+    if body := strings.TrimPrefix(reply, "ok: "); body != reply {
+        var result ReplayResult
+        if json.Unmarshal([]byte(body), &result) == nil {
+            printPlayResult(&result)
+        }
+        return exitOK
+    }
+
+    // Failures are "error: <exit status>: <result or message>".
+    code, detail := exitReplayFailed, strings.TrimPrefix(reply, "error: ")
+    if i := strings.Index(detail, ": "); i > 0 {
+        for c, status := range exitStatus {
+            if status == detail[:i] {
+                code, detail = c, detail[i+2:]
+            }
+        }
+    }
+    var result ReplayResult
+    if json.Unmarshal([]byte(detail), &result) != nil {
+        fmt.Println("[ERROR]", detail)
+        return code
+    }
+    printPlayResult(&result)
+    if code == exitAborted {
+        fmt.Println("[INFO]", msg("Replay aborted:"), result.Error)
+    } else {
+        fmt.Println("[ERROR]", msg("Replay failed:"), result.Error)
+    }
+    return code
+}
+
+// forwardRecord has the running MRR record until Ctrl+C is pressed here,
+// duration is up or it is stopped there, and returns the exit code 'mrr
+// record' would. The recording is saved where the running MRR saves.
+func forwardRecord(duration time.Duration) int {
+    reply, err := controlRequest("record-start")
+    if err != nil {
+        return unreachableInstance(err)
+    }
+    if !strings.HasPrefix(reply, "ok") {
+        fmt.Println("[ERROR]", strings.TrimPrefix(reply, "error: "))
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msg("Recording in the MRR that is already running; press Ctrl+C here or its record hotkey to stop"))
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    if duration > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, duration)
+        defer cancel()
+    }
+    for sleepContext(ctx, 250*time.Millisecond) == nil {
+        if reply, err := controlRequest("status"); err != nil || reply != "ok: recording" {
+            fmt.Println("[INFO]", msg("The running MRR stopped the recording and saved it"))
+            return exitOK
+        }
+    }
+
+    reply, err = controlRequest("record-stop")
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not reach a running MRR instance:"), err)
+        return exitReplayFailed
+    }
+    if path := strings.TrimPrefix(reply, "ok: recording saved to "); path != reply {
+        fmt.Println("[INFO]", msgf("Saved recording to %s", displayName(path)))
+        return exitOK
+    }
+    fmt.Println("[ERROR]", strings.TrimPrefix(reply, "error: "))
+    return exitReplayFailed
+}
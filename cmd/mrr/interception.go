@@ -0,0 +1,233 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "sync"
+    "syscall"
+    "time"
+    "unsafe"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/hook"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Interception driver backend
+// ------------------------------------------
+
+// The Interception driver (https://github.com/oblitum/Interception) injects
+// input below the Win32 input stack, as if it came from the device, for
+// software that ignores SendInput. It needs the driver installed and
+// interception.dll next to mrr.exe or on the PATH.
+var (
+    interceptionDLL                = syscall.NewLazyDLL("interception.dll")
+    procInterceptionCreateContext  = interceptionDLL.NewProc("interception_create_context")
+    procInterceptionDestroyContext = interceptionDLL.NewProc("interception_destroy_context")
+    procInterceptionSend           = interceptionDLL.NewProc("interception_send")
+)
+
+const (
+    // Devices 1-10 are keyboards, 11-20 mice; strokes go to the first.
+    interceptionKeyboard = 1
+    interceptionMouse    = 11
+
+    INTERCEPTION_MOUSE_LEFT_BUTTON_DOWN   = 0x001
+    INTERCEPTION_MOUSE_LEFT_BUTTON_UP     = 0x002
+    INTERCEPTION_MOUSE_RIGHT_BUTTON_DOWN  = 0x004
+    INTERCEPTION_MOUSE_RIGHT_BUTTON_UP    = 0x008
+    INTERCEPTION_MOUSE_MIDDLE_BUTTON_DOWN = 0x010
+    INTERCEPTION_MOUSE_MIDDLE_BUTTON_UP   = 0x020
+    INTERCEPTION_MOUSE_BUTTON_4_DOWN      = 0x040
+    INTERCEPTION_MOUSE_BUTTON_4_UP        = 0x080
+    INTERCEPTION_MOUSE_BUTTON_5_DOWN      = 0x100
+    INTERCEPTION_MOUSE_BUTTON_5_UP        = 0x200
+    INTERCEPTION_MOUSE_WHEEL              = 0x400
+    INTERCEPTION_MOUSE_HWHEEL             = 0x800
+
+    INTERCEPTION_MOUSE_MOVE_ABSOLUTE   = 0x001
+    INTERCEPTION_MOUSE_VIRTUAL_DESKTOP = 0x002
+
+    INTERCEPTION_KEY_UP = 0x01
+    INTERCEPTION_KEY_E0 = 0x02
+)
+
+// InterceptionMouseStroke is the driver's mouse stroke. Keyboard strokes
+// share the buffer: code, state, information.
+type InterceptionMouseStroke struct {
+    State       uint16
+    Flags       uint16
+    Rolling     int16
+    X           int32
+    Y           int32
+    Information uint32
+}
+
+type InterceptionKeyStroke struct {
+    Code        uint16
+    State       uint16
+    Information uint32
+    _           [unsafe.Sizeof(InterceptionMouseStroke{}) - 8]byte
+}
+
+var interceptionMouseStates = map[string]uint16{
+    "LeftButtonDown":   INTERCEPTION_MOUSE_LEFT_BUTTON_DOWN,
+    "LeftButtonUp":     INTERCEPTION_MOUSE_LEFT_BUTTON_UP,
+    "RightButtonDown":  INTERCEPTION_MOUSE_RIGHT_BUTTON_DOWN,
+    "RightButtonUp":    INTERCEPTION_MOUSE_RIGHT_BUTTON_UP,
+    "MiddleButtonDown": INTERCEPTION_MOUSE_MIDDLE_BUTTON_DOWN,
+    "MiddleButtonUp":   INTERCEPTION_MOUSE_MIDDLE_BUTTON_UP,
+    "Mouse4Down":       INTERCEPTION_MOUSE_BUTTON_4_DOWN,
+    "Mouse4Up":         INTERCEPTION_MOUSE_BUTTON_4_UP,
+    "Mouse5Down":       INTERCEPTION_MOUSE_BUTTON_5_DOWN,
+    "Mouse5Up":         INTERCEPTION_MOUSE_BUTTON_5_UP,
+    "MouseWheel":       INTERCEPTION_MOUSE_WHEEL,
+    "MouseHWheel":      INTERCEPTION_MOUSE_HWHEEL,
+}
+
+// Strokes the driver sends reach the low-level hooks like the user's own,
+// without being marked injected, so the hooks ask
+// driverInjectedKey and driverInjectedMouse whether an event is one of
+// them. Keys are matched one by one; mouse events count as the driver's
+// for driverStrokeTimeout after a mouse stroke, as their position and
+// split into move and button events aren't the stroke's.
+var driverStrokes struct {
+    mu         sync.Mutex
+    keys       []driverKey
+    mouseUntil time.Time
+}
+
+// driverKey is a key stroke sent through the driver, not yet seen by the
+// keyboard hook.
+type driverKey struct {
+    scan     uint16
+    up       bool
+    extended bool
+    expires  time.Time
+}
+
+// driverStrokeTimeout is how long a stroke may take to reach the hooks.
+const driverStrokeTimeout = 250 * time.Millisecond
+
+func noteDriverKey(scan uint16, up, extended bool) {
+    driverStrokes.mu.Lock()
+    defer driverStrokes.mu.Unlock()
+    driverStrokes.keys = append(driverStrokes.keys, driverKey{
+        scan:     scan,
+        up:       up,
+        extended: extended,
+        expires:  time.Now().Add(driverStrokeTimeout),
+    })
+}
+
+func noteDriverMouse() {
+    driverStrokes.mu.Lock()
+    driverStrokes.mouseUntil = time.Now().Add(driverStrokeTimeout)
+    driverStrokes.mu.Unlock()
+}
+
+// driverInjectedKey reports whether ev is a key stroke the driver sent,
+// which it then forgets.
+func driverInjectedKey(ev hook.Event) bool {
+    driverStrokes.mu.Lock()
+    defer driverStrokes.mu.Unlock()
+    now := time.Now()
+    keys := driverStrokes.keys[:0]
+    found := false
+    up := ev.Message == WM_KEYUP || ev.Message == WM_SYSKEYUP
+    for _, k := range driverStrokes.keys {
+        if now.After(k.expires) {
+            continue
+        }
+        if !found && k.scan == ev.Scan && k.up == up && k.extended == ev.Extended {
+            found = true
+            continue
+        }
+        keys = append(keys, k)
+    }
+    driverStrokes.keys = keys
+    return found
+}
+
+// driverInjectedMouse reports whether a mouse event may be the driver's.
+func driverInjectedMouse() bool {
+    driverStrokes.mu.Lock()
+    defer driverStrokes.mu.Unlock()
+    return time.Now().Before(driverStrokes.mouseUntil)
+}
+
+// interceptionInjector sends records through the Interception driver.
+// Text records have no device equivalent and still go through SendInput.
+type interceptionInjector struct {
+    ctx uintptr
+}
+
+func newInterceptionInjector() (playback.Injector, error) {
+    if err := procInterceptionCreateContext.Find(); err != nil {
+        return nil, err
+    }
+    ctx, _, _ := procInterceptionCreateContext.Call()
+    if ctx == 0 {
+        return nil, fmt.Errorf("interception_create_context failed, is the driver installed?")
+    }
+    return &interceptionInjector{ctx: ctx}, nil
+}
+
+func (ic *interceptionInjector) Close() {
+    procInterceptionDestroyContext.Call(ic.ctx)
+}
+
+func (ic *interceptionInjector) send(device int, stroke unsafe.Pointer) error {
+    n, _, _ := procInterceptionSend.Call(ic.ctx, uintptr(device), uintptr(stroke), 1)
+    if n != 1 {
+        return fmt.Errorf("interception_send failed")
+    }
+    return nil
+}
+
+func (ic *interceptionInjector) mouse(event string, data int32, flags uint16, x, y int32) error {
+    stroke := InterceptionMouseStroke{
+        State: interceptionMouseStates[event],
+        Flags: flags,
+        X:     x,
+        Y:     y,
+    }
+    if event == "MouseWheel" || event == "MouseHWheel" {
+        stroke.Rolling = int16(uint16(data))
+    }
+    noteDriverMouse()
+    return ic.send(interceptionMouse, unsafe.Pointer(&stroke))
+}
+
+func (ic *interceptionInjector) Inject(rec MouseRecord) error {
+    if rec.Event == EventText {
+        return playback.InjectKey(rec)
+    }
+    if playback.IsKey(rec) {
+        if rec.Key == nil {
+            return fmt.Errorf("%s record has no Key", rec.Event)
+        }
+        scan, extended := playback.ScanCode(rec.Key)
+        stroke := InterceptionKeyStroke{Code: scan}
+        if rec.Event == EventKeyUp {
+            stroke.State |= INTERCEPTION_KEY_UP
+        }
+        if extended {
+            stroke.State |= INTERCEPTION_KEY_E0
+        }
+        noteDriverKey(scan, rec.Event == EventKeyUp, extended)
+        return ic.send(interceptionKeyboard, unsafe.Pointer(&stroke))
+    }
+
+    dx, dy := playback.NormalizeAbsolute(rec.X, rec.Y, desktop.VirtualScreen())
+    return ic.mouse(rec.Event, rec.Data, INTERCEPTION_MOUSE_MOVE_ABSOLUTE|INTERCEPTION_MOUSE_VIRTUAL_DESKTOP, dx, dy)
+}
+
+// Release sends upEvent as a relative stroke that doesn't move.
+func (ic *interceptionInjector) Release(upEvent string) error {
+    return ic.mouse(upEvent, 0, 0, 0, 0)
+}
+
+func (ic *interceptionInjector) MovesCursor() bool { return true }
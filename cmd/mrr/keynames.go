@@ -0,0 +1,90 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// ------------------------------------------
+//     Key names
+// ------------------------------------------
+
+// keyNames maps key names, as AutoHotkey and most macro tools spell them,
+// to virtual-key codes. Single letters and digits are handled by vkForName.
+var keyNames = map[string]uint16{
+    "backspace":   0x08,
+    "bs":          0x08,
+    "tab":         0x09,
+    "enter":       0x0D,
+    "return":      0x0D,
+    "shift":       0x10,
+    "lshift":      0xA0,
+    "rshift":      0xA1,
+    "ctrl":        0x11,
+    "control":     0x11,
+    "lctrl":       0xA2,
+    "rctrl":       0xA3,
+    "alt":         0x12,
+    "lalt":        0xA4,
+    "ralt":        0xA5,
+    "pause":       VK_PAUSE,
+    "capslock":    0x14,
+    "esc":         VK_ESCAPE,
+    "escape":      VK_ESCAPE,
+    "space":       0x20,
+    "pgup":        0x21,
+    "pageup":      0x21,
+    "pgdn":        VK_NEXT,
+    "pagedown":    VK_NEXT,
+    "end":         VK_END,
+    "home":        VK_HOME,
+    "left":        0x25,
+    "up":          0x26,
+    "right":       0x27,
+    "down":        0x28,
+    "printscreen": 0x2C,
+    "ins":         VK_INSERT,
+    "insert":      VK_INSERT,
+    "del":         VK_DELETE,
+    "delete":      VK_DELETE,
+    "lwin":        0x5B,
+    "rwin":        0x5C,
+    "appskey":     0x5D,
+    "numpad0":     0x60,
+    "numpad1":     0x61,
+    "numpad2":     0x62,
+    "numpad3":     0x63,
+    "numpad4":     0x64,
+    "numpad5":     0x65,
+    "numpad6":     0x66,
+    "numpad7":     0x67,
+    "numpad8":     0x68,
+    "numpad9":     0x69,
+    "numpadmult":  VK_MULTIPLY,
+    "numpadadd":   VK_ADD,
+    "numpadsub":   VK_SUBTRACT,
+    "numpaddot":   0x6E,
+    "numpaddiv":   0x6F,
+    "numpadenter": 0x0D,
+    "numlock":     0x90,
+    "scrolllock":  0x91,
+}
+
+// vkForName returns the virtual-key code for a key name: anything in
+// keyNames, F1-F24, or a single letter or digit. Case doesn't matter.
+func vkForName(name string) (uint16, error) {
+    n := strings.ToLower(strings.TrimSpace(name))
+    if vk, ok := keyNames[n]; ok {
+        return vk, nil
+    }
+    var f int
+    if _, err := fmt.Sscanf(n, "f%d", &f); err == nil && f >= 1 && f <= 24 && n == fmt.Sprintf("f%d", f) {
+        return uint16(0x70 + f - 1), nil
+    }
+    if len(n) == 1 && (n[0] >= 'a' && n[0] <= 'z' || n[0] >= '0' && n[0] <= '9') {
+        return uint16(strings.ToUpper(n)[0]), nil
+    }
+    return 0, fmt.Errorf("unknown key %q", name)
+}
@@ -0,0 +1,564 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     Recording library
+// ------------------------------------------
+
+// The library is a folder of recordings, recordings in the data folder
+// unless --library points elsewhere, or a SQLite database (see store.go).
+// One of them can be made current with 'mrr use', and is then what End
+// replays.
+var libraryPath string
+
+// dataPath is the --data-dir folder, where MRR keeps the recording and
+// library by default.
+var dataPath string
+
+// outputPath is the --output file new recordings are saved to and End
+// replays, in place of recorded-mice.cfg in the data folder.
+var outputPath string
+
+// dataDir is --data-dir, else %APPDATA%\MRR, so running MRR from different
+// folders doesn't leave a recording in each.
+func dataDir() string {
+    if dataPath != "" {
+        return dataPath
+    }
+    if appData := os.Getenv("APPDATA"); appData != "" {
+        return filepath.Join(appData, "MRR")
+    }
+    return "."
+}
+
+// defaultRecordingPath is where a recording is saved when it isn't given a
+// name or a library.
+func defaultRecordingPath() string {
+    if outputPath != "" {
+        return outputPath
+    }
+    return filepath.Join(dataDir(), recordFileName)
+}
+
+// currentFileName holds the name of the current recording, inside the
+// library folder.
+const currentFileName = ".current"
+
+// libraryExts are tried, in order, when a recording is named without one.
+var libraryExts = []string{".cfg", ".cfg.gz", ".ndjson", ".csv"}
+
+func libraryDir() string {
+    if libraryPath != "" {
+        return libraryPath
+    }
+    return filepath.Join(dataDir(), "recordings")
+}
+
+// libraryFile is where a recording called name is saved in the library.
+func libraryFile(name string) string {
+    if libraryIsStore() {
+        return storeRef(libraryDir(), name)
+    }
+    if filepath.Ext(name) == "" {
+        name += libraryExts[0]
+    }
+    return filepath.Join(libraryDir(), name)
+}
+
+// resolveRecording finds the recording a name refers to: a path that
+// exists, else a recording in the library, with or without its extension.
+func resolveRecording(name string) (string, error) {
+    if _, err := os.Stat(name); err == nil {
+        return name, nil
+    }
+    if filepath.Base(name) == name && libraryIsStore() {
+        found := false
+        err := withStore(libraryDir(), func(s *recordingStore) error {
+            found = s.exists(name)
+            return nil
+        })
+        if err != nil {
+            return "", err
+        }
+        if found {
+            return storeRef(libraryDir(), name), nil
+        }
+    } else if filepath.Base(name) == name {
+        candidates := []string{filepath.Join(libraryDir(), name)}
+        for _, ext := range libraryExts {
+            candidates = append(candidates, filepath.Join(libraryDir(), name+ext))
+        }
+        for _, c := range candidates {
+            if fi, err := os.Stat(c); err == nil && !fi.IsDir() {
+                return c, nil
+            }
+        }
+    }
+    return "", &noRecordingError{name, libraryDir()}
+}
+
+// noRecordingError is resolveRecording's error for a name that isn't a
+// file or a library recording; it is an os.ErrNotExist.
+type noRecordingError struct {
+    name, dir string
+}
+
+func (e *noRecordingError) Error() string {
+    return fmt.Sprintf("no recording %q here or in %s", e.name, e.dir)
+}
+
+func (e *noRecordingError) Is(target error) bool {
+    return target == os.ErrNotExist
+}
+
+// currentRecording returns the path of the library's current recording, or
+// "" if none is set.
+func currentRecording() string {
+    if libraryIsStore() {
+        name := ""
+        withStore(libraryDir(), func(s *recordingStore) error {
+            name = s.setting("current")
+            return nil
+        })
+        if name == "" {
+            return ""
+        }
+        return storeRef(libraryDir(), name)
+    }
+    b, err := ioutil.ReadFile(filepath.Join(libraryDir(), currentFileName))
+    if err != nil {
+        return ""
+    }
+    name := strings.TrimSpace(string(b))
+    if name == "" {
+        return ""
+    }
+    return filepath.Join(libraryDir(), name)
+}
+
+// setCurrentRecording makes path, which must be in the library, current.
+func setCurrentRecording(path string) error {
+    if db, name, ok := parseStoreRef(path); ok {
+        return withStore(db, func(s *recordingStore) error {
+            return s.setSetting("current", name)
+        })
+    }
+    dir, name := filepath.Split(path)
+    if filepath.Clean(dir) != filepath.Clean(libraryDir()) {
+        return fmt.Errorf("%s is not in the library (%s)", path, libraryDir())
+    }
+    if err := os.MkdirAll(libraryDir(), 0755); err != nil {
+        return err
+    }
+    return ioutil.WriteFile(filepath.Join(libraryDir(), currentFileName), []byte(name+"\n"), 0644)
+}
+
+var (
+    replayTargetMtx sync.Mutex
+    // replayTargetSet is true once --playlist or 'mrr ctl use' chose what
+    // End replays.
+    replayTargetSet bool
+)
+
+// replayTarget is what End and 'mrr ctl replay' play: the --playlist, the
+// recording picked with 'mrr ctl use', the library's current recording or
+// the last recording made here, in that order.
+func replayTarget() string {
+    replayTargetMtx.Lock()
+    defer replayTargetMtx.Unlock()
+    if !replayTargetSet {
+        if cur := currentRecording(); cur != "" {
+            return cur
+        }
+    }
+    if replayFile != "" {
+        return replayFile
+    }
+    path := defaultRecordingPath()
+    // Earlier versions saved to the current folder; replay such a
+    // recording until a new one is made.
+    if _, err := os.Stat(path); os.IsNotExist(err) && outputPath == "" {
+        if _, err := os.Stat(recordFileName); err == nil {
+            return recordFileName
+        }
+    }
+    return path
+}
+
+func setReplayTarget(path string) {
+    replayTargetMtx.Lock()
+    replayFile = path
+    replayTargetSet = true
+    replayTargetMtx.Unlock()
+}
+
+// recordingEntry describes one library recording for 'mrr list'.
+type recordingEntry struct {
+    Name     string
+    Size     int64
+    Modified time.Time
+    // Events is the number of records; entries from a SQLite library
+    // carry it instead of the records themselves.
+    Events    int
+    Recording *Recording
+    // Encrypted recordings aren't opened, that would ask for the
+    // passphrase.
+    Encrypted bool
+    Err       error
+}
+
+func loadEntry(path string) recordingEntry {
+    if _, name, ok := parseStoreRef(path); ok {
+        e := recordingEntry{Name: name, Modified: time.Now()}
+        if e.Recording, e.Err = loadFromFile(path); e.Err == nil {
+            e.Events = len(e.Recording.Records)
+        }
+        return e
+    }
+    e := recordingEntry{Name: filepath.Base(path)}
+    fi, err := os.Stat(path)
+    if err != nil {
+        e.Err = err
+        return e
+    }
+    e.Size, e.Modified = fi.Size(), fi.ModTime()
+
+    f, err := os.Open(path)
+    if err != nil {
+        e.Err = err
+        return e
+    }
+    magic, _ := bufio.NewReader(f).Peek(len(encryptedMagic))
+    f.Close()
+    if bytes.Equal(magic, encryptedMagic) {
+        e.Encrypted = true
+        return e
+    }
+    if e.Recording, e.Err = loadFromFile(path); e.Err == nil {
+        e.Events = len(e.Recording.Records)
+    }
+    return e
+}
+
+// summary is the recording's summary, as saved if it was.
+func (e recordingEntry) summary() RecordingSummary {
+    if e.Recording.Summary != nil {
+        return *e.Recording.Summary
+    }
+    return format.Summarize(e.Recording.Records)
+}
+
+// created is when the recording was made, or failing that last saved.
+func (e recordingEntry) created() time.Time {
+    if e.Recording != nil && e.Recording.Metadata != nil && !e.Recording.Metadata.CreatedAt.IsZero() {
+        return e.Recording.Metadata.CreatedAt
+    }
+    return e.Modified
+}
+
+func (e recordingEntry) screen() string {
+    if e.Recording == nil || e.Recording.Metadata == nil {
+        return "-"
+    }
+    s := e.Recording.Metadata.Screen
+    return fmt.Sprintf("%dx%d", s.Width, s.Height)
+}
+
+// libraryEntries lists the library recordings q selects, skipping
+// checkpoints and our own files.
+func libraryEntries(q storeQuery) ([]recordingEntry, error) {
+    if libraryIsStore() {
+        if _, err := os.Stat(libraryDir()); os.IsNotExist(err) {
+            return nil, nil
+        }
+        var entries []recordingEntry
+        err := withStore(libraryDir(), func(s *recordingStore) (err error) {
+            entries, err = s.entries(q)
+            return err
+        })
+        return entries, err
+    }
+    files, err := ioutil.ReadDir(libraryDir())
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    var entries []recordingEntry
+    for _, fi := range files {
+        name := fi.Name()
+        if fi.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, checkpointExt) || isBackupName(name) {
+            continue
+        }
+        if e := loadEntry(filepath.Join(libraryDir(), name)); q.matches(e) {
+            entries = append(entries, e)
+        }
+    }
+    sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+    return entries, nil
+}
+
+// runList implements `mrr list`.
+func runList(args []string) int {
+    var q storeQuery
+    var rest []string
+    var err error
+    for i := 0; i < len(args) && err == nil; i++ {
+        switch args[i] {
+        case "--longer-than":
+            if i++; i < len(args) {
+                q.LongerThan, err = parseClock(args[i])
+            } else {
+                err = fmt.Errorf("--longer-than needs a duration")
+            }
+        case "--window":
+            if i++; i < len(args) {
+                q.Window = args[i]
+            } else {
+                err = fmt.Errorf("--window needs a title")
+            }
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    if err == nil {
+        var files []string
+        if files, err = parseArgs(rest); err == nil && len(files) != 0 {
+            err = fmt.Errorf("unexpected argument %q", files[0])
+        }
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr list [--library dir|file.db] [--longer-than 5m] [--window title]")
+        return exitUsage
+    }
+    entries, err := libraryEntries(q)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not read the library:"), err)
+        return exitLoadFailed
+    }
+    if len(entries) == 0 {
+        fmt.Println("[INFO]", msgf("No recordings in %s", libraryDir()))
+        return exitOK
+    }
+
+    cur := filepath.Base(currentRecording())
+    if _, name, ok := parseStoreRef(currentRecording()); ok {
+        cur = name
+    }
+    tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(tw, "\tNAME\tDURATION\tEVENTS\tCREATED\tSCREEN")
+    for _, e := range entries {
+        mark := ""
+        if e.Name == cur {
+            mark = "*"
+        }
+        switch {
+        case e.Err != nil:
+            fmt.Fprintf(tw, "%s\t%s\t-\t-\t%s\terror: %v\n", mark, e.Name, e.Modified.Format("2006-01-02 15:04"), e.Err)
+        case e.Encrypted:
+            fmt.Fprintf(tw, "%s\t%s\t-\t-\t%s\tencrypted\n", mark, e.Name, e.Modified.Format("2006-01-02 15:04"))
+        default:
+            s := e.summary()
+            fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", mark, e.Name,
+                formatClock(time.Duration(s.DurationMS)*time.Millisecond), e.Events,
+                e.created().Format("2006-01-02 15:04"), e.screen())
+        }
+    }
+    tw.Flush()
+    fmt.Printf("\n%s\n", msgf("%d recording(s) in %s", len(entries), libraryDir()))
+    return exitOK
+}
+
+// runInfo implements `mrr info <name>`.
+func runInfo(args []string) int {
+    files, err := parseArgs(args)
+    if err != nil || len(files) != 1 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr info <name or file>")
+        return exitUsage
+    }
+    path, err := resolveRecording(files[0])
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    e := loadEntry(path)
+    if e.Err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), e.Err)
+        return loadExitCode(e.Err)
+    }
+    if e.Encrypted {
+        // Asking for the passphrase is fine here, it was asked for.
+        if e.Recording, e.Err = loadFromFile(path); e.Err != nil {
+            fmt.Println("[ERROR]", msg("Could not load recording:"), e.Err)
+            return loadExitCode(e.Err)
+        }
+    }
+
+    r := e.Recording
+    fmt.Println("[INFO]", msgf("Recording %s", path))
+    if e.Size > 0 {
+        printField("size", "%d bytes", e.Size)
+    }
+    printField("format version", "%d", r.Version)
+    printField("created", "%s", e.created().Format("2006-01-02 15:04:05"))
+    if r.Metadata != nil {
+        s := r.Metadata.Screen
+        printField("screen", "%dx%d at (%d,%d)", s.Width, s.Height, s.X, s.Y)
+        if w := r.Metadata.Window; w != nil {
+            printField("window", "%q, client %dx%d at (%d,%d)",
+                w.Title, w.Client.Width, w.Client.Height, w.Client.X, w.Client.Y)
+        }
+    }
+    printField("records", "%d", len(r.Records))
+    if len(r.DPISegments) > 0 {
+        printField("DPI segments", "%d", len(r.DPISegments))
+    }
+    printSummary(format.Summarize(r.Records))
+    return exitOK
+}
+
+// runUse implements `mrr use <name>`: make a library recording current.
+func runUse(args []string) int {
+    files, err := parseArgs(args)
+    if err != nil || len(files) != 1 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr use <name>")
+        return exitUsage
+    }
+    path, err := resolveRecording(files[0])
+    if err == nil {
+        err = setCurrentRecording(path)
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    if _, name, ok := parseStoreRef(path); ok {
+        path = name
+    }
+    fmt.Println("[INFO]", msgf("Current recording is now %s", filepath.Base(path)))
+    return exitOK
+}
+
+// runRemove implements `mrr rm <name>...`. In a SQLite library either all
+// of them are removed or none are.
+func runRemove(args []string) int {
+    names, err := parseArgs(args)
+    if err != nil || len(names) == 0 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr rm <name>...")
+        return exitUsage
+    }
+    if libraryIsStore() {
+        err = withStore(libraryDir(), func(s *recordingStore) error {
+            return s.db.transaction(func() error {
+                for _, name := range names {
+                    if err := s.remove(name); err != nil {
+                        return fmt.Errorf("%s: %v", name, err)
+                    }
+                }
+                return nil
+            })
+        })
+    } else {
+        // Resolve them all first so a typo removes nothing.
+        var paths []string
+        for _, name := range names {
+            path, rerr := resolveRecording(name)
+            if rerr != nil {
+                err = rerr
+                break
+            }
+            paths = append(paths, path)
+        }
+        for _, path := range paths {
+            if err != nil {
+                break
+            }
+            err = os.Remove(path)
+        }
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    fmt.Println("[INFO]", msgf("Removed %d recording(s)", len(names)))
+    return exitOK
+}
+
+// runImport implements `mrr import <file>...`: copy recordings into the
+// library, named after their files. In a SQLite library either all of
+// them are imported or none are.
+func runImport(args []string) int {
+    files, err := parseArgs(args)
+    if err != nil || len(files) == 0 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr import [--library dir|file.db] <file>...")
+        return exitUsage
+    }
+    recordings := make([]*Recording, len(files))
+    names := make([]string, len(files))
+    for i, f := range files {
+        if recordings[i], err = loadFromFile(f); err != nil {
+            fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+            return loadExitCode(err)
+        }
+        base := filepath.Base(f)
+        names[i] = strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), filepath.Ext(strings.TrimSuffix(base, ".gz")))
+    }
+
+    if libraryIsStore() {
+        if err = os.MkdirAll(filepath.Dir(libraryDir()), 0755); err == nil {
+            err = withStore(libraryDir(), func(s *recordingStore) error {
+                return s.db.transaction(func() error {
+                    for i, name := range names {
+                        if err := s.save(name, recordings[i]); err != nil {
+                            return fmt.Errorf("%s: %v", name, err)
+                        }
+                    }
+                    return nil
+                })
+            })
+        }
+    } else if err = os.MkdirAll(libraryDir(), 0755); err == nil {
+        for i, name := range names {
+            if err = dumpToFile(libraryFile(name), recordings[i]); err != nil {
+                break
+            }
+        }
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not import:"), err)
+        return exitLoadFailed
+    }
+    fmt.Println("[INFO]", msgf("Imported %d recording(s) into %s", len(files), libraryDir()))
+    return exitOK
+}
@@ -0,0 +1,325 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Log file
+// ------------------------------------------
+
+// With --log-file, everything MRR prints is also written to the file,
+// each line stamped with the time, so a session that runs for days keeps
+// a record beyond the console's scrollback. The file is rotated once it
+// grows past --log-max-size or, with --log-rotate, every day or hour: the
+// old one becomes name.1, name.1 becomes name.2 and so on, --log-keep of
+// them kept.
+//
+// With --log-format json every line printed, on the console and in the
+// log file, is a JSON object instead: the printed lines become
+//
+//     {"time":"...","level":"info","msg":"Saved recording to ..."}
+//
+// and the moments a supervisor cares about are events of their own, with
+// their details as fields:
+//
+//     {"time":"...","level":"error","event":"replay_failed","code":"failsafe",...}
+
+var (
+    // logFormat is "text" or "json" (--log-format).
+    logFormat = "text"
+
+    // logFilePath is the --log-file, if any.
+    logFilePath string
+    // logMaxSize is the size in bytes a log file rotates at (--log-max-size).
+    logMaxSize int64 = 10 << 20
+    // logRotate rotates the log "daily" or "hourly" as well (--log-rotate).
+    logRotate string
+    // logKeep is how many rotated logs are kept (--log-keep).
+    logKeep = 5
+)
+
+// console is where MRR's output went before logging or the TUI took
+// os.Stdout over.
+var console = os.Stdout
+
+// printPrompt prints a prompt, which doesn't end its line, straight to
+// the console: logging only passes whole lines on, so it would show up
+// once the prompt had been answered. Prompts aren't logged.
+func printPrompt(format string, a ...interface{}) {
+    fmt.Fprintf(console, format, a...)
+}
+
+// rotatingLog is an open log file.
+type rotatingLog struct {
+    mu     sync.Mutex
+    path   string
+    f      *os.File
+    size   int64
+    period time.Time
+}
+
+// activeLog is the log being written, nil without --log-file.
+var activeLog *rotatingLog
+
+// parseSize parses a byte count such as 500KB, 10MB or 1GB.
+func parseSize(s string) (int64, error) {
+    units := []struct {
+        suffix string
+        mult   int64
+    }{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+    upper := strings.ToUpper(strings.TrimSpace(s))
+    mult := int64(1)
+    for _, u := range units {
+        if strings.HasSuffix(upper, u.suffix) {
+            upper, mult = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.mult
+            break
+        }
+    }
+    n, err := strconv.ParseFloat(upper, 64)
+    if err != nil || n <= 0 {
+        return 0, fmt.Errorf("invalid size %q (e.g. 500KB, 10MB)", s)
+    }
+    return int64(n * float64(mult)), nil
+}
+
+// logPeriod is the start of the --log-rotate period t falls in.
+func logPeriod(t time.Time) time.Time {
+    switch logRotate {
+    case "daily":
+        y, m, d := t.Date()
+        return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+    case "hourly":
+        return t.Truncate(time.Hour)
+    }
+    return time.Time{}
+}
+
+func openLog(path string) (*rotatingLog, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return nil, err
+    }
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return nil, err
+    }
+    l := &rotatingLog{path: path, f: f}
+    if fi, err := f.Stat(); err == nil {
+        l.size = fi.Size()
+        // A log left from an earlier period rotates at the first line.
+        l.period = logPeriod(fi.ModTime())
+    }
+    return l, nil
+}
+
+// rotate moves the log to name.1, shifting the older ones along, and
+// starts a new one. l.mu must be held.
+func (l *rotatingLog) rotate() error {
+    l.f.Close()
+    os.Remove(fmt.Sprintf("%s.%d", l.path, logKeep))
+    for n := logKeep - 1; n >= 1; n-- {
+        os.Rename(fmt.Sprintf("%s.%d", l.path, n), fmt.Sprintf("%s.%d", l.path, n+1))
+    }
+    if logKeep > 0 {
+        os.Rename(l.path, l.path+".1")
+    } else {
+        os.Remove(l.path)
+    }
+    f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+    if err != nil {
+        return err
+    }
+    l.f, l.size = f, 0
+    return nil
+}
+
+// writeLine writes line, stamped with the time unless it is JSON, which
+// has its own. It rotates first if due.
+func (l *rotatingLog) writeLine(line string) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    now := time.Now()
+    s := line + "\n"
+    if logFormat != "json" {
+        s = now.Format("2006-01-02 15:04:05.000 ") + s
+    }
+    period := logPeriod(now)
+    if l.size > 0 && (l.size+int64(len(s)) > logMaxSize || !period.Equal(l.period)) {
+        if err := l.rotate(); err != nil {
+            fmt.Fprintln(console, "[ERROR] Could not rotate the log:", err)
+        }
+    }
+    l.period = period
+    n, _ := l.f.WriteString(s)
+    l.size += int64(n)
+}
+
+// writeLog writes a printed line to the log file, if there is one.
+func writeLog(line string) {
+    if activeLog == nil {
+        return
+    }
+    if logFormat == "json" {
+        line = jsonLogLine(line)
+    }
+    activeLog.writeLine(line)
+}
+
+// startLogging opens --log-file and copies everything printed from now on
+// into it, turning it into JSON with --log-format json. The returned
+// function stops logging; it is a no-op without either flag.
+func startLogging() (func(), error) {
+    if logFilePath == "" && logFormat != "json" {
+        return func() {}, nil
+    }
+    var l *rotatingLog
+    if logFilePath != "" {
+        var err error
+        if l, err = openLog(logFilePath); err != nil {
+            return func() {}, err
+        }
+    }
+    r, w, err := os.Pipe()
+    if err != nil {
+        if l != nil {
+            l.f.Close()
+        }
+        return func() {}, err
+    }
+    activeLog = l
+    os.Stdout = w
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        sc := bufio.NewScanner(r)
+        for sc.Scan() {
+            line := sc.Text()
+            if logFormat == "json" {
+                if strings.TrimSpace(line) == "" {
+                    continue
+                }
+                line = jsonLogLine(line)
+            }
+            fmt.Fprintln(console, line)
+            if l != nil {
+                l.writeLine(line)
+            }
+        }
+    }()
+    return func() {
+        os.Stdout = console
+        w.Close()
+        <-done
+        activeLog = nil
+        if l != nil {
+            l.f.Close()
+        }
+    }, nil
+}
+
+// eventPrefix starts every line logEvent prints, which jsonLogLine passes
+// through as it is.
+const eventPrefix = `{"time":`
+
+// logLevels map the prefixes of printed lines to levels.
+var logLevels = []struct{ prefix, level string }{
+    {"[INFO]", "info"},
+    {"[WARN]", "warn"},
+    {"[ERROR]", "error"},
+    {"[DEBUG]", "debug"},
+    {"[STEP]", "info"},
+}
+
+// jsonLogLine turns a printed line into a JSON log line.
+func jsonLogLine(line string) string {
+    if strings.HasPrefix(line, eventPrefix) {
+        return line
+    }
+    level, msg := "info", strings.TrimSpace(line)
+    for _, l := range logLevels {
+        if strings.HasPrefix(msg, l.prefix) {
+            level, msg = l.level, strings.TrimSpace(strings.TrimPrefix(msg, l.prefix))
+            break
+        }
+    }
+    return encodeLogLine(level, "msg", msg, nil)
+}
+
+// encodeLogLine writes a JSON log line with time, level and key first and
+// the other fields after them, sorted.
+func encodeLogLine(level, key, value string, fields map[string]interface{}) string {
+    var b strings.Builder
+    t, _ := json.Marshal(time.Now().Format(time.RFC3339Nano))
+    l, _ := json.Marshal(level)
+    v, _ := json.Marshal(value)
+    fmt.Fprintf(&b, `{"time":%s,"level":%s,"%s":%s`, t, l, key, v)
+    names := make([]string, 0, len(fields))
+    for name := range fields {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        f, err := json.Marshal(fields[name])
+        if err != nil {
+            f, _ = json.Marshal(fmt.Sprint(fields[name]))
+        }
+        k, _ := json.Marshal(name)
+        fmt.Fprintf(&b, ",%s:%s", k, f)
+    }
+    b.WriteString("}")
+    return b.String()
+}
+
+// logEvent prints an event with --log-format json; the text format has
+// printed its own message already.
+func logEvent(level, event string, fields map[string]interface{}) {
+    if logFormat == "json" {
+        fmt.Println(encodeLogLine(level, "event", event, fields))
+    }
+}
+
+// logError logs event as an error with code, or if that is "" the code
+// errorCode gives err.
+func logError(event, code string, err error, fields map[string]interface{}) {
+    if fields == nil {
+        fields = make(map[string]interface{})
+    }
+    if code == "" {
+        code = errorCode(err)
+    }
+    fields["code"] = code
+    fields["error"] = err.Error()
+    logEvent("error", event, fields)
+}
+
+// errorCode classifies err for log collectors.
+func errorCode(err error) string {
+    var verr *ValidationError
+    var perr *os.PathError
+    switch {
+    case errors.Is(err, context.Canceled):
+        return "aborted"
+    case errors.Is(err, playback.ErrFailsafe):
+        return "failsafe"
+    case errors.Is(err, playback.ErrVerifyFailed):
+        return "verify_failed"
+    case errors.As(err, &verr), errors.As(err, &perr), errors.Is(err, errWrongKey):
+        return exitStatus[loadExitCode(err)]
+    }
+    return "failed"
+}
@@ -0,0 +1,867 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "runtime"
+    "sync"
+    "sync/atomic"
+    "syscall"
+    "time"
+    "unsafe"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+    "github.com/onixldlc/MRR/hook"
+    playback "github.com/onixldlc/MRR/player"
+    "github.com/onixldlc/MRR/recorder"
+)
+
+var (
+    user32   = syscall.MustLoadDLL("user32.dll")
+    kernel32 = syscall.MustLoadDLL("kernel32.dll")
+
+    procGetMessageW      = user32.MustFindProc("GetMessageW")
+    procGetCursorPos     = user32.MustFindProc("GetCursorPos")
+    procGetAsyncKeyState = user32.MustFindProc("GetAsyncKeyState")
+)
+
+// Original constants
+const (
+    recordFileName = "recorded-mice.cfg"
+
+    WM_KEYDOWN    = 0x0100
+    WM_KEYUP      = 0x0101
+    WM_SYSKEYDOWN = 0x0104
+
+    VK_INSERT = 0x2D
+    VK_END    = 0x23
+    VK_ESCAPE = 0x1B
+    VK_HOME   = 0x24
+    VK_DELETE = 0x2E
+    VK_PAUSE  = 0x13
+
+    VK_MULTIPLY = 0x6A
+    VK_ADD      = 0x6B
+    VK_SUBTRACT = 0x6D
+
+    WM_QUIT = 0x0012
+
+    WM_MOUSEMOVE   = 0x0200
+    WM_LBUTTONDOWN = 0x0201
+    WM_LBUTTONUP   = 0x0202
+    WM_RBUTTONDOWN = 0x0204
+    WM_RBUTTONUP   = 0x0205
+    WM_MBUTTONDOWN = 0x0207
+    WM_MBUTTONUP   = 0x0208
+    WM_MOUSEWHEEL  = 0x020A
+    WM_XBUTTONDOWN = 0x020B
+    WM_XBUTTONUP   = 0x020C
+    WM_MOUSEHWHEEL = 0x020E
+)
+
+type POINT = desktop.Point
+
+type MSG struct {
+    HWND    uintptr
+    Message uint32
+    WParam  uintptr
+    LParam  uintptr
+    Time    uint32
+    Pt      POINT
+}
+
+var (
+    // hooks are the low-level hooks, while they are installed.
+    hooks atomic.Pointer[hook.Hook]
+
+    mtx         sync.Mutex
+    isRecording bool
+
+    recordingStarted = false
+
+    // recordDone is closed whenever the running recording is stopped, so
+    // Record can return no matter who stopped it.
+    recordDone chan struct{}
+
+    // lastRecording is the most recently stopped recording.
+    lastRecording *Recording
+
+    // activeRecorder is the running recording. The hooks above feed it,
+    // so it installs none of its own.
+    activeRecorder *recorder.Recorder
+
+    // recordStream writes records out as they are captured with
+    // --format ndjson.
+    recordStream *ndjsonStream
+)
+
+// NEW: We'll add a global debugMode
+var debugMode bool
+
+// replayFile is what End and 'mrr ctl replay' play when set: the
+// --playlist file or one picked with 'mrr ctl use'. Otherwise it's the
+// default recording, see replayTarget.
+var replayFile string
+
+// saveAsName saves new recordings into the library under this name and
+// makes them current (--save-as).
+var saveAsName string
+
+// recordingSavePath is where a finished recording is saved.
+func recordingSavePath() string {
+    if saveAsName != "" {
+        return libraryFile(saveAsName)
+    }
+    return defaultRecordingPath()
+}
+
+// hookThread is the thread pumping messages for 'mrr hook', which
+// 'mrr ctl quit' stops.
+var hookThread uintptr
+
+// scheduleFile is the --schedule config, if any.
+var scheduleFile string
+
+// jsonOutput prints every replay result as JSON (--json).
+var jsonOutput bool
+
+// playerOpts collects the replay flags; player is built from it in main and
+// replays recordings for the hotkeys and the control pipe.
+var (
+    playerOpts = PlayerOptions{Options: playback.Options{Anchor: playback.AnchorCenter}}
+    player     *Player
+)
+
+// simplifyTolerance is the --simplify distance in pixels; 0 keeps every move.
+var simplifyTolerance float64
+
+// MouseRecord is one record of a recording: a mouse event, a key (see
+// keyboard.go), a wait step (wait.go) or a check step (assert.go). Its
+// Source index is kept through replay transforms for checkpoints.
+type MouseRecord = format.Record
+
+// ------------------------------------------------------------------
+//        HELPER DEBUG PRINT FUNCTIONS
+// ------------------------------------------------------------------
+func debugPrintln(a ...interface{}) {
+    if debugMode {
+        fmt.Println(a...)
+    }
+}
+
+func debugPrintf(format string, a ...interface{}) {
+    if debugMode {
+        fmt.Printf(format, a...)
+    }
+}
+
+// ------------------------------------------
+//        HOOK CALLBACKS
+// ------------------------------------------
+
+// hookEvent is the hooks' handler; returning true swallows ev.
+func hookEvent(ev hook.Event) bool {
+    if ev.Kind == hook.Keyboard {
+        return keyboardEvent(ev)
+    }
+    return mouseEvent(ev)
+}
+
+func keyboardEvent(ev hook.Event) bool {
+    wparam, vk := uintptr(ev.Message), uint32(ev.VK)
+    // Keys a replay types are not hotkeys.
+    injected := ev.Injected || driverInjectedKey(ev)
+    if !injected {
+        trackModifier(wparam, vk)
+    }
+    if !injected && inputBlocked.Load() {
+        swallowBlockedKey(wparam, vk)
+        return true
+    }
+    if (wparam == WM_KEYUP || wparam == WM_SYSKEYUP) && !injected && vk == chordKeyDown {
+        chordKeyDown = 0
+        return true
+    }
+    if (wparam == WM_KEYDOWN || wparam == WM_SYSKEYDOWN) && !injected {
+        action := hotkeyFor(vk)
+        if !hotkeyEnabled(action) {
+            action = actionNone
+        }
+        // A hotkey with modifiers is MRR's alone: the application in front
+        // doesn't get Ctrl+Shift+R too.
+        chord := action != actionNone && hotkeyOf(action).Mods != 0
+        if chord {
+            swallowChord(vk, hotkeyOf(action).Mods)
+        }
+        switch action {
+        case actionRecord:
+            if recordOnlyStop != nil {
+                recordOnlyStop()
+                break
+            }
+            if recordingActive() {
+                fmt.Println("[INFO]", msgf("%s pressed -> Stop recording", hotkeyName(action)))
+                finishRecording()
+            } else {
+                startRecording()
+                fmt.Println("[INFO]", msgf("%s pressed -> Start recording", hotkeyName(action)))
+            }
+
+        case actionReplay:
+            if n := queueReplay(replayTarget()); n > 0 {
+                fmt.Println("[INFO]", msgf("%s pressed -> Replay queued (%d waiting)", hotkeyName(action), n))
+            } else {
+                fmt.Println("[INFO]", msgf("%s pressed -> Replaying recorded movements", hotkeyName(action)))
+            }
+
+        case actionClear:
+            if n := clearReplayQueue(); n > 0 {
+                fmt.Println("[INFO]", msgf("%s pressed -> Cleared %d queued replay(s)", hotkeyName(action), n))
+            }
+
+        case actionPause:
+            p := replayingPlayer()
+            if p == nil {
+                break
+            }
+            if p.Resume() {
+                fmt.Println("[INFO]", msgf("%s pressed -> Resuming replay", hotkeyName(action)))
+            } else {
+                p.Pause()
+                fmt.Println("[INFO]", msgf("%s pressed -> Pausing replay", hotkeyName(action)))
+            }
+
+        case actionStep:
+            if p := replayingPlayer(); p != nil && p.opts.Step {
+                // Swallowed, so stepping doesn't scroll the target.
+                p.Step()
+                return true
+            }
+
+        case actionFaster, actionSlower, actionResetSpeed:
+            p := replayingPlayer()
+            if p == nil {
+                break
+            }
+            speed := adjustSpeed(p.Speed(), action)
+            p.SetSpeed(speed)
+            fmt.Println("[INFO]", msgf("Replay speed %gx", speed))
+            // Swallowed, so the target doesn't get typed into.
+            return true
+
+        case actionCheck:
+            if !recordingActive() {
+                break
+            }
+            if err := recordPixelCheck(); err != nil {
+                fmt.Println("[ERROR]", msg("Could not add a check:"), err)
+            }
+            // Swallowed, so the recorded application doesn't see it.
+            return true
+
+        case actionCycleSpeed:
+            p := activePlayer()
+            speed := nextSpeedPreset(p.Speed())
+            p.SetSpeed(speed)
+            fmt.Println("[INFO]", msgf("%s pressed -> Replay speed %gx", hotkeyName(action), speed))
+
+        case actionAbort:
+            if abortReplay() {
+                fmt.Println("[INFO]", msgf("%s pressed -> Aborting replay", hotkeyName(action)))
+            }
+
+        case actionReload:
+            if err := reloadConfig(); err != nil {
+                fmt.Println("[ERROR]", msg("Could not reload the config:"), err)
+                notifyError(msg("Config not reloaded"), err)
+            } else {
+                fmt.Println("[INFO]", msgf("%s pressed -> Reloaded the config", hotkeyName(action)))
+            }
+        }
+        if chord {
+            return true
+        }
+    }
+    return false
+}
+
+func mouseEvent(ev hook.Event) bool {
+    mtx.Lock()
+    recording := isRecording
+    mtx.Unlock()
+
+    if !ev.Injected && inputBlocked.Load() && !driverInjectedMouse() {
+        return true
+    }
+    rec, ok := recorder.RecordOf(ev)
+    if !ok {
+        return false
+    }
+
+    // Print debug only if --debug
+    debugPrintf("Detected event: %s, X: %d, Y: %d, Data: %d\n", rec.Event, rec.X, rec.Y, rec.Data)
+
+    if recording {
+        tr := timedRecord{rec, time.Now()}
+        var kept []MouseRecord
+        mtx.Lock()
+        if isRecording {
+            if trackingDevices() {
+                kept = keepRecords(holdForDevice(tr)...)
+            } else {
+                kept = keepRecords(tr)
+            }
+        }
+        mtx.Unlock()
+
+        for _, rec := range kept {
+            fireEventRecorded(rec)
+        }
+    }
+    return false
+}
+
+// recordingActive reports whether a recording is currently running.
+func recordingActive() bool {
+    mtx.Lock()
+    defer mtx.Unlock()
+    return recordingStarted
+}
+
+// finishRecording stops the running recording, prints its summary and saves
+// it to recordingSavePath. It returns false when nothing was being recorded,
+// and the error if the recording couldn't be saved.
+func finishRecording() (bool, error) {
+    recording, stopped := stopRecording()
+    if !stopped {
+        return false, nil
+    }
+
+    summary := format.Summarize(recording.Records)
+    printSummary(summary)
+    recording.Summary = &summary
+    path := recordingSavePath()
+    err := os.MkdirAll(filepath.Dir(path), 0755)
+    if err == nil {
+        err = dumpToFile(path, recording)
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not save recording:"), err)
+        notifyError(msg("Recording not saved"), err)
+        fireError(err)
+        logError("recording_failed", "save_failed", err, map[string]interface{}{"file": path})
+        noteRunError(err)
+        return true, err
+    }
+    if saveAsName != "" {
+        if err := setCurrentRecording(path); err != nil {
+            fmt.Println("[WARN]", msg("Could not make the recording current:"), err)
+        }
+    }
+    fmt.Println("[INFO]", msgf("Saved recording to %s", displayName(path)))
+    notifyRecordingSaved(path, summary.DurationMS)
+    noteRecordingSaved(path)
+    logEvent("info", "recording_saved", map[string]interface{}{
+        "file": path, "events": len(recording.Records), "duration_ms": summary.DurationMS,
+    })
+    return true, nil
+}
+
+// replayOutcome is what a background replay delivers when it ends.
+type replayOutcome struct {
+    result *ReplayResult
+    err    error
+}
+
+var (
+    replayMtx sync.Mutex
+    // replayCancel aborts the running replay; nil while none is running.
+    replayCancel context.CancelFunc
+    // replayQueue holds files to play once the running replay completes.
+    replayQueue []string
+    // replayPlayer plays the running replay: player, or the one a control
+    // pipe play built from its own flags. nil while none is running.
+    replayPlayer *Player
+)
+
+// beginReplay replays filename with p, or player when p is nil, on its own
+// goroutine so the hook thread keeps pumping messages. It returns nil when a
+// replay is already running, otherwise a channel that receives the outcome
+// once the replay ends.
+func beginReplay(p *Player, filename string) <-chan replayOutcome {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+
+    if replayCancel != nil {
+        return nil
+    }
+    return startReplayLocked(p, filename)
+}
+
+// startReplayLocked starts filename's replay with p. replayMtx must be
+// held. When the replay completes, the next queued file starts with player;
+// a failed or aborted replay drops the queue instead.
+func startReplayLocked(p *Player, filename string) <-chan replayOutcome {
+    if p == nil {
+        p = player
+    }
+    // A pause left over from an aborted replay doesn't carry over.
+    p.Resume()
+    ctx, cancel := context.WithCancel(context.Background())
+    replayCancel = cancel
+    replayPlayer = p
+
+    done := make(chan replayOutcome, 1)
+    go func() {
+        waitModifiersReleased(ctx)
+        result, err := runReplay(ctx, p, filename)
+        cancel()
+
+        replayMtx.Lock()
+        replayCancel = nil
+        replayPlayer = nil
+        if len(replayQueue) > 0 {
+            if err != nil {
+                fmt.Println("[INFO]", msgf("Dropped %d queued replay(s)", len(replayQueue)))
+                replayQueue = nil
+            } else {
+                next := replayQueue[0]
+                replayQueue = replayQueue[1:]
+                fmt.Println("[INFO]", msgf("Starting queued replay of %s (%d more queued)", next, len(replayQueue)))
+                startReplayLocked(nil, next)
+            }
+        }
+        replayMtx.Unlock()
+
+        done <- replayOutcome{result, err}
+    }()
+    return done
+}
+
+// queueReplay starts filename now if nothing is replaying, or queues it
+// behind the running replay. It returns the queue position, 0 when the
+// replay started right away.
+func queueReplay(filename string) int {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+
+    if replayCancel == nil {
+        startReplayLocked(nil, filename)
+        return 0
+    }
+    replayQueue = append(replayQueue, filename)
+    return len(replayQueue)
+}
+
+// clearReplayQueue drops every queued replay and returns how many there
+// were. The running replay is left alone.
+func clearReplayQueue() int {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+
+    n := len(replayQueue)
+    replayQueue = nil
+    return n
+}
+
+// replayActive reports whether a replay is running.
+func replayActive() bool {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+    return replayCancel != nil
+}
+
+// activePlayer returns the player of the running replay, or player while
+// none is running, for pausing, stepping and speed changes to act on.
+func activePlayer() *Player {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+    if replayPlayer != nil {
+        return replayPlayer
+    }
+    return player
+}
+
+// setPlayer makes p the player that replays started without one of their
+// own use.
+func setPlayer(p *Player) {
+    replayMtx.Lock()
+    player = p
+    replayMtx.Unlock()
+}
+
+// replayingPlayer returns the player of the running replay, nil while none
+// is running.
+func replayingPlayer() *Player {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+    return replayPlayer
+}
+
+// abortReplay cancels the running replay and anything queued behind it.
+// It returns false when there was nothing to abort.
+func abortReplay() bool {
+    replayMtx.Lock()
+    defer replayMtx.Unlock()
+
+    if replayCancel == nil {
+        return false
+    }
+    replayQueue = nil
+    replayCancel()
+    return true
+}
+
+// runReplay replays filename with p and reports the outcome on the
+// console. The result is returned for callers that pass it on.
+func runReplay(ctx context.Context, p *Player, filename string) (*ReplayResult, error) {
+    logEvent("info", "replay_started", map[string]interface{}{"file": filename})
+    result, err := p.ReplayFile(ctx, filename)
+    noteReplay(filename, result)
+    notifyReplayEnded(filename, result, err)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Replay failed:"), err)
+        fireError(err)
+        logError("replay_failed", "", err, map[string]interface{}{"file": filename, "result": result})
+        noteRunError(err)
+    } else {
+        fmt.Println("[INFO]", msg("Replay completed."))
+        logEvent("info", "replay_finished", map[string]interface{}{"file": filename, "result": result})
+    }
+
+    // The events carry the result in JSON logs.
+    if jsonOutput && logFormat != "json" {
+        if b, jerr := json.MarshalIndent(result, "", "  "); jerr == nil {
+            fmt.Println(string(b))
+        }
+    } else {
+        debugPrintf("[DEBUG] injected %d/%d events in %dms, max drift %.1fms\n",
+            result.EventsInjected, result.EventsTotal, result.DurationMS, result.Drift.MaxMS)
+    }
+    return result, err
+}
+
+// keepRecords passes captured records on to the running recording and
+// returns the ones it kept, as stored. mtx must be held.
+func keepRecords(trs ...timedRecord) []MouseRecord {
+    var kept []MouseRecord
+    for _, tr := range trs {
+        kept = append(kept, activeRecorder.Add(tr.rec, tr.at)...)
+    }
+    if recordStream != nil {
+        for _, rec := range kept {
+            recordStream.add(rec)
+        }
+    }
+    return kept
+}
+
+func main() {
+    desktop.EnableDPIAwareness()
+    removeReplacedExecutable()
+    os.Exit(runCLI(os.Args[1:]))
+}
+
+// runHook implements `mrr hook`, MRR's default: install the hooks and
+// record and replay with hotkeys until the console is closed.
+func runHook(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitUsage
+    }
+    release, ok := claimInstance()
+    if !ok {
+        return alreadyRunning()
+    }
+    defer release()
+    if firstRun(cliArgs) {
+        if err := runFirstRunSetup(); err != nil {
+            fmt.Println("[ERROR]", msg("Could not write the config:"), err)
+            return exitInvalid
+        }
+    }
+    stopLogging, err := startLogging()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not open the log file:"), err)
+        return exitUsage
+    }
+    defer stopLogging()
+    player = NewPlayer(playerOpts)
+
+    // The tray icon and the Raw Input window are served by this thread,
+    // which pumps messages until exit; the hooks run on one of their own.
+    runtime.LockOSThread()
+    defer runtime.UnlockOSThread()
+    hookThread, _, _ = procGetCurrentThreadId.Call()
+
+    // Recordings are saved from the hook thread, which mustn't wait on the
+    // console or on deriving the key, so both happen up front.
+    if encryptRecordings {
+        if _, err := sealingKey(); err != nil {
+            fmt.Println("[ERROR]", err)
+            return exitUsage
+        }
+    }
+
+    // Runs once the hooks are off; see waitReplayStopped.
+    defer waitReplayStopped()
+    if err := installHooks(); err != nil {
+        fmt.Println("[ERROR]", msg("Could not install hooks:"), err)
+        noteRunError(err)
+        fireError(err)
+        logError("hooks_failed", "hooks_failed", err, nil)
+        return exitHooksFailed
+    }
+    defer unInstallHooks()
+    // Ctrl+C and closing the console save the recording and abort the
+    // replay before exiting.
+    defer handleConsoleCtrl(func() { quitThread(hookThread) })()
+    logEvent("info", "started", map[string]interface{}{"command": activeCommand, "pid": os.Getpid()})
+    defer logEvent("info", "stopped", nil)
+
+    go serveControlPipe()
+
+    if trayMode || notifyMode {
+        if err := startTray(); err != nil {
+            fmt.Println("[WARN]", msg("Could not add the tray icon:"), err)
+        }
+        defer stopTray()
+    }
+
+    if scheduleFile != "" {
+        sf, err := loadSchedule(scheduleFile)
+        if err != nil {
+            fmt.Println("[ERROR]", msg("Could not load schedule:"), err)
+            noteRunError(err)
+            return loadExitCode(err)
+        }
+        fmt.Println("[INFO]", msgf("Loaded %d scheduled job(s) from %s", len(sf.Jobs), scheduleFile))
+        go runScheduler(sf)
+    }
+    if profileName != "" {
+        fmt.Println("[INFO]", msgf("Using profile %s", profileName))
+    }
+
+    // Always show instructions to user
+    fmt.Println("=======================================================")
+    fmt.Println(" Mouse Recorder & Replayer (Modified)")
+    fmt.Println("=======================================================")
+    // Each paragraph is translated whole, then wrapped.
+    for _, p := range []string{
+        msgf("Press %s to toggle recording.", hotkeyName(actionRecord)),
+        msgf("Press %s to replay recorded movements.", hotkeyName(actionReplay)),
+        msgf("Press %s during a replay to queue another, %s to clear the queue.", hotkeyName(actionReplay), hotkeyName(actionClear)),
+        msgf("Press %s to abort a running replay, or slam the mouse into a screen corner.", hotkeyName(actionAbort)),
+        msgf("Press %s to pause a running replay and again to resume.", hotkeyName(actionPause)),
+        msgf("Press %s / %s to speed up or slow down a running replay, %s to go back to the starting speed.",
+            hotkeyName(actionFaster), hotkeyName(actionSlower), hotkeyName(actionResetSpeed)),
+        msgf("Press %s while recording to add a pixel check at the cursor.", hotkeyName(actionCheck)),
+        msgf("Press %s to cycle the replay speed (0.5x-5x).", hotkeyName(actionCycleSpeed)),
+        msgf("Press %s to reload the config file.", hotkeyName(actionReload)),
+        msg("Use 'mrr ctl record-start|record-stop|replay|status|quit' from another console to drive this instance without hotkeys."),
+        msg("Use 'mrr play <file>' to replay a file once without hotkeys."),
+        msg("Use 'mrr list', 'mrr info <name>' and 'mrr use <name>' to browse the recording library and pick what END replays."),
+        msg("Use 'mrr help' to see every command."),
+        msg("Close this console or press Ctrl+C to exit; a recording in progress is saved first."),
+    } {
+        printWrapped(p)
+    }
+    fmt.Println()
+    for _, p := range []string{
+        msg("Run with --debug to see verbose logs."),
+        msg("Run with --json to print each replay result as JSON."),
+        msg("Run with --speed <x> to replay faster or slower."),
+        msg("Run with --loop N|forever and --loop-delay 500ms to repeat a replay; ESC stops the loop."),
+        msg("Run with --interpolate <hz> to glide between sparse moves."),
+        msg("Run with --humanize to jitter timings and curve paths."),
+        msg("Run with --rescale fit|stretch|none and --anchor to adapt recordings made at another resolution."),
+        msg("Run with --from 00:10 --to 00:25 or --events 100:250 to replay only part of a recording."),
+        msg("Run with --reverse to play a recording backwards."),
+        msg("Run with --target-window <title> [--foreground] to replay relative to that window wherever it is now."),
+        msg("Run with --no-dpi-scale to replay coordinates unscaled on monitors whose DPI differs from the recording."),
+        msg("Run with --restore-cursor or --park x,y to choose where the cursor is left after a replay."),
+        msg("Run with --simplify <px> to drop redundant straight-line moves."),
+        msg("Run with --device <id> to record only one mouse ('mrr devices')."),
+        msg("Run with --hotkey record=ctrl+f9 to move a hotkey."),
+        msg("Run with --tray for a notification area icon and menu."),
+        msg("Run with --notify to be notified when a recording is saved or a replay ends."),
+        msg("Run with --log-file <file> to keep a log of the session."),
+        msg("Run with --profile <name> to use a [profile.<name>] from the config; 'mrr ctl profile <name>' or the tray switches it."),
+        msg("Run with --lang de, or any language MRR has messages in, to change the language of these messages."),
+    } {
+        printWrapped(p)
+    }
+
+    runMessageLoop()
+    return exitOK
+}
+
+// installHooks installs the mouse and keyboard hooks, which run on a
+// thread of their own, and listens to Raw Input for --device on this one.
+func installHooks() error {
+    h, err := hook.Install(hook.Mouse|hook.Keyboard, hookEvent)
+    if err != nil {
+        return err
+    }
+    hooks.Store(h)
+
+    if deviceFilter != "" {
+        if err := startRawInput(); err != nil {
+            return fmt.Errorf("could not listen to Raw Input for --device: %v", err)
+        }
+    }
+    return nil
+}
+
+func unInstallHooks() {
+    stopRawInput()
+    if h := hooks.Swap(nil); h != nil {
+        h.Close()
+    }
+}
+
+func runMessageLoop() {
+    var msg MSG
+    for {
+        r, _, _ := procGetMessageW.Call(
+            uintptr(unsafe.Pointer(&msg)),
+            0,
+            0,
+            0,
+        )
+        if r == 0 {
+            break
+        }
+        // Only the tray and Raw Input windows get window messages.
+        procDispatchMessageW.Call(uintptr(unsafe.Pointer(&msg)))
+    }
+}
+
+// ------------------------------------------
+//     Context-aware Record
+// ------------------------------------------
+
+// startRecording begins a fresh recording. It returns false when one is
+// already running.
+func startRecording() bool {
+    // Start before taking mtx: it looks up the window the recording is
+    // anchored to, the --target-window one or the one in front, which
+    // isn't free, and the mouse hook waits on mtx.
+    r := recorder.New(recorder.Options{
+        Simplify: simplifyTolerance,
+        Window:   playerOpts.TargetWindow,
+        NoHooks:  true,
+    })
+    if _, err := r.Start(context.Background()); err != nil {
+        fmt.Println("[ERROR]", msg("Could not start recording:"), err)
+        return false
+    }
+    meta := r.Metadata()
+    if playerOpts.TargetWindow != "" && meta.Window == nil {
+        fmt.Println("[WARN]", msg("Recording without a window reference:"),
+            fmt.Sprintf("no visible window titled %q", playerOpts.TargetWindow))
+    }
+
+    mtx.Lock()
+    if recordingStarted {
+        mtx.Unlock()
+        r.Stop()
+        return false
+    }
+    recordStream = nil
+    if recordFormat == format.FormatNDJSON && !compressRecordings && !encryptRecordings && !libraryIsStore() {
+        path := recordingSavePath()
+        err := os.MkdirAll(filepath.Dir(path), 0755)
+        var s *ndjsonStream
+        if err == nil {
+            s, err = openNDJSONStream(path, meta)
+        }
+        if err != nil {
+            fmt.Println("[WARN]", msg("Could not stream the recording to disk:"), err)
+        } else {
+            recordStream = s
+        }
+    }
+    isRecording = true
+    recordingStarted = true
+    activeRecorder = r
+    recordDone = make(chan struct{})
+    mtx.Unlock()
+
+    fireRecordStart()
+    logEvent("info", "recording_started", nil)
+    return true
+}
+
+// stopRecording ends the running recording and returns what was captured.
+// The second result is false when nothing was being recorded.
+func stopRecording() (*Recording, bool) {
+    mtx.Lock()
+    if !recordingStarted {
+        mtx.Unlock()
+        return nil, false
+    }
+    flushed := keepRecords(flushDevices()...)
+    // Stop adds the moves --simplify held back.
+    n := activeRecorder.Len()
+    recording, _ := activeRecorder.Stop()
+    for _, rec := range recording.Records[n:] {
+        if recordStream != nil {
+            recordStream.add(rec)
+        }
+        flushed = append(flushed, rec)
+    }
+    isRecording = false
+    recordingStarted = false
+    activeRecorder = nil
+    close(recordDone)
+    lastRecording = recording
+    stream := recordStream
+    recordStream = nil
+    mtx.Unlock()
+
+    if stream != nil {
+        if err := stream.close(); err != nil {
+            fmt.Println("[WARN]", msg("Streaming the recording to disk failed:"), err)
+        }
+    }
+    for _, rec := range flushed {
+        fireEventRecorded(rec)
+    }
+    fireRecordStop(recording.Records)
+    return recording, true
+}
+
+// Record captures mouse events until ctx is done or the recording is stopped
+// some other way (e.g. the Insert hotkey). The hooks must already be
+// installed and pumped by runMessageLoop. When ctx ends the recording, the
+// captured records are returned together with ctx.Err().
+func Record(ctx context.Context) (*Recording, error) {
+    if !startRecording() {
+        return nil, fmt.Errorf("a recording is already in progress")
+    }
+    mtx.Lock()
+    done := recordDone
+    mtx.Unlock()
+
+    select {
+    case <-ctx.Done():
+        recording, _ := stopRecording()
+        return recording, ctx.Err()
+    case <-done:
+        mtx.Lock()
+        recording := lastRecording
+        mtx.Unlock()
+        return recording, nil
+    }
+}
@@ -0,0 +1,123 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+    "syscall"
+    "unicode/utf8"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Messages
+// ------------------------------------------
+
+// The console messages are written in English in the code and looked up
+// in the catalog of the user's language when printed, with msg and msgf.
+// A catalog maps the English text to its translation, so a message
+// missing from it, a new one say, still prints in English. The [INFO],
+// [WARN] and [ERROR] prefixes, [DEBUG] lines, the control pipe's replies
+// and JSON stay English for the scripts that read them.
+//
+// The language is --lang (or lang in the config, or MRR_LANG), else the
+// one Windows is set to. A catalog is a messages_<lang>.go file that adds
+// itself to catalogs.
+
+const LOCALE_NAME_MAX_LENGTH = 85
+
+var procGetUserDefaultLocaleName = kernel32.MustFindProc("GetUserDefaultLocaleName")
+
+// catalogs are the translations, by language code.
+var catalogs = map[string]map[string]string{}
+
+// langFlag is the --lang language, or "" for the system's.
+var langFlag string
+
+var (
+    systemLangOnce sync.Once
+    systemLang     string
+)
+
+// parseLang checks a --lang value: a language code such as de, or a
+// locale such as de-DE, en for English and auto for the system's.
+func parseLang(s string) (string, error) {
+    lang := langCode(s)
+    if lang == "auto" || lang == "en" || catalogs[lang] != nil {
+        return lang, nil
+    }
+    names := []string{"auto", "en"}
+    for name := range catalogs {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return "", fmt.Errorf("no messages in %q; the languages are %s", s, strings.Join(names, ", "))
+}
+
+// langCode turns a locale name such as de-DE into its language, de.
+func langCode(locale string) string {
+    locale = strings.ToLower(strings.TrimSpace(locale))
+    if i := strings.IndexAny(locale, "-_."); i >= 0 {
+        locale = locale[:i]
+    }
+    return locale
+}
+
+// language is the language the messages are printed in.
+func language() string {
+    lang := langFlag
+    if lang == "" {
+        // Commands that read no config still follow MRR_LANG.
+        lang, _ = envFlag("--lang")
+        lang = langCode(lang)
+    }
+    if lang == "" || lang == "auto" {
+        systemLangOnce.Do(func() {
+            buf := make([]uint16, LOCALE_NAME_MAX_LENGTH)
+            if n, _, _ := procGetUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf))); n != 0 {
+                systemLang = langCode(syscall.UTF16ToString(buf))
+            }
+        })
+        lang = systemLang
+    }
+    return lang
+}
+
+// msg is s in the user's language.
+func msg(s string) string {
+    if t, ok := catalogs[language()][s]; ok {
+        return t
+    }
+    return s
+}
+
+// msgf formats the message format in the user's language. Translations
+// can reorder the arguments with %[n]s.
+func msgf(format string, a ...interface{}) string {
+    return fmt.Sprintf(msg(format), a...)
+}
+
+// bannerWidth is how wide printWrapped fills a line.
+const bannerWidth = 62
+
+// printWrapped prints text as an indented paragraph, wrapped between
+// words, so a translation longer or shorter than the English still lines
+// up.
+func printWrapped(text string) {
+    line, width := "", 0
+    for _, word := range strings.Fields(text) {
+        n := utf8.RuneCountInString(word)
+        if width > 0 && width+1+n > bannerWidth {
+            fmt.Println(line)
+            line, width = "", 0
+        }
+        line += " " + word
+        width += 1 + n
+    }
+    if line != "" {
+        fmt.Println(line)
+    }
+}
@@ -0,0 +1,367 @@
+// +build windows
+
+package main
+
+// German messages.
+func init() {
+    catalogs["de"] = map[string]string{
+        // Banner
+        "Press %s to toggle recording.":                                                                                          "%s startet und beendet eine Aufnahme.",
+        "Press %s to replay recorded movements.":                                                                                 "%s spielt die aufgenommenen Bewegungen ab.",
+        "Press %s during a replay to queue another, %s to clear the queue.":                                                      "%s während einer Wiedergabe reiht eine weitere ein, %s leert die Warteschlange.",
+        "Press %s to abort a running replay, or slam the mouse into a screen corner.":                                            "%s bricht eine laufende Wiedergabe ab, ebenso die Maus in eine Bildschirmecke zu schieben.",
+        "Press %s to pause a running replay and again to resume.":                                                                "%s hält eine laufende Wiedergabe an, ein zweites Mal setzt sie fort.",
+        "Press %s / %s to speed up or slow down a running replay, %s to go back to the starting speed.":                          "%s / %s beschleunigen oder verlangsamen eine laufende Wiedergabe, %s kehrt zur Anfangsgeschwindigkeit zurück.",
+        "Press %s while recording to add a pixel check at the cursor.":                                                           "%s fügt während der Aufnahme eine Pixelprüfung am Mauszeiger ein.",
+        "Press %s to cycle the replay speed (0.5x-5x).":                                                                          "%s wechselt die Wiedergabegeschwindigkeit (0.5x-5x).",
+        "Press %s to reload the config file.":                                                                                    "%s lädt die Konfigurationsdatei neu.",
+        "Use 'mrr ctl record-start|record-stop|replay|status|quit' from another console to drive this instance without hotkeys.": "Mit 'mrr ctl record-start|record-stop|replay|status|quit' lässt sich diese Instanz aus einer anderen Konsole ohne Tastenkürzel steuern.",
+        "Use 'mrr play <file>' to replay a file once without hotkeys.":                                                           "Mit 'mrr play <datei>' wird eine Datei einmal ohne Tastenkürzel abgespielt.",
+        "Use 'mrr list', 'mrr info <name>' and 'mrr use <name>' to browse the recording library and pick what END replays.":      "Mit 'mrr list', 'mrr info <name>' und 'mrr use <name>' durchsuchen Sie die Aufnahmebibliothek und wählen, was ENDE abspielt.",
+        "Use 'mrr help' to see every command.":                                                                                   "'mrr help' zeigt alle Befehle.",
+        "Close this console or press Ctrl+C to exit; a recording in progress is saved first.":                                    "Zum Beenden diese Konsole schließen oder Strg+C drücken; eine laufende Aufnahme wird vorher gespeichert.",
+        "Run with --debug to see verbose logs.":                                                                                  "Mit --debug starten, um ausführliche Protokolle zu sehen.",
+        "Run with --json to print each replay result as JSON.":                                                                   "Mit --json starten, um jedes Wiedergabeergebnis als JSON auszugeben.",
+        "Run with --speed <x> to replay faster or slower.":                                                                       "Mit --speed <x> starten, um schneller oder langsamer abzuspielen.",
+        "Run with --loop N|forever and --loop-delay 500ms to repeat a replay; ESC stops the loop.":                               "Mit --loop N|forever und --loop-delay 500ms starten, um eine Wiedergabe zu wiederholen; ESC beendet die Schleife.",
+        "Run with --interpolate <hz> to glide between sparse moves.":                                                             "Mit --interpolate <hz> starten, um zwischen spärlichen Bewegungen zu gleiten.",
+        "Run with --humanize to jitter timings and curve paths.":                                                                 "Mit --humanize starten, um Zeiten zu variieren und Wege zu krümmen.",
+        "Run with --rescale fit|stretch|none and --anchor to adapt recordings made at another resolution.":                       "Mit --rescale fit|stretch|none und --anchor starten, um Aufnahmen aus einer anderen Auflösung anzupassen.",
+        "Run with --from 00:10 --to 00:25 or --events 100:250 to replay only part of a recording.":                               "Mit --from 00:10 --to 00:25 oder --events 100:250 starten, um nur einen Teil einer Aufnahme abzuspielen.",
+        "Run with --reverse to play a recording backwards.":                                                                      "Mit --reverse starten, um eine Aufnahme rückwärts abzuspielen.",
+        "Run with --target-window <title> [--foreground] to replay relative to that window wherever it is now.":                  "Mit --target-window <titel> [--foreground] starten, um relativ zu diesem Fenster abzuspielen, wo immer es gerade ist.",
+        "Run with --no-dpi-scale to replay coordinates unscaled on monitors whose DPI differs from the recording.":               "Mit --no-dpi-scale starten, um Koordinaten auf Monitoren mit anderer DPI als bei der Aufnahme unskaliert abzuspielen.",
+        "Run with --restore-cursor or --park x,y to choose where the cursor is left after a replay.":                             "Mit --restore-cursor oder --park x,y starten, um festzulegen, wo der Mauszeiger nach einer Wiedergabe bleibt.",
+        "Run with --simplify <px> to drop redundant straight-line moves.":                                                        "Mit --simplify <px> starten, um überflüssige geradlinige Bewegungen zu verwerfen.",
+        "Run with --device <id> to record only one mouse ('mrr devices').":                                                       "Mit --device <id> starten, um nur eine Maus aufzunehmen ('mrr devices').",
+        "Run with --hotkey record=ctrl+f9 to move a hotkey.":                                                                     "Mit --hotkey record=ctrl+f9 starten, um ein Tastenkürzel zu verlegen.",
+        "Run with --tray for a notification area icon and menu.":                                                                 "Mit --tray starten für ein Symbol mit Menü im Infobereich.",
+        "Run with --log-file <file> to keep a log of the session.":                                                               "Mit --log-file <datei> starten, um die Sitzung zu protokollieren.",
+        "Run with --profile <name> to use a [profile.<name>] from the config; 'mrr ctl profile <name>' or the tray switches it.": "Mit --profile <name> starten, um ein [profile.<name>] aus der Konfiguration zu verwenden; 'mrr ctl profile <name>' oder das Infobereichsmenü wechseln es.",
+        "Run with --lang de, or any language MRR has messages in, to change the language of these messages.":                     "Mit --lang en oder einer anderen Sprache, in der MRR Meldungen hat, starten, um die Sprache dieser Meldungen zu ändern.",
+
+        // Hotkeys
+        "%s pressed -> Stop recording":                   "%s gedrückt -> Aufnahme beenden",
+        "%s pressed -> Start recording":                  "%s gedrückt -> Aufnahme starten",
+        "%s pressed -> Replay queued (%d waiting)":       "%s gedrückt -> Wiedergabe eingereiht (%d wartend)",
+        "%s pressed -> Replaying recorded movements":     "%s gedrückt -> Aufgenommene Bewegungen werden abgespielt",
+        "%s pressed -> Cleared %d queued replay(s)":      "%s gedrückt -> %d eingereihte Wiedergabe(n) entfernt",
+        "%s pressed -> Resuming replay":                  "%s gedrückt -> Wiedergabe wird fortgesetzt",
+        "%s pressed -> Pausing replay":                   "%s gedrückt -> Wiedergabe wird angehalten",
+        "%s pressed -> Replay speed %gx":                 "%s gedrückt -> Wiedergabegeschwindigkeit %gx",
+        "%s pressed -> Aborting replay":                  "%s gedrückt -> Wiedergabe wird abgebrochen",
+        "%s pressed -> Aborting replay, input unblocked": "%s gedrückt -> Wiedergabe wird abgebrochen, Eingabe freigegeben",
+        "%s pressed -> Reloaded the config":              "%s gedrückt -> Konfiguration neu geladen",
+        "Replay speed %gx":                               "Wiedergabegeschwindigkeit %gx",
+        "Check added: pixel (%d,%d) must be %s":          "Prüfung hinzugefügt: Pixel (%d,%d) muss %s sein",
+
+        // Tray
+        "Start recording":                      "Aufnahme starten",
+        "Stop recording":                       "Aufnahme beenden",
+        "Replay":                               "Abspielen",
+        "Abort replay":                         "Wiedergabe abbrechen",
+        "Open recordings folder":               "Aufnahmeordner öffnen",
+        "Show console":                         "Konsole anzeigen",
+        "Hide console":                         "Konsole ausblenden",
+        "Profile":                              "Profil",
+        "Exit":                                 "Beenden",
+        "recording":                            "Aufnahme",
+        "idle":                                 "bereit",
+        "replaying":                            "Wiedergabe",
+        "(paused)":                             "(angehalten)",
+        "Tray -> Stop recording":               "Infobereich -> Aufnahme beenden",
+        "Tray -> Start recording":              "Infobereich -> Aufnahme starten",
+        "Tray -> Replay queued (%d waiting)":   "Infobereich -> Wiedergabe eingereiht (%d wartend)",
+        "Tray -> Replaying recorded movements": "Infobereich -> Aufgenommene Bewegungen werden abgespielt",
+        "Tray -> Aborting replay":              "Infobereich -> Wiedergabe wird abgebrochen",
+        "Tray -> Exit":                         "Infobereich -> Beenden",
+        "Tray -> Switched to profile %s":       "Infobereich -> Zu Profil %s gewechselt",
+
+        // Control pipe
+        "Control pipe -> Replaying %s from now on":     "Steuerkanal -> Ab jetzt wird %s abgespielt",
+        "Control pipe -> Switched to profile %s":       "Steuerkanal -> Zu Profil %s gewechselt",
+        "Control pipe -> Start recording":              "Steuerkanal -> Aufnahme starten",
+        "Control pipe -> Stop recording":               "Steuerkanal -> Aufnahme beenden",
+        "Control pipe -> Replaying recorded movements": "Steuerkanal -> Aufgenommene Bewegungen werden abgespielt",
+        "Control pipe -> Aborting replay":              "Steuerkanal -> Wiedergabe wird abgebrochen",
+        "Control pipe -> Pausing replay":               "Steuerkanal -> Wiedergabe wird angehalten",
+        "Control pipe -> Resuming replay":              "Steuerkanal -> Wiedergabe wird fortgesetzt",
+        "Control pipe -> Reloaded the config":          "Steuerkanal -> Konfiguration neu geladen",
+        "Control pipe -> Exit":                         "Steuerkanal -> Beenden",
+
+        // Shutdown
+        "%s, exiting":      "%s, wird beendet",
+        "Console closed":   "Konsole geschlossen",
+        "Logging off":      "Abmeldung",
+        "Shutting down":    "Herunterfahren",
+        "Console event %d": "Konsolenereignis %d",
+
+        // Recording and replaying
+        "A recording is already in progress":                       "Es läuft bereits eine Aufnahme",
+        "No recording in progress":                                 "Keine Aufnahme aktiv",
+        "No replay in progress":                                    "Keine Wiedergabe aktiv",
+        "Saved recording to %s":                                    "Aufnahme gespeichert unter %s",
+        "Recording for %s; press %s or Ctrl+C to stop sooner":      "Aufnahme für %s; %s oder Strg+C beendet sie früher",
+        "Recording; press %s or Ctrl+C to stop":                    "Aufnahme läuft; %s oder Strg+C beendet sie",
+        "Recording without a window reference:":                    "Aufnahme ohne Fensterbezug:",
+        "Recording the mouse only from %s":                         "Nur die Maus %s wird aufgenommen",
+        "Tagging mouse events with their device":                   "Mausereignisse werden mit ihrem Gerät versehen",
+        "No attached mouse matches --device %q, see 'mrr devices'": "Keine angeschlossene Maus passt zu --device %q, siehe 'mrr devices'",
+        "Dropped %d queued replay(s)":                              "%d eingereihte Wiedergabe(n) verworfen",
+        "Starting queued replay of %s (%d more queued)":            "Eingereihte Wiedergabe von %s startet (%d weitere eingereiht)",
+        "Replaying %s":        "%s wird abgespielt",
+        "Playing playlist %s": "Wiedergabeliste %s wird abgespielt",
+        "Replay completed.":   "Wiedergabe abgeschlossen.",
+        "Replay aborted":      "Wiedergabe abgebrochen",
+        "Replay aborted:":     "Wiedergabe abgebrochen:",
+        "Replay failed:":      "Wiedergabe fehlgeschlagen:",
+        "Replay paused":       "Wiedergabe angehalten",
+        "Replay resumed":      "Wiedergabe fortgesetzt",
+        "Injected %d/%d events in %.2fs (%d iteration(s), max drift %.1fms)": "%d/%d Ereignisse in %.2fs eingespielt (%d Durchlauf/Durchläufe, max. Abweichung %.1fms)",
+        "Resuming at record %d of %d":                                        "Fortsetzung bei Eintrag %d von %d",
+        "Stopped at record %d; run with --resume to continue from there":     "Bei Eintrag %d gestoppt; mit --resume geht es dort weiter",
+        "Step mode: press Enter to inject each event":                        "Schrittmodus: Enter spielt jedes Ereignis einzeln ein",
+        "Input not blocked:":                                                     "Eingabe nicht gesperrt:",
+        "%s backend unavailable, using SendInput: %v":                            "Backend %s nicht verfügbar, SendInput wird verwendet: %v",
+        "Check #%d failed (%s), replaying %d record(s) again (%d/%d)":            "Prüfung #%d fehlgeschlagen (%s), %d Eintrag/Einträge werden erneut abgespielt (%d/%d)",
+        "Ignoring checkpoint: it was saved for %d records, the recording has %d": "Prüfpunkt wird ignoriert: er gehört zu %d Einträgen, die Aufnahme hat %d",
+        "Ignoring checkpoint:":                                                   "Prüfpunkt wird ignoriert:",
+        "Loaded %d scheduled job(s) from %s":                                     "%d geplante Aufgabe(n) aus %s geladen",
+        "Schedule -> running %q (%s)":                                            "Zeitplan -> %q läuft (%s)",
+        "Schedule -> skipped %q: a replay is already in progress":                "Zeitplan -> %q übersprungen: es läuft bereits eine Wiedergabe",
+        "Schedule -> %q failed: %v":                                              "Zeitplan -> %q fehlgeschlagen: %v",
+        "Schedule -> %q finished: %d events in %.2fs":                            "Zeitplan -> %q beendet: %d Ereignisse in %.2fs",
+        "Using profile %s":                                                       "Profil %s wird verwendet",
+        "Switched to profile %s":                                                 "Zu Profil %s gewechselt",
+        "Reloaded the config":                                                    "Konfiguration neu geladen",
+        "Agent started (pid %d), logging to %s":                                  "Agent gestartet (PID %d), Protokoll in %s",
+        "The agent runs in session 0 (as a service), where input can't reach anyone's desktop": "Der Agent läuft in Sitzung 0 (als Dienst), wo Eingaben keinen Desktop erreichen",
+        "Use 'mrr ctl status' to talk to it and 'mrr ctl quit' to stop it.":                    "Mit 'mrr ctl status' sprechen Sie ihn an, mit 'mrr ctl quit' beenden Sie ihn.",
+
+        // Errors
+        "Could not add a check:":                                             "Prüfung konnte nicht hinzugefügt werden:",
+        "Could not add the tray icon:":                                       "Symbol im Infobereich konnte nicht hinzugefügt werden:",
+        "Could not back up %s: %v":                                           "Sicherung von %s fehlgeschlagen: %v",
+        "Could not create control pipe:":                                     "Steuerkanal konnte nicht erstellt werden:",
+        "Could not draw recording:":                                          "Aufnahme konnte nicht gezeichnet werden:",
+        "Could not import:":                                                  "Import fehlgeschlagen:",
+        "Could not install hooks:":                                           "Hooks konnten nicht installiert werden:",
+        "Could not list the input devices:":                                  "Eingabegeräte konnten nicht aufgelistet werden:",
+        "Could not load playlist:":                                           "Wiedergabeliste konnte nicht geladen werden:",
+        "Could not load recording:":                                          "Aufnahme konnte nicht geladen werden:",
+        "Could not load schedule:":                                           "Zeitplan konnte nicht geladen werden:",
+        "Could not load the background:":                                     "Hintergrund konnte nicht geladen werden:",
+        "Could not make the recording current:":                              "Aufnahme konnte nicht zur aktuellen gemacht werden:",
+        "Could not open the browser:":                                        "Browser konnte nicht geöffnet werden:",
+        "Could not open the log file:":                                       "Protokolldatei konnte nicht geöffnet werden:",
+        "Could not open the recordings folder:":                              "Aufnahmeordner konnte nicht geöffnet werden:",
+        "Could not reach a running MRR instance:":                            "Keine laufende MRR-Instanz erreichbar:",
+        "Could not read reply:":                                              "Antwort konnte nicht gelesen werden:",
+        "Could not read the config:":                                         "Konfiguration konnte nicht gelesen werden:",
+        "Could not read the library:":                                        "Bibliothek konnte nicht gelesen werden:",
+        "Could not reload the config:":                                       "Konfiguration konnte nicht neu geladen werden:",
+        "Could not render:":                                                  "Rendern fehlgeschlagen:",
+        "Could not save checkpoint:":                                         "Prüfpunkt konnte nicht gespeichert werden:",
+        "Could not start recording:":                                         "Aufnahme konnte nicht gestartet werden:",
+        "Could not save recording:":                                          "Aufnahme konnte nicht gespeichert werden:",
+        "Could not send command:":                                            "Befehl konnte nicht gesendet werden:",
+        "Could not start the agent:":                                         "Agent konnte nicht gestartet werden:",
+        "Could not start the editor:":                                        "Editor konnte nicht gestartet werden:",
+        "Could not stream the recording to disk:":                            "Aufnahme konnte nicht laufend auf die Festplatte geschrieben werden:",
+        "Streaming the recording to disk failed:":                            "Laufendes Schreiben der Aufnahme auf die Festplatte fehlgeschlagen:",
+        "Could not switch the profile:":                                      "Profil konnte nicht gewechselt werden:",
+        "Could not write --result-json:":                                     "--result-json konnte nicht geschrieben werden:",
+        "Unknown command %q":                                                 "Unbekannter Befehl %q",
+        "Unknown command %q%s":                                               "Unbekannter Befehl %q%s",
+        "Unknown edit %q":                                                    "Unbekannte Bearbeitung %q",
+        "No completion for %q%s":                                             "Keine Vervollständigung für %q%s",
+        "invalid --duration %q":                                              "ungültige --duration %q",
+        "--duration needs a duration such as 30s":                            "--duration braucht eine Dauer wie 30s",
+        "--at needs a time such as 00:30":                                    "--at braucht eine Zeit wie 00:30",
+        "--at times must increase":                                           "--at-Zeiten müssen aufsteigend sein",
+        "--gap needs a duration":                                             "--gap braucht eine Dauer",
+        "--coords needs screen or client":                                    "--coords braucht screen oder client",
+        "-o needs a file":                                                    "-o braucht eine Datei",
+        "%s needs a format":                                                  "%s braucht ein Format",
+        "line %d skipped (%s): %v":                                           "Zeile %d übersprungen (%s): %v",
+        "This console can't show the TUI:":                                   "Diese Konsole kann die TUI nicht anzeigen:",
+        "mrr tui needs a console; use 'mrr hook' or 'mrr play' from scripts": "mrr tui braucht eine Konsole; in Skripten 'mrr hook' oder 'mrr play' verwenden",
+
+        // Library and editing
+        "No recordings in %s":                                   "Keine Aufnahmen in %s",
+        "Recording %s":                                          "Aufnahme %s",
+        "Recording summary:":                                    "Zusammenfassung der Aufnahme:",
+        "Current recording is now %s":                           "Aktuelle Aufnahme ist jetzt %s",
+        "Removed %d recording(s)":                               "%d Aufnahme(n) gelöscht",
+        "Imported %d recording(s) into %s":                      "%d Aufnahme(n) nach %s importiert",
+        "Wrote %d records to %s":                                "%d Einträge nach %s geschrieben",
+        "Wrote %d records to %s as %s":                          "%d Einträge nach %s als %s geschrieben",
+        "Wrote %d records from %d recordings to %s":             "%d Einträge aus %d Aufnahmen nach %s geschrieben",
+        "%s: %s (%d -> %d records, %s)":                         "%s: %s (%d -> %d Einträge, %s)",
+        "Saved %s (%d records, %s)":                             "%s gespeichert (%d Einträge, %s)",
+        "Editing %s at %s":                                      "%s wird unter %s bearbeitet",
+        "Quit from the page or press Ctrl+C to stop the editor": "Den Editor über die Seite oder mit Strg+C beenden",
+        "Part %d (%s) has no records":                           "Teil %d (%s) hat keine Einträge",
+        "%s is held down across the cut at %s":                  "%s ist über den Schnitt bei %s hinweg gedrückt",
+        "%s is held down where the recording now starts":        "%s ist dort gedrückt, wo die Aufnahme jetzt beginnt",
+        "%s is left held down where the recording now ends":     "%s bleibt dort gedrückt, wo die Aufnahme jetzt endet",
+        "%s is still held down where %s starts":                 "%s ist noch gedrückt, wo %s beginnt",
+        "%d region check(s) keep their size and hash; record them again at the new scale": "%d Bereichsprüfung(en) behalten Größe und Hash; bitte im neuen Maßstab neu aufnehmen",
+        "Drew %s to %s":                          "%s nach %s gezeichnet",
+        "Can't draw to %s, name it .svg or .png": "Kann nicht nach %s zeichnen, bitte .svg oder .png verwenden",
+        "Rendered %s to %s":                      "%s nach %s gerendert",
+        "Nothing to render":                      "Nichts zu rendern",
+
+        // Shell
+        "MRR shell; type 'help' for the commands and 'exit' to quit.": "MRR-Shell; 'help' zeigt die Befehle, 'exit' beendet sie.",
+        "Recording; 'stop' saves it":                                  "Aufnahme läuft; 'stop' speichert sie",
+        "Queued %s (%d waiting)":                                      "%s eingereiht (%d wartend)",
+        "Flags can't change a running replay; 'wait' or 'stop' first": "Optionen können eine laufende Wiedergabe nicht ändern; erst 'wait' oder 'stop'",
+        "Nothing to stop":                                             "Nichts zu beenden",
+        "Set %s":                                                      "Gesetzt: %s",
+        "Using %s":                                                    "Verwendet: %s",
+        "Use 'profile <name>' to switch profiles":                     "Profile wechseln Sie mit 'profile <name>'",
+        "usage: profile [name]":                                       "Aufruf: profile [name]",
+        "usage: record [start|stop]":                                  "Aufruf: record [start|stop]",
+        "usage: set <flags>":                                          "Aufruf: set <optionen>",
+        "Recording":                                                   "Aufnahme läuft",
+        "Paused %s":                                                   "Angehalten %s",
+        "Idle":                                                        "Bereit",
+        "The hotkeys work meanwhile: %s records, %s replays, %s aborts.":                                   "Die Tastenkürzel funktionieren weiterhin: %s nimmt auf, %s spielt ab, %s bricht ab.",
+        "start a recording, or stop and save it":                                                           "eine Aufnahme starten, oder beenden und speichern",
+        "replay name, or what End replays, with replay flags for this replay; queued behind a running one": "name abspielen, oder was Ende abspielt, mit Wiedergabeoptionen nur für diese Wiedergabe; hinter einer laufenden eingereiht",
+        "save the recording, or abort the replay and its queue":                                            "die Aufnahme speichern, oder die Wiedergabe samt Warteschlange abbrechen",
+        "pause or resume the running replay":                                                               "die laufende Wiedergabe anhalten oder fortsetzen",
+        "wait for the running replay and its queue to end":                                                 "warten, bis die laufende Wiedergabe und ihre Warteschlange enden",
+        "say what MRR is doing":                                                                            "anzeigen, was MRR gerade tut",
+        "apply flags for the rest of the session, e.g. set --save-as demo":                                 "Optionen für den Rest der Sitzung setzen, z. B. set --save-as demo",
+        "reload the config file":                                                                           "die Konfigurationsdatei neu laden",
+        "switch to a [profile.name] from the config, or say which is in use":                               "zu einem [profile.name] aus der Konfiguration wechseln, oder anzeigen, welches aktiv ist",
+        "as 'mrr <command>'":                                                                               "wie 'mrr <befehl>'",
+        "this list, or a library command's usage and flags":                                                "diese Liste, oder Aufruf und Optionen eines Bibliotheksbefehls",
+        "save a recording in progress, abort any replay and quit":                                          "eine laufende Aufnahme speichern, jede Wiedergabe abbrechen und beenden",
+
+        // mrr help
+        "Run 'mrr help' for the list.":                    "'mrr help' zeigt die Liste.",
+        "Run 'mrr help <command>' for a command's flags.": "'mrr help <befehl>' zeigt die Optionen eines Befehls.",
+        "flags:": "Optionen:",
+        "See the README for what each flag does.":                                "Was jede Option tut, steht in der README.",
+        "run in the background and record and replay with hotkeys (the default)": "im Hintergrund laufen und mit Tastenkürzeln aufnehmen und abspielen (Standard)",
+        "start 'mrr hook' in the background, with a tray icon and no console":    "'mrr hook' im Hintergrund starten, mit Symbol im Infobereich und ohne Konsole",
+        "record until Insert, Ctrl+C or --duration, without hotkeys":             "aufnehmen bis Einfg, Strg+C oder --duration, ohne Tastenkürzel",
+        "browse, record and replay recordings in a full-screen console UI":       "Aufnahmen in einer Vollbild-Konsolenoberfläche durchsuchen, aufnehmen und abspielen",
+        "record, replay and manage the library from an interactive prompt":       "über eine interaktive Eingabe aufnehmen, abspielen und die Bibliothek verwalten",
+        "replay a recording or playlist once and exit":                           "eine Aufnahme oder Wiedergabeliste einmal abspielen und beenden",
+        "list the mice, keyboards and other input devices attached":              "die angeschlossenen Mäuse, Tastaturen und anderen Eingabegeräte auflisten",
+        "list the recording library":                                             "die Aufnahmebibliothek auflisten",
+        "show the details of a recording":                                        "die Details einer Aufnahme anzeigen",
+        "make a library recording the one End replays":                           "eine Aufnahme der Bibliothek zu der machen, die Ende abspielt",
+        "delete library recordings":                                              "Aufnahmen aus der Bibliothek löschen",
+        "copy recordings into the library":                                       "Aufnahmen in die Bibliothek kopieren",
+        "change a recording's format or export it as a script":                   "das Format einer Aufnahme ändern oder sie als Skript exportieren",
+        "trim, retime, move or thin out a recording":                             "eine Aufnahme kürzen, neu takten, verschieben oder ausdünnen",
+        "edit a recording's events on a timeline in the browser":                 "die Ereignisse einer Aufnahme auf einer Zeitleiste im Browser bearbeiten",
+        "cut a recording into parts":                                             "eine Aufnahme in Teile schneiden",
+        "join recordings one after another":                                      "Aufnahmen hintereinander verbinden",
+        "draw a recording's path":                                                "den Weg einer Aufnahme zeichnen",
+        "animate a recording without replaying it":                               "eine Aufnahme animieren, ohne sie abzuspielen",
+        "print a script that completes mrr's commands, flags and recordings":     "ein Skript ausgeben, das mrrs Befehle, Optionen und Aufnahmen vervollständigt",
+        "drive a running 'mrr hook' from another console":                        "ein laufendes 'mrr hook' aus einer anderen Konsole steuern",
+        "show this list, or a command's usage and flags":                         "diese Liste anzeigen, oder Aufruf und Optionen eines Befehls",
+
+        // Setup
+        "Welcome to Mouse Recorder & Replayer": "Willkommen bei Mouse Recorder & Replayer",
+        "This looks like MRR's first run. A few questions set up the hotkeys, where recordings go and how monitors with different scaling are handled.": "MRR scheint zum ersten Mal zu laufen. Ein paar Fragen legen die Tastenkürzel fest, wohin Aufnahmen gehen und wie Monitore mit unterschiedlicher Skalierung behandelt werden.",
+        "Set up now?": "Jetzt einrichten?",
+        "Y/n":         "J/n",
+        "y/N":         "j/N",
+        "y":           "j",
+        "Run 'mrr setup' to choose the hotkeys, the library folder and how monitors are handled.": "Mit 'mrr setup' wählen Sie die Tastenkürzel, den Bibliotheksordner und den Umgang mit Monitoren.",
+        "mrr setup asks questions and needs a console":                                            "mrr setup stellt Fragen und braucht eine Konsole",
+        "%s exists; the setup replaces it, settings it doesn't ask about included.":               "%s existiert bereits; die Einrichtung ersetzt die Datei, auch Einstellungen, nach denen sie nicht fragt.",
+        "Replace it?":                 "Ersetzen?",
+        "Could not write the config:": "Konfiguration konnte nicht geschrieben werden:",
+        "1/3 Where recordings go":     "1/3 Wohin Aufnahmen gehen",
+        "Recordings are saved to the library folder, where 'mrr list' and 'mrr play <name>' find them.": "Aufnahmen werden im Bibliotheksordner gespeichert, wo 'mrr list' und 'mrr play <name>' sie finden.",
+        "Library folder": "Bibliotheksordner",
+        "2/3 Hotkeys":    "2/3 Tastenkürzel",
+        "Keys go by name, such as f9, end or numpadadd, with ctrl, alt, shift or win in front: ctrl+shift+r.": "Tasten werden beim Namen genannt, etwa f9, end oder numpadadd, mit ctrl, alt, shift oder win davor: ctrl+shift+r.",
+        "Key to start and stop recording":  "Taste zum Starten und Beenden einer Aufnahme",
+        "Key to replay":                    "Taste zum Abspielen",
+        "Key to abort a replay":            "Taste zum Abbrechen einer Wiedergabe",
+        "Key to pause and resume a replay": "Taste zum Anhalten und Fortsetzen einer Wiedergabe",
+        "%s is already the %s hotkey":      "%s ist bereits das Tastenkürzel für %s",
+        "3/3 Monitors":                     "3/3 Monitore",
+        "%dx%d at %d,%d":                   "%dx%d bei %d,%d",
+        "primary":                          "Hauptbildschirm",
+        "Your monitors use different scaling. Recordings note the scaling of the monitor under the cursor, and replays convert positions for the scaling the monitor has then.": "Ihre Monitore sind unterschiedlich skaliert. Aufnahmen merken sich die Skalierung des Monitors unter dem Mauszeiger, und Wiedergaben rechnen Positionen auf die Skalierung um, die der Monitor dann hat.",
+        "Convert positions between scalings?": "Positionen zwischen Skalierungen umrechnen?",
+        "Your monitors use the same scaling. Recordings made at another scaling are converted when replayed; --no-dpi-scale turns that off.": "Ihre Monitore sind gleich skaliert. Aufnahmen mit anderer Skalierung werden beim Abspielen umgerechnet; --no-dpi-scale schaltet das ab.",
+        "Positions are kept across monitors as they are; --rescale adapts recordings made on another screen layout.":                         "Positionen bleiben über Monitore hinweg, wie sie sind; --rescale passt Aufnahmen von einer anderen Bildschirmanordnung an.",
+        "Written by 'mrr setup'. Any flag can be set here without its dashes; see the README's config file section.":                         "Geschrieben von 'mrr setup'. Jede Option lässt sich hier ohne ihre Striche setzen; siehe den Abschnitt zur Konfigurationsdatei in der README.",
+        "Saved the settings to %s; edit it or run 'mrr setup' to change them":                                                                "Einstellungen in %s gespeichert; zum Ändern die Datei bearbeiten oder 'mrr setup' ausführen",
+        "choose the hotkeys, the library folder and how monitors are handled, and save them to the config":                                   "Tastenkürzel, Bibliotheksordner und Umgang mit Monitoren wählen und in der Konfiguration speichern",
+        "Could not register the file types:":                     "Dateitypen konnten nicht registriert werden:",
+        "Could not unregister the file types:":                   "Dateitypen konnten nicht entfernt werden:",
+        "Double-clicking %s files now replays them with %s":      "Ein Doppelklick auf %s-Dateien spielt sie jetzt ab mit %s",
+        "If Windows asks which app to open them with, pick MRR.": "Fragt Windows, mit welcher App sie geöffnet werden sollen, wählen Sie MRR.",
+        "Double-clicking %s files no longer runs MRR":            "Ein Doppelklick auf %s-Dateien startet MRR nicht mehr",
+        "MRR recording":                     "MRR-Aufnahme",
+        "Replay with MRR":                   "Mit MRR abspielen",
+        "Press Enter to close this window.": "Enter schließt dieses Fenster.",
+        "make double-clicking a recording or playlist replay it with 'mrr play'":                                              "Doppelklick auf eine Aufnahme oder Wiedergabeliste spielt sie mit 'mrr play' ab",
+        "stop double-clicking recordings from running MRR":                                                                    "Doppelklick auf Aufnahmen startet MRR nicht mehr",
+        "open the recordings folder in Explorer":                                                                              "den Aufnahmeordner im Explorer öffnen",
+        "Waiting for %s to be released before replaying":                                                                      "Warte, bis %s losgelassen ist, bevor die Wiedergabe beginnt",
+        "MRR is already running; two instances would fight over the hotkeys and the recordings.":                              "MRR läuft bereits; zwei Instanzen würden sich um die Tastenkürzel und die Aufnahmen streiten.",
+        "Drive it with 'mrr ctl' or 'mrr play <file>', or stop it with 'mrr ctl quit' and try again.":                         "Steuern Sie es mit 'mrr ctl' oder 'mrr play <Datei>', oder beenden Sie es mit 'mrr ctl quit' und versuchen Sie es erneut.",
+        "MRR is already running, but can't take commands:":                                                                    "MRR läuft bereits, kann aber keine Befehle annehmen:",
+        "Only 'mrr hook' and the agent take commands; stop the 'mrr record', 'mrr tui' or 'mrr shell' running and try again.": "Nur 'mrr hook' und der Agent nehmen Befehle an; beenden Sie das laufende 'mrr record', 'mrr tui' oder 'mrr shell' und versuchen Sie es erneut.",
+        "Replaying %s in the MRR that is already running":                                                                     "Spiele %s im bereits laufenden MRR ab",
+        "Recording in the MRR that is already running; press Ctrl+C here or its record hotkey to stop":                        "Aufnahme im bereits laufenden MRR; Strg+C hier oder dessen Aufnahme-Tastenkürzel beendet sie",
+        "The running MRR stopped the recording and saved it":                                                                  "Das laufende MRR hat die Aufnahme beendet und gespeichert",
+        "Control pipe -> Replaying %s":                                                                                        "Steuerkanal -> Spiele %s ab",
+        "Recording saved":                                                                                                     "Aufnahme gespeichert",
+        "%s, %s long":                                                                                                         "%s, %s lang",
+        "Replay finished":                                                                                                     "Wiedergabe beendet",
+        "%s, after %s: %v":                                                                                                    "%s, nach %s: %v",
+        "Replay failed":                                                                                                       "Wiedergabe fehlgeschlagen",
+        "Recording not saved":                                                                                                 "Aufnahme nicht gespeichert",
+        "Config not reloaded":                                                                                                 "Konfiguration nicht neu geladen",
+        "Run with --notify to be notified when a recording is saved or a replay ends.":                                        "Mit --notify melden Benachrichtigungen gespeicherte Aufnahmen und beendete Wiedergaben.",
+        "Could not look up the latest release:":                                                                               "Neueste Version konnte nicht abgefragt werden:",
+        "MRR %s is up to date":                                                                                                "MRR %s ist aktuell",
+        "MRR %s is available; this is %s. Run 'mrr update' to install it.":                                                    "MRR %s ist verfügbar; dies ist %s. 'mrr update' installiert es.",
+        "Could not update MRR:":                                                                                               "MRR konnte nicht aktualisiert werden:",
+        "Downloading MRR %s":                                                                                                  "Lade MRR %s herunter",
+        "Could not download the update:":                                                                                      "Update konnte nicht heruntergeladen werden:",
+        "Updated %s from %s to %s":                                                                                            "%s von %s auf %s aktualisiert",
+        "The MRR already running keeps the old version until it is restarted ('mrr ctl quit', then start it again).": "Das bereits laufende MRR behält die alte Version, bis es neu gestartet wird ('mrr ctl quit', dann erneut starten).",
+        "%v; the previous version is %s":                                                    "%v; die vorherige Version ist %s",
+        "download the latest release and replace this mrr.exe with it":                      "die neueste Version herunterladen und diese mrr.exe damit ersetzen",
+        "Could not register MRR to start at login:":                                         "MRR konnte nicht für den Start bei der Anmeldung eingetragen werden:",
+        "MRR now starts at login with %s":                                                   "MRR startet jetzt bei der Anmeldung mit %s",
+        "Run 'mrr agent' to start it now as well.":                                          "'mrr agent' startet es auch gleich jetzt.",
+        "MRR wasn't set to start at login":                                                  "MRR war nicht für den Start bei der Anmeldung eingetragen",
+        "Could not stop MRR starting at login:":                                             "Start von MRR bei der Anmeldung konnte nicht entfernt werden:",
+        "MRR no longer starts at login; a running agent keeps running until 'mrr ctl quit'": "MRR startet nicht mehr bei der Anmeldung; ein laufender Agent läuft bis 'mrr ctl quit' weiter",
+        "start the agent, with the hotkeys and the tray icon, whenever you log in":          "den Agenten mit Tastenkürzeln und Infobereichssymbol bei jeder Anmeldung starten",
+        "stop starting the agent at login":                                                  "den Agenten nicht mehr bei der Anmeldung starten",
+        "%d recording(s) in %s":                                                             "%d Aufnahme(n) in %s",
+        "%d device(s); record one mouse with --device <id or name>":                         "%d Gerät(e); eine einzelne Maus zeichnet --device <ID oder Name> auf",
+        "size":                        "Größe",
+        "%d bytes":                    "%d Bytes",
+        "format version":              "Formatversion",
+        "created":                     "erstellt",
+        "screen":                      "Bildschirm",
+        "%dx%d at (%d,%d)":            "%dx%d bei (%d,%d)",
+        "window":                      "Fenster",
+        "%q, client %dx%d at (%d,%d)": "%q, Clientbereich %dx%d bei (%d,%d)",
+        "records":                     "Einträge",
+        "DPI segments":                "DPI-Abschnitte",
+        "duration":                    "Dauer",
+        "distance":                    "Strecke",
+        "clicks/minute":               "Klicks/Minute",
+        "bounding box":                "Bereich",
+    }
+}
@@ -0,0 +1,75 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     NDJSON recording stream
+// ------------------------------------------
+
+// While recording with --format ndjson every record is written out as it
+// is captured, and the file is rewritten with its summary at the end.
+
+// ndjsonStream writes records to an NDJSON file as they are recorded. The
+// hook thread only hands records over; encoding and disk writes happen on
+// the stream's own goroutine.
+type ndjsonStream struct {
+    f    *os.File
+    recs chan MouseRecord
+    done chan error
+}
+
+func openNDJSONStream(filename string, meta *RecordingMetadata) (*ndjsonStream, error) {
+    // The stream writes over filename as it goes, so the old recording is
+    // backed up now rather than by the save at the end.
+    if err := backupFile(filename); err != nil {
+        return nil, fmt.Errorf("could not back up %s: %v", filename, err)
+    }
+    markBackedUp(filename)
+    f, err := os.Create(filename)
+    if err != nil {
+        return nil, err
+    }
+    s := &ndjsonStream{f: f, recs: make(chan MouseRecord, 4096), done: make(chan error, 1)}
+
+    go func() {
+        bw := bufio.NewWriter(f)
+        nw, err := format.NewNDJSONWriter(bw, &Recording{Version: format.Version, Metadata: meta})
+        for rec := range s.recs {
+            if err == nil {
+                err = nw.Write(rec)
+            }
+            // Flush whenever we catch up, so the file trails the
+            // recording by moments rather than a buffer.
+            if err == nil && len(s.recs) == 0 {
+                err = bw.Flush()
+            }
+        }
+        if err == nil {
+            err = bw.Flush()
+        }
+        s.done <- err
+    }()
+    return s, nil
+}
+
+func (s *ndjsonStream) add(rec MouseRecord) {
+    s.recs <- rec
+}
+
+// close writes out what is left and closes the file.
+func (s *ndjsonStream) close() error {
+    close(s.recs)
+    err := <-s.done
+    if cerr := s.f.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
@@ -0,0 +1,86 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "time"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Notifications
+// ------------------------------------------
+
+// With --notify, 'mrr hook' tells about saved recordings, finished replays
+// and errors in a notification from its tray icon, which Windows 10 and
+// later show as a toast, for when its console is behind the application
+// being automated. --notify adds the icon if --tray didn't, without hiding
+// the console.
+
+const (
+    NIF_INFO = 0x10
+
+    NIIF_INFO    = 0x1
+    NIIF_WARNING = 0x2
+    NIIF_ERROR   = 0x3
+)
+
+// notifyMode is set by --notify.
+var notifyMode bool
+
+// notify shows a notification with title and text from the tray icon.
+// kind is NIIF_INFO, NIIF_WARNING or NIIF_ERROR.
+func notify(kind uint32, title, text string) {
+    if !notifyMode || trayWindow == 0 {
+        return
+    }
+    nid := trayIconData()
+    nid.UFlags = NIF_INFO
+    nid.DwInfoFlags = kind
+    t, _ := syscall.UTF16FromString(title)
+    copy(nid.SzInfoTitle[:len(nid.SzInfoTitle)-1], t)
+    s, _ := syscall.UTF16FromString(text)
+    copy(nid.SzInfo[:len(nid.SzInfo)-1], s)
+    if r, _, err := procShellNotifyIconW.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid))); r == 0 {
+        debugPrintln("[DEBUG] could not show a notification:", err)
+    }
+}
+
+// notifyName is what a notification calls the recording at path: its name
+// without the folder and extension.
+func notifyName(path string) string {
+    name := filepath.Base(displayName(path))
+    return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// notifyRecordingSaved tells that the recording at path, durationMS long,
+// was saved.
+func notifyRecordingSaved(path string, durationMS int64) {
+    notify(NIIF_INFO, msg("Recording saved"),
+        msgf("%s, %s long", notifyName(path), formatClock(time.Duration(durationMS)*time.Millisecond)))
+}
+
+// notifyReplayEnded tells how the replay of path ended.
+func notifyReplayEnded(path string, result *ReplayResult, err error) {
+    took := ""
+    if result != nil {
+        took = formatClock(time.Duration(result.DurationMS) * time.Millisecond)
+    }
+    switch replayExitCode(err) {
+    case exitOK:
+        notify(NIIF_INFO, msg("Replay finished"), msgf("%s, in %s", notifyName(path), took))
+    case exitAborted:
+        notify(NIIF_WARNING, msg("Replay aborted"), msgf("%s, after %s: %v", notifyName(path), took, err))
+    default:
+        notify(NIIF_ERROR, msg("Replay failed"), fmt.Sprintf("%s: %v", notifyName(path), err))
+    }
+}
+
+// notifyError tells about an error that isn't a replay's.
+func notifyError(title string, err error) {
+    notify(NIIF_ERROR, title, err.Error())
+}
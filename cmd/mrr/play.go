@@ -0,0 +1,171 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "os/signal"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     mrr play: one-shot replay
+// ------------------------------------------
+
+// Exit codes of the one-shot commands. A recording, playlist or schedule
+// that can't be loaded is exitNotFound if it doesn't exist, exitInvalid if
+// it can't be parsed or isn't valid and exitLoadFailed otherwise, see
+// loadExitCode.
+const (
+    exitOK           = 0
+    exitReplayFailed = 1
+    exitUsage        = 2
+    exitLoadFailed   = 3
+    exitAborted      = 4
+    exitVerifyFailed = 5
+    exitNotFound     = 6
+    exitInvalid      = 7
+    exitHooksFailed  = 8
+    exitRunning      = 9
+)
+
+// runPlay implements `mrr play [flags] <file>`: replay the file once
+// without installing hooks or pumping messages, print the result and
+// return the exit code. With no hooks there are no hotkeys; Ctrl+C and the
+// corner failsafe abort the replay.
+func runPlay(args []string) (code int) {
+    // Opened from Explorer, the console closes when MRR exits; keep it open
+    // until an error has been read.
+    defer func() {
+        if code != exitOK && code != exitAborted && ownConsole() {
+            printPrompt("%s", msg("Press Enter to close this window."))
+            bufio.NewReader(os.Stdin).ReadString('\n')
+        }
+    }()
+    files, err := parseArgs(args)
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitUsage
+    }
+    // Without a file, play the current recording, playlist or --output;
+    // the unnamed default recording has to be asked for.
+    if target := replayTarget(); len(files) == 0 && (outputPath != "" ||
+        target != defaultRecordingPath() && target != recordFileName) {
+        files = []string{target}
+    }
+    if len(files) != 1 {
+        fmt.Println("usage: mrr play [flags] <file>")
+        return exitUsage
+    }
+    // Replaying beside a running MRR would fight it for the mouse.
+    if instanceRunning() {
+        return forwardPlay(files[0])
+    }
+    stopLogging, err := startLogging()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not open the log file:"), err)
+        return exitUsage
+    }
+    defer stopLogging()
+    player = NewPlayer(playerOpts)
+    if playerOpts.Step {
+        go stepFromConsole(player)
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    // Closing the console aborts the replay, which lets go of everything
+    // it holds down, as Ctrl+C does.
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    defer handleConsoleCtrl(cancel)()
+
+    logEvent("info", "replay_started", map[string]interface{}{"file": files[0]})
+    var result *ReplayResult
+    if isPlaylistFile(files[0]) {
+        pl, lerr := loadPlaylist(files[0])
+        if lerr != nil {
+            fmt.Println("[ERROR]", msg("Could not load playlist:"), lerr)
+            return loadFailed(files[0], lerr)
+        }
+        fmt.Println("[INFO]", msgf("Playing playlist %s", files[0]))
+        result, err = player.ReplayPlaylist(ctx, pl)
+    } else {
+        if path, rerr := resolveRecording(files[0]); rerr == nil {
+            files[0] = path
+        }
+        recording, lerr := loadFromFile(files[0])
+        if lerr != nil {
+            fmt.Println("[ERROR]", msg("Could not load recording:"), lerr)
+            return loadFailed(files[0], lerr)
+        }
+        fmt.Println("[INFO]", msgf("Replaying %s", files[0]))
+        result, err = player.replayRecordingFile(ctx, files[0], recording)
+    }
+    printPlayResult(result)
+
+    code = replayExitCode(err)
+    switch code {
+    case exitOK:
+    case exitAborted:
+        fmt.Println("[INFO]", msg("Replay aborted:"), err)
+    case exitVerifyFailed:
+        fmt.Println("[ERROR]", err)
+    default:
+        fmt.Println("[ERROR]", msg("Replay failed:"), err)
+    }
+    noteReplay(files[0], result)
+    fields := map[string]interface{}{"file": files[0], "result": result, "exit_code": code}
+    if err != nil {
+        noteRunError(err)
+        logError("replay_failed", "", err, fields)
+    } else {
+        logEvent("info", "replay_finished", fields)
+    }
+    return code
+}
+
+// replayExitCode is the exit code for a replay that ended with err.
+func replayExitCode(err error) int {
+    switch {
+    case err == nil:
+        return exitOK
+    case errors.Is(err, context.Canceled), errors.Is(err, playback.ErrFailsafe):
+        return exitAborted
+    case errors.Is(err, playback.ErrVerifyFailed):
+        return exitVerifyFailed
+    }
+    return exitReplayFailed
+}
+
+// loadFailed reports that file couldn't be loaded and returns the exit
+// code for it.
+func loadFailed(file string, err error) int {
+    code := loadExitCode(err)
+    noteRunError(err)
+    logError("replay_failed", exitStatus[code], err, map[string]interface{}{"file": file, "exit_code": code})
+    return code
+}
+
+// printPlayResult prints how the replay went; JSON logs carry the result
+// in the replay_finished or replay_failed event instead.
+func printPlayResult(result *ReplayResult) {
+    if logFormat == "json" {
+        return
+    }
+    if jsonOutput {
+        if b, err := json.MarshalIndent(result, "", "  "); err == nil {
+            fmt.Println(string(b))
+        }
+        return
+    }
+    fmt.Println("[INFO]", msgf("Injected %d/%d events in %.2fs (%d iteration(s), max drift %.1fms)",
+        result.EventsInjected, result.EventsTotal, float64(result.DurationMS)/1000,
+        result.Iterations, result.Drift.MaxMS))
+}
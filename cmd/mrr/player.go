@@ -0,0 +1,274 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "runtime"
+    "time"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//        Player
+// ------------------------------------------
+
+// Replays run on package player's engine; see playback.Options for what
+// the replay flags set.
+type (
+    ReplayResult   = playback.Result
+    ReplayProgress = playback.Progress
+)
+
+// PlayerOptions configures a Player: the engine's options and what mrr
+// does around a replay. The zero value replays a recording exactly as it
+// was captured.
+type PlayerOptions struct {
+    playback.Options
+
+    // BlockInput keeps the real mouse and keyboard from reaching other
+    // applications while replaying. Esc still aborts.
+    BlockInput bool
+
+    // Resume starts a file replay where the previous, interrupted replay
+    // of the same file stopped, if it left a checkpoint.
+    Resume bool
+
+    // Countdown waits this long before a replay starts, counting down on
+    // the console, so the right window can be focused first.
+    Countdown time.Duration
+
+    // ShowProgress redraws a progress line with percentage and ETA on the
+    // console while replaying.
+    ShowProgress bool
+
+    // Backend names the injection backend (see backend.go); empty means
+    // SendInput. Unavailable backends fall back to SendInput.
+    Backend string
+}
+
+// Player replays recordings and reports on the console as it goes.
+// Pausing, stepping and speed changes go to the embedded engine.
+type Player struct {
+    *playback.Player
+    opts    PlayerOptions
+    console *replayConsole
+}
+
+// NewPlayer returns a Player using opts.
+func NewPlayer(opts PlayerOptions) *Player {
+    c := &replayConsole{}
+    return &Player{Player: playback.New(c.options(opts)), opts: opts, console: c}
+}
+
+// derive returns a player with different options that shares p's pause
+// state and progress. Its opts.Speed is relative to p's speed, so speed
+// changes on p still reach it.
+func (p *Player) derive(opts PlayerOptions) *Player {
+    c := &replayConsole{}
+    return &Player{Player: p.Player.With(c.options(opts)), opts: opts, console: c}
+}
+
+// ReplayFile loads a recording from filename and replays it. Playlist
+// files are played with ReplayPlaylistFile.
+func (p *Player) ReplayFile(ctx context.Context, filename string) (*ReplayResult, error) {
+    if isPlaylistFile(filename) {
+        return p.ReplayPlaylistFile(ctx, filename)
+    }
+    recording, err := loadFromFile(filename)
+    if err != nil {
+        return &ReplayResult{Error: err.Error()}, err
+    }
+    return p.replayRecordingFile(ctx, filename, recording)
+}
+
+// replayRecordingFile replays recording, loaded from filename, resuming
+// from and saving its checkpoint.
+func (p *Player) replayRecordingFile(ctx context.Context, filename string, recording *Recording) (*ReplayResult, error) {
+    player := p
+    if p.opts.Resume {
+        player = p.resumeFrom(filename, recording)
+    }
+    result, err := player.Replay(ctx, recording)
+    p.checkpoint(filename, recording, result, err)
+    return result, err
+}
+
+// Replay counts down, opens the injection backend and blocks input as
+// the options ask, and has the engine replay recording.
+func (p *Player) Replay(ctx context.Context, recording *Recording) (*ReplayResult, error) {
+    // Count down first: the engine looks up and focuses target windows.
+    if err := countdown(ctx, p.opts.Countdown); err != nil {
+        return &ReplayResult{Error: err.Error(), AbortReason: err.Error()}, err
+    }
+
+    opts := p.console.options(p.opts)
+    opts.Speed = 1
+    driver := false
+    if p.opts.BackgroundWindow == "" {
+        inj := openBackend(p.opts.Backend)
+        if c, ok := inj.(interface{ Close() }); ok {
+            defer c.Close()
+        }
+        _, driver = inj.(*interceptionInjector)
+        opts.Injector = inj
+    }
+
+    if p.opts.BlockInput && !p.opts.DryRun {
+        runtime.LockOSThread()
+        defer runtime.UnlockOSThread()
+        if unblock, err := blockUserInput(driver); err != nil {
+            fmt.Println("[WARN]", msg("Input not blocked:"), err)
+        } else {
+            // Deferred, so aborts, errors and panics unblock too.
+            defer unblock()
+        }
+    }
+
+    result, err := p.Player.With(opts).Replay(ctx, recording)
+    p.console.endProgress()
+    printVerifyReport(result)
+    return result, err
+}
+
+// printVerifyReport prints what --verify found, listing the first
+// positions that were off target.
+func printVerifyReport(result *ReplayResult) {
+    report := result.Verify
+    if report == nil {
+        return
+    }
+
+    fmt.Printf("[VERIFY] %d position(s) checked, %d off target\n", report.Checked, report.Mismatched)
+    shown := 0
+    for _, a := range result.Assertions {
+        if a.Kind != "CursorPosition" {
+            continue
+        }
+        if shown == 10 {
+            fmt.Println("[VERIFY]   ... (see --json for more)")
+            break
+        }
+        fmt.Printf("[VERIFY]   #%d %s\n", a.Index, a.Detail)
+        shown++
+    }
+}
+
+// replayConsole is what a Player prints while replaying.
+type replayConsole struct {
+    lastPrint time.Time
+    // lineOpen is set while the progress line lacks its newline.
+    lineOpen bool
+    // reblock is set while a pause has lifted --block-input.
+    reblock bool
+}
+
+// options returns the engine options for opts, with callbacks that report
+// on the console.
+func (c *replayConsole) options(opts PlayerOptions) playback.Options {
+    o := opts.Options
+    o.Logf = func(f string, args ...interface{}) {
+        debugPrintf("[DEBUG] "+f+"\n", args...)
+    }
+    o.OnProgress = func(rp ReplayProgress) {
+        fireReplayProgress(rp)
+        if opts.ShowProgress {
+            c.progress(rp)
+        }
+    }
+    o.OnPause = c.pause
+    o.OnStep = func(i int, rec MouseRecord) {
+        fmt.Printf("[STEP] next #%-5d +%5dms %-16s at (%d,%d) data=%d\n",
+            i, rec.DeltaMS, rec.Event, rec.X, rec.Y, rec.Data)
+    }
+    o.OnRetry = func(i int, detail string, n, attempt, retries int) {
+        fmt.Println("[WARN]", msgf("Check #%d failed (%s), replaying %d record(s) again (%d/%d)",
+            i, detail, n, attempt, retries))
+    }
+    o.OnDryRun = func(i int, rec MouseRecord, what string) {
+        if what != "" {
+            fmt.Printf("[DRY-RUN] #%-5d +%5dms %s\n", i, rec.DeltaMS, what)
+            return
+        }
+        fmt.Printf("[DRY-RUN] #%-5d +%5dms %-16s at (%d,%d) data=%d\n",
+            i, rec.DeltaMS, rec.Event, rec.X, rec.Y, rec.Data)
+    }
+    return o
+}
+
+func (c *replayConsole) pause(paused bool) {
+    if paused {
+        fmt.Println("[INFO]", msg("Replay paused"))
+        // The user needs their mouse back while paused, and the Pause key
+        // to resume.
+        c.reblock = inputBlocked.Swap(false)
+        return
+    }
+    fmt.Println("[INFO]", msg("Replay resumed"))
+    if c.reblock {
+        inputBlocked.Store(true)
+        c.reblock = false
+    }
+}
+
+// progress redraws the progress line, at most every progressInterval
+// except for the first and last record of an iteration.
+func (c *replayConsole) progress(rp ReplayProgress) {
+    last := rp.Index == rp.Total
+    if !last && rp.Index > 1 && time.Since(c.lastPrint) < progressInterval {
+        return
+    }
+    c.lastPrint = time.Now()
+    fmt.Printf("\r[PROGRESS] %-60s", formatProgress(rp))
+    c.lineOpen = !last
+    if last {
+        fmt.Println()
+    }
+}
+
+// endProgress finishes a progress line cut short by an abort.
+func (c *replayConsole) endProgress() {
+    if c.lineOpen {
+        fmt.Println()
+        c.lineOpen = false
+    }
+}
+
+// countdown ticks down d on the console, one line update per second.
+func countdown(ctx context.Context, d time.Duration) error {
+    if d <= 0 {
+        return nil
+    }
+    for left := d; left > 0; {
+        step := left % time.Second
+        if step == 0 {
+            step = time.Second
+        }
+        fmt.Printf("\r[INFO] Replay starts in %ds ", int((left+time.Second-1)/time.Second))
+        if err := sleepContext(ctx, step); err != nil {
+            fmt.Println()
+            return err
+        }
+        left -= step
+    }
+    fmt.Println("\r[INFO] Replay starting       ")
+    return nil
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+    if d <= 0 {
+        return ctx.Err()
+    }
+    t := time.NewTimer(d)
+    defer t.Stop()
+
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
@@ -0,0 +1,128 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// ------------------------------------------
+//        Playlists
+// ------------------------------------------
+
+// playlistExt marks a file as a playlist rather than a recording.
+const playlistExt = ".mrrlist"
+
+// Playlist chains several recordings. It is stored as JSON in a file ending
+// in playlistExt.
+type Playlist struct {
+    Items []PlaylistItem `json:"Items"`
+}
+
+// PlaylistItem is one entry of a playlist. File is relative to the
+// playlist's own directory unless absolute. Repeat 0 plays it once,
+// DelayMS waits before the item starts, and Speed (0 = 1) multiplies the
+// player's speed for this item.
+type PlaylistItem struct {
+    File    string  `json:"File"`
+    Repeat  int     `json:"Repeat,omitempty"`
+    DelayMS int64   `json:"DelayMS,omitempty"`
+    Speed   float64 `json:"Speed,omitempty"`
+}
+
+func isPlaylistFile(filename string) bool {
+    return strings.EqualFold(filepath.Ext(filename), playlistExt)
+}
+
+func loadPlaylist(filename string) (*Playlist, error) {
+    b, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    var pl Playlist
+    if err := json.Unmarshal(b, &pl); err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+
+    dir := filepath.Dir(filename)
+    for i := range pl.Items {
+        if pl.Items[i].File == "" {
+            return nil, fmt.Errorf("%s: item %d has no File", filename, i)
+        }
+        if !filepath.IsAbs(pl.Items[i].File) {
+            pl.Items[i].File = filepath.Join(dir, pl.Items[i].File)
+        }
+    }
+    return &pl, nil
+}
+
+// ReplayPlaylistFile loads a playlist and plays it with ReplayPlaylist.
+func (p *Player) ReplayPlaylistFile(ctx context.Context, filename string) (*ReplayResult, error) {
+    pl, err := loadPlaylist(filename)
+    if err != nil {
+        return &ReplayResult{Error: err.Error()}, err
+    }
+    return p.ReplayPlaylist(ctx, pl)
+}
+
+// ReplayPlaylist plays every item in order with the player's options,
+// overriding speed and loop count per item. The results of all items are
+// added up; the first failing item stops the playlist.
+func (p *Player) ReplayPlaylist(ctx context.Context, pl *Playlist) (*ReplayResult, error) {
+    total := &ReplayResult{}
+    start := time.Now()
+    var driftSum float64
+
+    if err := countdown(ctx, p.opts.Countdown); err != nil {
+        return finishPlaylist(ctx, total, start, driftSum, err)
+    }
+
+    for i, item := range pl.Items {
+        if err := sleepContext(ctx, time.Duration(item.DelayMS)*time.Millisecond); err != nil {
+            return finishPlaylist(ctx, total, start, driftSum, err)
+        }
+
+        opts := p.opts
+        opts.Speed = 1
+        if item.Speed > 0 {
+            opts.Speed = item.Speed
+        }
+        opts.Loop = item.Repeat
+        opts.Countdown = 0
+        debugPrintf("[DEBUG] playlist item %d: %s (x%d, %gx)\n", i+1, item.File, item.Repeat, opts.Speed)
+
+        result, err := p.derive(opts).ReplayFile(ctx, item.File)
+        total.EventsInjected += result.EventsInjected
+        total.EventsTotal += result.EventsTotal
+        total.Iterations += result.Iterations
+        total.Assertions = append(total.Assertions, result.Assertions...)
+        total.Drift.MaxMS = math.Max(total.Drift.MaxMS, result.Drift.MaxMS)
+        total.Drift.FinalMS = result.Drift.FinalMS
+        driftSum += result.Drift.MeanMS * float64(result.EventsInjected)
+        if err != nil {
+            return finishPlaylist(ctx, total, start, driftSum, fmt.Errorf("%s: %w", item.File, err))
+        }
+    }
+    return finishPlaylist(ctx, total, start, driftSum, nil)
+}
+
+func finishPlaylist(ctx context.Context, total *ReplayResult, start time.Time, driftSum float64, err error) (*ReplayResult, error) {
+    total.DurationMS = time.Since(start).Milliseconds()
+    if total.EventsInjected > 0 {
+        total.Drift.MeanMS = driftSum / float64(total.EventsInjected)
+    }
+    if err != nil {
+        total.Error = err.Error()
+        if ctx.Err() != nil {
+            total.AbortReason = ctx.Err().Error()
+        }
+    }
+    return total, err
+}
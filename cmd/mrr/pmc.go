@@ -0,0 +1,223 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// ------------------------------------------
+//     Pulover's Macro Creator import
+// ------------------------------------------
+
+// A .pmc file holds one action per line as pipe-separated columns, the same
+// as PMC's action list: [index|]Action|Details|Repeat|Delay|Type|Target|
+// Window|Comment. Lines starting with "[" or holding settings (Context=,
+// Groups=) aren't actions. The importer understands the actions a recording
+// in PMC produces: Click (moves, clicks, presses, releases and wheel),
+// Sleep and the Send family; anything else is skipped with a warning.
+type pmcImporter struct {
+    recording *Recording
+    // wait is the delay owed to the next record.
+    wait int64
+    x, y int32
+}
+
+var pmcButtons = map[string]string{
+    "left":   "LeftButton",
+    "l":      "LeftButton",
+    "right":  "RightButton",
+    "r":      "RightButton",
+    "middle": "MiddleButton",
+    "m":      "MiddleButton",
+    "x1":     "Mouse4",
+    "x2":     "Mouse5",
+}
+
+func (im *pmcImporter) add(rec MouseRecord) {
+    if rec.Event == EventKeyDown || rec.Event == EventKeyUp || rec.Event == EventText {
+        rec.X, rec.Y = im.x, im.y
+    }
+    rec.DeltaMS = im.wait
+    im.wait = 0
+    im.x, im.y = rec.X, rec.Y
+    im.recording.Records = append(im.recording.Records, rec)
+}
+
+// click handles a Click action's details, e.g. "512, 384 Left, 1",
+// "Left, 1, Down", "512, 384" (a move) or "WheelDown, 3".
+func (im *pmcImporter) click(details string) error {
+    fields := strings.Fields(strings.Replace(details, ",", " ", -1))
+    var nums []int
+    button, state := "", ""
+    for _, f := range fields {
+        if n, err := strconv.Atoi(f); err == nil {
+            nums = append(nums, n)
+            continue
+        }
+        switch lf := strings.ToLower(f); {
+        case lf == "down" || lf == "d":
+            state = "Down"
+        case lf == "up" || lf == "u":
+            state = "Up"
+        case strings.HasPrefix(lf, "wheel") || pmcButtons[lf] != "":
+            button = lf
+        case lf == "rel" || lf == "relative":
+            return fmt.Errorf("relative clicks aren't supported")
+        default:
+            return fmt.Errorf("unexpected %q", f)
+        }
+    }
+
+    // Numbers are x, y when two come before the button, then the count.
+    x, y, count := im.x, im.y, 1
+    if len(nums) >= 2 {
+        x, y = int32(nums[0]), int32(nums[1])
+        nums = nums[2:]
+    }
+    if len(nums) > 0 {
+        count = nums[0]
+    }
+    if x != im.x || y != im.y || button == "" {
+        im.add(MouseRecord{X: x, Y: y, Event: "MouseMove"})
+    }
+    if button == "" {
+        return nil
+    }
+
+    if strings.HasPrefix(button, "wheel") {
+        event, delta := "MouseWheel", int32(120)
+        switch button {
+        case "wheeldown":
+            delta = -120
+        case "wheelleft":
+            event, delta = "MouseHWheel", -120
+        case "wheelright":
+            event = "MouseHWheel"
+        }
+        for i := 0; i < count; i++ {
+            im.add(MouseRecord{X: x, Y: y, Event: event, Data: int32(uint16(int16(delta)))})
+        }
+        return nil
+    }
+
+    b := pmcButtons[button]
+    if state != "" {
+        count = 1
+    }
+    for i := 0; i < count; i++ {
+        if state != "Up" {
+            im.add(MouseRecord{X: x, Y: y, Event: b + "Down"})
+        }
+        if state != "Down" {
+            im.add(MouseRecord{X: x, Y: y, Event: b + "Up"})
+        }
+    }
+    return nil
+}
+
+// send handles a Send action: literal text becomes a Text record and
+// {Key}, {Key down} and {Key up} become key records.
+func (im *pmcImporter) send(details string) error {
+    for details != "" {
+        i := strings.IndexByte(details, '{')
+        if i != 0 {
+            if i < 0 {
+                i = len(details)
+            }
+            im.add(MouseRecord{Event: EventText, Key: &KeyStroke{Text: details[:i]}})
+            details = details[i:]
+            continue
+        }
+        j := strings.IndexByte(details[1:], '}')
+        if j < 0 {
+            return fmt.Errorf("unterminated %q", details)
+        }
+        // {}} is a literal brace.
+        if j == 0 && strings.HasPrefix(details, "{}}") {
+            j = 1
+        }
+        name := details[1 : j+1]
+        details = details[j+2:]
+
+        parts := strings.Fields(name)
+        if len(parts) == 0 {
+            continue
+        }
+        if len([]rune(parts[0])) == 1 && len(parts) == 1 {
+            im.add(MouseRecord{Event: EventText, Key: &KeyStroke{Text: parts[0]}})
+            continue
+        }
+        vk, err := vkForName(parts[0])
+        if err != nil {
+            return err
+        }
+        state := ""
+        if len(parts) > 1 {
+            state = strings.ToLower(parts[1])
+        }
+        if state != "up" {
+            im.add(MouseRecord{Event: EventKeyDown, Key: &KeyStroke{VK: vk}})
+        }
+        if state != "down" {
+            im.add(MouseRecord{Event: EventKeyUp, Key: &KeyStroke{VK: vk}})
+        }
+    }
+    return nil
+}
+
+// readPMC converts a Pulover's Macro Creator macro. Each action's Delay
+// becomes the wait before the next record.
+func readPMC(r io.Reader) (*Recording, error) {
+    im := &pmcImporter{recording: &Recording{}}
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 64*1024), 1<<20)
+
+    for line := 1; sc.Scan(); line++ {
+        text := strings.TrimSpace(sc.Text())
+        if text == "" || strings.HasPrefix(text, "[") || !strings.Contains(text, "|") {
+            continue
+        }
+        cols := strings.Split(text, "|")
+        if _, err := strconv.Atoi(cols[0]); err == nil {
+            cols = cols[1:]
+        }
+        if len(cols) < 5 {
+            continue
+        }
+        details, kind := cols[1], strings.ToLower(cols[4])
+        repeat, err := strconv.Atoi(strings.TrimSpace(cols[2]))
+        if err != nil || repeat < 1 {
+            repeat = 1
+        }
+        delay, _ := strconv.ParseInt(strings.TrimSpace(cols[3]), 10, 64)
+
+        for n := 0; n < repeat; n++ {
+            switch kind {
+            case "click":
+                err = im.click(details)
+            case "sleep":
+            case "send", "sendraw", "sendinput", "sendevent", "sendplay", "controlsend":
+                err = im.send(details)
+            default:
+                err = fmt.Errorf("%s actions aren't supported", cols[4])
+            }
+            if err != nil {
+                fmt.Println("[WARN]", msgf("line %d skipped (%s): %v", line, cols[0], err))
+                break
+            }
+            im.wait += delay
+        }
+    }
+    if err := sc.Err(); err != nil {
+        return nil, err
+    }
+    if len(im.recording.Records) == 0 {
+        return nil, fmt.Errorf("no supported actions found")
+    }
+    return im.recording, nil
+}
@@ -0,0 +1,30 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "time"
+)
+
+// ------------------------------------------
+//     Replay progress
+// ------------------------------------------
+
+// progressInterval limits how often the console progress line is redrawn.
+const progressInterval = 250 * time.Millisecond
+
+// formatProgress prints rp the way the progress line and the tray show it.
+func formatProgress(rp ReplayProgress) string {
+    return fmt.Sprintf("%d/%d  %5.1f%%  %s elapsed  ETA %s",
+        rp.Index, rp.Total, rp.Percent, formatClock(rp.Elapsed), formatClock(rp.Remaining))
+}
+
+// formatClock prints d as m:ss, or h:mm:ss once it reaches an hour.
+func formatClock(d time.Duration) string {
+    s := int64(d.Round(time.Second) / time.Second)
+    if s >= 3600 {
+        return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+    }
+    return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,220 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+
+    "github.com/onixldlc/MRR/format"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     PowerShell export
+// ------------------------------------------
+
+// ps1Prelude compiles the P/Invoke helpers the exported script calls. It is
+// written as-is at the top of every script.
+const ps1Prelude = `$ErrorActionPreference = 'Stop'
+Add-Type -TypeDefinition @'
+using System;
+using System.Runtime.InteropServices;
+using System.Threading;
+
+public static class MrrInput {
+    [StructLayout(LayoutKind.Sequential)]
+    struct MOUSEINPUT { public int dx, dy; public uint mouseData, dwFlags, time; public IntPtr dwExtraInfo; }
+    [StructLayout(LayoutKind.Sequential)]
+    struct KEYBDINPUT { public ushort wVk, wScan; public uint dwFlags, time; public IntPtr dwExtraInfo; }
+    [StructLayout(LayoutKind.Explicit)]
+    struct INPUTUNION { [FieldOffset(0)] public MOUSEINPUT mi; [FieldOffset(0)] public KEYBDINPUT ki; }
+    [StructLayout(LayoutKind.Sequential)]
+    struct INPUT { public uint type; public INPUTUNION u; }
+
+    [DllImport("user32.dll")] static extern uint SendInput(uint n, INPUT[] inputs, int size);
+    [DllImport("user32.dll")] static extern int GetSystemMetrics(int index);
+    [DllImport("user32.dll")] static extern bool SetProcessDPIAware();
+    [DllImport("user32.dll")] static extern short GetAsyncKeyState(int vk);
+    [DllImport("user32.dll")] static extern IntPtr GetDC(IntPtr hwnd);
+    [DllImport("user32.dll")] static extern int ReleaseDC(IntPtr hwnd, IntPtr hdc);
+    [DllImport("gdi32.dll")] static extern uint GetPixel(IntPtr hdc, int x, int y);
+    [DllImport("winmm.dll")] static extern uint timeBeginPeriod(uint ms);
+
+    public static void Init() {
+        SetProcessDPIAware();
+        timeBeginPeriod(1);
+    }
+
+    static void Send(INPUT input) {
+        SendInput(1, new INPUT[] { input }, Marshal.SizeOf(typeof(INPUT)));
+    }
+
+    static int Normalize(int v, int origin, int size) {
+        long rel = v - origin;
+        if (size <= 1 || rel <= 0) return 0;
+        if (rel >= size) return 65535;
+        return (int)Math.Min(65535, (rel * 65536 + size - 1) / size);
+    }
+
+    // Mouse moves to x,y and injects flags there, like MRR does.
+    public static void Mouse(int x, int y, uint flags, uint data) {
+        INPUT input = new INPUT();
+        input.type = 0;
+        input.u.mi.dx = Normalize(x, GetSystemMetrics(76), GetSystemMetrics(78));
+        input.u.mi.dy = Normalize(y, GetSystemMetrics(77), GetSystemMetrics(79));
+        input.u.mi.mouseData = data;
+        input.u.mi.dwFlags = flags | 0x0001 | 0x4000 | 0x8000;
+        Send(input);
+    }
+
+    public static void Key(ushort vk, ushort scan, uint flags) {
+        INPUT input = new INPUT();
+        input.type = 1;
+        input.u.ki.wVk = vk;
+        input.u.ki.wScan = scan;
+        input.u.ki.dwFlags = flags;
+        Send(input);
+    }
+
+    public static void Text(string s) {
+        foreach (char c in s) {
+            Key(0, c, 0x0004);
+            Key(0, c, 0x0004 | 0x0002);
+        }
+    }
+
+    // Sleep waits ms milliseconds, ending the script if Esc is pressed.
+    public static void Sleep(int ms) {
+        DateTime end = DateTime.UtcNow.AddMilliseconds(ms);
+        do {
+            if ((GetAsyncKeyState(0x1B) & 0x8000) != 0) Environment.Exit(4);
+            TimeSpan left = end - DateTime.UtcNow;
+            if (left > TimeSpan.Zero) Thread.Sleep(left < TimeSpan.FromMilliseconds(20) ? left : TimeSpan.FromMilliseconds(20));
+        } while (DateTime.UtcNow < end);
+    }
+
+    static bool Close(uint a, uint b, int tolerance) {
+        return Math.Abs((int)a - (int)b) <= tolerance;
+    }
+
+    // WaitPixel waits for x,y to show rgb (0xRRGGBB), ending the script
+    // with exit code 1 after timeoutMS.
+    public static void WaitPixel(int x, int y, uint rgb, int tolerance, int timeoutMS) {
+        DateTime end = DateTime.UtcNow.AddMilliseconds(timeoutMS);
+        while (true) {
+            IntPtr hdc = GetDC(IntPtr.Zero);
+            uint c = GetPixel(hdc, x, y);
+            ReleaseDC(IntPtr.Zero, hdc);
+            if (Close(c & 0xFF, rgb >> 16, tolerance) && Close((c >> 8) & 0xFF, (rgb >> 8) & 0xFF, tolerance) && Close((c >> 16) & 0xFF, rgb & 0xFF, tolerance)) return;
+            if (DateTime.UtcNow > end) Environment.Exit(1);
+            Sleep(50);
+        }
+    }
+}
+'@
+[MrrInput]::Init()
+`
+
+// psQuotes are the characters that end a single-quoted PowerShell
+// string: the apostrophe and the typographic single quotes.
+const psQuotes = "'\u2018\u2019\u201A\u201B"
+
+// psString quotes s as a single-quoted PowerShell string, doubling every
+// quote character in it.
+func psString(s string) string {
+    var b strings.Builder
+    b.WriteByte('\'')
+    for _, r := range s {
+        if strings.ContainsRune(psQuotes, r) {
+            b.WriteRune(r)
+        }
+        b.WriteRune(r)
+    }
+    b.WriteByte('\'')
+    return b.String()
+}
+
+// writePS1 writes recording as a standalone PowerShell script that replays
+// it through SendInput. Esc stops the script. Checks are left out as
+// comments.
+func writePS1(w io.Writer, recording *Recording, opts ExportOptions) error {
+    if opts.Coords == CoordsClient {
+        return fmt.Errorf("the PowerShell exporter only writes screen coordinates")
+    }
+    bw := bufio.NewWriter(w)
+    line := func(format string, a ...interface{}) {
+        fmt.Fprintf(bw, format+"\n", a...)
+    }
+
+    // Windows PowerShell reads a script without a BOM as ANSI, which would
+    // garble any text that isn't ASCII.
+    bw.WriteString("\ufeff")
+    line("# Exported by MRR, %d records. Run with:", len(recording.Records))
+    line("#   powershell -ExecutionPolicy Bypass -File script.ps1")
+    line("# Press Esc to stop.")
+    bw.WriteString(ps1Prelude)
+
+    clock := newExportClock(opts.Speed)
+    for i, rec := range recording.Records {
+        if i > 0 {
+            if d := clock.sleep(rec.DeltaMS); d > 0 {
+                line("[MrrInput]::Sleep(%d)", d)
+            }
+        }
+
+        switch {
+        case rec.Event == "MouseMove":
+            line("[MrrInput]::Mouse(%d, %d, 0, 0)", rec.X, rec.Y)
+        case rec.Event == EventKeyDown || rec.Event == EventKeyUp:
+            if rec.Key == nil {
+                line("# record %d: %s without Key", i, rec.Event)
+                continue
+            }
+            var flags uint32
+            if rec.Key.Scan != 0 {
+                flags |= playback.KEYEVENTF_SCANCODE
+                if rec.Key.Extended {
+                    flags |= playback.KEYEVENTF_EXTENDEDKEY
+                }
+            }
+            if rec.Event == EventKeyUp {
+                flags |= playback.KEYEVENTF_KEYUP
+            }
+            line("[MrrInput]::Key(%d, %d, %d)", rec.Key.VK, rec.Key.Scan, flags)
+        case rec.Event == EventText:
+            if rec.Key != nil {
+                line("[MrrInput]::Text(%s)", psString(rec.Key.Text))
+            }
+        case rec.Event == EventWaitWindow:
+            if rec.Wait == nil {
+                continue
+            }
+            line("$deadline = (Get-Date).AddMilliseconds(%d)", rec.Wait.Timeout().Milliseconds())
+            line("while (-not (Get-Process | Where-Object { $_.MainWindowTitle.Contains(%s) })) {", psString(rec.Wait.Title))
+            line("    if ((Get-Date) -gt $deadline) { exit 1 }")
+            line("    [MrrInput]::Sleep(100)")
+            line("}")
+        case rec.Event == EventWaitPixel:
+            if rec.Wait == nil {
+                continue
+            }
+            r, g, b, err := format.ParseColor(rec.Wait.Color)
+            if err != nil {
+                return fmt.Errorf("record %d: %v", i, err)
+            }
+            line("[MrrInput]::WaitPixel(%d, %d, 0x%02X%02X%02X, %d, %d)", rec.X, rec.Y, r, g, b,
+                rec.Wait.Tolerance, rec.Wait.Timeout().Milliseconds())
+        default:
+            flags, data := playback.MouseFlags(rec.Event, rec.Data)
+            if flags == 0 {
+                line("# record %d: %s is not exported", i, rec.Event)
+                continue
+            }
+            line("[MrrInput]::Mouse(%d, %d, 0x%X, %d)", rec.X, rec.Y, flags, data)
+        }
+    }
+    return bw.Flush()
+}
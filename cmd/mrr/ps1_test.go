@@ -0,0 +1,18 @@
+// +build windows
+
+package main
+
+import "testing"
+
+func TestPSString(t *testing.T) {
+    for _, c := range []struct{ in, want string }{
+        {"hello", "'hello'"},
+        {"it's", "'it''s'"},
+        {"don’t", "'don’’t'"},
+        {"‘x‚‛", "'‘‘x‚‚‛‛'"},
+    } {
+        if got := psString(c.in); got != c.want {
+            t.Errorf("psString(%q) = %q, want %q", c.in, got, c.want)
+        }
+    }
+}
@@ -0,0 +1,136 @@
+// +build windows
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "runtime"
+    "time"
+)
+
+// ------------------------------------------
+//     mrr record
+// ------------------------------------------
+
+var (
+    procGetCurrentThreadId = kernel32.MustFindProc("GetCurrentThreadId")
+    procPostThreadMessageW = user32.MustFindProc("PostThreadMessageW")
+)
+
+// recordOnlyStop ends 'mrr record'. While it is set the record hotkey
+// calls it instead of toggling recording, and the replay hotkeys are off.
+var recordOnlyStop context.CancelFunc
+
+// hotkeyEnabled tells whether the keyboard hook acts on action.
+func hotkeyEnabled(action hotkeyAction) bool {
+    return recordOnlyStop == nil || action == actionRecord || action == actionCheck
+}
+
+// runRecord implements `mrr record [out] [--duration 30s]`: record right
+// away, save when Insert or Ctrl+C is pressed or the duration is up, and
+// exit.
+func runRecord(args []string) int {
+    var duration time.Duration
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        if args[i] != "--duration" {
+            rest = append(rest, args[i])
+            continue
+        }
+        if i++; i >= len(args) {
+            fmt.Println("[ERROR]", msg("--duration needs a duration such as 30s"))
+            return exitUsage
+        }
+        d, err := parseClock(args[i])
+        if err != nil || d <= 0 {
+            fmt.Println("[ERROR]", msgf("invalid --duration %q", args[i]))
+            return exitUsage
+        }
+        duration = d
+    }
+    files, err := parseArgs(rest)
+    if err == nil && len(files) == 1 && saveAsName != "" {
+        err = fmt.Errorf("name the file or --save-as, not both")
+    }
+    if err != nil || len(files) > 1 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr record [flags] [out] [--duration 30s]")
+        return exitUsage
+    }
+    release, ok := claimInstance()
+    if !ok {
+        // Only a plain recording can be handed over: the running MRR
+        // saves with its own settings.
+        for i := 0; i < len(cliArgs); i++ {
+            if cliArgs[i] != "--duration" {
+                return alreadyRunning()
+            }
+            i++
+        }
+        return forwardRecord(duration)
+    }
+    defer release()
+    if len(files) == 1 {
+        outputPath = files[0]
+    }
+    stopLogging, err := startLogging()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not open the log file:"), err)
+        return exitUsage
+    }
+    defer stopLogging()
+    if encryptRecordings {
+        if _, err := sealingKey(); err != nil {
+            fmt.Println("[ERROR]", err)
+            return exitUsage
+        }
+    }
+
+    // The hooks are called on the thread that installed them, which has to
+    // keep pumping messages until the recording is saved.
+    runtime.LockOSThread()
+    defer runtime.UnlockOSThread()
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    if duration > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, duration)
+        defer cancel()
+    }
+    ctx, recordOnlyStop = context.WithCancel(ctx)
+    defer recordOnlyStop()
+
+    if err := installHooks(); err != nil {
+        fmt.Println("[ERROR]", msg("Could not install hooks:"), err)
+        noteRunError(err)
+        return exitHooksFailed
+    }
+    defer unInstallHooks()
+    thread, _, _ := procGetCurrentThreadId.Call()
+    // Closing the console saves the recording as Ctrl+C does.
+    defer handleConsoleCtrl(recordOnlyStop)()
+
+    startRecording()
+    if duration > 0 {
+        fmt.Println("[INFO]", msgf("Recording for %s; press %s or Ctrl+C to stop sooner", formatClock(duration), hotkeyName(actionRecord)))
+    } else {
+        fmt.Println("[INFO]", msgf("Recording; press %s or Ctrl+C to stop", hotkeyName(actionRecord)))
+    }
+    code := make(chan int, 1)
+    go func() {
+        <-ctx.Done()
+        if _, err := finishRecording(); err != nil {
+            code <- exitReplayFailed
+        } else {
+            code <- exitOK
+        }
+        procPostThreadMessageW.Call(thread, WM_QUIT, 0, 0)
+    }()
+    runMessageLoop()
+    return <-code
+}
@@ -0,0 +1,209 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "sort"
+    "strings"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//        Recording file format
+// ------------------------------------------
+
+// A Recording is what gets written to disk: the captured records plus an
+// optional summary. Files written before the summary existed are a bare
+// JSON array of records and are still accepted by loadFromFile, which
+// upgrades older versions on load (see package format).
+type (
+    Recording         = format.Recording
+    RecordingMetadata = format.Metadata
+    RecordingSummary  = format.Summary
+    Rect              = format.Rect
+    ScreenBounds      = format.ScreenBounds
+    DPISegment        = format.DPISegment
+    WindowInfo        = format.WindowInfo
+    KeyStroke         = format.KeyStroke
+    WaitStep          = format.WaitStep
+)
+
+// Records besides the mouse ones; package player replays them.
+const (
+    EventKeyDown    = format.EventKeyDown
+    EventKeyUp      = format.EventKeyUp
+    EventText       = format.EventText
+    EventWaitPixel  = format.EventWaitPixel
+    EventWaitWindow = format.EventWaitWindow
+)
+
+func printSummary(s RecordingSummary) {
+    events := make([]string, 0, len(s.EventCounts))
+    for event := range s.EventCounts {
+        events = append(events, event)
+    }
+    sort.Strings(events)
+
+    fmt.Println("[INFO]", msg("Recording summary:"))
+    printField("duration", "%.2fs", float64(s.DurationMS)/1000)
+    for _, event := range events {
+        fmt.Printf("       %-16s: %d\n", event, s.EventCounts[event])
+    }
+    printField("distance", "%.0fpx", s.Distance)
+    printField("clicks/minute", "%.1f", s.ClicksPerMinute)
+    printField("bounding box", "(%d,%d)-(%d,%d)",
+        s.BoundingBox.MinX, s.BoundingBox.MinY, s.BoundingBox.MaxX, s.BoundingBox.MaxY)
+}
+
+// printField prints one line of a summary: the label and the value, both
+// in the user's language, with the label padded so the values line up.
+func printField(label, format string, a ...interface{}) {
+    fmt.Printf("       %-16s: %s\n", msg(label), msgf(format, a...))
+}
+
+// ------------------------------------------
+//        Save/Load Recorded Data
+// ------------------------------------------
+
+// compressRecordings gzips saved recordings (--compress). Files named
+// *.gz are always compressed.
+var compressRecordings bool
+
+// dumpToFile saves recording in the --format format.
+func dumpToFile(filename string, recording *Recording) error {
+    return saveAs(filename, recording, recordingCodec(), ExportOptions{})
+}
+
+// saveAs writes recording to filename with c. Recordings in MRR's own
+// formats are stamped with the current version and checksum, and
+// compressed and encrypted as asked; exported scripts are written as is.
+// Either way the file is replaced atomically, see writeAtomic.
+func saveAs(filename string, recording *Recording, c codec, opts ExportOptions) error {
+    if _, _, ok := parseStoreRef(filename); ok {
+        if !c.Native() {
+            return fmt.Errorf("%s scripts can't be saved to a SQLite library", c.Name())
+        }
+        return saveToStore(filename, recording)
+    }
+    if c.Native() {
+        recording.Version = format.Version
+        recording.Checksum = ""
+        if c.Checksummed() {
+            sum, err := format.Checksum(recording.Records)
+            if err != nil {
+                return err
+            }
+            recording.Checksum = sum
+        }
+    }
+    return writeAtomic(filename, func(f *os.File) error {
+        var w io.Writer = f
+        // Encrypted recordings are encoded into memory and sealed as a whole.
+        var plain *bytes.Buffer
+        if encryptRecordings && c.Native() {
+            plain = &bytes.Buffer{}
+            w = plain
+        }
+        var zw *gzip.Writer
+        if c.Native() && (compressRecordings || strings.HasSuffix(strings.ToLower(filename), ".gz")) {
+            zw = gzip.NewWriter(w)
+            w = zw
+        }
+        err := c.Encode(w, recording, opts)
+        if zw != nil && err == nil {
+            err = zw.Close()
+        }
+        if plain != nil && err == nil {
+            var sealed []byte
+            if sealed, err = seal(plain.Bytes()); err == nil {
+                _, err = f.Write(sealed)
+            }
+        }
+        return err
+    })
+}
+
+func loadFromFile(filename string) (*Recording, error) {
+    return loadAs(filename, nil)
+}
+
+// loadAs loads filename with c, or whatever format it turns out to be in
+// when c is nil, and upgrades it to the current version.
+func loadAs(filename string, c codec) (*Recording, error) {
+    var recording *Recording
+    if _, _, ok := parseStoreRef(filename); ok {
+        var err error
+        if recording, err = loadFromStore(filename); err != nil {
+            return nil, err
+        }
+    } else {
+        f, err := os.Open(filename)
+        if err != nil {
+            return nil, err
+        }
+        defer f.Close()
+        if recording, err = readRecording(f, c); err != nil {
+            return nil, fmt.Errorf("%s: %v", filename, err)
+        }
+    }
+
+    from := recording.Version
+    err := verifyChecksum(recording)
+    if err == nil {
+        err = format.Migrate(recording)
+    }
+    if err == nil && recording.Version != from {
+        debugPrintf("[DEBUG] Migrated recording from format version %d to %d\n", from, recording.Version)
+    }
+    if err == nil {
+        err = validateRecords(recording.Records)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+    return recording, nil
+}
+
+// readRecording decodes a recording with c, or in any of MRR's formats
+// when c is nil, telling them apart by their first bytes. Binary and NDJSON
+// are decoded as they are read rather than loaded whole first.
+func readRecording(r io.Reader, c codec) (*Recording, error) {
+    br := bufio.NewReader(r)
+
+    if magic, _ := br.Peek(len(encryptedMagic)); bytes.Equal(magic, encryptedMagic) {
+        sealed, err := ioutil.ReadAll(br)
+        if err != nil {
+            return nil, err
+        }
+        plain, err := unseal(sealed)
+        if err != nil {
+            return nil, err
+        }
+        return readRecording(bytes.NewReader(plain), c)
+    }
+
+    // Compressed files are recognised by the gzip header, whatever they
+    // are called.
+    if magic, _ := br.Peek(len(format.GzipMagic)); bytes.Equal(magic, format.GzipMagic) {
+        zr, err := gzip.NewReader(br)
+        if err != nil {
+            return nil, err
+        }
+        defer zr.Close()
+        br = bufio.NewReader(zr)
+    }
+
+    if c == nil {
+        c = sniffCodec(br)
+    }
+    recording, err := c.Decode(br)
+    return recording, suggestField(err)
+}
@@ -0,0 +1,112 @@
+// +build windows
+
+package main
+
+import (
+    "syscall"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Registry
+// ------------------------------------------
+
+// What MRR keeps in the registry is per user, under HKEY_CURRENT_USER, so
+// none of it needs administrator rights.
+
+const (
+    HKEY_CURRENT_USER = 0x80000001
+
+    KEY_READ  = 0x20019
+    KEY_WRITE = 0x20006
+
+    REG_SZ = 1
+
+    ERROR_FILE_NOT_FOUND = 2
+)
+
+var (
+    advapi32             = syscall.NewLazyDLL("advapi32.dll")
+    procRegCreateKeyExW  = advapi32.NewProc("RegCreateKeyExW")
+    procRegOpenKeyExW    = advapi32.NewProc("RegOpenKeyExW")
+    procRegSetValueExW   = advapi32.NewProc("RegSetValueExW")
+    procRegQueryValueExW = advapi32.NewProc("RegQueryValueExW")
+    procRegDeleteValueW  = advapi32.NewProc("RegDeleteValueW")
+    procRegDeleteTreeW   = advapi32.NewProc("RegDeleteTreeW")
+    procRegCloseKey      = advapi32.NewProc("RegCloseKey")
+)
+
+// regSetString sets value name of key under HKEY_CURRENT_USER to s,
+// creating the key. An empty name is the key's default value.
+func regSetString(key, name, s string) error {
+    k, _ := syscall.UTF16PtrFromString(key)
+    var h uintptr
+    if r, _, _ := procRegCreateKeyExW.Call(HKEY_CURRENT_USER, uintptr(unsafe.Pointer(k)), 0, 0, 0, KEY_WRITE, 0,
+        uintptr(unsafe.Pointer(&h)), 0); r != 0 {
+        return syscall.Errno(r)
+    }
+    defer procRegCloseKey.Call(h)
+    n, _ := syscall.UTF16PtrFromString(name)
+    data, _ := syscall.UTF16FromString(s)
+    if r, _, _ := procRegSetValueExW.Call(h, uintptr(unsafe.Pointer(n)), 0, REG_SZ,
+        uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)*2)); r != 0 {
+        return syscall.Errno(r)
+    }
+    return nil
+}
+
+// regGetString reads value name of key under HKEY_CURRENT_USER; ok is
+// false when there is no such value.
+func regGetString(key, name string) (s string, ok bool) {
+    k, _ := syscall.UTF16PtrFromString(key)
+    var h uintptr
+    if r, _, _ := procRegOpenKeyExW.Call(HKEY_CURRENT_USER, uintptr(unsafe.Pointer(k)), 0, KEY_READ,
+        uintptr(unsafe.Pointer(&h))); r != 0 {
+        return "", false
+    }
+    defer procRegCloseKey.Call(h)
+    n, _ := syscall.UTF16PtrFromString(name)
+    var size uint32
+    if r, _, _ := procRegQueryValueExW.Call(h, uintptr(unsafe.Pointer(n)), 0, 0, 0, uintptr(unsafe.Pointer(&size))); r != 0 {
+        return "", false
+    }
+    if size < 2 {
+        return "", true
+    }
+    buf := make([]uint16, size/2)
+    if r, _, _ := procRegQueryValueExW.Call(h, uintptr(unsafe.Pointer(n)), 0, 0,
+        uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); r != 0 {
+        return "", false
+    }
+    return syscall.UTF16ToString(buf), true
+}
+
+// regDeleteValue deletes value name of key under HKEY_CURRENT_USER. A
+// missing key or value is not an error.
+func regDeleteValue(key, name string) error {
+    k, _ := syscall.UTF16PtrFromString(key)
+    var h uintptr
+    r, _, _ := procRegOpenKeyExW.Call(HKEY_CURRENT_USER, uintptr(unsafe.Pointer(k)), 0, KEY_WRITE, uintptr(unsafe.Pointer(&h)))
+    if r == ERROR_FILE_NOT_FOUND {
+        return nil
+    }
+    if r != 0 {
+        return syscall.Errno(r)
+    }
+    defer procRegCloseKey.Call(h)
+    n, _ := syscall.UTF16PtrFromString(name)
+    if r, _, _ := procRegDeleteValueW.Call(h, uintptr(unsafe.Pointer(n))); r != 0 && r != ERROR_FILE_NOT_FOUND {
+        return syscall.Errno(r)
+    }
+    return nil
+}
+
+// regDeleteTree deletes key under HKEY_CURRENT_USER with everything in
+// it. A missing key is not an error.
+func regDeleteTree(key string) error {
+    k, _ := syscall.UTF16PtrFromString(key)
+    if r, _, _ := procRegDeleteTreeW.Call(HKEY_CURRENT_USER, uintptr(unsafe.Pointer(k))); r != 0 && r != ERROR_FILE_NOT_FOUND {
+        return syscall.Errno(r)
+    }
+    return nil
+}
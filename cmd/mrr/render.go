@@ -0,0 +1,424 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "image/color/palette"
+    "image/gif"
+    _ "image/jpeg"
+    _ "image/png"
+    "io"
+    "math"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/onixldlc/MRR/desktop"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     mrr render: animated preview
+// ------------------------------------------
+
+// A render plays a recording offline over a screenshot or a blank canvas:
+// the cursor moves as it would, leaving the path, click rings and wheel
+// crosses of 'mrr visualize' behind it. Nothing is injected. GIFs are
+// written directly; MP4 needs ffmpeg on the PATH.
+
+const (
+    defaultRenderFPS   = 10
+    defaultRenderWidth = 960
+)
+
+// cursorArrow is the cursor drawn in each frame: X black, . white.
+var cursorArrow = []string{
+    "X",
+    "XX",
+    "X.X",
+    "X..X",
+    "X...X",
+    "X....X",
+    "X.....X",
+    "X......X",
+    "X.......X",
+    "X........X",
+    "X.....XXXXX",
+    "X..X..X",
+    "X.X X..X",
+    "XX  X..X",
+    "X    X..X",
+    "     X..X",
+    "      XX",
+}
+
+// renderer draws a recording frame by frame onto base, which holds the
+// background and everything the cursor has left behind so far.
+type renderer struct {
+    cv      *canvas
+    records []MouseRecord
+    times   []int64
+    next    int
+    held    playback.HeldButtons
+    downs   map[string]string
+    last    *POINT
+    cursor  image.Point
+    // dirty is the part of base changed since the last frame.
+    dirty image.Rectangle
+}
+
+func newRenderer(recording *Recording, background image.Image, width int) *renderer {
+    b := buildViz(recording).Bounds
+    scale := float64(width) / float64(b.Width)
+    img := image.NewRGBA(image.Rect(0, 0, width, int(math.Round(float64(b.Height)*scale))))
+    if background != nil {
+        scaleImage(img, background)
+    } else {
+        for i := range img.Pix {
+            img.Pix[i] = 0xFF
+        }
+    }
+    r := &renderer{
+        cv:      &canvas{img: img, bounds: b, scale: scale},
+        records: recording.Records,
+        times:   recordTimes(recording.Records),
+        held:    make(playback.HeldButtons),
+        downs:   make(map[string]string),
+        cursor:  image.Pt(-100, -100),
+    }
+    for _, btn := range playback.Buttons {
+        r.downs[btn.Up] = btn.Down
+    }
+    return r
+}
+
+// scaleImage fills dst with src resized to fit, nearest neighbour.
+func scaleImage(dst *image.RGBA, src image.Image) {
+    db, sb := dst.Bounds(), src.Bounds()
+    for y := db.Min.Y; y < db.Max.Y; y++ {
+        sy := sb.Min.Y + (y-db.Min.Y)*sb.Dy()/db.Dy()
+        for x := db.Min.X; x < db.Max.X; x++ {
+            sx := sb.Min.X + (x-db.Min.X)*sb.Dx()/db.Dx()
+            dst.Set(x, y, src.At(sx, sy))
+        }
+    }
+}
+
+// touch marks the area within pad of (x, y) as changed.
+func (r *renderer) touch(x, y, pad float64) {
+    r.dirty = r.dirty.Union(image.Rect(int(x-pad)-1, int(y-pad)-1, int(x+pad)+2, int(y+pad)+2))
+}
+
+// advance draws every record up to ms into the canvas.
+func (r *renderer) advance(ms int64) {
+    for ; r.next < len(r.records) && r.times[r.next] <= ms; r.next++ {
+        rec := r.records[r.next]
+        if !playback.Positional(rec) {
+            continue
+        }
+        p := POINT{X: rec.X, Y: rec.Y}
+        x, y := r.cv.point(p.X, p.Y)
+        if r.last != nil && *r.last != p {
+            c, width := pathColor, 2.0
+            for up := range r.held {
+                c, width = buttonColors[r.downs[up]], 4
+            }
+            lx, ly := r.cv.point(r.last.X, r.last.Y)
+            r.cv.line(lx, ly, x, y, width, c)
+            r.dirty = r.dirty.Union(image.Rect(int(math.Min(lx, x))-3, int(math.Min(ly, y))-3,
+                int(math.Max(lx, x))+4, int(math.Max(ly, y))+4))
+        }
+        r.last = &p
+
+        if c, ok := buttonColors[rec.Event]; ok {
+            r.cv.ring(x, y, 9, 3, c)
+            r.touch(x, y, 12)
+        } else if rec.Event == "MouseWheel" || rec.Event == "MouseHWheel" {
+            r.cv.line(x-6, y-6, x+6, y+6, 2, wheelColor)
+            r.cv.line(x-6, y+6, x+6, y-6, 2, wheelColor)
+            r.touch(x, y, 8)
+        }
+        r.held.Track(rec.Event)
+        r.cursor = image.Pt(int(x), int(y))
+    }
+}
+
+// cursorRect is where the cursor is drawn.
+func (r *renderer) cursorRect() image.Rectangle {
+    return image.Rect(r.cursor.X, r.cursor.Y, r.cursor.X+11, r.cursor.Y+len(cursorArrow))
+}
+
+// drawCursor paints the cursor with set, which takes black or white.
+func (r *renderer) drawCursor(bounds image.Rectangle, set func(x, y int, black bool)) {
+    for dy, row := range cursorArrow {
+        for dx, ch := range row {
+            p := image.Pt(r.cursor.X+dx, r.cursor.Y+dy)
+            if ch != ' ' && p.In(bounds) {
+                set(p.X, p.Y, ch == 'X')
+            }
+        }
+    }
+}
+
+// frames calls frame with frames 0 to n at fps, the recording replayed
+// at speed, and returns n+1. The last frame is held for a second.
+func (r *renderer) frames(fps int, speed float64, frame func(i int) error) (int, error) {
+    if speed <= 0 {
+        speed = 1
+    }
+    end := int64(0)
+    if len(r.times) > 0 {
+        end = r.times[len(r.times)-1]
+    }
+    total := int(float64(end)/speed/1000*float64(fps)) + fps
+    for i := 0; i <= total; i++ {
+        r.advance(int64(float64(i) * 1000 / float64(fps) * speed))
+        if err := frame(i); err != nil {
+            return i, err
+        }
+    }
+    return total + 1, nil
+}
+
+// quantizer maps colours to a palette, remembering what it has seen.
+type quantizer struct {
+    pal   color.Palette
+    cache map[color.RGBA]uint8
+}
+
+func (q *quantizer) index(c color.RGBA) uint8 {
+    i, ok := q.cache[c]
+    if !ok {
+        i = uint8(q.pal.Index(c))
+        q.cache[c] = i
+    }
+    return i
+}
+
+// renderGIF writes the animation as a GIF. Only the part of each frame
+// that changed is stored, so long recordings stay small.
+func renderGIF(w io.Writer, r *renderer, fps int, speed float64) error {
+    q := &quantizer{pal: palette.Plan9, cache: make(map[color.RGBA]uint8)}
+    black, white := q.index(color.RGBA{0, 0, 0, 0xFF}), q.index(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+    full := r.cv.img.Bounds()
+    base := image.NewPaletted(full, q.pal)
+    quantize := func(rect image.Rectangle) {
+        for y := rect.Min.Y; y < rect.Max.Y; y++ {
+            for x := rect.Min.X; x < rect.Max.X; x++ {
+                base.SetColorIndex(x, y, q.index(r.cv.img.RGBAAt(x, y)))
+            }
+        }
+    }
+    quantize(full)
+
+    anim := &gif.GIF{}
+    // GIF delays are in hundredths of a second. Each frame lasts until the
+    // next one starts, rounded on the whole timeline so errors don't add up.
+    at := func(i int) int {
+        return int(math.Round(float64(i) * 100 / float64(fps)))
+    }
+    shown := 0
+    prevCursor := image.Rectangle{}
+    n, err := r.frames(fps, speed, func(i int) error {
+        if i > 0 && r.dirty.Empty() && r.cursorRect() == prevCursor {
+            // Nothing moved: the previous frame stays up longer.
+            return nil
+        }
+        rect := r.dirty.Union(prevCursor).Union(r.cursorRect()).Intersect(full)
+        if i == 0 {
+            rect = full
+        }
+        quantize(r.dirty.Intersect(full))
+        r.dirty = image.Rectangle{}
+        if rect.Empty() {
+            return nil
+        }
+        if k := len(anim.Delay); k > 0 {
+            anim.Delay[k-1] = at(i) - shown
+        }
+        shown = at(i)
+
+        img := image.NewPaletted(rect, q.pal)
+        for y := rect.Min.Y; y < rect.Max.Y; y++ {
+            copy(img.Pix[img.PixOffset(rect.Min.X, y):img.PixOffset(rect.Max.X, y)],
+                base.Pix[base.PixOffset(rect.Min.X, y):base.PixOffset(rect.Max.X, y)])
+        }
+        r.drawCursor(rect, func(x, y int, isBlack bool) {
+            if isBlack {
+                img.SetColorIndex(x, y, black)
+            } else {
+                img.SetColorIndex(x, y, white)
+            }
+        })
+        anim.Image = append(anim.Image, img)
+        anim.Delay = append(anim.Delay, 0)
+        anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+        prevCursor = r.cursorRect()
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    anim.Delay[len(anim.Delay)-1] = at(n) - shown
+    anim.Config = image.Config{ColorModel: q.pal, Width: full.Dx(), Height: full.Dy()}
+    return gif.EncodeAll(w, anim)
+}
+
+// renderMP4 pipes raw frames through ffmpeg.
+func renderMP4(out string, r *renderer, fps int, speed float64) error {
+    ffmpeg, err := exec.LookPath("ffmpeg")
+    if err != nil {
+        return fmt.Errorf("MP4 output needs ffmpeg on the PATH; name the output .gif instead")
+    }
+    b := r.cv.img.Bounds()
+    // yuv420p needs even dimensions.
+    w, h := b.Dx()&^1, b.Dy()&^1
+    cmd := exec.Command(ffmpeg, "-y", "-loglevel", "error",
+        "-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", b.Dx(), b.Dy()), "-r", strconv.Itoa(fps), "-i", "-",
+        "-vf", fmt.Sprintf("crop=%d:%d:0:0", w, h), "-pix_fmt", "yuv420p", out)
+    cmd.Stderr = os.Stderr
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return err
+    }
+    if err := cmd.Start(); err != nil {
+        return err
+    }
+
+    frame := image.NewRGBA(b)
+    _, err = r.frames(fps, speed, func(int) error {
+        copy(frame.Pix, r.cv.img.Pix)
+        r.drawCursor(b, func(x, y int, black bool) {
+            if black {
+                frame.SetRGBA(x, y, color.RGBA{0, 0, 0, 0xFF})
+            } else {
+                frame.SetRGBA(x, y, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+            }
+        })
+        _, err := stdin.Write(frame.Pix)
+        return err
+    })
+    stdin.Close()
+    if werr := cmd.Wait(); err == nil && werr != nil {
+        err = fmt.Errorf("ffmpeg: %v", werr)
+    }
+    return err
+}
+
+// loadBackground reads the --background image, or captures the recorded
+// screen area for "screen".
+func loadBackground(name string, bounds ScreenBounds) (image.Image, error) {
+    if name == "screen" {
+        pixels, err := desktop.CaptureScreen(bounds.X, bounds.Y, bounds.Width, bounds.Height)
+        if err != nil {
+            return nil, err
+        }
+        img := image.NewRGBA(image.Rect(0, 0, int(bounds.Width), int(bounds.Height)))
+        for i := 0; i < len(pixels); i += 4 {
+            img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = pixels[i+2], pixels[i+1], pixels[i], 0xFF
+        }
+        return img, nil
+    }
+    f, err := os.Open(name)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    img, _, err := image.Decode(f)
+    return img, err
+}
+
+// runRender implements `mrr render <in> -o <out.gif|out.mp4>`.
+func runRender(args []string) int {
+    var out, background string
+    fps, width := defaultRenderFPS, 0
+    var rest []string
+    var err error
+    for i := 0; i < len(args) && err == nil; i++ {
+        switch args[i] {
+        case "-o", "--out":
+            out, err = editValue(args, &i)
+        case "--background":
+            background, err = editValue(args, &i)
+        case "--fps", "--width":
+            var v string
+            if v, err = editValue(args, &i); err == nil {
+                n, perr := strconv.Atoi(v)
+                if perr != nil || n <= 0 {
+                    err = fmt.Errorf("%s needs a positive number", args[i-1])
+                } else if args[i-1] == "--fps" {
+                    fps = n
+                } else {
+                    width = n
+                }
+            }
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    var files []string
+    if err == nil {
+        files, err = parseArgs(rest)
+    }
+    ext := strings.ToLower(filepath.Ext(out))
+    if err != nil || len(files) != 1 || (ext != ".gif" && ext != ".mp4") {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr render <in> -o <out.gif|out.mp4> [--fps 10] [--width 960] [--speed x] [--background image|screen]")
+        return exitUsage
+    }
+    if fps > 50 {
+        fps = 50
+    }
+
+    in, err := resolveRecording(files[0])
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    recording, err := loadFromFile(in)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+        return loadExitCode(err)
+    }
+    bounds := buildViz(recording).Bounds
+    if bounds.Width <= 0 || bounds.Height <= 0 {
+        fmt.Println("[ERROR]", msg("Nothing to render"))
+        return exitLoadFailed
+    }
+    if width == 0 {
+        width = int(math.Min(float64(bounds.Width), defaultRenderWidth))
+    }
+    var bg image.Image
+    if background != "" {
+        if bg, err = loadBackground(background, bounds); err != nil {
+            fmt.Println("[ERROR]", msg("Could not load the background:"), err)
+            return exitLoadFailed
+        }
+    }
+
+    r := newRenderer(recording, bg, width)
+    if ext == ".mp4" {
+        err = renderMP4(out, r, fps, playerOpts.Speed)
+    } else {
+        var f *os.File
+        if f, err = os.Create(out); err == nil {
+            err = renderGIF(f, r, fps, playerOpts.Speed)
+            if cerr := f.Close(); err == nil {
+                err = cerr
+            }
+        }
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not render:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Rendered %s to %s", displayName(in), out))
+    return exitOK
+}
@@ -0,0 +1,46 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Resolution rescaling
+// ------------------------------------------
+
+func parseRescaleMode(s string) (playback.RescaleMode, error) {
+    switch strings.ToLower(s) {
+    case "fit", "letterbox":
+        return playback.RescaleFit, nil
+    case "stretch":
+        return playback.RescaleStretch, nil
+    case "none", "off":
+        return playback.RescaleNone, nil
+    }
+    return playback.RescaleFit, fmt.Errorf("unknown rescale mode %q (want fit, stretch or none)", s)
+}
+
+var anchorNames = map[string]playback.Anchor{
+    "topleft":     {X: 0, Y: 0},
+    "top":         {X: 0.5, Y: 0},
+    "topright":    {X: 1, Y: 0},
+    "left":        {X: 0, Y: 0.5},
+    "center":      {X: 0.5, Y: 0.5},
+    "right":       {X: 1, Y: 0.5},
+    "bottomleft":  {X: 0, Y: 1},
+    "bottom":      {X: 0.5, Y: 1},
+    "bottomright": {X: 1, Y: 1},
+}
+
+func parseAnchor(s string) (playback.Anchor, error) {
+    name := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(s))
+    if a, ok := anchorNames[name]; ok {
+        return a, nil
+    }
+    return playback.AnchorCenter, fmt.Errorf("unknown anchor %q", s)
+}
@@ -0,0 +1,110 @@
+// +build windows
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "sync"
+    "time"
+)
+
+// ------------------------------------------
+//     Run results
+// ------------------------------------------
+
+// With --result-json, 'mrr hook', 'record', 'play', 'tui' and 'shell'
+// write what they did to a file when they exit: the exit code and its
+// name, the last error, the recordings saved and every replay's result,
+// for a CI job to read instead of scraping the console.
+
+// resultJSONPath is the --result-json file, if any.
+var resultJSONPath string
+
+// RunResult is what --result-json writes.
+type RunResult struct {
+    Command    string      `json:"Command"`
+    ExitCode   int         `json:"ExitCode"`
+    Status     string      `json:"Status"`
+    Error      string      `json:"Error,omitempty"`
+    StartedAt  time.Time   `json:"StartedAt"`
+    FinishedAt time.Time   `json:"FinishedAt"`
+    Recordings []string    `json:"Recordings,omitempty"`
+    Replays    []ReplayRun `json:"Replays,omitempty"`
+}
+
+// ReplayRun is one replay in a RunResult.
+type ReplayRun struct {
+    File   string        `json:"File"`
+    Result *ReplayResult `json:"Result"`
+}
+
+var (
+    runResultMtx sync.Mutex
+    runResult    = RunResult{StartedAt: time.Now()}
+)
+
+// exitStatus names the exit codes.
+var exitStatus = map[int]string{
+    exitOK:           "ok",
+    exitReplayFailed: "replay_failed",
+    exitUsage:        "usage",
+    exitLoadFailed:   "load_failed",
+    exitAborted:      "aborted",
+    exitVerifyFailed: "verify_failed",
+    exitNotFound:     "not_found",
+    exitInvalid:      "invalid",
+    exitHooksFailed:  "hooks_failed",
+    exitRunning:      "already_running",
+}
+
+// loadExitCode is the exit code for failing to load a recording, playlist
+// or schedule with err.
+func loadExitCode(err error) int {
+    var perr *os.PathError
+    switch {
+    case errors.Is(err, os.ErrNotExist):
+        return exitNotFound
+    case errors.As(err, &perr), errors.Is(err, errWrongKey):
+        return exitLoadFailed
+    }
+    return exitInvalid
+}
+
+// noteRunError records err as the run's last error.
+func noteRunError(err error) {
+    runResultMtx.Lock()
+    runResult.Error = err.Error()
+    runResultMtx.Unlock()
+}
+
+func noteRecordingSaved(path string) {
+    runResultMtx.Lock()
+    runResult.Recordings = append(runResult.Recordings, path)
+    runResultMtx.Unlock()
+}
+
+func noteReplay(file string, result *ReplayResult) {
+    runResultMtx.Lock()
+    runResult.Replays = append(runResult.Replays, ReplayRun{file, result})
+    runResultMtx.Unlock()
+}
+
+// writeRunResult writes --result-json for command, which exited with
+// code.
+func writeRunResult(command string, code int) {
+    runResultMtx.Lock()
+    r := runResult
+    runResultMtx.Unlock()
+    r.Command, r.ExitCode, r.Status, r.FinishedAt = command, code, exitStatus[code], time.Now()
+    b, err := json.MarshalIndent(r, "", "  ")
+    if err == nil {
+        err = ioutil.WriteFile(resultJSONPath, append(b, '\n'), 0644)
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not write --result-json:"), err)
+    }
+}
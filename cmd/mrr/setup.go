@@ -0,0 +1,287 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "unsafe"
+
+    "github.com/onixldlc/MRR/desktop"
+)
+
+// ------------------------------------------
+//     First-run setup
+// ------------------------------------------
+
+// The first time 'mrr hook' runs on a console, with no config and no data
+// folder yet, it asks where to keep recordings, which keys to use and how
+// to treat monitors with different scaling, and writes the answers to
+// config.toml before starting. 'mrr setup' asks again.
+
+// setupHotkeys are the hotkeys the setup asks about. The others are written
+// to the config with their keys, for the user to find.
+var setupHotkeys = []hotkeyAction{actionRecord, actionReplay, actionAbort, actionPause}
+
+// setupAnswers are what the setup was told.
+type setupAnswers struct {
+    library    string
+    hotkeys    map[hotkeyAction]hotkey
+    noDPIScale bool
+}
+
+// setupInput reads the answers.
+var setupInput = bufio.NewReader(os.Stdin)
+
+// stdinIsConsole tells whether someone can answer on the console.
+func stdinIsConsole() bool {
+    var mode uint32
+    r, _, _ := procGetConsoleMode.Call(os.Stdin.Fd(), uintptr(unsafe.Pointer(&mode)))
+    return r != 0
+}
+
+// firstRun tells whether MRR runs for the first time, on a console: there
+// is neither a config nor a data folder.
+func firstRun(args []string) bool {
+    if _, err := os.Stat(configPath(args)); !os.IsNotExist(err) {
+        return false
+    }
+    if _, err := os.Stat(dataDir()); !os.IsNotExist(err) {
+        return false
+    }
+    return stdinIsConsole()
+}
+
+// runFirstRunSetup offers the setup and applies the config it writes. A
+// user who declines gets a config that says how to run it later, so they
+// aren't asked again.
+func runFirstRunSetup() error {
+    path := configPath(cliArgs)
+    fmt.Println("=======================================================")
+    fmt.Println(" " + msg("Welcome to Mouse Recorder & Replayer"))
+    fmt.Println("=======================================================")
+    printWrapped(msg("This looks like MRR's first run. A few questions set up the hotkeys, where recordings go and how monitors with different scaling are handled."))
+    if !askYesNo(msg("Set up now?"), true) {
+        if err := writeConfigFile(path, "# "+msg("Run 'mrr setup' to choose the hotkeys, the library folder and how monitors are handled.")+"\n"); err != nil {
+            return err
+        }
+        fmt.Println()
+        return nil
+    }
+    if err := runSetupQuestions(path); err != nil {
+        return err
+    }
+    return applyConfig(cliArgs)
+}
+
+// runSetup implements `mrr setup [flags]`.
+func runSetup(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr setup [flags]")
+        return exitUsage
+    }
+    if !stdinIsConsole() {
+        fmt.Println("[ERROR]", msg("mrr setup asks questions and needs a console"))
+        return exitUsage
+    }
+    path := configPath(cliArgs)
+    if _, err := os.Stat(path); err == nil {
+        printWrapped(msgf("%s exists; the setup replaces it, settings it doesn't ask about included.", path))
+        if !askYesNo(msg("Replace it?"), false) {
+            return exitOK
+        }
+    }
+    if err := runSetupQuestions(path); err != nil {
+        fmt.Println("[ERROR]", msg("Could not write the config:"), err)
+        return exitInvalid
+    }
+    return exitOK
+}
+
+// runSetupQuestions asks the questions and writes the answers to path.
+func runSetupQuestions(path string) error {
+    answers := setupAnswers{hotkeys: copyHotkeys()}
+
+    fmt.Println()
+    fmt.Println(msg("1/3 Where recordings go"))
+    printWrapped(msg("Recordings are saved to the library folder, where 'mrr list' and 'mrr play <name>' find them."))
+    for {
+        dir := ask(msg("Library folder"), libraryDir())
+        if dir == libraryDir() {
+            break
+        }
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            fmt.Println("[ERROR]", err)
+            continue
+        }
+        if abs, err := filepath.Abs(dir); err == nil {
+            dir = abs
+        }
+        answers.library = dir
+        break
+    }
+
+    fmt.Println()
+    fmt.Println(msg("2/3 Hotkeys"))
+    printWrapped(msg("Keys go by name, such as f9, end or numpadadd, with ctrl, alt, shift or win in front: ctrl+shift+r."))
+    for _, action := range setupHotkeys {
+        for {
+            current := answers.hotkeys[action]
+            keys := ask(setupHotkeyQuestion(action), strings.ToLower(current.String()))
+            h, err := parseHotkey(keys)
+            if err == nil {
+                for other, oh := range answers.hotkeys {
+                    if other != action && oh == h {
+                        err = errors.New(msgf("%s is already the %s hotkey", h, actionName(other)))
+                    }
+                }
+            }
+            if err != nil {
+                fmt.Println("[ERROR]", err)
+                continue
+            }
+            answers.hotkeys[action] = h
+            break
+        }
+    }
+
+    fmt.Println()
+    fmt.Println(msg("3/3 Monitors"))
+    mons := desktop.Monitors()
+    mixed := false
+    for i, m := range mons {
+        primary := ""
+        if m.Primary {
+            primary = "  " + msg("primary")
+        }
+        at := msgf("%dx%d at %d,%d", m.Rect.MaxX-m.Rect.MinX+1, m.Rect.MaxY-m.Rect.MinY+1, m.Rect.MinX, m.Rect.MinY)
+        fmt.Printf("  %d  %s  %d DPI (%d%%)%s\n", i+1, at, m.DPI, m.DPI*100/desktop.DefaultDPI, primary)
+        mixed = mixed || m.DPI != mons[0].DPI
+    }
+    if mixed {
+        printWrapped(msg("Your monitors use different scaling. Recordings note the scaling of the monitor under the cursor, and replays convert positions for the scaling the monitor has then."))
+        answers.noDPIScale = !askYesNo(msg("Convert positions between scalings?"), true)
+    } else {
+        printWrapped(msg("Your monitors use the same scaling. Recordings made at another scaling are converted when replayed; --no-dpi-scale turns that off."))
+    }
+    if len(mons) > 1 {
+        printWrapped(msg("Positions are kept across monitors as they are; --rescale adapts recordings made on another screen layout."))
+    }
+
+    if err := writeConfigFile(path, setupConfig(answers)); err != nil {
+        return err
+    }
+    fmt.Println()
+    fmt.Println("[INFO]", msgf("Saved the settings to %s; edit it or run 'mrr setup' to change them", path))
+    fmt.Println()
+    return nil
+}
+
+// setupHotkeyQuestion asks for action's key.
+func setupHotkeyQuestion(action hotkeyAction) string {
+    switch action {
+    case actionRecord:
+        return msg("Key to start and stop recording")
+    case actionReplay:
+        return msg("Key to replay")
+    case actionAbort:
+        return msg("Key to abort a replay")
+    case actionPause:
+        return msg("Key to pause and resume a replay")
+    }
+    return actionName(action)
+}
+
+// setupConfig is the config for answers. Defaults are written commented
+// out, and every hotkey is listed, so the file shows what can be set.
+func setupConfig(answers setupAnswers) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "# %s\n", msg("Written by 'mrr setup'. Any flag can be set here without its dashes; see the README's config file section."))
+    if answers.library != "" {
+        fmt.Fprintf(&b, "library = %s\n", tomlString(answers.library))
+    } else {
+        fmt.Fprintf(&b, "# library = %s\n", tomlString(libraryDir()))
+    }
+    if answers.noDPIScale {
+        fmt.Fprintln(&b, "no-dpi-scale = true")
+    } else {
+        fmt.Fprintln(&b, "# no-dpi-scale = true")
+    }
+    fmt.Fprintln(&b, "\n[hotkeys]")
+    for action := actionRecord; action <= actionReload; action++ {
+        fmt.Fprintf(&b, "%s = %s\n", actionName(action), strconv.Quote(strings.ToLower(answers.hotkeys[action].String())))
+    }
+    return b.String()
+}
+
+// tomlString quotes s for the config, in single quotes, which keep
+// backslashes as they are, unless s has one.
+func tomlString(s string) string {
+    if strings.Contains(s, "'") {
+        return strconv.Quote(s)
+    }
+    return "'" + s + "'"
+}
+
+// writeConfigFile writes the config to path, creating its folder.
+func writeConfigFile(path, text string) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+    return writeAtomic(path, func(f *os.File) error {
+        _, err := f.WriteString(text)
+        return err
+    })
+}
+
+// ask prints question with its default and returns the answer, or the
+// default for an empty one or the end of the input.
+func ask(question, def string) string {
+    printPrompt("  %s [%s]: ", question, def)
+    line, err := setupInput.ReadString('\n')
+    if err == io.EOF {
+        printPrompt("\n")
+    }
+    if line = strings.TrimSpace(line); line == "" {
+        return def
+    }
+    return line
+}
+
+// askYesNo asks a yes or no question.
+func askYesNo(question string, def bool) bool {
+    hint := msg("Y/n")
+    if !def {
+        hint = msg("y/N")
+    }
+    for {
+        printPrompt("  %s [%s]: ", question, hint)
+        line, err := setupInput.ReadString('\n')
+        answer := strings.ToLower(strings.TrimSpace(line))
+        switch {
+        case answer == "":
+            if err != nil {
+                fmt.Println()
+            }
+            return def
+        case strings.HasPrefix(answer, "y"), strings.HasPrefix(answer, msg("y")):
+            return true
+        case strings.HasPrefix(answer, "n"):
+            return false
+        }
+        if err != nil {
+            return def
+        }
+    }
+}
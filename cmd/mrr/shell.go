@@ -0,0 +1,409 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "runtime"
+    "strings"
+    "time"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     mrr shell
+// ------------------------------------------
+
+// 'mrr shell' installs the hooks as 'mrr hook' does, so the hotkeys keep
+// working, and reads commands from a prompt: record, play, stop, the
+// library commands and so on, all in one session. Its input can be a
+// script too, 'mrr shell < steps.txt', which ends once the last replay
+// has.
+
+// shellLibraryCommands are the 'mrr' commands the shell runs as they are,
+// each with its own flags.
+var shellLibraryCommands = []string{"list", "info", "use", "rm", "import", "convert", "edit", "split", "merge", "visualize", "render", "devices"}
+
+var shellHelp = []struct{ usage, summary string }{
+    {"record [start|stop]", "start a recording, or stop and save it"},
+    {"play [name] [flags]", "replay name, or what End replays, with replay flags for this replay; queued behind a running one"},
+    {"stop", "save the recording, or abort the replay and its queue"},
+    {"pause, resume", "pause or resume the running replay"},
+    {"wait", "wait for the running replay and its queue to end"},
+    {"status", "say what MRR is doing"},
+    {"set <flags>", "apply flags for the rest of the session, e.g. set --save-as demo"},
+    {"reload", "reload the config file"},
+    {"profile [name]", "switch to a [profile.name] from the config, or say which is in use"},
+    {strings.Join(shellLibraryCommands, ", "), "as 'mrr <command>'"},
+    {"help [command]", "this list, or a library command's usage and flags"},
+    {"exit", "save a recording in progress, abort any replay and quit"},
+}
+
+// runShell implements `mrr shell [flags]`.
+func runShell(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr shell [flags]")
+        return exitUsage
+    }
+    release, ok := claimInstance()
+    if !ok {
+        return alreadyRunning()
+    }
+    defer release()
+    stopLogging, err := startLogging()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not open the log file:"), err)
+        return exitUsage
+    }
+    defer stopLogging()
+    player = NewPlayer(playerOpts)
+    if encryptRecordings {
+        if _, err := sealingKey(); err != nil {
+            fmt.Println("[ERROR]", err)
+            return exitUsage
+        }
+    }
+
+    runtime.LockOSThread()
+    defer runtime.UnlockOSThread()
+    defer waitReplayStopped()
+    if err := installHooks(); err != nil {
+        fmt.Println("[ERROR]", msg("Could not install hooks:"), err)
+        noteRunError(err)
+        return exitHooksFailed
+    }
+    defer unInstallHooks()
+    thread, _, _ := procGetCurrentThreadId.Call()
+    defer handleConsoleCtrl(func() { quitThread(thread) })()
+
+    var mode uint32
+    interactive, _, _ := procGetConsoleMode.Call(os.Stdin.Fd(), uintptr(unsafe.Pointer(&mode)))
+    if interactive != 0 {
+        fmt.Println("[INFO]", msg("MRR shell; type 'help' for the commands and 'exit' to quit."))
+    }
+    go func() {
+        runShellInput(os.Stdin, interactive != 0)
+        quitThread(thread)
+    }()
+    runMessageLoop()
+    return exitOK
+}
+
+// runShellInput runs the commands in r until exit or the end of the input,
+// where it waits for the replays to finish.
+func runShellInput(r io.Reader, prompt bool) {
+    sc := bufio.NewScanner(r)
+    for {
+        if prompt {
+            printPrompt("mrr> ")
+        }
+        if !sc.Scan() {
+            if prompt {
+                printPrompt("\n")
+            }
+            waitReplays()
+            return
+        }
+        line := strings.TrimSpace(sc.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        if !runShellLine(line) {
+            return
+        }
+    }
+}
+
+// runShellLine runs one command and returns false to quit.
+func runShellLine(line string) bool {
+    args, err := splitCommandLine(line)
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return true
+    }
+    name, args := args[0], args[1:]
+    switch name {
+    case "exit", "quit":
+        return false
+    case "help", "?":
+        shellHelpCommand(args)
+    case "record":
+        shellRecord(args)
+    case "play":
+        shellPlay(args)
+    case "stop":
+        switch {
+        case recordingActive():
+            finishRecording()
+        case abortReplay():
+            fmt.Println("[INFO]", msg("Replay aborted"))
+        default:
+            fmt.Println("[INFO]", msg("Nothing to stop"))
+        }
+    case "pause", "resume":
+        p := replayingPlayer()
+        switch {
+        case p == nil:
+            fmt.Println("[ERROR]", msg("No replay in progress"))
+        case name == "pause" && p.Pause():
+            fmt.Println("[INFO]", msg("Replay paused"))
+        case name == "resume" && p.Resume():
+            fmt.Println("[INFO]", msg("Replay resumed"))
+        }
+    case "wait":
+        waitReplays()
+    case "status":
+        fmt.Println("[INFO]", shellStatus())
+    case "set":
+        shellSet(args)
+    case "reload":
+        if err := reloadConfig(); err != nil {
+            fmt.Println("[ERROR]", msg("Could not reload the config:"), err)
+        } else {
+            fmt.Println("[INFO]", msg("Reloaded the config"))
+        }
+    case "profile":
+        shellProfile(args)
+    default:
+        cmd := findCommand(name)
+        if cmd == nil || !isShellLibraryCommand(name) {
+            names := append([]string{"record", "play", "stop", "pause", "resume", "wait", "status", "set", "reload", "profile", "help", "exit"}, shellLibraryCommands...)
+            fmt.Println("[ERROR]", msgf("Unknown command %q%s", name, suggest(name, names)))
+            return true
+        }
+        runShellLibraryCommand(cmd, args)
+    }
+    return true
+}
+
+func isShellLibraryCommand(name string) bool {
+    for _, c := range shellLibraryCommands {
+        if c == name {
+            return true
+        }
+    }
+    return false
+}
+
+// runShellLibraryCommand runs cmd as 'mrr' would. The flags given to it
+// apply to that command only.
+func runShellLibraryCommand(cmd *command, args []string) {
+    settings := currentFlagSettings()
+    prevCommand, prevFlags := activeCommand, activeFlags
+    activeCommand, activeFlags = cmd.name, cmd.flags
+    defer func() {
+        settings.restore()
+        activeCommand, activeFlags = prevCommand, prevFlags
+    }()
+    for _, a := range args {
+        if isHelpFlag(a) {
+            commandHelp(cmd)
+            return
+        }
+    }
+    if code := cmd.run(args); code != exitOK {
+        debugPrintln("[DEBUG]", cmd.name, "exited with", code)
+    }
+}
+
+func shellHelpCommand(args []string) {
+    if len(args) > 0 {
+        if cmd := findCommand(args[0]); cmd != nil && isShellLibraryCommand(args[0]) {
+            commandHelp(cmd)
+            return
+        }
+    }
+    for _, h := range shellHelp {
+        fmt.Printf("  %-22s %s\n", h.usage, msg(h.summary))
+    }
+    fmt.Println(" ", msgf("The hotkeys work meanwhile: %s records, %s replays, %s aborts.",
+        hotkeyName(actionRecord), hotkeyName(actionReplay), hotkeyName(actionAbort)))
+}
+
+func shellRecord(args []string) {
+    op := "start"
+    if len(args) > 0 {
+        op = args[0]
+    }
+    switch {
+    case len(args) > 1 || op != "start" && op != "stop":
+        fmt.Println("[ERROR]", msg("usage: record [start|stop]"))
+    case op == "start":
+        if !startRecording() {
+            fmt.Println("[ERROR]", msg("A recording is already in progress"))
+            return
+        }
+        fmt.Println("[INFO]", msg("Recording; 'stop' saves it"))
+    case !recordingActive():
+        fmt.Println("[ERROR]", msg("No recording in progress"))
+    default:
+        finishRecording()
+    }
+}
+
+// shellPlay replays a recording, with replay flags for this replay only.
+func shellPlay(args []string) {
+    settings := currentFlagSettings()
+    defer settings.restore()
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 1 {
+        err = fmt.Errorf("play takes one recording")
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return
+    }
+    target := replayTarget()
+    if len(files) == 1 {
+        target = files[0]
+        if path, err := resolveRecording(target); err == nil {
+            target = path
+        }
+    }
+    if replayActive() {
+        if len(files) < len(args) {
+            fmt.Println("[ERROR]", msg("Flags can't change a running replay; 'wait' or 'stop' first"))
+            return
+        }
+        if n := queueReplay(target); n > 0 {
+            fmt.Println("[INFO]", msgf("Queued %s (%d waiting)", displayName(target), n))
+            return
+        }
+    } else if beginReplay(NewPlayer(playerOpts), target) == nil {
+        // Another replay got in first; this one waits with the session's
+        // flags.
+        n := queueReplay(target)
+        fmt.Println("[INFO]", msgf("Queued %s (%d waiting)", displayName(target), n))
+        return
+    }
+    fmt.Println("[INFO]", msgf("Replaying %s", displayName(target)))
+}
+
+// shellSet applies flags for the rest of the session.
+func shellSet(args []string) {
+    if len(args) == 0 {
+        fmt.Println("[ERROR]", msg("usage: set <flags>"))
+        return
+    }
+    if containsString(args, "--profile") {
+        fmt.Println("[ERROR]", msg("Use 'profile <name>' to switch profiles"))
+        return
+    }
+    settings := currentFlagSettings()
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        settings.restore()
+        fmt.Println("[ERROR]", err)
+        return
+    }
+    setPlayer(NewPlayer(playerOpts))
+    fmt.Println("[INFO]", msgf("Set %s", strings.Join(args, " ")))
+}
+
+// shellProfile switches profiles, or says which one is in use.
+func shellProfile(args []string) {
+    switch len(args) {
+    case 0:
+        summary, err := profileSummary()
+        if err != nil {
+            fmt.Println("[ERROR]", msg("Could not read the config:"), err)
+            return
+        }
+        fmt.Println("[INFO]", msgf("Using %s", summary))
+    case 1:
+        if err := switchProfile(args[0]); err != nil {
+            fmt.Println("[ERROR]", msg("Could not switch the profile:"), err)
+            return
+        }
+        fmt.Println("[INFO]", msgf("Switched to profile %s", args[0]))
+    default:
+        fmt.Println("[ERROR]", msg("usage: profile [name]"))
+    }
+}
+
+func shellStatus() string {
+    if recordingActive() {
+        return msg("Recording")
+    }
+    p := activePlayer()
+    if rp := p.Progress(); rp != nil {
+        if p.Paused() {
+            return msgf("Paused %s", formatProgress(*rp))
+        }
+        return msgf("Replaying %s", formatProgress(*rp))
+    }
+    return msg("Idle")
+}
+
+// waitReplays waits for the running replay and the ones queued behind it.
+func waitReplays() {
+    for replayActive() {
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
+// splitCommandLine splits line into words at spaces, keeping what is in
+// double or single quotes together. Backslashes are plain characters, so
+// Windows paths need no escaping.
+func splitCommandLine(line string) ([]string, error) {
+    var words []string
+    var word strings.Builder
+    inWord := false
+    var quote rune
+    for _, c := range line {
+        switch {
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            } else {
+                word.WriteRune(c)
+            }
+        case c == '"' || c == '\'':
+            quote, inWord = c, true
+        case c == ' ' || c == '\t':
+            if inWord {
+                words = append(words, word.String())
+                word.Reset()
+                inWord = false
+            }
+        default:
+            word.WriteRune(c)
+            inWord = true
+        }
+    }
+    if quote != 0 {
+        return nil, fmt.Errorf("unterminated %c quote", quote)
+    }
+    if inWord {
+        words = append(words, word.String())
+    }
+    return words, nil
+}
+
+// quoteCommandLine joins args for splitCommandLine, quoting the ones with
+// spaces or quotes.
+func quoteCommandLine(args []string) string {
+    quoted := make([]string, len(args))
+    for i, a := range args {
+        switch {
+        case a != "" && !strings.ContainsAny(a, " \t\"'"):
+            quoted[i] = a
+        case !strings.Contains(a, `"`):
+            quoted[i] = `"` + a + `"`
+        default:
+            quoted[i] = "'" + a + "'"
+        }
+    }
+    return strings.Join(quoted, " ")
+}
@@ -0,0 +1,179 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "syscall"
+)
+
+// ------------------------------------------
+//     Explorer integration
+// ------------------------------------------
+
+// 'mrr install-shell' makes double-clicking a recording or playlist in
+// Explorer replay it with 'mrr play', after a countdown to let go of the
+// mouse. It registers a file type for the current user, so it needs no
+// administrator rights, and 'mrr uninstall-shell' takes it out again.
+
+const (
+    shellProgID = "MRR.Recording"
+    classesKey  = `Software\Classes\`
+    // shellPreviousValue keeps an extension's file type from before, for
+    // uninstall-shell to put back.
+    shellPreviousValue = "MRR.Previous"
+    // shellCountdown gives the user time to move their hand off the mouse
+    // after double-clicking.
+    shellCountdown = "3s"
+
+    SHCNE_ASSOCCHANGED = 0x08000000
+    SHCNF_IDLIST       = 0x0000
+)
+
+// shellExts are the extensions double-clicking replays.
+var shellExts = []string{".cfg", playlistExt}
+
+var procSHChangeNotify = shell32.NewProc("SHChangeNotify")
+
+// runInstallShell implements `mrr install-shell [replay flags]`. The flags
+// go into the command Explorer runs.
+func runInstallShell(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr install-shell [replay flags]")
+        return exitUsage
+    }
+    exe, err := os.Executable()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not register the file types:"), err)
+        return exitInvalid
+    }
+
+    // The config is read again when a file is opened, so only the command
+    // line's own flags are kept. Explorer doesn't start it in this folder.
+    playArgs := []string{"play"}
+    if !containsString(cliArgs, "--countdown") {
+        playArgs = append(playArgs, "--countdown", shellCountdown)
+    }
+    playArgs = append(playArgs, absolutePathArgs(cliArgs)...)
+    command := commandLine(exe, playArgs) + ` "%1"`
+
+    if err := installShell(exe, command); err != nil {
+        fmt.Println("[ERROR]", msg("Could not register the file types:"), err)
+        return exitInvalid
+    }
+    fmt.Println("[INFO]", msgf("Double-clicking %s files now replays them with %s", strings.Join(shellExts, " and "), command))
+    fmt.Println("[INFO]", msg("If Windows asks which app to open them with, pick MRR."))
+    return exitOK
+}
+
+// commandLine is the command line that runs exe with args, quoted for
+// Windows.
+func commandLine(exe string, args []string) string {
+    command := syscall.EscapeArg(exe)
+    for _, a := range args {
+        command += " " + syscall.EscapeArg(a)
+    }
+    return command
+}
+
+func installShell(exe, command string) error {
+    prog := classesKey + shellProgID
+    for _, v := range []struct{ key, name, value string }{
+        {prog, "", msg("MRR recording")},
+        {prog + `\DefaultIcon`, "", exe + ",0"},
+        {prog + `\shell`, "", "open"},
+        {prog + `\shell\open`, "", msg("Replay with MRR")},
+        {prog + `\shell\open\command`, "", command},
+    } {
+        if err := regSetString(v.key, v.name, v.value); err != nil {
+            return err
+        }
+    }
+    for _, ext := range shellExts {
+        key := classesKey + ext
+        if prev, ok := regGetString(key, ""); ok && prev != shellProgID && prev != "" {
+            if err := regSetString(key, shellPreviousValue, prev); err != nil {
+                return err
+            }
+        }
+        if err := regSetString(key, "", shellProgID); err != nil {
+            return err
+        }
+        if err := regSetString(key+`\OpenWithProgids`, shellProgID, ""); err != nil {
+            return err
+        }
+    }
+    procSHChangeNotify.Call(SHCNE_ASSOCCHANGED, SHCNF_IDLIST, 0, 0)
+    return nil
+}
+
+// runUninstallShell implements `mrr uninstall-shell`.
+func runUninstallShell(args []string) int {
+    if len(args) > 0 {
+        fmt.Println("usage: mrr uninstall-shell")
+        return exitUsage
+    }
+    if err := uninstallShell(); err != nil {
+        fmt.Println("[ERROR]", msg("Could not unregister the file types:"), err)
+        return exitInvalid
+    }
+    fmt.Println("[INFO]", msgf("Double-clicking %s files no longer runs MRR", strings.Join(shellExts, " and ")))
+    return exitOK
+}
+
+// uninstallShell removes the file type and gives the extensions back the
+// ones they had.
+func uninstallShell() error {
+    for _, ext := range shellExts {
+        key := classesKey + ext
+        if err := regDeleteValue(key+`\OpenWithProgids`, shellProgID); err != nil {
+            return err
+        }
+        if cur, _ := regGetString(key, ""); cur != shellProgID {
+            continue
+        }
+        var err error
+        if prev, ok := regGetString(key, shellPreviousValue); ok {
+            err = regSetString(key, "", prev)
+        } else {
+            err = regDeleteValue(key, "")
+        }
+        if err == nil {
+            err = regDeleteValue(key, shellPreviousValue)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    if err := regDeleteTree(classesKey + shellProgID); err != nil {
+        return err
+    }
+    procSHChangeNotify.Call(SHCNE_ASSOCCHANGED, SHCNF_IDLIST, 0, 0)
+    return nil
+}
+
+// runOpen implements `mrr open`: the recordings folder in Explorer, as the
+// tray's "Open recordings folder".
+func runOpen(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr open [flags]")
+        return exitUsage
+    }
+    if err := openFolder(dataDir()); err != nil {
+        fmt.Println("[ERROR]", msg("Could not open the recordings folder:"), err)
+        return exitInvalid
+    }
+    return exitOK
+}
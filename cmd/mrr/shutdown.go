@@ -0,0 +1,128 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// ------------------------------------------
+//     Shutdown
+// ------------------------------------------
+
+// Without a handler of its own, Ctrl+C or closing the console ends the
+// process on the spot: the recording in progress is lost, a replay leaves
+// whatever it held down pressed and the hooks go with the process. The
+// console control handler stops the session properly first.
+
+const (
+    CTRL_C_EVENT        = 0
+    CTRL_BREAK_EVENT    = 1
+    CTRL_CLOSE_EVENT    = 2
+    CTRL_LOGOFF_EVENT   = 5
+    CTRL_SHUTDOWN_EVENT = 6
+
+    // replayStopWait bounds how long an aborted replay gets to release
+    // the buttons and keys it holds.
+    replayStopWait = 2 * time.Second
+    // ctrlCloseWait is how long the handler holds off Windows after a
+    // close, log off or shut down; the process is ended when the handler
+    // returns, so it waits for the command to clean up and exit instead.
+    ctrlCloseWait = 10 * time.Second
+)
+
+var (
+    procSetConsoleCtrlHandler = kernel32.MustFindProc("SetConsoleCtrlHandler")
+
+    ctrlMtx sync.Mutex
+    // ctrlStop stops the running command; nil when no handler is set.
+    ctrlStop func()
+    // ctrlStopped is set once ctrlStop has been called.
+    ctrlStopped bool
+
+    ctrlCallback = syscall.NewCallback(consoleCtrlHandler)
+)
+
+// handleConsoleCtrl makes Ctrl+C, Ctrl+Break, closing the console, logging
+// off and shutting down call stop, which has to make the command return.
+// A second Ctrl+C ends the process regardless. The returned function
+// removes the handler.
+func handleConsoleCtrl(stop func()) func() {
+    ctrlMtx.Lock()
+    ctrlStop, ctrlStopped = stop, false
+    ctrlMtx.Unlock()
+    procSetConsoleCtrlHandler.Call(ctrlCallback, 1)
+    return func() {
+        procSetConsoleCtrlHandler.Call(ctrlCallback, 0)
+        ctrlMtx.Lock()
+        ctrlStop = nil
+        ctrlMtx.Unlock()
+    }
+}
+
+// consoleCtrlHandler runs on a thread Windows starts for the event.
+func consoleCtrlHandler(event uintptr) uintptr {
+    ctrlMtx.Lock()
+    stop, again := ctrlStop, ctrlStopped
+    ctrlStopped = true
+    ctrlMtx.Unlock()
+    if stop == nil {
+        return 0
+    }
+    if again {
+        if event == CTRL_C_EVENT || event == CTRL_BREAK_EVENT {
+            // Let the default handler end the process.
+            return 0
+        }
+    } else {
+        fmt.Println("[INFO]", msgf("%s, exiting", ctrlEventName(event)))
+        stop()
+    }
+    if event != CTRL_C_EVENT && event != CTRL_BREAK_EVENT {
+        time.Sleep(ctrlCloseWait)
+    }
+    return 1
+}
+
+func ctrlEventName(event uintptr) string {
+    switch event {
+    case CTRL_C_EVENT:
+        return "Ctrl+C"
+    case CTRL_BREAK_EVENT:
+        return "Ctrl+Break"
+    case CTRL_CLOSE_EVENT:
+        return msg("Console closed")
+    case CTRL_LOGOFF_EVENT:
+        return msg("Logging off")
+    case CTRL_SHUTDOWN_EVENT:
+        return msg("Shutting down")
+    }
+    return msgf("Console event %d", event)
+}
+
+// stopSession saves a recording in progress and aborts any replay.
+func stopSession() {
+    if recordingActive() {
+        finishRecording()
+    }
+    abortReplay()
+}
+
+// waitReplayStopped gives an aborted replay time to let go of what it
+// holds down. It is called once the hooks are off, so the hook thread no
+// longer pumping messages doesn't hold up the injected releases.
+func waitReplayStopped() {
+    deadline := time.Now().Add(replayStopWait)
+    for replayActive() && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// quitThread stops the session and ends thread's message loop.
+func quitThread(thread uintptr) {
+    stopSession()
+    procPostThreadMessageW.Call(thread, WM_QUIT, 0, 0)
+}
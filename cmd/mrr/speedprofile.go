@@ -0,0 +1,63 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Speed profiles
+// ------------------------------------------
+
+// parseRamp parses "start:duration", e.g. "0.25:10s" to start at a
+// quarter speed and reach full speed after ten recorded seconds.
+func parseRamp(s string) (playback.SpeedProfile, error) {
+    parts := strings.SplitN(s, ":", 2)
+    if len(parts) != 2 {
+        return nil, fmt.Errorf("expected start:duration like 0.25:10s but got %q", s)
+    }
+    start, err := strconv.ParseFloat(parts[0], 64)
+    if err != nil || start <= 0 {
+        return nil, fmt.Errorf("invalid start speed %q", parts[0])
+    }
+    d, err := time.ParseDuration(parts[1])
+    if err != nil || d <= 0 {
+        return nil, fmt.Errorf("invalid ramp duration %q", parts[1])
+    }
+    return playback.SpeedProfile{
+        {At: 0, Speed: start},
+        {At: d, Speed: 1, Ramp: true},
+    }, nil
+}
+
+// parseSpeedMap parses comma separated "time=speed" segments, e.g.
+// "0s=0.5,30s=1,2m=3". A speed prefixed with ~ is ramped up to from the
+// previous segment: "0s=0.5,30s=~2".
+func parseSpeedMap(s string) (playback.SpeedProfile, error) {
+    var sp playback.SpeedProfile
+    for _, seg := range strings.Split(s, ",") {
+        parts := strings.SplitN(strings.TrimSpace(seg), "=", 2)
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("expected time=speed but got %q", seg)
+        }
+        at, err := time.ParseDuration(parts[0])
+        if err != nil || at < 0 {
+            return nil, fmt.Errorf("invalid time %q", parts[0])
+        }
+        ramp := strings.HasPrefix(parts[1], "~")
+        speed, err := strconv.ParseFloat(strings.TrimPrefix(parts[1], "~"), 64)
+        if err != nil || speed <= 0 {
+            return nil, fmt.Errorf("invalid speed %q", parts[1])
+        }
+        sp = append(sp, playback.SpeedPoint{At: at, Speed: speed, Ramp: ramp})
+    }
+    sort.SliceStable(sp, func(i, j int) bool { return sp[i].At < sp[j].At })
+    return sp, nil
+}
@@ -0,0 +1,273 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     mrr split / mrr merge
+// ------------------------------------------
+
+// A record's DeltaMS is the wait before it, so a recording's timeline is
+// the running sum of its deltas. Splitting keeps, for the first record of
+// each part, the wait since the cut; merging keeps, for the first record of
+// each later file, the wait it had after its own recording started, plus
+// any --gap.
+
+// recordTimes returns when each record happens, from the start.
+func recordTimes(records []MouseRecord) []int64 {
+    times := make([]int64, len(records))
+    var t int64
+    for i, rec := range records {
+        t += rec.DeltaMS
+        times[i] = t
+    }
+    return times
+}
+
+// sliceRecording returns the records [lo, hi) of r as a recording of their
+// own, with the DPI segments moved along and the summary recomputed.
+// startMS is when, on r's timeline, the new recording starts.
+func sliceRecording(r *Recording, lo, hi int, startMS int64) *Recording {
+    out := &Recording{Metadata: r.Metadata}
+    out.Records = append([]MouseRecord(nil), r.Records[lo:hi]...)
+    if len(out.Records) > 0 {
+        first := recordTimes(r.Records[:lo+1])[lo]
+        out.Records[0].DeltaMS = first - startMS
+    }
+    for _, seg := range r.DPISegments {
+        switch {
+        case seg.Index >= hi:
+        case seg.Index <= lo:
+            // The segment in effect at lo starts the new recording.
+            seg.Index = 0
+            if len(out.DPISegments) > 0 {
+                out.DPISegments[0] = seg
+            } else {
+                out.DPISegments = append(out.DPISegments, seg)
+            }
+        default:
+            seg.Index -= lo
+            out.DPISegments = append(out.DPISegments, seg)
+        }
+    }
+    summary := format.Summarize(out.Records)
+    out.Summary = &summary
+    return out
+}
+
+// appendRecording adds src's records to dst, gapMS after dst's last one.
+func appendRecording(dst, src *Recording, gapMS int64) {
+    base := len(dst.Records)
+    for i, rec := range src.Records {
+        if i == 0 {
+            rec.DeltaMS += gapMS
+        }
+        dst.Records = append(dst.Records, rec)
+    }
+    for _, seg := range src.DPISegments {
+        seg.Index += base
+        dst.DPISegments = append(dst.DPISegments, seg)
+    }
+    summary := format.Summarize(dst.Records)
+    dst.Summary = &summary
+}
+
+// heldAt returns the buttons still down after records, which a part
+// starting there would never press.
+func heldAt(records []MouseRecord) []string {
+    held := make(playback.HeldButtons)
+    for _, rec := range records {
+        held.Track(rec.Event)
+    }
+    var names []string
+    for _, b := range playback.Buttons {
+        if held[b.Up] {
+            names = append(names, strings.TrimSuffix(b.Up, "Up"))
+        }
+    }
+    return names
+}
+
+// siblingName names the n-th part of the recording at path: "login.cfg"
+// gives "login-2.cfg", and a library name "login" gives "login-2".
+func siblingName(path string, n int) string {
+    if db, name, ok := parseStoreRef(path); ok {
+        return storeRef(db, fmt.Sprintf("%s-%d", name, n))
+    }
+    base, gz := path, ""
+    if strings.HasSuffix(strings.ToLower(base), ".gz") {
+        base, gz = base[:len(base)-3], base[len(base)-3:]
+    }
+    ext := filepath.Ext(base)
+    return fmt.Sprintf("%s-%d%s%s", strings.TrimSuffix(base, ext), n, ext, gz)
+}
+
+// displayName is a file name, or a library reference's name.
+func displayName(path string) string {
+    if _, name, ok := parseStoreRef(path); ok {
+        return name
+    }
+    return path
+}
+
+// saveRecording saves r to path in the format its name implies, else
+// --format.
+func saveRecording(path string, r *Recording) error {
+    c := codecForFile(path)
+    if c == nil || !c.Native() {
+        c = recordingCodec()
+    }
+    return saveAs(path, r, c, ExportOptions{})
+}
+
+// runSplit implements `mrr split <in> --at 00:30 [--at 01:10]`.
+func runSplit(args []string) int {
+    var cuts []time.Duration
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        if args[i] != "--at" {
+            rest = append(rest, args[i])
+            continue
+        }
+        if i++; i >= len(args) {
+            fmt.Println("[ERROR]", msg("--at needs a time such as 00:30"))
+            return exitUsage
+        }
+        for _, s := range strings.Split(args[i], ",") {
+            d, err := parseClock(strings.TrimSpace(s))
+            if err != nil {
+                fmt.Println("[ERROR] --at:", err)
+                return exitUsage
+            }
+            cuts = append(cuts, d)
+        }
+    }
+    files, err := parseArgs(rest)
+    if err != nil || len(files) != 1 || len(cuts) == 0 {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr split <in> --at [hh:]mm:ss [--at ...]")
+        return exitUsage
+    }
+    in, err := resolveRecording(files[0])
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    recording, err := loadFromFile(in)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+        return loadExitCode(err)
+    }
+
+    times := recordTimes(recording.Records)
+    lo := 0
+    var start int64
+    for n := 1; n <= len(cuts)+1; n++ {
+        hi := len(recording.Records)
+        var end int64
+        if n <= len(cuts) {
+            end = cuts[n-1].Milliseconds()
+            if end <= start {
+                fmt.Println("[ERROR]", msg("--at times must increase"))
+                return exitUsage
+            }
+            hi = lo
+            for hi < len(times) && times[hi] < end {
+                hi++
+            }
+        }
+        part := sliceRecording(recording, lo, hi, start)
+        out := siblingName(in, n)
+        if len(part.Records) == 0 {
+            fmt.Println("[WARN]", msgf("Part %d (%s) has no records", n, displayName(out)))
+        }
+        if held := heldAt(recording.Records[:hi]); n <= len(cuts) && len(held) > 0 {
+            fmt.Println("[WARN]", msgf("%s is held down across the cut at %s", strings.Join(held, ", "), formatClock(cuts[n-1])))
+        }
+        if err := saveRecording(out, part); err != nil {
+            fmt.Println("[ERROR]", msg("Could not save recording:"), err)
+            return exitReplayFailed
+        }
+        fmt.Println("[INFO]", msgf("Wrote %d records to %s", len(part.Records), displayName(out)))
+        lo, start = hi, end
+    }
+    return exitOK
+}
+
+// runMerge implements `mrr merge <a> <b>... -o <out> [--gap 500ms]`.
+func runMerge(args []string) int {
+    var out string
+    var gap time.Duration
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        switch args[i] {
+        case "-o", "--out":
+            if i++; i >= len(args) {
+                fmt.Println("[ERROR]", msg("-o needs a file"))
+                return exitUsage
+            }
+            out = args[i]
+        case "--gap":
+            if i++; i >= len(args) {
+                fmt.Println("[ERROR]", msg("--gap needs a duration"))
+                return exitUsage
+            }
+            d, err := parseClock(args[i])
+            if err != nil {
+                fmt.Println("[ERROR] --gap:", err)
+                return exitUsage
+            }
+            gap = d
+        default:
+            rest = append(rest, args[i])
+        }
+    }
+    files, err := parseArgs(rest)
+    if err != nil || len(files) < 2 || out == "" {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr merge <a> <b>... -o <out> [--gap 500ms]")
+        return exitUsage
+    }
+
+    var merged *Recording
+    for _, f := range files {
+        path, err := resolveRecording(f)
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+            return loadExitCode(err)
+        }
+        r, err := loadFromFile(path)
+        if err != nil {
+            fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+            return loadExitCode(err)
+        }
+        if merged == nil {
+            merged = &Recording{Metadata: r.Metadata}
+            appendRecording(merged, r, 0)
+            continue
+        }
+        if held := heldAt(merged.Records); len(held) > 0 {
+            fmt.Println("[WARN]", msgf("%s is still held down where %s starts", strings.Join(held, ", "), displayName(path)))
+        }
+        appendRecording(merged, r, gap.Milliseconds())
+    }
+    if err := saveRecording(out, merged); err != nil {
+        fmt.Println("[ERROR]", msg("Could not save recording:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Wrote %d records from %d recordings to %s", len(merged.Records), len(files), displayName(out)))
+    return exitOK
+}
@@ -0,0 +1,248 @@
+// +build windows
+
+package main
+
+import (
+    "errors"
+    "fmt"
+    "syscall"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     winsqlite3 bindings
+// ------------------------------------------
+
+// Windows 10 and later ship SQLite as winsqlite3.dll, so the SQLite library
+// needs neither cgo nor a DLL next to mrr.exe. Only what the store uses is
+// bound here.
+var (
+    sqliteDLL               = syscall.NewLazyDLL("winsqlite3.dll")
+    procSqliteOpenV2        = sqliteDLL.NewProc("sqlite3_open_v2")
+    procSqliteCloseV2       = sqliteDLL.NewProc("sqlite3_close_v2")
+    procSqliteErrmsg        = sqliteDLL.NewProc("sqlite3_errmsg")
+    procSqliteExec          = sqliteDLL.NewProc("sqlite3_exec")
+    procSqlitePrepareV2     = sqliteDLL.NewProc("sqlite3_prepare_v2")
+    procSqliteBindInt64     = sqliteDLL.NewProc("sqlite3_bind_int64")
+    procSqliteBindText      = sqliteDLL.NewProc("sqlite3_bind_text")
+    procSqliteBindNull      = sqliteDLL.NewProc("sqlite3_bind_null")
+    procSqliteStep          = sqliteDLL.NewProc("sqlite3_step")
+    procSqliteReset         = sqliteDLL.NewProc("sqlite3_reset")
+    procSqliteFinalize      = sqliteDLL.NewProc("sqlite3_finalize")
+    procSqliteColumnInt64   = sqliteDLL.NewProc("sqlite3_column_int64")
+    procSqliteColumnText    = sqliteDLL.NewProc("sqlite3_column_text")
+    procSqliteColumnBytes   = sqliteDLL.NewProc("sqlite3_column_bytes")
+    procSqliteColumnType    = sqliteDLL.NewProc("sqlite3_column_type")
+    procSqliteLastInsertRow = sqliteDLL.NewProc("sqlite3_last_insert_rowid")
+)
+
+const (
+    SQLITE_OK   = 0
+    SQLITE_ROW  = 100
+    SQLITE_DONE = 101
+    SQLITE_NULL = 5
+
+    SQLITE_OPEN_READWRITE = 0x00000002
+    SQLITE_OPEN_CREATE    = 0x00000004
+)
+
+// sqliteTransient makes SQLite copy bound text before the call returns.
+const sqliteTransient = ^uintptr(0)
+
+// sqliteDB is an open database connection.
+type sqliteDB struct {
+    handle uintptr
+}
+
+// sqliteStmt is a prepared statement.
+type sqliteStmt struct {
+    db     *sqliteDB
+    handle uintptr
+}
+
+// cString returns s as a NUL-terminated UTF-8 string.
+func cString(s string) *byte {
+    b := make([]byte, len(s)+1)
+    copy(b, s)
+    return &b[0]
+}
+
+// goString copies the NUL-terminated UTF-8 string at p.
+func goString(p uintptr) string {
+    if p == 0 {
+        return ""
+    }
+    n := 0
+    for *(*byte)(unsafe.Pointer(p + uintptr(n))) != 0 {
+        n++
+    }
+    return string(unsafe.Slice((*byte)(unsafe.Pointer(p)), n))
+}
+
+// int64Args splits v into the call arguments it takes: one on 64-bit
+// Windows, low and high halves on 32-bit.
+func int64Args(v int64) []uintptr {
+    if unsafe.Sizeof(uintptr(0)) == 4 {
+        return []uintptr{uintptr(uint32(v)), uintptr(uint32(uint64(v) >> 32))}
+    }
+    return []uintptr{uintptr(v)}
+}
+
+func openSQLite(path string) (*sqliteDB, error) {
+    if err := sqliteDLL.Load(); err != nil {
+        return nil, errors.New("winsqlite3.dll is not available (it ships with Windows 10 and later)")
+    }
+    db := &sqliteDB{}
+    rc, _, _ := procSqliteOpenV2.Call(uintptr(unsafe.Pointer(cString(path))), uintptr(unsafe.Pointer(&db.handle)),
+        SQLITE_OPEN_READWRITE|SQLITE_OPEN_CREATE, 0)
+    if rc != SQLITE_OK {
+        err := db.error(rc)
+        db.close()
+        return nil, err
+    }
+    return db, nil
+}
+
+func (db *sqliteDB) close() {
+    if db.handle != 0 {
+        procSqliteCloseV2.Call(db.handle)
+        db.handle = 0
+    }
+}
+
+// error describes result code rc with the connection's last message.
+func (db *sqliteDB) error(rc uintptr) error {
+    if db.handle == 0 {
+        return fmt.Errorf("sqlite error %d", rc)
+    }
+    msg, _, _ := procSqliteErrmsg.Call(db.handle)
+    return fmt.Errorf("sqlite: %s", goString(msg))
+}
+
+// exec runs one or more statements that take no parameters.
+func (db *sqliteDB) exec(sql string) error {
+    rc, _, _ := procSqliteExec.Call(db.handle, uintptr(unsafe.Pointer(cString(sql))), 0, 0, 0)
+    if rc != SQLITE_OK {
+        return db.error(rc)
+    }
+    return nil
+}
+
+// transaction runs fn inside BEGIN/COMMIT, rolling back if it fails.
+func (db *sqliteDB) transaction(fn func() error) error {
+    if err := db.exec("BEGIN IMMEDIATE"); err != nil {
+        return err
+    }
+    if err := fn(); err != nil {
+        db.exec("ROLLBACK")
+        return err
+    }
+    return db.exec("COMMIT")
+}
+
+func (db *sqliteDB) lastInsertRowID() int64 {
+    lo, hi, _ := procSqliteLastInsertRow.Call(db.handle)
+    return joinInt64(lo, hi)
+}
+
+// joinInt64 rebuilds a 64-bit result, which 32-bit Windows returns in
+// two registers.
+func joinInt64(lo, hi uintptr) int64 {
+    if unsafe.Sizeof(uintptr(0)) == 4 {
+        return int64(uint64(uint32(lo)) | uint64(uint32(hi))<<32)
+    }
+    return int64(lo)
+}
+
+func (db *sqliteDB) prepare(sql string) (*sqliteStmt, error) {
+    st := &sqliteStmt{db: db}
+    rc, _, _ := procSqlitePrepareV2.Call(db.handle, uintptr(unsafe.Pointer(cString(sql))), ^uintptr(0),
+        uintptr(unsafe.Pointer(&st.handle)), 0)
+    if rc != SQLITE_OK {
+        return nil, db.error(rc)
+    }
+    return st, nil
+}
+
+// bind sets the statement's parameters, in order, from int, int64, string
+// or nil values.
+func (st *sqliteStmt) bind(args ...interface{}) error {
+    for i, a := range args {
+        idx := uintptr(i + 1)
+        var rc uintptr
+        switch v := a.(type) {
+        case nil:
+            rc, _, _ = procSqliteBindNull.Call(st.handle, idx)
+        case int:
+            rc, _, _ = procSqliteBindInt64.Call(append([]uintptr{st.handle, idx}, int64Args(int64(v))...)...)
+        case int64:
+            rc, _, _ = procSqliteBindInt64.Call(append([]uintptr{st.handle, idx}, int64Args(v)...)...)
+        case string:
+            rc, _, _ = procSqliteBindText.Call(st.handle, idx, uintptr(unsafe.Pointer(cString(v))),
+                uintptr(len(v)), sqliteTransient)
+        default:
+            return fmt.Errorf("sqlite: cannot bind %T", a)
+        }
+        if rc != SQLITE_OK {
+            return st.db.error(rc)
+        }
+    }
+    return nil
+}
+
+// step advances the statement, returning true while there is a row.
+func (st *sqliteStmt) step() (bool, error) {
+    rc, _, _ := procSqliteStep.Call(st.handle)
+    switch rc {
+    case SQLITE_ROW:
+        return true, nil
+    case SQLITE_DONE:
+        return false, nil
+    }
+    return false, st.db.error(rc)
+}
+
+// run binds args and steps the statement to completion, ready to be run
+// again.
+func (st *sqliteStmt) run(args ...interface{}) error {
+    defer procSqliteReset.Call(st.handle)
+    if err := st.bind(args...); err != nil {
+        return err
+    }
+    for {
+        more, err := st.step()
+        if err != nil || !more {
+            return err
+        }
+    }
+}
+
+func (st *sqliteStmt) int64(col int) int64 {
+    lo, hi, _ := procSqliteColumnInt64.Call(st.handle, uintptr(col))
+    return joinInt64(lo, hi)
+}
+
+func (st *sqliteStmt) int(col int) int {
+    return int(st.int64(col))
+}
+
+func (st *sqliteStmt) text(col int) string {
+    p, _, _ := procSqliteColumnText.Call(st.handle, uintptr(col))
+    n, _, _ := procSqliteColumnBytes.Call(st.handle, uintptr(col))
+    if p == 0 || n == 0 {
+        return ""
+    }
+    return string(unsafe.Slice((*byte)(unsafe.Pointer(p)), int(int32(n))))
+}
+
+func (st *sqliteStmt) isNull(col int) bool {
+    t, _, _ := procSqliteColumnType.Call(st.handle, uintptr(col))
+    return t == SQLITE_NULL
+}
+
+func (st *sqliteStmt) close() {
+    if st.handle != 0 {
+        procSqliteFinalize.Call(st.handle)
+        st.handle = 0
+    }
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+)
+
+// ------------------------------------------
+//     Single-step playback
+// ------------------------------------------
+
+// VK_NEXT (Page Down) advances a single-stepped replay by one event.
+const VK_NEXT = 0x22
+
+// stepFromConsole calls Step for every line read from the console, for
+// `mrr play` where there are no hotkeys.
+func stepFromConsole(p *Player) {
+    fmt.Println("[INFO]", msg("Step mode: press Enter to inject each event"))
+    sc := bufio.NewScanner(os.Stdin)
+    for sc.Scan() {
+        p.Step()
+    }
+}
@@ -0,0 +1,411 @@
+// +build windows
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// ------------------------------------------
+//     SQLite recording store
+// ------------------------------------------
+
+// When --library names a .db file instead of a folder, recordings are kept
+// in SQLite: one row per recording with its metadata in indexed columns,
+// and one row per record. 'mrr list' filters with SQL, and saving,
+// importing and removing recordings are transactions.
+//
+// Recordings in a store are addressed as "<db>|<name>"; '|' can't appear
+// in a Windows path, so the reference goes through the same code paths as
+// a file name.
+var storeExts = []string{".db", ".sqlite", ".sqlite3"}
+
+const storeRefSep = "|"
+
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS recordings (
+    id          INTEGER PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    version     INTEGER NOT NULL,
+    checksum    TEXT,
+    created_at  INTEGER NOT NULL,
+    saved_at    INTEGER NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    events      INTEGER NOT NULL,
+    window      TEXT,
+    header      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS recordings_duration ON recordings(duration_ms);
+CREATE INDEX IF NOT EXISTS recordings_window ON recordings(window);
+CREATE TABLE IF NOT EXISTS records (
+    recording INTEGER NOT NULL,
+    seq       INTEGER NOT NULL,
+    delta_ms  INTEGER NOT NULL,
+    x         INTEGER NOT NULL,
+    y         INTEGER NOT NULL,
+    event     TEXT NOT NULL,
+    data      INTEGER NOT NULL,
+    extras    TEXT,
+    PRIMARY KEY (recording, seq)
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS settings (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);`
+
+func isStorePath(path string) bool {
+    ext := strings.ToLower(filepath.Ext(path))
+    for _, e := range storeExts {
+        if ext == e {
+            return true
+        }
+    }
+    return false
+}
+
+// libraryIsStore is true when --library points at a SQLite database.
+func libraryIsStore() bool {
+    return isStorePath(libraryDir())
+}
+
+func storeRef(db, name string) string {
+    return db + storeRefSep + name
+}
+
+// parseStoreRef splits a "<db>|<name>" reference.
+func parseStoreRef(ref string) (db, name string, ok bool) {
+    i := strings.LastIndex(ref, storeRefSep)
+    if i < 0 {
+        return "", "", false
+    }
+    return ref[:i], ref[i+1:], true
+}
+
+// storeQuery narrows 'mrr list'.
+type storeQuery struct {
+    // LongerThan keeps recordings lasting longer than this.
+    LongerThan time.Duration
+    // Window keeps recordings made against a window whose title contains
+    // this, ignoring case.
+    Window string
+}
+
+// matches applies q to a recording outside a store.
+func (q storeQuery) matches(e recordingEntry) bool {
+    if q.LongerThan == 0 && q.Window == "" {
+        return true
+    }
+    if e.Recording == nil {
+        return false
+    }
+    if time.Duration(e.summary().DurationMS)*time.Millisecond <= q.LongerThan {
+        return false
+    }
+    if q.Window != "" {
+        m := e.Recording.Metadata
+        if m == nil || m.Window == nil || !strings.Contains(strings.ToLower(m.Window.Title), strings.ToLower(q.Window)) {
+            return false
+        }
+    }
+    return true
+}
+
+type recordingStore struct {
+    path string
+    db   *sqliteDB
+}
+
+func openStore(path string) (*recordingStore, error) {
+    db, err := openSQLite(path)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    if err := db.exec(storeSchema); err != nil {
+        db.close()
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return &recordingStore{path: path, db: db}, nil
+}
+
+func (s *recordingStore) close() {
+    s.db.close()
+}
+
+// save stores recording as name, replacing any recording of that name.
+// It runs inside the caller's transaction.
+func (s *recordingStore) save(name string, recording *Recording) error {
+    recording.Version = format.Version
+    sum, err := format.Checksum(recording.Records)
+    if err != nil {
+        return err
+    }
+    recording.Checksum = sum
+    summary := format.Summarize(recording.Records)
+    if recording.Summary == nil {
+        recording.Summary = &summary
+    }
+
+    header := *recording
+    header.Records = nil
+    hb, err := json.Marshal(header)
+    if err != nil {
+        return err
+    }
+    created := time.Now()
+    var window interface{}
+    if m := recording.Metadata; m != nil {
+        if !m.CreatedAt.IsZero() {
+            created = m.CreatedAt
+        }
+        if m.Window != nil {
+            window = m.Window.Title
+        }
+    }
+
+    if err := s.remove(name); err != nil && err != errNoSuchRecording {
+        return err
+    }
+    ins, err := s.db.prepare(`INSERT INTO recordings (name, version, checksum, created_at, saved_at, duration_ms, events, window, header)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+    if err != nil {
+        return err
+    }
+    err = ins.run(name, recording.Version, recording.Checksum, created.UnixNano()/int64(time.Millisecond),
+        time.Now().UnixNano()/int64(time.Millisecond), summary.DurationMS, len(recording.Records), window, string(hb))
+    ins.close()
+    if err != nil {
+        return err
+    }
+    id := s.db.lastInsertRowID()
+
+    rows, err := s.db.prepare(`INSERT INTO records (recording, seq, delta_ms, x, y, event, data, extras)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+    if err != nil {
+        return err
+    }
+    defer rows.close()
+    for i, rec := range recording.Records {
+        var extras interface{}
+        b, err := rec.MarshalExtras()
+        if err != nil {
+            return fmt.Errorf("record %d: %v", i, err)
+        }
+        if b != nil {
+            extras = string(b)
+        }
+        if err := rows.run(id, i, rec.DeltaMS, int(rec.X), int(rec.Y), rec.Event, int64(rec.Data), extras); err != nil {
+            return fmt.Errorf("record %d: %v", i, err)
+        }
+    }
+    return nil
+}
+
+var errNoSuchRecording = errors.New("no such recording")
+
+// remove deletes the recording called name.
+func (s *recordingStore) remove(name string) error {
+    sel, err := s.db.prepare(`SELECT id FROM recordings WHERE name = ?`)
+    if err != nil {
+        return err
+    }
+    defer sel.close()
+    if err := sel.bind(name); err != nil {
+        return err
+    }
+    found, err := sel.step()
+    if err != nil {
+        return err
+    }
+    if !found {
+        return errNoSuchRecording
+    }
+    id := sel.int64(0)
+    for _, q := range []string{`DELETE FROM records WHERE recording = ?`, `DELETE FROM recordings WHERE id = ?`} {
+        del, err := s.db.prepare(q)
+        if err != nil {
+            return err
+        }
+        err = del.run(id)
+        del.close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// load reads the recording called name, as it was saved.
+func (s *recordingStore) load(name string) (*Recording, error) {
+    sel, err := s.db.prepare(`SELECT id, header FROM recordings WHERE name = ?`)
+    if err != nil {
+        return nil, err
+    }
+    defer sel.close()
+    if err := sel.bind(name); err != nil {
+        return nil, err
+    }
+    found, err := sel.step()
+    if err != nil {
+        return nil, err
+    }
+    if !found {
+        return nil, fmt.Errorf("no recording %q in %s", name, s.path)
+    }
+    id := sel.int64(0)
+    var recording Recording
+    if err := json.Unmarshal([]byte(sel.text(1)), &recording); err != nil {
+        return nil, fmt.Errorf("recording %q: %v", name, err)
+    }
+
+    rows, err := s.db.prepare(`SELECT delta_ms, x, y, event, data, extras FROM records WHERE recording = ? ORDER BY seq`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.close()
+    if err := rows.bind(id); err != nil {
+        return nil, err
+    }
+    for {
+        more, err := rows.step()
+        if err != nil {
+            return nil, err
+        }
+        if !more {
+            break
+        }
+        rec := MouseRecord{
+            DeltaMS: rows.int64(0),
+            X:       int32(rows.int(1)),
+            Y:       int32(rows.int(2)),
+            Event:   rows.text(3),
+            Data:    int32(rows.int64(4)),
+        }
+        if !rows.isNull(5) {
+            if err := rec.UnmarshalExtras([]byte(rows.text(5))); err != nil {
+                return nil, fmt.Errorf("record %d: %v", len(recording.Records), err)
+            }
+        }
+        recording.Records = append(recording.Records, rec)
+    }
+    return &recording, nil
+}
+
+func (s *recordingStore) exists(name string) bool {
+    sel, err := s.db.prepare(`SELECT 1 FROM recordings WHERE name = ?`)
+    if err != nil {
+        return false
+    }
+    defer sel.close()
+    if sel.bind(name) != nil {
+        return false
+    }
+    found, _ := sel.step()
+    return found
+}
+
+// entries lists the recordings q selects, without their records.
+func (s *recordingStore) entries(q storeQuery) ([]recordingEntry, error) {
+    sql := `SELECT name, saved_at, events, header FROM recordings WHERE duration_ms > ?`
+    args := []interface{}{q.LongerThan.Milliseconds()}
+    if q.Window != "" {
+        sql += ` AND window LIKE ? ESCAPE '\'`
+        esc := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Window)
+        args = append(args, "%"+esc+"%")
+    }
+    sel, err := s.db.prepare(sql + ` ORDER BY name`)
+    if err != nil {
+        return nil, err
+    }
+    defer sel.close()
+    if q.LongerThan == 0 {
+        // duration_ms > -1 keeps empty recordings too.
+        args[0] = -1
+    }
+    if err := sel.bind(args...); err != nil {
+        return nil, err
+    }
+    var entries []recordingEntry
+    for {
+        more, err := sel.step()
+        if err != nil {
+            return nil, err
+        }
+        if !more {
+            break
+        }
+        e := recordingEntry{
+            Name:     sel.text(0),
+            Modified: time.Unix(0, sel.int64(1)*int64(time.Millisecond)),
+            Events:   sel.int(2),
+        }
+        var header Recording
+        if e.Err = json.Unmarshal([]byte(sel.text(3)), &header); e.Err == nil {
+            e.Recording = &header
+        }
+        entries = append(entries, e)
+    }
+    return entries, nil
+}
+
+func (s *recordingStore) setting(key string) string {
+    sel, err := s.db.prepare(`SELECT value FROM settings WHERE key = ?`)
+    if err != nil {
+        return ""
+    }
+    defer sel.close()
+    if sel.bind(key) != nil {
+        return ""
+    }
+    if found, _ := sel.step(); !found {
+        return ""
+    }
+    return sel.text(0)
+}
+
+func (s *recordingStore) setSetting(key, value string) error {
+    st, err := s.db.prepare(`INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)`)
+    if err != nil {
+        return err
+    }
+    defer st.close()
+    return st.run(key, value)
+}
+
+// withStore opens the store at path for the length of fn.
+func withStore(path string, fn func(*recordingStore) error) error {
+    s, err := openStore(path)
+    if err != nil {
+        return err
+    }
+    defer s.close()
+    return fn(s)
+}
+
+// saveToStore saves recording under the reference ref.
+func saveToStore(ref string, recording *Recording) error {
+    db, name, _ := parseStoreRef(ref)
+    if encryptRecordings {
+        return fmt.Errorf("recordings in a SQLite library can't be encrypted")
+    }
+    return withStore(db, func(s *recordingStore) error {
+        return s.db.transaction(func() error { return s.save(name, recording) })
+    })
+}
+
+// loadFromStore loads the recording ref refers to.
+func loadFromStore(ref string) (*Recording, error) {
+    db, name, _ := parseStoreRef(ref)
+    var recording *Recording
+    err := withStore(db, func(s *recordingStore) (err error) {
+        recording, err = s.load(name)
+        return err
+    })
+    return recording, err
+}
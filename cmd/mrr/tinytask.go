@@ -0,0 +1,116 @@
+// +build windows
+
+package main
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+
+    "github.com/onixldlc/MRR/hook"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     TinyTask import
+// ------------------------------------------
+
+// A TinyTask .rec file is the raw array of the EVENTMSG structs its journal
+// hook captured, as written by the 32-bit executable.
+type tinyTaskEvent struct {
+    Message uint32
+    ParamL  uint32
+    ParamH  uint32
+    Time    uint32
+    // Hwnd carries the wheel delta for WM_MOUSEWHEEL.
+    Hwnd uint32
+}
+
+const WM_SYSKEYUP = 0x0105
+
+var tinyTaskButtons = map[uint32]string{
+    WM_MOUSEMOVE:   "MouseMove",
+    WM_LBUTTONDOWN: "LeftButtonDown",
+    WM_LBUTTONUP:   "LeftButtonUp",
+    WM_RBUTTONDOWN: "RightButtonDown",
+    WM_RBUTTONUP:   "RightButtonUp",
+    WM_MBUTTONDOWN: "MiddleButtonDown",
+    WM_MBUTTONUP:   "MiddleButtonUp",
+}
+
+// readTinyTask converts a TinyTask recording. Timings come from the event
+// timestamps; mouse positions are screen coordinates.
+func readTinyTask(r io.Reader) (*Recording, error) {
+    recording := &Recording{}
+    var prev uint32
+    for i := 0; ; i++ {
+        var ev tinyTaskEvent
+        if err := binary.Read(r, binary.LittleEndian, &ev); err != nil {
+            if err == io.EOF {
+                break
+            }
+            if err == io.ErrUnexpectedEOF {
+                return nil, fmt.Errorf("truncated event %d", i)
+            }
+            return nil, err
+        }
+
+        // Deltas are from the previous record kept, so the time of
+        // skipped events carries over to the next one.
+        rec := MouseRecord{X: int32(ev.ParamL), Y: int32(ev.ParamH)}
+        if len(recording.Records) > 0 {
+            rec.DeltaMS = int64(ev.Time - prev)
+        }
+
+        switch ev.Message {
+        case WM_MOUSEWHEEL, WM_MOUSEHWHEEL:
+            rec.Event = "MouseWheel"
+            if ev.Message == WM_MOUSEHWHEEL {
+                rec.Event = "MouseHWheel"
+            }
+            // Data holds the raw high word, like the hook records it.
+            rec.Data = int32(uint16(ev.Hwnd))
+        case WM_XBUTTONDOWN, WM_XBUTTONUP:
+            n := "4"
+            if ev.Hwnd == hook.XBUTTON2 {
+                n = "5"
+            }
+            rec.Event = "Mouse" + n + "Down"
+            if ev.Message == WM_XBUTTONUP {
+                rec.Event = "Mouse" + n + "Up"
+            }
+        case WM_KEYDOWN, WM_SYSKEYDOWN, WM_KEYUP, WM_SYSKEYUP:
+            rec.X, rec.Y = 0, 0
+            rec.Event = EventKeyDown
+            if ev.Message == WM_KEYUP || ev.Message == WM_SYSKEYUP {
+                rec.Event = EventKeyUp
+            }
+            rec.Key = &KeyStroke{
+                VK:       uint16(ev.ParamL & 0xFF),
+                Scan:     uint16(ev.ParamL >> 8 & 0xFF),
+                Extended: ev.ParamH&0x8000 != 0,
+            }
+        default:
+            event, ok := tinyTaskButtons[ev.Message]
+            if !ok {
+                debugPrintf("[DEBUG] skipping TinyTask event %d, message 0x%X\n", i, ev.Message)
+                continue
+            }
+            rec.Event = event
+        }
+        recording.Records = append(recording.Records, rec)
+        prev = ev.Time
+    }
+
+    // Keyboard records don't position anything; give them the last mouse
+    // position so summaries and transforms don't see jumps to 0,0.
+    var x, y int32
+    for i := range recording.Records {
+        if playback.IsKey(recording.Records[i]) {
+            recording.Records[i].X, recording.Records[i].Y = x, y
+        } else {
+            x, y = recording.Records[i].X, recording.Records[i].Y
+        }
+    }
+    return recording, nil
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Replay-time record transforms
+// ------------------------------------------
+
+func parseMirror(s string) (playback.Mirror, error) {
+    switch strings.ToLower(s) {
+    case "h", "horizontal", "x":
+        return playback.Mirror{Horizontal: true}, nil
+    case "v", "vertical", "y":
+        return playback.Mirror{Vertical: true}, nil
+    case "hv", "vh", "both":
+        return playback.Mirror{Horizontal: true, Vertical: true}, nil
+    }
+    return playback.Mirror{}, fmt.Errorf("unknown mirror %q (want h, v or hv)", s)
+}
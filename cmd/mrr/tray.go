@@ -0,0 +1,435 @@
+// +build windows
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "syscall"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     System tray icon
+// ------------------------------------------
+
+// With --tray, 'mrr hook' puts an icon in the notification area whose menu
+// starts and stops recordings, replays, opens the data folder and exits.
+// The icon shows whether MRR is idle, recording, replaying or paused. A
+// console MRR opened for itself (a double-clicked mrr.exe) is hidden, so it
+// can't be closed mid-recording by accident; double-clicking the icon
+// shows it again.
+
+const (
+    NIM_ADD    = 0
+    NIM_MODIFY = 1
+    NIM_DELETE = 2
+
+    NIF_MESSAGE = 0x1
+    NIF_ICON    = 0x2
+    NIF_TIP     = 0x4
+
+    WM_NULL          = 0x0000
+    WM_TIMER         = 0x0113
+    WM_LBUTTONDBLCLK = 0x0203
+    WM_APP           = 0x8000
+
+    MF_STRING    = 0x0000
+    MF_GRAYED    = 0x0001
+    MF_SEPARATOR = 0x0800
+    MF_CHECKED   = 0x0008
+    MF_POPUP     = 0x0010
+
+    TPM_RIGHTBUTTON = 0x0002
+    TPM_NONOTIFY    = 0x0080
+    TPM_RETURNCMD   = 0x0100
+
+    SW_HIDE = 0
+    SW_SHOW = 5
+
+    IDI_APPLICATION = 32512
+    IDI_ERROR       = 32513
+    IDI_WARNING     = 32515
+    IDI_INFORMATION = 32516
+
+    // wmTrayIcon is the message the icon sends its window.
+    wmTrayIcon = WM_APP + 1
+
+    trayIconID = 1
+    trayTimer  = 1
+)
+
+// Tray menu commands.
+const (
+    trayCmdRecord = iota + 1
+    trayCmdReplay
+    trayCmdAbort
+    trayCmdOpenFolder
+    trayCmdConsole
+    trayCmdExit
+
+    // trayCmdProfile+i switches to trayProfiles[i].
+    trayCmdProfile = 100
+)
+
+var (
+    shell32              = syscall.NewLazyDLL("shell32.dll")
+    procShellNotifyIconW = shell32.NewProc("Shell_NotifyIconW")
+    procShellExecuteW    = shell32.NewProc("ShellExecuteW")
+
+    procRegisterClassExW       = user32.MustFindProc("RegisterClassExW")
+    procCreateWindowExW        = user32.MustFindProc("CreateWindowExW")
+    procDestroyWindow          = user32.MustFindProc("DestroyWindow")
+    procDefWindowProcW         = user32.MustFindProc("DefWindowProcW")
+    procDispatchMessageW       = user32.MustFindProc("DispatchMessageW")
+    procPostQuitMessage        = user32.MustFindProc("PostQuitMessage")
+    procPostMessageW           = user32.MustFindProc("PostMessageW")
+    procRegisterWindowMessageW = user32.MustFindProc("RegisterWindowMessageW")
+    procLoadIconW              = user32.MustFindProc("LoadIconW")
+    procCreatePopupMenu        = user32.MustFindProc("CreatePopupMenu")
+    procAppendMenuW            = user32.MustFindProc("AppendMenuW")
+    procTrackPopupMenu         = user32.MustFindProc("TrackPopupMenu")
+    procDestroyMenu            = user32.MustFindProc("DestroyMenu")
+    procSetTimer               = user32.MustFindProc("SetTimer")
+    procShowWindow             = user32.MustFindProc("ShowWindow")
+    procSetForegroundWindow    = user32.MustFindProc("SetForegroundWindow")
+    procGetModuleHandleW       = kernel32.MustFindProc("GetModuleHandleW")
+    procGetConsoleWindow       = kernel32.MustFindProc("GetConsoleWindow")
+    procGetConsoleProcessList  = kernel32.MustFindProc("GetConsoleProcessList")
+)
+
+type NOTIFYICONDATAW struct {
+    CbSize           uint32
+    HWnd             uintptr
+    UID              uint32
+    UFlags           uint32
+    UCallbackMessage uint32
+    HIcon            uintptr
+    SzTip            [128]uint16
+    DwState          uint32
+    DwStateMask      uint32
+    SzInfo           [256]uint16
+    UVersion         uint32
+    SzInfoTitle      [64]uint16
+    DwInfoFlags      uint32
+    GuidItem         [16]byte
+    HBalloonIcon     uintptr
+}
+
+type WNDCLASSEXW struct {
+    CbSize        uint32
+    Style         uint32
+    LpfnWndProc   uintptr
+    CbClsExtra    int32
+    CbWndExtra    int32
+    HInstance     uintptr
+    HIcon         uintptr
+    HCursor       uintptr
+    HbrBackground uintptr
+    LpszMenuName  *uint16
+    LpszClassName *uint16
+    HIconSm       uintptr
+}
+
+// trayMode is set by --tray.
+var trayMode bool
+
+var (
+    trayWindow uintptr
+    // trayShown is the tooltip the icon shows now.
+    trayShown string
+    // taskbarCreated is sent when Explorer restarts, which drops the icon.
+    taskbarCreated uintptr
+    // consoleHidden is set while the tray hides the console.
+    consoleHidden bool
+    // trayProfiles are the profiles the menu last listed.
+    trayProfiles []string
+)
+
+// startTray adds the tray icon. It must run on the thread that pumps
+// messages for the hooks, which then serves the icon too.
+func startTray() error {
+    if err := procShellNotifyIconW.Find(); err != nil {
+        return err
+    }
+    instance, _, _ := procGetModuleHandleW.Call(0)
+    className, _ := syscall.UTF16PtrFromString("MRRTray")
+    wc := WNDCLASSEXW{
+        LpfnWndProc:   syscall.NewCallback(trayWndProc),
+        HInstance:     instance,
+        LpszClassName: className,
+    }
+    wc.CbSize = uint32(unsafe.Sizeof(wc))
+    if r, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r == 0 {
+        return fmt.Errorf("RegisterClassExW failed: %v", err)
+    }
+    // A window that is never shown rather than a message-only one, which
+    // can't be brought to the foreground for the menu.
+    hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+        0, 0, 0, 0, 0, 0, 0, instance, 0)
+    if hwnd == 0 {
+        return fmt.Errorf("CreateWindowExW failed: %v", err)
+    }
+    trayWindow = hwnd
+    msg, _ := syscall.UTF16PtrFromString("TaskbarCreated")
+    taskbarCreated, _, _ = procRegisterWindowMessageW.Call(uintptr(unsafe.Pointer(msg)))
+
+    if err := addTrayIcon(); err != nil {
+        procDestroyWindow.Call(hwnd)
+        trayWindow = 0
+        return err
+    }
+    procSetTimer.Call(hwnd, trayTimer, 250, 0)
+    if trayMode && ownConsole() {
+        showConsole(false)
+    }
+    return nil
+}
+
+// stopTray removes the icon and shows the console again.
+func stopTray() {
+    if trayWindow == 0 {
+        return
+    }
+    nid := trayIconData()
+    procShellNotifyIconW.Call(NIM_DELETE, uintptr(unsafe.Pointer(&nid)))
+    procDestroyWindow.Call(trayWindow)
+    trayWindow = 0
+    if consoleHidden {
+        showConsole(true)
+    }
+}
+
+func trayIconData() NOTIFYICONDATAW {
+    nid := NOTIFYICONDATAW{HWnd: trayWindow, UID: trayIconID}
+    nid.CbSize = uint32(unsafe.Sizeof(nid))
+    return nid
+}
+
+func addTrayIcon() error {
+    trayShown = ""
+    nid := trayIconData()
+    nid.UFlags = NIF_MESSAGE
+    nid.UCallbackMessage = wmTrayIcon
+    if r, _, err := procShellNotifyIconW.Call(NIM_ADD, uintptr(unsafe.Pointer(&nid))); r == 0 {
+        return fmt.Errorf("Shell_NotifyIconW failed: %v", err)
+    }
+    updateTrayIcon()
+    return nil
+}
+
+// trayState returns the stock icon and the tooltip for what MRR is doing.
+func trayState() (icon uintptr, tip string) {
+    switch {
+    case recordingActive():
+        return IDI_ERROR, "MRR - " + msg("recording")
+    case !replayActive():
+        return IDI_APPLICATION, "MRR - " + msg("idle")
+    }
+    tip = "MRR - " + msg("replaying")
+    p := activePlayer()
+    if rp := p.Progress(); rp != nil {
+        tip += fmt.Sprintf(" %.0f%%", rp.Percent)
+    }
+    if p.Paused() {
+        return IDI_WARNING, tip + " " + msg("(paused)")
+    }
+    return IDI_INFORMATION, tip
+}
+
+// updateTrayIcon brings the icon and tooltip up to date.
+func updateTrayIcon() {
+    icon, tip := trayState()
+    if tip == trayShown {
+        return
+    }
+    trayShown = tip
+    nid := trayIconData()
+    nid.UFlags = NIF_ICON | NIF_TIP
+    nid.HIcon, _, _ = procLoadIconW.Call(0, icon)
+    t, _ := syscall.UTF16FromString(tip)
+    copy(nid.SzTip[:len(nid.SzTip)-1], t)
+    procShellNotifyIconW.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid)))
+}
+
+func trayWndProc(hwnd uintptr, msg uint32, wparam, lparam uintptr) uintptr {
+    switch {
+    case msg == wmTrayIcon:
+        switch lparam {
+        case WM_RBUTTONUP:
+            runTrayCommand(showTrayMenu())
+        case WM_LBUTTONDBLCLK:
+            showConsole(consoleHidden)
+        }
+        return 0
+    case msg == WM_TIMER:
+        updateTrayIcon()
+        return 0
+    case msg == uint32(taskbarCreated) && taskbarCreated != 0:
+        if err := addTrayIcon(); err != nil {
+            debugPrintln("[DEBUG] could not add the tray icon back:", err)
+        }
+        return 0
+    }
+    r, _, _ := procDefWindowProcW.Call(hwnd, uintptr(msg), wparam, lparam)
+    return r
+}
+
+// showTrayMenu pops the menu up at the cursor and returns the command
+// picked, or 0.
+func showTrayMenu() int {
+    menu, _, _ := procCreatePopupMenu.Call()
+    if menu == 0 {
+        return 0
+    }
+    defer procDestroyMenu.Call(menu)
+
+    recording, replaying := recordingActive(), replayActive()
+    add := func(id int, text string, enabled bool) {
+        flags := uintptr(MF_STRING)
+        if !enabled {
+            flags |= MF_GRAYED
+        }
+        p, _ := syscall.UTF16PtrFromString(text)
+        procAppendMenuW.Call(menu, flags, uintptr(id), uintptr(unsafe.Pointer(p)))
+    }
+    separator := func() { procAppendMenuW.Call(menu, MF_SEPARATOR, 0, 0) }
+
+    if recording {
+        add(trayCmdRecord, msg("Stop recording")+"\t"+hotkeyName(actionRecord), true)
+    } else {
+        add(trayCmdRecord, msg("Start recording")+"\t"+hotkeyName(actionRecord), !replaying)
+    }
+    add(trayCmdReplay, msg("Replay")+"\t"+hotkeyName(actionReplay), !recording)
+    add(trayCmdAbort, msg("Abort replay")+"\t"+hotkeyName(actionAbort), replaying)
+    separator()
+    add(trayCmdOpenFolder, msg("Open recordings folder"), true)
+    // The agent has no console to show.
+    if console, _, _ := procGetConsoleWindow.Call(); console != 0 {
+        if consoleHidden {
+            add(trayCmdConsole, msg("Show console"), true)
+        } else {
+            add(trayCmdConsole, msg("Hide console"), true)
+        }
+    }
+    // The profiles, read afresh so edits to the config show up.
+    trayProfiles, _ = configProfiles()
+    if len(trayProfiles) > 0 {
+        sub, _, _ := procCreatePopupMenu.Call()
+        for i, name := range trayProfiles {
+            flags := uintptr(MF_STRING)
+            if name == profileName {
+                flags |= MF_CHECKED
+            }
+            if recording || replaying {
+                flags |= MF_GRAYED
+            }
+            p, _ := syscall.UTF16PtrFromString(name)
+            procAppendMenuW.Call(sub, flags, uintptr(trayCmdProfile+i), uintptr(unsafe.Pointer(p)))
+        }
+        p, _ := syscall.UTF16PtrFromString(msg("Profile"))
+        procAppendMenuW.Call(menu, MF_POPUP, sub, uintptr(unsafe.Pointer(p)))
+    }
+    separator()
+    add(trayCmdExit, msg("Exit"), true)
+
+    // The menu only closes when clicking elsewhere if its window is in
+    // the foreground, and needs a message afterwards to close reliably.
+    var pt POINT
+    procGetCursorPos.Call(uintptr(unsafe.Pointer(&pt)))
+    procSetForegroundWindow.Call(trayWindow)
+    cmd, _, _ := procTrackPopupMenu.Call(menu, TPM_RIGHTBUTTON|TPM_NONOTIFY|TPM_RETURNCMD,
+        uintptr(pt.X), uintptr(pt.Y), 0, trayWindow, 0)
+    procPostMessageW.Call(trayWindow, WM_NULL, 0, 0)
+    return int(cmd)
+}
+
+func runTrayCommand(cmd int) {
+    switch cmd {
+    case trayCmdRecord:
+        if recordingActive() {
+            fmt.Println("[INFO]", msg("Tray -> Stop recording"))
+            finishRecording()
+        } else if startRecording() {
+            fmt.Println("[INFO]", msg("Tray -> Start recording"))
+        }
+
+    case trayCmdReplay:
+        if n := queueReplay(replayTarget()); n > 0 {
+            fmt.Println("[INFO]", msgf("Tray -> Replay queued (%d waiting)", n))
+        } else {
+            fmt.Println("[INFO]", msg("Tray -> Replaying recorded movements"))
+        }
+
+    case trayCmdAbort:
+        if abortReplay() {
+            fmt.Println("[INFO]", msg("Tray -> Aborting replay"))
+        }
+
+    case trayCmdOpenFolder:
+        if err := openFolder(dataDir()); err != nil {
+            fmt.Println("[ERROR]", msg("Could not open the recordings folder:"), err)
+        }
+
+    case trayCmdConsole:
+        showConsole(consoleHidden)
+
+    case trayCmdExit:
+        fmt.Println("[INFO]", msg("Tray -> Exit"))
+        // A recording in progress is saved rather than lost.
+        stopSession()
+        procPostQuitMessage.Call(0)
+
+    default:
+        if i := cmd - trayCmdProfile; i >= 0 && i < len(trayProfiles) {
+            if err := switchProfile(trayProfiles[i]); err != nil {
+                fmt.Println("[ERROR]", msg("Could not switch the profile:"), err)
+            } else {
+                fmt.Println("[INFO]", msgf("Tray -> Switched to profile %s", trayProfiles[i]))
+            }
+        }
+    }
+    updateTrayIcon()
+}
+
+// openFolder opens dir in Explorer, creating it first.
+func openFolder(dir string) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    return shellOpen(dir)
+}
+
+// shellOpen opens target, a file, folder or URL, as Explorer would.
+func shellOpen(target string) error {
+    verb, _ := syscall.UTF16PtrFromString("open")
+    path, _ := syscall.UTF16PtrFromString(target)
+    // ShellExecuteW returns a value above 32 on success.
+    r, _, err := procShellExecuteW.Call(0, uintptr(unsafe.Pointer(verb)), uintptr(unsafe.Pointer(path)), 0, 0, SW_SHOW)
+    if r <= 32 {
+        return fmt.Errorf("ShellExecuteW failed: %v", err)
+    }
+    return nil
+}
+
+// ownConsole tells whether MRR is the only process on its console, i.e.
+// the console was opened for it rather than being the user's shell.
+func ownConsole() bool {
+    var pids [2]uint32
+    n, _, _ := procGetConsoleProcessList.Call(uintptr(unsafe.Pointer(&pids[0])), uintptr(len(pids)))
+    return n == 1
+}
+
+func showConsole(show bool) {
+    hwnd, _, _ := procGetConsoleWindow.Call()
+    if hwnd == 0 {
+        return
+    }
+    if show {
+        procShowWindow.Call(hwnd, SW_SHOW)
+        procSetForegroundWindow.Call(hwnd)
+    } else {
+        procShowWindow.Call(hwnd, SW_HIDE)
+    }
+    consoleHidden = !show
+}
@@ -0,0 +1,570 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "syscall"
+    "time"
+    "unicode/utf8"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     Terminal UI
+// ------------------------------------------
+
+// 'mrr tui' is a full-screen front-end to the same recorder and player the
+// hotkeys drive: the library on the left, the selected recording's details
+// and first events on the right, what MRR printed below and a live status
+// line. The hotkeys keep working while it runs. It draws with VT escape
+// sequences, which Windows 10 consoles understand.
+
+const (
+    ENABLE_PROCESSED_INPUT             = 0x0001
+    ENABLE_LINE_INPUT                  = 0x0002
+    ENABLE_VIRTUAL_TERMINAL_PROCESSING = 0x0004
+    ENABLE_VIRTUAL_TERMINAL_INPUT      = 0x0200
+
+    // tuiLogLines is how many lines of output the log pane keeps.
+    tuiLogLines = 200
+)
+
+var procGetConsoleScreenBufferInfo = kernel32.MustFindProc("GetConsoleScreenBufferInfo")
+
+type COORD struct {
+    X, Y int16
+}
+
+type SMALL_RECT struct {
+    Left, Top, Right, Bottom int16
+}
+
+type CONSOLE_SCREEN_BUFFER_INFO struct {
+    Size              COORD
+    CursorPosition    COORD
+    Attributes        uint16
+    Window            SMALL_RECT
+    MaximumWindowSize COORD
+}
+
+// Keys the TUI reads, past plain characters.
+const (
+    keyUp = -(iota + 1)
+    keyDown
+    keyPageUp
+    keyPageDown
+    keyHome
+    keyEnd
+)
+
+// tuiEntry is one line of the list: a library recording, or the last
+// recording made outside the library.
+type tuiEntry struct {
+    recordingEntry
+    Path string
+}
+
+// tui is the state of the running UI. Only its own goroutine touches it.
+type tui struct {
+    out     *os.File
+    entries []tuiEntry
+    sel     int
+    top     int
+    log     []string
+    // message is the answer to the last key, shown on the status line.
+    message string
+    // wasRecording notices a recording ending, to list it.
+    wasRecording bool
+}
+
+// runTUI implements `mrr tui`.
+func runTUI(args []string) int {
+    files, err := parseArgs(args)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr tui [flags]")
+        return exitUsage
+    }
+    release, ok := claimInstance()
+    if !ok {
+        return alreadyRunning()
+    }
+    defer release()
+    stopLogging, err := startLogging()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not open the log file:"), err)
+        return exitUsage
+    }
+    defer stopLogging()
+    player = NewPlayer(playerOpts)
+    if encryptRecordings {
+        if _, err := sealingKey(); err != nil {
+            fmt.Println("[ERROR]", err)
+            return exitUsage
+        }
+    }
+
+    stdin, stdout := syscall.Handle(os.Stdin.Fd()), syscall.Handle(console.Fd())
+    var inMode, outMode uint32
+    r1, _, _ := procGetConsoleMode.Call(uintptr(stdin), uintptr(unsafe.Pointer(&inMode)))
+    r2, _, _ := procGetConsoleMode.Call(uintptr(stdout), uintptr(unsafe.Pointer(&outMode)))
+    if r1 == 0 || r2 == 0 {
+        fmt.Println("[ERROR]", msg("mrr tui needs a console; use 'mrr hook' or 'mrr play' from scripts"))
+        return exitUsage
+    }
+    if r, _, err := procSetConsoleMode.Call(uintptr(stdout), uintptr(outMode|ENABLE_VIRTUAL_TERMINAL_PROCESSING)); r == 0 {
+        fmt.Println("[ERROR]", msg("This console can't show the TUI:"), err)
+        return exitUsage
+    }
+    defer procSetConsoleMode.Call(uintptr(stdout), uintptr(outMode))
+    // Keys arrive one at a time, unechoed, with Ctrl+C as a key.
+    procSetConsoleMode.Call(uintptr(stdin),
+        uintptr(inMode&^(ENABLE_LINE_INPUT|ENABLE_ECHO_INPUT|ENABLE_PROCESSED_INPUT)|ENABLE_VIRTUAL_TERMINAL_INPUT))
+    defer procSetConsoleMode.Call(uintptr(stdin), uintptr(inMode))
+
+    runtime.LockOSThread()
+    defer runtime.UnlockOSThread()
+    defer waitReplayStopped()
+    if err := installHooks(); err != nil {
+        fmt.Println("[ERROR]", msg("Could not install hooks:"), err)
+        noteRunError(err)
+        return exitHooksFailed
+    }
+    defer unInstallHooks()
+    thread, _, _ := procGetCurrentThreadId.Call()
+    // Closing the console quits as q does.
+    defer handleConsoleCtrl(func() { quitThread(thread) })()
+
+    // Everything the recorder and player print goes to the log pane
+    // instead of over the screen.
+    logR, logW, err := os.Pipe()
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return exitReplayFailed
+    }
+    t := &tui{out: console}
+    prev := os.Stdout
+    os.Stdout = logW
+    defer func() {
+        os.Stdout = prev
+        logW.Close()
+    }()
+    lines := make(chan string, 64)
+    go func() {
+        sc := bufio.NewScanner(logR)
+        for sc.Scan() {
+            writeLog(sc.Text())
+            lines <- sc.Text()
+        }
+    }()
+
+    fmt.Fprint(t.out, "\x1b[?1049h\x1b[?25l")
+    defer fmt.Fprint(t.out, "\x1b[?25h\x1b[?1049l")
+    go func() {
+        t.run(lines, readKeys(os.Stdin))
+        procPostThreadMessageW.Call(thread, WM_QUIT, 0, 0)
+    }()
+    runMessageLoop()
+    return exitOK
+}
+
+// readKeys turns console input into keys.
+func readKeys(in *os.File) <-chan int {
+    keys := make(chan int, 16)
+    go func() {
+        r := bufio.NewReader(in)
+        for {
+            c, _, err := r.ReadRune()
+            if err != nil {
+                close(keys)
+                return
+            }
+            if c != 0x1B {
+                keys <- int(c)
+                continue
+            }
+            // Escape sequences arrive in one read; a lone Esc doesn't.
+            if r.Buffered() == 0 {
+                keys <- int(c)
+                continue
+            }
+            seq := ""
+            for r.Buffered() > 0 {
+                b, _ := r.ReadByte()
+                seq += string(b)
+                if len(seq) > 1 && (b >= 'A' && b <= 'Z' || b == '~') {
+                    break
+                }
+            }
+            switch seq {
+            case "[A":
+                keys <- keyUp
+            case "[B":
+                keys <- keyDown
+            case "[5~":
+                keys <- keyPageUp
+            case "[6~":
+                keys <- keyPageDown
+            case "[H", "[1~":
+                keys <- keyHome
+            case "[F", "[4~":
+                keys <- keyEnd
+            }
+        }
+    }()
+    return keys
+}
+
+// run draws the UI and handles keys until q is pressed or the console
+// goes away.
+func (t *tui) run(lines <-chan string, keys <-chan int) {
+    t.refresh()
+    tick := time.NewTicker(250 * time.Millisecond)
+    defer tick.Stop()
+    for {
+        t.draw()
+        select {
+        case line := <-lines:
+            t.log = append(t.log, line)
+            if len(t.log) > tuiLogLines {
+                t.log = t.log[len(t.log)-tuiLogLines:]
+            }
+        case <-tick.C:
+            recording := recordingActive()
+            if t.wasRecording && !recording {
+                t.refresh()
+            }
+            t.wasRecording = recording
+        case k, ok := <-keys:
+            if !ok || !t.key(k) {
+                t.quit()
+                return
+            }
+        }
+    }
+}
+
+// refresh reloads the list, keeping the selection on the same recording.
+func (t *tui) refresh() {
+    selected := ""
+    if t.sel < len(t.entries) {
+        selected = t.entries[t.sel].Path
+    }
+    t.entries = t.entries[:0]
+    if path := recordingSavePath(); filepath.Dir(path) != filepath.Clean(libraryDir()) {
+        if _, err := os.Stat(path); err == nil {
+            e := loadEntry(path)
+            e.Name = "(last) " + e.Name
+            t.entries = append(t.entries, tuiEntry{e, path})
+        }
+    }
+    entries, err := libraryEntries(storeQuery{})
+    if err != nil {
+        t.message = "could not read the library: " + err.Error()
+    }
+    for _, e := range entries {
+        path := filepath.Join(libraryDir(), e.Name)
+        if libraryIsStore() {
+            path = storeRef(libraryDir(), e.Name)
+        }
+        t.entries = append(t.entries, tuiEntry{e, path})
+    }
+    t.sel = 0
+    for i, e := range t.entries {
+        if e.Path == selected {
+            t.sel = i
+        }
+    }
+}
+
+// key handles one key and returns false to quit.
+func (t *tui) key(k int) bool {
+    t.message = ""
+    switch k {
+    case 'q', 0x03:
+        return false
+    case keyUp, 'k':
+        t.sel--
+    case keyDown, 'j':
+        t.sel++
+    case keyPageUp:
+        t.sel -= 10
+    case keyPageDown:
+        t.sel += 10
+    case keyHome:
+        t.sel = 0
+    case keyEnd:
+        t.sel = len(t.entries) - 1
+    case 'l':
+        t.refresh()
+        t.message = "list reloaded"
+
+    case 'r':
+        if recordingActive() {
+            if _, err := finishRecording(); err == nil {
+                t.message = "recording saved"
+            }
+            t.refresh()
+        } else if startRecording() {
+            t.message = "recording; press r or " + hotkeyName(actionRecord) + " to stop"
+        }
+
+    case '\r', 'p':
+        e, ok := t.selected()
+        if !ok {
+            break
+        }
+        if e.Encrypted && !passphraseKnown() {
+            t.message = "encrypted; play it with 'mrr play' to enter the passphrase"
+            break
+        }
+        if n := queueReplay(e.Path); n > 0 {
+            t.message = fmt.Sprintf("replay queued (%d waiting)", n)
+        } else {
+            t.message = "replaying " + e.Name
+        }
+
+    case ' ':
+        p := replayingPlayer()
+        if p == nil {
+            break
+        }
+        if !p.Resume() {
+            p.Pause()
+        }
+
+    case 'a':
+        if abortReplay() {
+            t.message = "replay aborted"
+        }
+
+    case 'u':
+        if e, ok := t.selected(); ok {
+            setReplayTarget(e.Path)
+            t.message = hotkeyName(actionReplay) + " now replays " + e.Name
+        }
+    }
+    if t.sel >= len(t.entries) {
+        t.sel = len(t.entries) - 1
+    }
+    if t.sel < 0 {
+        t.sel = 0
+    }
+    return true
+}
+
+func (t *tui) selected() (tuiEntry, bool) {
+    if t.sel >= len(t.entries) {
+        return tuiEntry{}, false
+    }
+    return t.entries[t.sel], true
+}
+
+// quit saves a recording in progress and stops any replay.
+func (t *tui) quit() {
+    stopSession()
+}
+
+// consoleSize is the visible size of the console window.
+func consoleSize(f *os.File) (w, h int) {
+    var info CONSOLE_SCREEN_BUFFER_INFO
+    r, _, _ := procGetConsoleScreenBufferInfo.Call(f.Fd(), uintptr(unsafe.Pointer(&info)))
+    if r == 0 {
+        return 80, 25
+    }
+    return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1
+}
+
+// fit cuts s to w columns and pads it out to them.
+func fit(s string, w int) string {
+    if w <= 0 {
+        return ""
+    }
+    if n := utf8.RuneCountInString(s); n <= w {
+        return s + strings.Repeat(" ", w-n)
+    }
+    return string([]rune(s)[:w])
+}
+
+// inverse is fit(s, w) in reverse video.
+func inverse(s string, w int) string {
+    return "\x1b[7m" + fit(s, w) + "\x1b[0m"
+}
+
+// draw paints the whole screen.
+func (t *tui) draw() {
+    w, h := consoleSize(t.out)
+    logRows := h / 4
+    if logRows < 3 {
+        logRows = 3
+    }
+    rows := h - logRows - 4
+    if rows < 1 {
+        rows = 1
+    }
+    listW := w * 2 / 5
+    if listW > 48 {
+        listW = 48
+    }
+
+    var b strings.Builder
+    b.WriteString("\x1b[H")
+    line := func(s string) {
+        b.WriteString(s)
+        b.WriteString("\x1b[K\r\n")
+    }
+    line(inverse(" MRR  "+libraryDir(), w))
+
+    if t.sel < t.top {
+        t.top = t.sel
+    }
+    if t.sel >= t.top+rows {
+        t.top = t.sel - rows + 1
+    }
+    detail := t.detail(rows)
+    cur := replayTarget()
+    for i := 0; i < rows; i++ {
+        left := fit("", listW)
+        if n := t.top + i; n < len(t.entries) {
+            e := t.entries[n]
+            mark := "  "
+            if e.Path == cur {
+                mark = " *"
+            }
+            left = fit(mark+" "+e.Name, listW-8) + t.duration(e)
+            if n == t.sel {
+                left = inverse(left, listW)
+            }
+        } else if n == 0 {
+            left = fit("   no recordings yet", listW)
+        }
+        right := ""
+        if i < len(detail) {
+            right = detail[i]
+        }
+        line(left + " | " + fit(right, w-listW-3))
+    }
+
+    line(fit(strings.Repeat("-", w), w))
+    start := len(t.log) - logRows
+    if start < 0 {
+        start = 0
+    }
+    for i := 0; i < logRows; i++ {
+        if start+i < len(t.log) {
+            line(fit(" "+t.log[start+i], w))
+        } else {
+            line("")
+        }
+    }
+    line(inverse(" "+t.status(), w))
+    b.WriteString(fit(" enter play  r record  space pause  a abort  u use for "+hotkeyName(actionReplay)+"  l reload  q quit", w))
+    b.WriteString("\x1b[K")
+    fmt.Fprint(t.out, b.String())
+}
+
+// duration is an entry's length for the list.
+func (t *tui) duration(e tuiEntry) string {
+    switch {
+    case e.Err != nil:
+        return "  error"
+    case e.Encrypted:
+        return " locked"
+    }
+    return fmt.Sprintf("%7s", formatClock(time.Duration(e.summary().DurationMS)*time.Millisecond))
+}
+
+// detail describes the selected recording in up to rows lines.
+func (t *tui) detail(rows int) []string {
+    e, ok := t.selected()
+    if !ok {
+        return nil
+    }
+    // A SQLite library lists headers only; the events are read when
+    // first shown.
+    if e.Err == nil && !e.Encrypted && len(e.Recording.Records) == 0 && e.Events > 0 {
+        if r, err := loadFromFile(e.Path); err == nil {
+            e.Recording = r
+            t.entries[t.sel] = e
+        }
+    }
+    d := []string{e.Name, ""}
+    switch {
+    case e.Err != nil:
+        return append(d, "error: "+e.Err.Error())
+    case e.Encrypted:
+        return append(d, "encrypted")
+    }
+    s := e.summary()
+    d = append(d,
+        fmt.Sprintf("duration  %s", formatClock(time.Duration(s.DurationMS)*time.Millisecond)),
+        fmt.Sprintf("events    %d", e.Events),
+        fmt.Sprintf("created   %s", e.created().Format("2006-01-02 15:04")),
+        fmt.Sprintf("screen    %s", e.screen()))
+    if m := e.Recording.Metadata; m != nil && m.Window != nil {
+        d = append(d, fmt.Sprintf("window    %q", m.Window.Title))
+    }
+    d = append(d, "")
+    var at int64
+    for i, rec := range e.Recording.Records {
+        if len(d) >= rows {
+            break
+        }
+        at += rec.DeltaMS
+        d = append(d, fmt.Sprintf("%5d %8s  %-16s (%d,%d)", i,
+            formatClock(time.Duration(at)*time.Millisecond), rec.Event, rec.X, rec.Y))
+    }
+    return d
+}
+
+// status is the live status line.
+func (t *tui) status() string {
+    s := "idle"
+    switch {
+    case recordingActive():
+        s = fmt.Sprintf("recording, %d events", recordedCount())
+    case replayActive():
+        p := activePlayer()
+        s = "replaying"
+        if p.Paused() {
+            s = "paused"
+        }
+        if rp := p.Progress(); rp != nil {
+            s += "  " + formatProgress(*rp)
+        }
+        s += fmt.Sprintf("  %gx", p.Speed())
+    }
+    if t.message != "" {
+        s += "  -  " + t.message
+    }
+    return s
+}
+
+// recordedCount is how many records the running recording holds.
+func recordedCount() int {
+    mtx.Lock()
+    defer mtx.Unlock()
+    if activeRecorder == nil {
+        return 0
+    }
+    return activeRecorder.Len()
+}
+
+// passphraseKnown tells whether encrypted recordings open without asking.
+func passphraseKnown() bool {
+    if keyFile != "" {
+        return true
+    }
+    secretMtx.Lock()
+    defer secretMtx.Unlock()
+    return secret != nil
+}
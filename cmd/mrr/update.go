@@ -0,0 +1,484 @@
+// +build windows
+
+package main
+
+import (
+    "bytes"
+    "crypto/ed25519"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+    "unsafe"
+)
+
+// ------------------------------------------
+//     mrr update
+// ------------------------------------------
+
+// 'mrr update' looks up the latest release, downloads its mrr.exe, checks
+// it and puts it in place of the running one. The release is described as
+// GitHub's releases API does, so --update-url can point at a file with the
+// same shape on a team's own server:
+//
+//     {"tag_name": "v1.4.0", "assets": [
+//         {"name": "mrr.exe", "browser_download_url": "https://..."},
+//         {"name": "mrr.exe.sha256", "browser_download_url": "https://..."},
+//         {"name": "mrr.exe.sig", "browser_download_url": "https://..."}]}
+//
+// The .sha256 asset is required, but a hash from the same server only
+// catches damaged downloads, so the binary has to be signed as well. A build
+// with updatePublicKey requires the .sig asset, an ed25519 signature of the
+// binary; one without requires a valid Authenticode signature on it from
+// the publisher that signed the running mrr.exe, and can't update at all
+// if that isn't signed.
+
+// version is this build's version, set with
+// -ldflags "-X main.version=1.4.0".
+var version = "dev"
+
+// updatePublicKey is the base64 ed25519 key releases are signed with, set
+// with -ldflags "-X main.updatePublicKey=...". Without it the binary needs
+// an Authenticode signature Windows trusts, by the running one's signer.
+var updatePublicKey = ""
+
+const (
+    defaultUpdateURL = "https://api.github.com/repos/onixldlc/MRR/releases/latest"
+    // updateTimeout bounds each request, the download included.
+    updateTimeout = 5 * time.Minute
+    // maxBinarySize bounds the download.
+    maxBinarySize = 256 << 20
+)
+
+// updateURL is the --update-url release endpoint.
+var updateURL = defaultUpdateURL
+
+// release is the part of a release description MRR reads.
+type release struct {
+    TagName string `json:"tag_name"`
+    Assets  []struct {
+        Name string `json:"name"`
+        URL  string `json:"browser_download_url"`
+    } `json:"assets"`
+}
+
+// asset returns the download URL of the asset called name.
+func (r *release) asset(name string) (string, bool) {
+    for _, a := range r.Assets {
+        if strings.EqualFold(a.Name, name) {
+            return a.URL, true
+        }
+    }
+    return "", false
+}
+
+// binaryAsset returns the name of the release's binary for this machine:
+// mrr-windows-<arch>.exe, else mrr.exe.
+func (r *release) binaryAsset() (string, bool) {
+    for _, name := range []string{"mrr-windows-" + runtime.GOARCH + ".exe", "mrr.exe"} {
+        if _, ok := r.asset(name); ok {
+            return name, true
+        }
+    }
+    return "", false
+}
+
+// runUpdate implements `mrr update [--check] [--force] [--update-url url]`.
+func runUpdate(args []string) int {
+    var check, force bool
+    var rest []string
+    for _, a := range args {
+        switch a {
+        case "--check":
+            check = true
+        case "--force":
+            force = true
+        default:
+            rest = append(rest, a)
+        }
+    }
+    files, err := parseArgs(rest)
+    if err == nil && len(files) > 0 {
+        err = fmt.Errorf("unexpected argument %q", files[0])
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        fmt.Println("usage: mrr update [--check] [--force] [--update-url url]")
+        return exitUsage
+    }
+
+    rel, err := latestRelease()
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not look up the latest release:"), err)
+        return exitLoadFailed
+    }
+    latest := strings.TrimPrefix(rel.TagName, "v")
+    current := strings.TrimPrefix(version, "v")
+    switch {
+    case compareVersions(latest, current) <= 0 && !force:
+        fmt.Println("[INFO]", msgf("MRR %s is up to date", current))
+        return exitOK
+    case check:
+        fmt.Println("[INFO]", msgf("MRR %s is available; this is %s. Run 'mrr update' to install it.", latest, current))
+        return exitOK
+    }
+
+    exe, err := os.Executable()
+    if err == nil {
+        exe, err = filepath.EvalSymlinks(exe)
+    }
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not update MRR:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Downloading MRR %s", latest))
+    binary, err := downloadRelease(rel, exe)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not download the update:"), err)
+        return exitInvalid
+    }
+    if err := replaceExecutable(exe, binary); err != nil {
+        fmt.Println("[ERROR]", msg("Could not update MRR:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Updated %s from %s to %s", exe, current, latest))
+    if instanceRunning() {
+        fmt.Println("[INFO]", msg("The MRR already running keeps the old version until it is restarted ('mrr ctl quit', then start it again)."))
+    }
+    return exitOK
+}
+
+// compareVersions compares versions such as 1.4.0 number by number, and
+// returns -1, 0 or 1. A development build is older than any release.
+func compareVersions(a, b string) int {
+    if a == b {
+        return 0
+    }
+    if b == "dev" {
+        return 1
+    }
+    if a == "dev" {
+        return -1
+    }
+    as, bs := strings.Split(a, "."), strings.Split(b, ".")
+    for i := 0; i < len(as) || i < len(bs); i++ {
+        var x, y int
+        if i < len(as) {
+            x, _ = strconv.Atoi(as[i])
+        }
+        if i < len(bs) {
+            y, _ = strconv.Atoi(bs[i])
+        }
+        switch {
+        case x < y:
+            return -1
+        case x > y:
+            return 1
+        }
+    }
+    return 0
+}
+
+// latestRelease fetches the release description from updateURL.
+func latestRelease() (*release, error) {
+    body, err := httpGet(updateURL, 1<<20)
+    if err != nil {
+        return nil, err
+    }
+    var rel release
+    if err := json.Unmarshal(body, &rel); err != nil {
+        return nil, fmt.Errorf("%s: %v", updateURL, err)
+    }
+    if rel.TagName == "" {
+        return nil, fmt.Errorf("%s names no release (no tag_name)", updateURL)
+    }
+    return &rel, nil
+}
+
+// downloadRelease downloads the release's binary to replace exe and checks
+// it against its hash and its signature.
+func downloadRelease(rel *release, exe string) ([]byte, error) {
+    name, ok := rel.binaryAsset()
+    if !ok {
+        return nil, fmt.Errorf("release %s has no mrr.exe", rel.TagName)
+    }
+    binURL, _ := rel.asset(name)
+    hashURL, ok := rel.asset(name + ".sha256")
+    if !ok {
+        return nil, fmt.Errorf("release %s has no %s.sha256 to check %s against", rel.TagName, name, name)
+    }
+    binary, err := httpGet(binURL, maxBinarySize)
+    if err != nil {
+        return nil, err
+    }
+    hashFile, err := httpGet(hashURL, 4096)
+    if err != nil {
+        return nil, err
+    }
+    // sha256sum's format: the hash, then the file name.
+    fields := strings.Fields(string(hashFile))
+    if len(fields) == 0 {
+        return nil, fmt.Errorf("%s.sha256 is empty", name)
+    }
+    want, err := hex.DecodeString(fields[0])
+    if err != nil || len(want) != sha256.Size {
+        return nil, fmt.Errorf("%s.sha256 holds no SHA-256 hash", name)
+    }
+    if got := sha256.Sum256(binary); !bytes.Equal(got[:], want) {
+        return nil, fmt.Errorf("%s doesn't match its hash; the download is damaged or was tampered with", name)
+    }
+
+    if updatePublicKey == "" {
+        // Any publisher can buy a certificate Windows trusts, so only the
+        // one that signed this mrr.exe is taken.
+        want, err := verifyAuthenticode(exe)
+        if err != nil {
+            return nil, fmt.Errorf("this build has no update key and %s isn't signed (%v), so there is no publisher to trust updates from", exe, err)
+        }
+        got, err := verifyDownload(binary)
+        if err != nil {
+            return nil, fmt.Errorf("%s isn't signed by a publisher Windows trusts: %v", name, err)
+        }
+        if !bytes.Equal(got.RawSubject, want.RawSubject) {
+            return nil, fmt.Errorf("%s is signed by %q, not by %q, who signed this mrr.exe", name, got.Subject.CommonName, want.Subject.CommonName)
+        }
+        return binary, nil
+    }
+    key, err := base64.StdEncoding.DecodeString(updatePublicKey)
+    if err != nil || len(key) != ed25519.PublicKeySize {
+        return nil, fmt.Errorf("this build's update key is invalid")
+    }
+    sigURL, ok := rel.asset(name + ".sig")
+    if !ok {
+        return nil, fmt.Errorf("release %s isn't signed (no %s.sig)", rel.TagName, name)
+    }
+    sig, err := httpGet(sigURL, 4096)
+    if err != nil {
+        return nil, err
+    }
+    // Raw or base64.
+    if len(sig) != ed25519.SignatureSize {
+        if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err != nil {
+            return nil, fmt.Errorf("%s.sig holds no signature", name)
+        }
+    }
+    if !ed25519.Verify(ed25519.PublicKey(key), binary, sig) {
+        return nil, fmt.Errorf("%s's signature doesn't verify; it wasn't signed with this build's key", name)
+    }
+    return binary, nil
+}
+
+var (
+    wintrust                           = syscall.NewLazyDLL("wintrust.dll")
+    procWinVerifyTrust                 = wintrust.NewProc("WinVerifyTrust")
+    procWTHelperProvDataFromStateData  = wintrust.NewProc("WTHelperProvDataFromStateData")
+    procWTHelperGetProvSignerFromChain = wintrust.NewProc("WTHelperGetProvSignerFromChain")
+    procWTHelperGetProvCertFromChain   = wintrust.NewProc("WTHelperGetProvCertFromChain")
+)
+
+const (
+    WTD_UI_NONE            = 2
+    WTD_REVOKE_WHOLECHAIN  = 1
+    WTD_CHOICE_FILE        = 1
+    WTD_STATEACTION_VERIFY = 1
+    WTD_STATEACTION_CLOSE  = 2
+)
+
+// WINTRUST_ACTION_GENERIC_VERIFY_V2 checks a file's Authenticode signature
+// and its certificate chain.
+var WINTRUST_ACTION_GENERIC_VERIFY_V2 = syscall.GUID{
+    Data1: 0x00aac56b,
+    Data2: 0xcd44,
+    Data3: 0x11d0,
+    Data4: [8]byte{0x8c, 0xc2, 0x00, 0xc0, 0x4f, 0xc2, 0x95, 0xee},
+}
+
+type WINTRUST_FILE_INFO struct {
+    CbStruct       uint32
+    PcwszFilePath  *uint16
+    HFile          uintptr
+    PgKnownSubject *syscall.GUID
+}
+
+type WINTRUST_DATA struct {
+    CbStruct            uint32
+    PPolicyCallbackData uintptr
+    PSIPClientData      uintptr
+    DwUIChoice          uint32
+    FdwRevocationChecks uint32
+    DwUnionChoice       uint32
+    PFile               *WINTRUST_FILE_INFO
+    DwStateAction       uint32
+    HWVTStateData       uintptr
+    PwszURLReference    *uint16
+    DwProvFlags         uint32
+    DwUIContext         uint32
+    PSignatureSettings  uintptr
+}
+
+// CRYPT_PROVIDER_CERT and CERT_CONTEXT are cut short after the fields
+// used; Windows owns them.
+type CRYPT_PROVIDER_CERT struct {
+    CbStruct uint32
+    PCert    *CERT_CONTEXT
+}
+
+type CERT_CONTEXT struct {
+    DwCertEncodingType uint32
+    PbCertEncoded      *byte
+    CbCertEncoded      uint32
+}
+
+// verifyDownload checks binary's Authenticode signature, which
+// WinVerifyTrust wants in a file, and returns its signer.
+func verifyDownload(binary []byte) (*x509.Certificate, error) {
+    f, err := os.CreateTemp("", "mrr-update-*.exe")
+    if err != nil {
+        return nil, err
+    }
+    defer os.Remove(f.Name())
+    _, err = f.Write(binary)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return nil, err
+    }
+    return verifyAuthenticode(f.Name())
+}
+
+// verifyAuthenticode checks the Authenticode signature of the file at
+// filename with WinVerifyTrust and returns the certificate it was signed
+// with.
+func verifyAuthenticode(filename string) (*x509.Certificate, error) {
+    if err := procWinVerifyTrust.Find(); err != nil {
+        return nil, err
+    }
+
+    path, _ := syscall.UTF16PtrFromString(filename)
+    file := WINTRUST_FILE_INFO{PcwszFilePath: path}
+    file.CbStruct = uint32(unsafe.Sizeof(file))
+    data := WINTRUST_DATA{
+        DwUIChoice:          WTD_UI_NONE,
+        FdwRevocationChecks: WTD_REVOKE_WHOLECHAIN,
+        DwUnionChoice:       WTD_CHOICE_FILE,
+        PFile:               &file,
+        DwStateAction:       WTD_STATEACTION_VERIFY,
+    }
+    data.CbStruct = uint32(unsafe.Sizeof(data))
+    r, _, _ := procWinVerifyTrust.Call(
+        uintptr(syscall.InvalidHandle),
+        uintptr(unsafe.Pointer(&WINTRUST_ACTION_GENERIC_VERIFY_V2)),
+        uintptr(unsafe.Pointer(&data)),
+    )
+    var signer []byte
+    if r == 0 {
+        signer = signerCertificate(data.HWVTStateData)
+    }
+    // The state the check kept has to be released either way.
+    data.DwStateAction = WTD_STATEACTION_CLOSE
+    procWinVerifyTrust.Call(
+        uintptr(syscall.InvalidHandle),
+        uintptr(unsafe.Pointer(&WINTRUST_ACTION_GENERIC_VERIFY_V2)),
+        uintptr(unsafe.Pointer(&data)),
+    )
+    if r != 0 {
+        return nil, fmt.Errorf("WinVerifyTrust: %v", syscall.Errno(uint32(r)))
+    }
+    if signer == nil {
+        return nil, errors.New("WinVerifyTrust kept no signer certificate")
+    }
+    return x509.ParseCertificate(signer)
+}
+
+// signerCertificate copies the leaf certificate of the first signer out of
+// a verification's state, or returns nil.
+func signerCertificate(state uintptr) []byte {
+    provData, _, _ := procWTHelperProvDataFromStateData.Call(state)
+    if provData == 0 {
+        return nil
+    }
+    sgnr, _, _ := procWTHelperGetProvSignerFromChain.Call(provData, 0, 0, 0)
+    if sgnr == 0 {
+        return nil
+    }
+    cert, _, _ := procWTHelperGetProvCertFromChain.Call(sgnr, 0)
+    if cert == 0 {
+        return nil
+    }
+    ctx := (*CRYPT_PROVIDER_CERT)(unsafe.Pointer(cert)).PCert
+    if ctx == nil || ctx.PbCertEncoded == nil {
+        return nil
+    }
+    return append([]byte(nil), unsafe.Slice(ctx.PbCertEncoded, ctx.CbCertEncoded)...)
+}
+
+// httpGet fetches url, refusing bodies over limit bytes.
+func httpGet(url string, limit int64) ([]byte, error) {
+    client := &http.Client{Timeout: updateTimeout}
+    req, err := http.NewRequest("GET", url, nil)
+    if err != nil {
+        return nil, err
+    }
+    // GitHub's API wants a User-Agent.
+    req.Header.Set("User-Agent", "mrr/"+version)
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("%s: %s", url, resp.Status)
+    }
+    body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+    if err != nil {
+        return nil, err
+    }
+    if int64(len(body)) > limit {
+        return nil, fmt.Errorf("%s: larger than %d bytes", url, limit)
+    }
+    return body, nil
+}
+
+// replaceExecutable puts binary in place of exe. Windows won't overwrite a
+// running program but lets it be renamed, so exe moves aside to exe.old,
+// which the next start removes.
+func replaceExecutable(exe string, binary []byte) error {
+    newPath, oldPath := exe+".new", exe+".old"
+    if err := os.WriteFile(newPath, binary, 0755); err != nil {
+        return err
+    }
+    os.Remove(oldPath)
+    if err := os.Rename(exe, oldPath); err != nil {
+        os.Remove(newPath)
+        return err
+    }
+    if err := os.Rename(newPath, exe); err != nil {
+        // Put the old one back rather than leave no mrr.exe.
+        if rerr := os.Rename(oldPath, exe); rerr != nil {
+            return errors.New(msgf("%v; the previous version is %s", err, oldPath))
+        }
+        return err
+    }
+    return nil
+}
+
+// removeReplacedExecutable removes the exe.old an update left behind. It
+// fails quietly while the old version still runs.
+func removeReplacedExecutable() {
+    if exe, err := os.Executable(); err == nil {
+        os.Remove(exe + ".old")
+    }
+}
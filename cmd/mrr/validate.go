@@ -0,0 +1,180 @@
+// +build windows
+
+package main
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/onixldlc/MRR/format"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     Recording validation
+// ------------------------------------------
+
+// maxCoordinate bounds plausible positions; Windows keeps screen
+// coordinates within 16 bits.
+const maxCoordinate = 32767
+
+// maxProblems is how many problems a validation error lists.
+const maxProblems = 10
+
+// knownEvents are every event name a recording may use, for suggestions.
+var knownEvents = []string{
+    "MouseMove",
+    "LeftButtonDown", "LeftButtonUp",
+    "RightButtonDown", "RightButtonUp",
+    "MiddleButtonDown", "MiddleButtonUp",
+    "Mouse4Down", "Mouse4Up",
+    "Mouse5Down", "Mouse5Up",
+    "MouseWheel", "MouseHWheel",
+    EventKeyDown, EventKeyUp, EventText,
+    EventWaitPixel, EventWaitWindow,
+    EventAssertPixel, EventAssertRegion,
+}
+
+// ValidationError lists what is wrong with a recording, record by record.
+type ValidationError struct {
+    Problems []string
+    // More counts problems past the ones listed.
+    More int
+}
+
+func (e *ValidationError) Error() string {
+    s := "invalid recording:\n  " + strings.Join(e.Problems, "\n  ")
+    if e.More > 0 {
+        s += fmt.Sprintf("\n  ... and %d more", e.More)
+    }
+    return s
+}
+
+// editDistance is the Levenshtein distance between a and b, ignoring case.
+func editDistance(a, b string) int {
+    a, b = strings.ToLower(a), strings.ToLower(b)
+    prev := make([]int, len(b)+1)
+    cur := make([]int, len(b)+1)
+    for j := range prev {
+        prev[j] = j
+    }
+    for i := 1; i <= len(a); i++ {
+        cur[0] = i
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+            cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+        }
+        prev, cur = cur, prev
+    }
+    return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+// suggest returns ` (did you mean "x"?)` for the closest of names to s,
+// or "" when none is close.
+func suggest(s string, names []string) string {
+    best, bestDist := "", 4
+    for _, name := range names {
+        if d := editDistance(s, name); d < bestDist {
+            best, bestDist = name, d
+        }
+    }
+    if best == "" {
+        return ""
+    }
+    return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// recordProblem returns what is wrong with record rec, or "".
+func recordProblem(rec MouseRecord) string {
+    switch {
+    case rec.Event == "":
+        return "missing Event"
+    case !playback.KnownEvent(rec):
+        return fmt.Sprintf("unknown event %q%s", rec.Event, suggest(rec.Event, knownEvents))
+    case rec.DeltaMS < 0:
+        return fmt.Sprintf("negative DeltaMS %d", rec.DeltaMS)
+    case rec.X < -maxCoordinate || rec.X > maxCoordinate || rec.Y < -maxCoordinate || rec.Y > maxCoordinate:
+        return fmt.Sprintf("implausible position (%d,%d)", rec.X, rec.Y)
+    }
+
+    switch rec.Event {
+    case EventKeyDown, EventKeyUp:
+        if rec.Key == nil || rec.Key.VK == 0 && rec.Key.Scan == 0 {
+            return rec.Event + " needs a Key with VK or Scan"
+        }
+    case EventText:
+        if rec.Key == nil || rec.Key.Text == "" {
+            return "Text needs a Key with Text"
+        }
+    case EventWaitPixel:
+        if rec.Wait == nil {
+            return "WaitPixel needs a Wait with Color"
+        }
+        if _, _, _, err := format.ParseColor(rec.Wait.Color); err != nil {
+            return fmt.Sprintf("WaitPixel: %v", err)
+        }
+    case EventAssertPixel:
+        if rec.Check == nil {
+            return "AssertPixel needs a Check with Color"
+        }
+        if _, _, _, err := format.ParseColor(rec.Check.Color); err != nil {
+            return fmt.Sprintf("AssertPixel: %v", err)
+        }
+    case EventWaitWindow:
+        if rec.Wait == nil || rec.Wait.Title == "" {
+            return "WaitWindow needs a Wait with Title"
+        }
+    case EventAssertRegion:
+        if rec.Check == nil || rec.Check.Width <= 0 || rec.Check.Height <= 0 || rec.Check.Hash == "" {
+            return "AssertRegion needs a Check with Width, Height and Hash"
+        }
+    }
+    if playback.IsWaitStep(rec) && rec.Wait.TimeoutMS < 0 {
+        return fmt.Sprintf("negative TimeoutMS %d", rec.Wait.TimeoutMS)
+    }
+    if playback.IsCheckStep(rec) && (rec.Check.Retries < 0 || rec.Check.RetryDelayMS < 0) {
+        return "negative Retries or RetryDelayMS"
+    }
+    return ""
+}
+
+// validateRecords checks every record, reporting problems by index.
+func validateRecords(records []MouseRecord) error {
+    verr := &ValidationError{}
+    for i, rec := range records {
+        problem := recordProblem(rec)
+        if problem == "" {
+            continue
+        }
+        if len(verr.Problems) < maxProblems {
+            verr.Problems = append(verr.Problems, fmt.Sprintf("record %d: %s", i, problem))
+        } else {
+            verr.More++
+        }
+    }
+    if len(verr.Problems) == 0 {
+        return nil
+    }
+    return verr
+}
+
+// suggestField adds a suggestion to err if it is about a field a record
+// doesn't have.
+func suggestField(err error) error {
+    var field *format.UnknownFieldError
+    if errors.As(err, &field) {
+        return fmt.Errorf("%w%s", err, suggest(field.Field, format.RecordFields))
+    }
+    return err
+}
@@ -0,0 +1,345 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "io"
+    "math"
+    "path/filepath"
+    "strings"
+
+    "github.com/onixldlc/MRR/format"
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     mrr visualize: draw the cursor path
+// ------------------------------------------
+
+// A visualization shows the recorded screen with the cursor path in grey,
+// drags in the colour of the held button, a ring where each button was
+// pressed and a cross where the wheel turned. SVG and PNG come out of the
+// same model; only SVG has room for a legend and labels.
+
+// buttonColors colour clicks and drags by button.
+var buttonColors = map[string]color.RGBA{
+    "LeftButtonDown":   {0xE0, 0x30, 0x30, 0xFF},
+    "RightButtonDown":  {0x30, 0x60, 0xE0, 0xFF},
+    "MiddleButtonDown": {0x20, 0xA0, 0x40, 0xFF},
+    "Mouse4Down":       {0xE0, 0x90, 0x10, 0xFF},
+    "Mouse5Down":       {0x90, 0x30, 0xC0, 0xFF},
+}
+
+var (
+    pathColor  = color.RGBA{0x70, 0x70, 0x70, 0xA0}
+    wheelColor = color.RGBA{0x20, 0x20, 0x20, 0xFF}
+)
+
+// maxImageSide bounds the longer side of a PNG, in pixels.
+const maxImageSide = 2048
+
+// vizSegment is a straight piece of the path, drawn in Color.
+type vizSegment struct {
+    X1, Y1, X2, Y2 int32
+    Color          color.RGBA
+    Drag           bool
+}
+
+// vizMarker is a click or wheel turn.
+type vizMarker struct {
+    X, Y  int32
+    Event string
+    Color color.RGBA
+    // N numbers the clicks, from 1.
+    N int
+}
+
+type vizModel struct {
+    Bounds   ScreenBounds
+    Segments []vizSegment
+    Markers  []vizMarker
+    Start    *POINT
+}
+
+// buildViz lays out recording for drawing.
+func buildViz(recording *Recording) vizModel {
+    var m vizModel
+    if recording.Metadata != nil && recording.Metadata.Screen.Width > 0 {
+        m.Bounds = recording.Metadata.Screen
+    } else {
+        s := format.Summarize(recording.Records)
+        b := s.BoundingBox
+        m.Bounds = ScreenBounds{X: b.MinX - 20, Y: b.MinY - 20, Width: b.MaxX - b.MinX + 41, Height: b.MaxY - b.MinY + 41}
+    }
+
+    // downs maps each button's up event to its down, to colour drags.
+    downs := make(map[string]string)
+    for _, b := range playback.Buttons {
+        downs[b.Up] = b.Down
+    }
+    held := make(playback.HeldButtons)
+    var last *POINT
+    clicks := 0
+    for _, rec := range recording.Records {
+        if !playback.Positional(rec) {
+            continue
+        }
+        p := POINT{X: rec.X, Y: rec.Y}
+        if last == nil {
+            start := p
+            m.Start = &start
+        } else if *last != p {
+            seg := vizSegment{X1: last.X, Y1: last.Y, X2: p.X, Y2: p.Y, Color: pathColor}
+            for up := range held {
+                seg.Color, seg.Drag = buttonColors[downs[up]], true
+            }
+            m.Segments = append(m.Segments, seg)
+        }
+        last = &p
+
+        if c, ok := buttonColors[rec.Event]; ok {
+            clicks++
+            m.Markers = append(m.Markers, vizMarker{X: p.X, Y: p.Y, Event: rec.Event, Color: c, N: clicks})
+        } else if rec.Event == "MouseWheel" || rec.Event == "MouseHWheel" {
+            m.Markers = append(m.Markers, vizMarker{X: p.X, Y: p.Y, Event: rec.Event, Color: wheelColor})
+        }
+        held.Track(rec.Event)
+    }
+    return m
+}
+
+func svgColor(c color.RGBA) string {
+    return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func writeSVG(w io.Writer, recording *Recording, opts ExportOptions) error {
+    m := buildViz(recording)
+    b := m.Bounds
+    bw := bufio.NewWriter(w)
+    line := func(format string, a ...interface{}) {
+        fmt.Fprintf(bw, format+"\n", a...)
+    }
+    line(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="%d %d %d %d" width="%d" height="%d">`,
+        b.X, b.Y, b.Width, b.Height, b.Width, b.Height)
+    line(`<rect x="%d" y="%d" width="%d" height="%d" fill="#ffffff" stroke="#cccccc"/>`, b.X, b.Y, b.Width, b.Height)
+    line(`<g stroke-linecap="round" fill="none">`)
+    for _, s := range m.Segments {
+        width, opacity := 2, float64(s.Color.A)/255
+        if s.Drag {
+            width = 4
+        }
+        line(`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="%d" stroke-opacity="%.2f"/>`,
+            s.X1, s.Y1, s.X2, s.Y2, svgColor(s.Color), width, opacity)
+    }
+    line(`</g>`)
+    if m.Start != nil {
+        line(`<circle cx="%d" cy="%d" r="6" fill="#20a040"><title>start</title></circle>`, m.Start.X, m.Start.Y)
+    }
+    for _, mk := range m.Markers {
+        if mk.N == 0 {
+            line(`<path d="M%d %dl12 12m0 -12l-12 12" stroke="%s" stroke-width="2"><title>%s</title></path>`,
+                mk.X-6, mk.Y-6, svgColor(mk.Color), mk.Event)
+            continue
+        }
+        line(`<circle cx="%d" cy="%d" r="9" fill="none" stroke="%s" stroke-width="3"><title>%d: %s</title></circle>`,
+            mk.X, mk.Y, svgColor(mk.Color), mk.N, strings.TrimSuffix(mk.Event, "Down"))
+        line(`<text x="%d" y="%d" font-family="sans-serif" font-size="12" fill="%s">%d</text>`,
+            mk.X+11, mk.Y-11, svgColor(mk.Color), mk.N)
+    }
+
+    // Legend, in the top-left corner.
+    y := b.Y + 20
+    for _, btn := range playback.Buttons {
+        line(`<circle cx="%d" cy="%d" r="6" fill="none" stroke="%s" stroke-width="3"/>`, b.X+20, y, svgColor(buttonColors[btn.Down]))
+        line(`<text x="%d" y="%d" font-family="sans-serif" font-size="13">%s</text>`, b.X+34, y+4, strings.TrimSuffix(btn.Down, "Down"))
+        y += 20
+    }
+    line(`<text x="%d" y="%d" font-family="sans-serif" font-size="13">%d records, %d clicks</text>`,
+        b.X+14, y+4, len(recording.Records), countClicks(m.Markers))
+    line(`</svg>`)
+    return bw.Flush()
+}
+
+func countClicks(markers []vizMarker) int {
+    n := 0
+    for _, mk := range markers {
+        if mk.N > 0 {
+            n++
+        }
+    }
+    return n
+}
+
+// canvas is an RGBA image drawn on in recording coordinates.
+type canvas struct {
+    img    *image.RGBA
+    bounds ScreenBounds
+    scale  float64
+}
+
+// blend paints c over the pixel at (x, y) in image coordinates.
+func (cv *canvas) blend(x, y int, c color.RGBA) {
+    if !(image.Point{x, y}.In(cv.img.Rect)) {
+        return
+    }
+    a := uint32(c.A)
+    old := cv.img.RGBAAt(x, y)
+    mix := func(n, o uint8) uint8 { return uint8((uint32(n)*a + uint32(o)*(255-a)) / 255) }
+    cv.img.SetRGBA(x, y, color.RGBA{mix(c.R, old.R), mix(c.G, old.G), mix(c.B, old.B), 0xFF})
+}
+
+func (cv *canvas) point(x, y int32) (float64, float64) {
+    return float64(x-cv.bounds.X) * cv.scale, float64(y-cv.bounds.Y) * cv.scale
+}
+
+// dot paints a filled disc of radius r.
+func (cv *canvas) dot(cx, cy, r float64, c color.RGBA) {
+    for y := int(cy - r); y <= int(cy+r); y++ {
+        for x := int(cx - r); x <= int(cx+r); x++ {
+            if math.Hypot(float64(x)-cx, float64(y)-cy) <= r {
+                cv.blend(x, y, c)
+            }
+        }
+    }
+}
+
+// ring paints a circle outline of radius r and the given width.
+func (cv *canvas) ring(cx, cy, r, width float64, c color.RGBA) {
+    for y := int(cy - r - width); y <= int(cy+r+width); y++ {
+        for x := int(cx - r - width); x <= int(cx+r+width); x++ {
+            if math.Abs(math.Hypot(float64(x)-cx, float64(y)-cy)-r) <= width/2 {
+                cv.blend(x, y, c)
+            }
+        }
+    }
+}
+
+// line paints a line of the given width. Pixels are painted once, so
+// translucent lines don't darken where the brush overlaps itself.
+func (cv *canvas) line(x1, y1, x2, y2, width float64, c color.RGBA) {
+    r := width / 2
+    minX, maxX := int(math.Min(x1, x2)-r), int(math.Max(x1, x2)+r)
+    minY, maxY := int(math.Min(y1, y2)-r), int(math.Max(y1, y2)+r)
+    for y := minY; y <= maxY; y++ {
+        for x := minX; x <= maxX; x++ {
+            if pointSegmentDistance(float64(x), float64(y), x1, y1, x2, y2) <= r {
+                cv.blend(x, y, c)
+            }
+        }
+    }
+}
+
+// pointSegmentDistance is the distance from (px, py) to the segment from
+// (ax, ay) to (bx, by).
+func pointSegmentDistance(px, py, ax, ay, bx, by float64) float64 {
+    dx, dy := bx-ax, by-ay
+    lenSq := dx*dx + dy*dy
+    if lenSq == 0 {
+        return math.Hypot(px-ax, py-ay)
+    }
+
+    t := ((px-ax)*dx + (py-ay)*dy) / lenSq
+    if t < 0 {
+        t = 0
+    } else if t > 1 {
+        t = 1
+    }
+    return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+func writePNG(w io.Writer, recording *Recording, opts ExportOptions) error {
+    m := buildViz(recording)
+    b := m.Bounds
+    if b.Width <= 0 || b.Height <= 0 {
+        return fmt.Errorf("nothing to draw")
+    }
+    scale := math.Min(1, float64(maxImageSide)/float64(maxInt32(b.Width, b.Height)))
+    cv := &canvas{
+        img:    image.NewRGBA(image.Rect(0, 0, int(float64(b.Width)*scale), int(float64(b.Height)*scale))),
+        bounds: b,
+        scale:  scale,
+    }
+    for i := range cv.img.Pix {
+        cv.img.Pix[i] = 0xFF
+    }
+
+    for _, s := range m.Segments {
+        x1, y1 := cv.point(s.X1, s.Y1)
+        x2, y2 := cv.point(s.X2, s.Y2)
+        width := 2.0
+        if s.Drag {
+            width = 4
+        }
+        cv.line(x1, y1, x2, y2, width, s.Color)
+    }
+    if m.Start != nil {
+        x, y := cv.point(m.Start.X, m.Start.Y)
+        cv.dot(x, y, 6, color.RGBA{0x20, 0xA0, 0x40, 0xFF})
+    }
+    for _, mk := range m.Markers {
+        x, y := cv.point(mk.X, mk.Y)
+        if mk.N == 0 {
+            cv.line(x-6, y-6, x+6, y+6, 2, mk.Color)
+            cv.line(x-6, y+6, x+6, y-6, 2, mk.Color)
+            continue
+        }
+        cv.ring(x, y, 9, 3, mk.Color)
+    }
+    return png.Encode(w, cv.img)
+}
+
+func maxInt32(a, b int32) int32 {
+    if a > b {
+        return a
+    }
+    return b
+}
+
+// runVisualize implements `mrr visualize <in> -o <out.svg|out.png>`.
+func runVisualize(args []string) int {
+    var out string
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        if args[i] == "-o" || args[i] == "--out" {
+            if i++; i < len(args) {
+                out = args[i]
+            }
+            continue
+        }
+        rest = append(rest, args[i])
+    }
+    files, err := parseArgs(rest)
+    if err != nil || len(files) != 1 || out == "" {
+        if err != nil {
+            fmt.Println("[ERROR]", err)
+        }
+        fmt.Println("usage: mrr visualize <in> -o <out.svg|out.png>")
+        return exitUsage
+    }
+    c := codecForFile(out)
+    if c == nil || (c.Name() != "svg" && c.Name() != "png") {
+        fmt.Println("[ERROR]", msgf("Can't draw to %s, name it .svg or .png", filepath.Base(out)))
+        return exitUsage
+    }
+    in, err := resolveRecording(files[0])
+    if err != nil {
+        fmt.Println("[ERROR]", err)
+        return loadExitCode(err)
+    }
+    recording, err := loadFromFile(in)
+    if err != nil {
+        fmt.Println("[ERROR]", msg("Could not load recording:"), err)
+        return loadExitCode(err)
+    }
+    if err := saveAs(out, recording, c, ExportOptions{}); err != nil {
+        fmt.Println("[ERROR]", msg("Could not draw recording:"), err)
+        return exitReplayFailed
+    }
+    fmt.Println("[INFO]", msgf("Drew %s to %s", displayName(in), out))
+    return exitOK
+}
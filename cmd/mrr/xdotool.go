@@ -0,0 +1,309 @@
+// +build windows
+
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "strings"
+
+    playback "github.com/onixldlc/MRR/player"
+)
+
+// ------------------------------------------
+//     xdotool / ydotool export
+// ------------------------------------------
+
+// Both exports are bash scripts that replay a recording on a Linux box:
+// xdotool drives X11, ydotool (1.0 or later, with ydotoold running) drives
+// Wayland through uinput. Wait-for-pixel steps and checks have no
+// equivalent and are left as comments.
+
+// linuxButtons are X11 button numbers for xdotool; ydotool's codes are
+// derived from them in ydotoolButton.
+var linuxButtons = map[string]int{
+    "LeftButtonDown":   1,
+    "LeftButtonUp":     1,
+    "MiddleButtonDown": 2,
+    "MiddleButtonUp":   2,
+    "RightButtonDown":  3,
+    "RightButtonUp":    3,
+    "Mouse4Down":       8,
+    "Mouse4Up":         8,
+    "Mouse5Down":       9,
+    "Mouse5Up":         9,
+}
+
+// xKeysyms names virtual keys for xdotool. Letters, digits and F keys are
+// handled in xKeysym.
+var xKeysyms = map[uint16]string{
+    0x08:        "BackSpace",
+    0x09:        "Tab",
+    0x0D:        "Return",
+    0x10:        "Shift_L",
+    0xA0:        "Shift_L",
+    0xA1:        "Shift_R",
+    0x11:        "Control_L",
+    0xA2:        "Control_L",
+    0xA3:        "Control_R",
+    0x12:        "Alt_L",
+    0xA4:        "Alt_L",
+    0xA5:        "Alt_R",
+    VK_PAUSE:    "Pause",
+    0x14:        "Caps_Lock",
+    VK_ESCAPE:   "Escape",
+    0x20:        "space",
+    0x21:        "Prior",
+    VK_NEXT:     "Next",
+    VK_END:      "End",
+    VK_HOME:     "Home",
+    0x25:        "Left",
+    0x26:        "Up",
+    0x27:        "Right",
+    0x28:        "Down",
+    0x2C:        "Print",
+    VK_INSERT:   "Insert",
+    VK_DELETE:   "Delete",
+    0x5B:        "Super_L",
+    0x5C:        "Super_R",
+    0x5D:        "Menu",
+    VK_MULTIPLY: "KP_Multiply",
+    VK_ADD:      "KP_Add",
+    VK_SUBTRACT: "KP_Subtract",
+    0x6E:        "KP_Decimal",
+    0x6F:        "KP_Divide",
+    0x90:        "Num_Lock",
+    0x91:        "Scroll_Lock",
+    0xBA:        "semicolon",
+    0xBB:        "equal",
+    0xBC:        "comma",
+    0xBD:        "minus",
+    0xBE:        "period",
+    0xBF:        "slash",
+    0xC0:        "grave",
+    0xDB:        "bracketleft",
+    0xDC:        "backslash",
+    0xDD:        "bracketright",
+    0xDE:        "apostrophe",
+}
+
+func xKeysym(vk uint16) string {
+    switch {
+    case vk >= '0' && vk <= '9':
+        return string(rune(vk))
+    case vk >= 'A' && vk <= 'Z':
+        return strings.ToLower(string(rune(vk)))
+    case vk >= 0x60 && vk <= 0x69:
+        return fmt.Sprintf("KP_%d", vk-0x60)
+    case vk >= 0x70 && vk <= 0x87:
+        return fmt.Sprintf("F%d", vk-0x70+1)
+    }
+    return xKeysyms[vk]
+}
+
+// evdevExtended maps E0-prefixed scan codes to Linux input key codes.
+// Plain scan codes up to 0x58 are the same number on Linux.
+var evdevExtended = map[uint16]int{
+    0x1C: 96,  // keypad Enter
+    0x1D: 97,  // right Ctrl
+    0x35: 98,  // keypad /
+    0x38: 100, // right Alt
+    0x47: 102, // Home
+    0x48: 103, // Up
+    0x49: 104, // Page Up
+    0x4B: 105, // Left
+    0x4D: 106, // Right
+    0x4F: 107, // End
+    0x50: 108, // Down
+    0x51: 109, // Page Down
+    0x52: 110, // Insert
+    0x53: 111, // Delete
+    0x5B: 125, // left Windows
+    0x5C: 126, // right Windows
+    0x5D: 127, // menu
+}
+
+// evdevCode returns the Linux input key code for k, or 0.
+func evdevCode(k *KeyStroke) int {
+    scan, extended := playback.ScanCode(k)
+    if extended {
+        return evdevExtended[scan]
+    }
+    if scan > 0 && scan <= 0x58 {
+        return int(scan)
+    }
+    return 0
+}
+
+// shQuote quotes s for bash.
+func shQuote(s string) string {
+    return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// linuxScript holds what the xdotool and ydotool exports share.
+type linuxScript struct {
+    bw     *bufio.Writer
+    ox, oy int32
+}
+
+func (s *linuxScript) line(format string, a ...interface{}) {
+    fmt.Fprintf(s.bw, format+"\n", a...)
+}
+
+// sleep writes a pause of ms milliseconds.
+func (s *linuxScript) sleep(ms int64) {
+    if ms > 0 {
+        s.line("sleep %d.%03d", ms/1000, ms%1000)
+    }
+}
+
+// waitWindow writes a wait for a window whose title contains title.
+func (s *linuxScript) waitWindow(tool string, w *WaitStep) {
+    s.line("timeout %g %s search --sync --name %s >/dev/null || exit 1", w.Timeout().Seconds(), tool, shQuote(w.Title))
+}
+
+// writeLinux writes the script header and hands each record, with its
+// position, to event.
+func writeLinux(w io.Writer, recording *Recording, opts ExportOptions, tool string,
+    event func(s *linuxScript, i int, rec MouseRecord, x, y int32) error) error {
+    if opts.Coords == CoordsClient {
+        return fmt.Errorf("%s exports use screen coordinates only", tool)
+    }
+    s := &linuxScript{bw: bufio.NewWriter(w)}
+    s.line("#!/usr/bin/env bash")
+    s.line("# Exported by MRR, %d records. Needs %s.", len(recording.Records), tool)
+    s.line("set -e")
+    s.line("command -v %s >/dev/null || { echo '%s is not installed' >&2; exit 1; }", tool, tool)
+    if m := recording.Metadata; m != nil {
+        s.line("# Recorded on a %dx%d screen; positions are screen pixels.", m.Screen.Width, m.Screen.Height)
+        s.ox, s.oy = m.Screen.X, m.Screen.Y
+    }
+    s.line("")
+
+    clock := newExportClock(opts.Speed)
+    for i, rec := range recording.Records {
+        if i > 0 {
+            s.sleep(clock.sleep(rec.DeltaMS))
+        }
+        // Linux screens start at 0,0; Windows' virtual screen may not.
+        if err := event(s, i, rec, rec.X-s.ox, rec.Y-s.oy); err != nil {
+            return err
+        }
+    }
+    return s.bw.Flush()
+}
+
+func writeXdotool(w io.Writer, recording *Recording, opts ExportOptions) error {
+    return writeLinux(w, recording, opts, "xdotool", func(s *linuxScript, i int, rec MouseRecord, x, y int32) error {
+        if button, ok := linuxButtons[rec.Event]; ok {
+            action := "mouseup"
+            if isButtonDown(rec.Event) {
+                action = "mousedown"
+            }
+            s.line("xdotool mousemove %d %d %s %d", x, y, action, button)
+            return nil
+        }
+        switch rec.Event {
+        case "MouseMove":
+            s.line("xdotool mousemove %d %d", x, y)
+        case "MouseWheel", "MouseHWheel":
+            delta := wheelDelta(rec.Data)
+            button := 5
+            switch {
+            case rec.Event == "MouseHWheel" && delta > 0:
+                button = 7
+            case rec.Event == "MouseHWheel":
+                button = 6
+            case delta > 0:
+                button = 4
+            }
+            s.line("xdotool mousemove %d %d click --repeat %d %d", x, y, wheelClicks(delta), button)
+        case EventKeyDown, EventKeyUp:
+            action := "keyup"
+            if rec.Event == EventKeyDown {
+                action = "keydown"
+            }
+            if rec.Key == nil || xKeysym(rec.Key.VK) == "" {
+                s.line("# record %d: %s of a key xdotool has no name for", i, rec.Event)
+                return nil
+            }
+            s.line("xdotool %s %s", action, xKeysym(rec.Key.VK))
+        case EventText:
+            if rec.Key != nil {
+                s.line("xdotool type --delay 0 -- %s", shQuote(rec.Key.Text))
+            }
+        case EventWaitWindow:
+            if rec.Wait != nil {
+                s.waitWindow("xdotool", rec.Wait)
+            }
+        default:
+            s.line("# record %d: %s is not exported", i, rec.Event)
+        }
+        return nil
+    })
+}
+
+// ydotoolButton is ydotool's click code for a button event: the button
+// (0 left, 1 right, 2 middle, 3 side, 4 extra) with 0x40 for down or 0x80
+// for up.
+func ydotoolButton(event string) int {
+    code := map[int]int{1: 0, 3: 1, 2: 2, 8: 3, 9: 4}[linuxButtons[event]]
+    if isButtonDown(event) {
+        return code | 0x40
+    }
+    return code | 0x80
+}
+
+func writeYdotool(w io.Writer, recording *Recording, opts ExportOptions) error {
+    return writeLinux(w, recording, opts, "ydotool", func(s *linuxScript, i int, rec MouseRecord, x, y int32) error {
+        move := func() {
+            s.line("ydotool mousemove --absolute -x %d -y %d", x, y)
+        }
+        if _, ok := linuxButtons[rec.Event]; ok {
+            move()
+            s.line("ydotool click 0x%02X", ydotoolButton(rec.Event))
+            return nil
+        }
+        switch rec.Event {
+        case "MouseMove":
+            move()
+        case "MouseWheel", "MouseHWheel":
+            // ydotool scrolls by wheel clicks, up and right being positive
+            // as on Windows.
+            clicks := wheelClicks(wheelDelta(rec.Data))
+            if wheelDelta(rec.Data) < 0 {
+                clicks = -clicks
+            }
+            move()
+            if rec.Event == "MouseHWheel" {
+                s.line("ydotool mousemove --wheel -x %d -y 0", clicks)
+            } else {
+                s.line("ydotool mousemove --wheel -x 0 -y %d", clicks)
+            }
+        case EventKeyDown, EventKeyUp:
+            code := 0
+            if rec.Key != nil {
+                code = evdevCode(rec.Key)
+            }
+            if code == 0 {
+                s.line("# record %d: %s of a key with no Linux key code", i, rec.Event)
+                return nil
+            }
+            state := 0
+            if rec.Event == EventKeyDown {
+                state = 1
+            }
+            s.line("ydotool key %d:%d", code, state)
+        case EventText:
+            if rec.Key != nil {
+                s.line("ydotool type -- %s", shQuote(rec.Key.Text))
+            }
+        case EventWaitWindow:
+            s.line("# record %d: WaitWindow has no Wayland equivalent", i)
+        default:
+            s.line("# record %d: %s is not exported", i, rec.Event)
+        }
+        return nil
+    })
+}
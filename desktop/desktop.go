@@ -0,0 +1,262 @@
+// +build windows
+
+// Package desktop looks up what recordings are made and replayed on: the
+// virtual screen, the monitors that make it up and their DPI, top-level
+// windows, screen pixels and the cursor. It is what packages recorder and
+// player, and mrr itself, share of Windows beyond input.
+//
+// Positions are virtual-screen pixels, physical ones once the process is
+// per-monitor DPI aware; EnableDPIAwareness declares it so.
+package desktop
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+    "syscall"
+    "unsafe"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+const (
+    SM_XVIRTUALSCREEN  = 76
+    SM_YVIRTUALSCREEN  = 77
+    SM_CXVIRTUALSCREEN = 78
+    SM_CYVIRTUALSCREEN = 79
+
+    MONITOR_DEFAULTTONEAREST = 0x00000002
+    MDT_EFFECTIVE_DPI        = 0
+    MONITORINFOF_PRIMARY     = 0x00000001
+
+    // DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2 is ((DPI_AWARENESS_CONTEXT)-4).
+    DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2 = ^uintptr(3)
+
+    PROCESS_PER_MONITOR_DPI_AWARE = 2
+
+    // DefaultDPI is the DPI of a monitor at 100% scaling.
+    DefaultDPI = 96
+)
+
+// Point is a position in virtual-screen pixels, laid out like Win32's
+// POINT.
+type Point struct {
+    X int32
+    Y int32
+}
+
+type RECT struct {
+    Left   int32
+    Top    int32
+    Right  int32
+    Bottom int32
+}
+
+type MONITORINFO struct {
+    CbSize    uint32
+    RcMonitor RECT
+    RcWork    RECT
+    DwFlags   uint32
+}
+
+var (
+    user32 = syscall.NewLazyDLL("user32.dll")
+
+    procGetSystemMetrics    = user32.NewProc("GetSystemMetrics")
+    procMonitorFromPoint    = user32.NewProc("MonitorFromPoint")
+    procGetMonitorInfoW     = user32.NewProc("GetMonitorInfoW")
+    procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+    procGetCursorPos        = user32.NewProc("GetCursorPos")
+    procSetCursorPos        = user32.NewProc("SetCursorPos")
+
+    procOpenInputDesktop         = user32.NewProc("OpenInputDesktop")
+    procCloseDesktop             = user32.NewProc("CloseDesktop")
+    procGetUserObjectInformation = user32.NewProc("GetUserObjectInformationW")
+
+    // shcore.dll only exists on Windows 8.1 and later.
+    shcore                     = syscall.NewLazyDLL("shcore.dll")
+    procGetDpiForMonitor       = shcore.NewProc("GetDpiForMonitor")
+    procSetProcessDpiAwareness = shcore.NewProc("SetProcessDpiAwareness")
+
+    // SetProcessDpiAwarenessContext needs Windows 10 1703.
+    procSetProcessDpiAwarenessContext = user32.NewProc("SetProcessDpiAwarenessContext")
+    procSetProcessDPIAware            = user32.NewProc("SetProcessDPIAware")
+)
+
+// VirtualScreen is the bounding box of all monitors.
+func VirtualScreen() format.ScreenBounds {
+    metric := func(index uintptr) int32 {
+        v, _, _ := procGetSystemMetrics.Call(index)
+        return int32(v)
+    }
+    return format.ScreenBounds{
+        X:      metric(SM_XVIRTUALSCREEN),
+        Y:      metric(SM_YVIRTUALSCREEN),
+        Width:  metric(SM_CXVIRTUALSCREEN),
+        Height: metric(SM_CYVIRTUALSCREEN),
+    }
+}
+
+// EnableDPIAwareness declares the process per-monitor DPI aware, so
+// cursor positions, the screen metrics and injected input are in physical
+// pixels like the low-level mouse hook's. Unaware, Windows scales them on
+// displays above 100% and replays land off target. It falls back to older
+// APIs on older Windows and must run before any window or hook is
+// created.
+func EnableDPIAwareness() {
+    if procSetProcessDpiAwarenessContext.Find() == nil {
+        if r, _, _ := procSetProcessDpiAwarenessContext.Call(DPI_AWARENESS_CONTEXT_PER_MONITOR_AWARE_V2); r != 0 {
+            return
+        }
+    }
+    if procSetProcessDpiAwareness.Find() == nil {
+        // S_OK, or E_ACCESSDENIED when a manifest already set it.
+        if r, _, _ := procSetProcessDpiAwareness.Call(PROCESS_PER_MONITOR_DPI_AWARE); r == 0 {
+            return
+        }
+    }
+    procSetProcessDPIAware.Call()
+}
+
+// callWithPoint calls a Win32 function taking a POINT by value: the
+// arguments are h (left out when zero), pt and then rest. The POINT takes
+// one register on 64-bit and two slots on 32-bit.
+func callWithPoint(proc *syscall.LazyProc, h uintptr, pt Point, rest ...uintptr) uintptr {
+    var args []uintptr
+    if h != 0 {
+        args = append(args, h)
+    }
+    if unsafe.Sizeof(uintptr(0)) == 8 {
+        args = append(args, uintptr(uint64(uint32(pt.X))|uint64(uint32(pt.Y))<<32))
+    } else {
+        args = append(args, uintptr(uint32(pt.X)), uintptr(uint32(pt.Y)))
+    }
+    r, _, _ := proc.Call(append(args, rest...)...)
+    return r
+}
+
+// Monitor is a monitor handle (HMONITOR).
+type Monitor uintptr
+
+// MonitorFromPoint returns the monitor nearest to x,y.
+func MonitorFromPoint(x, y int32) Monitor {
+    return Monitor(callWithPoint(procMonitorFromPoint, 0, Point{x, y}, MONITOR_DEFAULTTONEAREST))
+}
+
+func (m Monitor) info() (MONITORINFO, bool) {
+    var mi MONITORINFO
+    mi.CbSize = uint32(unsafe.Sizeof(mi))
+    r, _, _ := procGetMonitorInfoW.Call(uintptr(m), uintptr(unsafe.Pointer(&mi)))
+    return mi, r != 0
+}
+
+// Rect returns the bounds of m in virtual screen coordinates.
+func (m Monitor) Rect() (format.Rect, bool) {
+    mi, ok := m.info()
+    if !ok {
+        return format.Rect{}, false
+    }
+    rc := mi.RcMonitor
+    return format.Rect{MinX: rc.Left, MinY: rc.Top, MaxX: rc.Right - 1, MaxY: rc.Bottom - 1}, true
+}
+
+// DPI returns the effective DPI of m, or DefaultDPI when it can't be
+// queried.
+func (m Monitor) DPI() uint32 {
+    if procGetDpiForMonitor.Find() != nil {
+        return DefaultDPI
+    }
+    var dpiX, dpiY uint32
+    r, _, _ := procGetDpiForMonitor.Call(
+        uintptr(m),
+        MDT_EFFECTIVE_DPI,
+        uintptr(unsafe.Pointer(&dpiX)),
+        uintptr(unsafe.Pointer(&dpiY)),
+    )
+    if r != 0 || dpiX == 0 {
+        return DefaultDPI
+    }
+    return dpiX
+}
+
+// Segment returns the DPI segment of a recording that is on m from record
+// index onwards.
+func (m Monitor) Segment(index int) format.DPISegment {
+    rect, _ := m.Rect()
+    return format.DPISegment{Index: index, DPI: m.DPI(), Monitor: rect}
+}
+
+// MonitorInfo describes an attached monitor.
+type MonitorInfo struct {
+    Rect    format.Rect
+    DPI     uint32
+    Primary bool
+}
+
+var (
+    enumMonitorsMtx      sync.Mutex
+    enumMonitorsFound    []Monitor
+    enumMonitorsCallback = syscall.NewCallback(func(mon, hdc, rect, data uintptr) uintptr {
+        enumMonitorsFound = append(enumMonitorsFound, Monitor(mon))
+        return 1
+    })
+)
+
+// Monitors lists the attached monitors.
+func Monitors() []MonitorInfo {
+    enumMonitorsMtx.Lock()
+    enumMonitorsFound = nil
+    procEnumDisplayMonitors.Call(0, 0, enumMonitorsCallback, 0)
+    found := enumMonitorsFound
+    enumMonitorsMtx.Unlock()
+
+    var list []MonitorInfo
+    for _, mon := range found {
+        mi, ok := mon.info()
+        if !ok {
+            continue
+        }
+        rect, _ := mon.Rect()
+        list = append(list, MonitorInfo{rect, mon.DPI(), mi.DwFlags&MONITORINFOF_PRIMARY != 0})
+    }
+    return list
+}
+
+// CursorPos returns where the cursor is.
+func CursorPos() (Point, error) {
+    var pt Point
+    r, _, err := procGetCursorPos.Call(uintptr(unsafe.Pointer(&pt)))
+    if r == 0 {
+        return pt, fmt.Errorf("GetCursorPos failed: %v", err)
+    }
+    return pt, nil
+}
+
+// SetCursorPos moves the cursor to x,y without injecting input.
+func SetCursorPos(x, y int32) {
+    procSetCursorPos.Call(uintptr(x), uintptr(y))
+}
+
+const (
+    DESKTOP_READOBJECTS = 0x0001
+    UOI_NAME            = 2
+)
+
+// CheckInputDesktop returns an error unless the user's desktop is the one
+// taking input, which is what SendInput injects into. It isn't while the
+// workstation is locked, a UAC prompt is up or the session is
+// disconnected, and SendInput then fails or goes nowhere.
+func CheckInputDesktop() error {
+    h, _, err := procOpenInputDesktop.Call(0, 0, DESKTOP_READOBJECTS)
+    if h == 0 {
+        return fmt.Errorf("no desktop takes input now, the workstation is locked or the session disconnected (%v)", err)
+    }
+    defer procCloseDesktop.Call(h)
+    var buf [64]uint16
+    var needed uint32
+    procGetUserObjectInformation.Call(h, UOI_NAME, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)*2), uintptr(unsafe.Pointer(&needed)))
+    if name := syscall.UTF16ToString(buf[:]); !strings.EqualFold(name, "Default") {
+        return fmt.Errorf("the %s desktop has the input, the workstation is locked or a UAC prompt is up", name)
+    }
+    return nil
+}
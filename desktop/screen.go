@@ -0,0 +1,107 @@
+// +build windows
+
+package desktop
+
+import (
+    "fmt"
+    "syscall"
+    "unsafe"
+)
+
+const (
+    SRCCOPY        = 0x00CC0020
+    BI_RGB         = 0
+    DIB_RGB_COLORS = 0
+
+    // CLR_INVALID is what GetPixel returns for points outside the screen.
+    CLR_INVALID = 0xFFFFFFFF
+)
+
+type BITMAPINFOHEADER struct {
+    BiSize          uint32
+    BiWidth         int32
+    BiHeight        int32
+    BiPlanes        uint16
+    BiBitCount      uint16
+    BiCompression   uint32
+    BiSizeImage     uint32
+    BiXPelsPerMeter int32
+    BiYPelsPerMeter int32
+    BiClrUsed       uint32
+    BiClrImportant  uint32
+}
+
+var (
+    procGetDC     = user32.NewProc("GetDC")
+    procReleaseDC = user32.NewProc("ReleaseDC")
+
+    gdi32                      = syscall.NewLazyDLL("gdi32.dll")
+    procGetPixel               = gdi32.NewProc("GetPixel")
+    procCreateCompatibleDC     = gdi32.NewProc("CreateCompatibleDC")
+    procCreateCompatibleBitmap = gdi32.NewProc("CreateCompatibleBitmap")
+    procSelectObject           = gdi32.NewProc("SelectObject")
+    procBitBlt                 = gdi32.NewProc("BitBlt")
+    procGetDIBits              = gdi32.NewProc("GetDIBits")
+    procDeleteObject           = gdi32.NewProc("DeleteObject")
+    procDeleteDC               = gdi32.NewProc("DeleteDC")
+)
+
+// PixelAt reads the screen color at x, y.
+func PixelAt(x, y int32) (r, g, b uint8, err error) {
+    hdc, _, callErr := procGetDC.Call(0)
+    if hdc == 0 {
+        return 0, 0, 0, fmt.Errorf("GetDC failed: %v", callErr)
+    }
+    defer procReleaseDC.Call(0, hdc)
+
+    c, _, _ := procGetPixel.Call(hdc, uintptr(x), uintptr(y))
+    if uint32(c) == CLR_INVALID {
+        return 0, 0, 0, fmt.Errorf("no pixel at (%d,%d)", x, y)
+    }
+    // COLORREF is 0x00BBGGRR.
+    return uint8(c), uint8(c >> 8), uint8(c >> 16), nil
+}
+
+// CaptureScreen copies w x h screen pixels at x, y as 32-bit top-down
+// BGRA rows; the fourth byte of each pixel is undefined.
+func CaptureScreen(x, y, w, h int32) ([]byte, error) {
+    if w <= 0 || h <= 0 {
+        return nil, fmt.Errorf("empty region %dx%d", w, h)
+    }
+    screen, _, err := procGetDC.Call(0)
+    if screen == 0 {
+        return nil, fmt.Errorf("GetDC failed: %v", err)
+    }
+    defer procReleaseDC.Call(0, screen)
+
+    mem, _, err := procCreateCompatibleDC.Call(screen)
+    if mem == 0 {
+        return nil, fmt.Errorf("CreateCompatibleDC failed: %v", err)
+    }
+    defer procDeleteDC.Call(mem)
+
+    bmp, _, err := procCreateCompatibleBitmap.Call(screen, uintptr(w), uintptr(h))
+    if bmp == 0 {
+        return nil, fmt.Errorf("CreateCompatibleBitmap failed: %v", err)
+    }
+    defer procDeleteObject.Call(bmp)
+
+    old, _, _ := procSelectObject.Call(mem, bmp)
+    r, _, err := procBitBlt.Call(mem, 0, 0, uintptr(w), uintptr(h), screen, uintptr(x), uintptr(y), SRCCOPY)
+    // The bitmap can't be selected into a DC for GetDIBits.
+    procSelectObject.Call(mem, old)
+    if r == 0 {
+        return nil, fmt.Errorf("BitBlt failed: %v", err)
+    }
+
+    // 32-bit top-down rows, so there is no row padding.
+    bi := BITMAPINFOHEADER{BiWidth: w, BiHeight: -h, BiPlanes: 1, BiBitCount: 32, BiCompression: BI_RGB}
+    bi.BiSize = uint32(unsafe.Sizeof(bi))
+    pixels := make([]byte, int(w)*int(h)*4)
+    r, _, err = procGetDIBits.Call(mem, bmp, 0, uintptr(h),
+        uintptr(unsafe.Pointer(&pixels[0])), uintptr(unsafe.Pointer(&bi)), DIB_RGB_COLORS)
+    if r == 0 {
+        return nil, fmt.Errorf("GetDIBits failed: %v", err)
+    }
+    return pixels, nil
+}
@@ -0,0 +1,144 @@
+// +build windows
+
+package desktop
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+    "syscall"
+    "unsafe"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+const (
+    SW_RESTORE = 9
+
+    CWP_SKIPINVISIBLE   = 0x0001
+    CWP_SKIPTRANSPARENT = 0x0004
+)
+
+var (
+    procEnumWindows          = user32.NewProc("EnumWindows")
+    procGetWindowTextW       = user32.NewProc("GetWindowTextW")
+    procGetWindowTextLengthW = user32.NewProc("GetWindowTextLengthW")
+    procIsWindowVisible      = user32.NewProc("IsWindowVisible")
+    procIsIconic             = user32.NewProc("IsIconic")
+    procGetClientRect        = user32.NewProc("GetClientRect")
+    procClientToScreen       = user32.NewProc("ClientToScreen")
+    procGetForegroundWindow  = user32.NewProc("GetForegroundWindow")
+    procSetForegroundWindow  = user32.NewProc("SetForegroundWindow")
+    procShowWindow           = user32.NewProc("ShowWindow")
+    procScreenToClient       = user32.NewProc("ScreenToClient")
+
+    procChildWindowFromPointEx = user32.NewProc("ChildWindowFromPointEx")
+)
+
+// WindowTitle returns the title of hwnd.
+func WindowTitle(hwnd uintptr) string {
+    n, _, _ := procGetWindowTextLengthW.Call(hwnd)
+    if n == 0 {
+        return ""
+    }
+    buf := make([]uint16, n+1)
+    procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+    return syscall.UTF16ToString(buf)
+}
+
+// findWindowCallback is created once; syscall.NewCallback slots are a
+// limited resource.
+var (
+    findWindowCallback = syscall.NewCallback(findWindowProc)
+    windowMtx          sync.Mutex
+    findWindowQuery    string
+    findWindowResult   uintptr
+)
+
+func findWindowProc(hwnd, lparam uintptr) uintptr {
+    visible, _, _ := procIsWindowVisible.Call(hwnd)
+    if visible == 0 {
+        return 1
+    }
+    if strings.Contains(strings.ToLower(WindowTitle(hwnd)), findWindowQuery) {
+        findWindowResult = hwnd
+        return 0
+    }
+    return 1
+}
+
+// FindWindow returns the first visible top-level window whose title
+// contains title, ignoring case.
+func FindWindow(title string) (uintptr, error) {
+    windowMtx.Lock()
+    defer windowMtx.Unlock()
+
+    findWindowQuery = strings.ToLower(title)
+    findWindowResult = 0
+    procEnumWindows.Call(findWindowCallback, 0)
+    if findWindowResult == 0 {
+        return 0, fmt.Errorf("no visible window titled %q", title)
+    }
+    return findWindowResult, nil
+}
+
+// ClientBounds returns the client area of hwnd in screen coordinates.
+func ClientBounds(hwnd uintptr) (format.ScreenBounds, error) {
+    var rc RECT
+    r, _, err := procGetClientRect.Call(hwnd, uintptr(unsafe.Pointer(&rc)))
+    if r == 0 {
+        return format.ScreenBounds{}, fmt.Errorf("GetClientRect failed: %v", err)
+    }
+    var origin Point
+    r, _, err = procClientToScreen.Call(hwnd, uintptr(unsafe.Pointer(&origin)))
+    if r == 0 {
+        return format.ScreenBounds{}, fmt.Errorf("ClientToScreen failed: %v", err)
+    }
+    return format.ScreenBounds{X: origin.X, Y: origin.Y, Width: rc.Right - rc.Left, Height: rc.Bottom - rc.Top}, nil
+}
+
+// DescribeWindow captures hwnd's title and client area, or nil when it
+// can't be queried.
+func DescribeWindow(hwnd uintptr) *format.WindowInfo {
+    if hwnd == 0 {
+        return nil
+    }
+    client, err := ClientBounds(hwnd)
+    if err != nil {
+        return nil
+    }
+    return &format.WindowInfo{Title: WindowTitle(hwnd), Client: client}
+}
+
+// ForegroundWindow returns the window in front.
+func ForegroundWindow() uintptr {
+    hwnd, _, _ := procGetForegroundWindow.Call()
+    return hwnd
+}
+
+// BringToForeground restores hwnd if minimized and activates it.
+func BringToForeground(hwnd uintptr) error {
+    if iconic, _, _ := procIsIconic.Call(hwnd); iconic != 0 {
+        procShowWindow.Call(hwnd, SW_RESTORE)
+    }
+    r, _, err := procSetForegroundWindow.Call(hwnd)
+    if r == 0 {
+        return fmt.Errorf("SetForegroundWindow failed: %v", err)
+    }
+    return nil
+}
+
+// WindowAt returns the deepest visible child of root under the screen
+// point x,y, and x,y in that child's client coordinates.
+func WindowAt(root uintptr, x, y int32) (uintptr, int32, int32) {
+    hwnd := root
+    for {
+        pt := Point{x, y}
+        procScreenToClient.Call(hwnd, uintptr(unsafe.Pointer(&pt)))
+        child := callWithPoint(procChildWindowFromPointEx, hwnd, pt, CWP_SKIPINVISIBLE|CWP_SKIPTRANSPARENT)
+        if child == 0 || child == hwnd {
+            return hwnd, pt.X, pt.Y
+        }
+        hwnd = child
+    }
+}
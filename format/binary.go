@@ -0,0 +1,234 @@
+package format
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+)
+
+// A binary recording is:
+//
+//     "MRRB" version
+//     uvarint length, JSON of the Recording without its records
+//     uvarint count, event names (uvarint length, bytes) indexed below
+//     uvarint count, records
+//
+// and each record is varint DeltaMS, varint X and Y as deltas from the
+// previous record, uvarint event index, varint Data, then a flag byte that,
+// when set, is followed by a uvarint length and the JSON of its Wait, Key,
+// Check and Device. Mouse moves mostly come down to 5-6 bytes instead of ~170
+// of indented JSON. Read recognises the magic, so any format loads.
+var binaryMagic = []byte("MRRB")
+
+const binaryVersion = 1
+
+// IsBinary reports whether br starts with a binary recording, without
+// consuming anything.
+func IsBinary(br *bufio.Reader) bool {
+    magic, _ := br.Peek(len(binaryMagic))
+    return bytes.Equal(magic, binaryMagic)
+}
+
+type binaryWriter struct {
+    w   *bufio.Writer
+    buf [binary.MaxVarintLen64]byte
+}
+
+func (bw *binaryWriter) uvarint(v uint64) {
+    bw.w.Write(bw.buf[:binary.PutUvarint(bw.buf[:], v)])
+}
+
+func (bw *binaryWriter) varint(v int64) {
+    bw.w.Write(bw.buf[:binary.PutVarint(bw.buf[:], v)])
+}
+
+func (bw *binaryWriter) bytes(b []byte) {
+    bw.uvarint(uint64(len(b)))
+    bw.w.Write(b)
+}
+
+// EncodeBinary writes recording in the binary format as it is, without
+// stamping it as Write does.
+func EncodeBinary(w io.Writer, recording *Recording) error {
+    header := *recording
+    header.Records = nil
+    hb, err := json.Marshal(header)
+    if err != nil {
+        return err
+    }
+
+    events := make(map[string]uint64)
+    var names []string
+    for _, rec := range recording.Records {
+        if _, ok := events[rec.Event]; !ok {
+            events[rec.Event] = uint64(len(names))
+            names = append(names, rec.Event)
+        }
+    }
+
+    bw := &binaryWriter{w: bufio.NewWriter(w)}
+    bw.w.Write(binaryMagic)
+    bw.w.WriteByte(binaryVersion)
+    bw.bytes(hb)
+    bw.uvarint(uint64(len(names)))
+    for _, name := range names {
+        bw.bytes([]byte(name))
+    }
+
+    bw.uvarint(uint64(len(recording.Records)))
+    var prevX, prevY int32
+    for _, rec := range recording.Records {
+        bw.varint(rec.DeltaMS)
+        bw.varint(int64(rec.X - prevX))
+        bw.varint(int64(rec.Y - prevY))
+        bw.uvarint(events[rec.Event])
+        bw.varint(int64(rec.Data))
+        prevX, prevY = rec.X, rec.Y
+
+        eb, err := rec.MarshalExtras()
+        if err != nil {
+            return err
+        }
+        if eb == nil {
+            bw.w.WriteByte(0)
+            continue
+        }
+        bw.w.WriteByte(1)
+        bw.bytes(eb)
+    }
+    return bw.w.Flush()
+}
+
+// maxBinaryEvents bounds the event-name table of a binary recording.
+const maxBinaryEvents = 1 << 16
+
+type binaryReader struct {
+    r   *bufio.Reader
+    err error
+}
+
+func (br *binaryReader) uvarint() uint64 {
+    if br.err != nil {
+        return 0
+    }
+    v, err := binary.ReadUvarint(br.r)
+    br.err = err
+    return v
+}
+
+func (br *binaryReader) varint() int64 {
+    if br.err != nil {
+        return 0
+    }
+    v, err := binary.ReadVarint(br.r)
+    br.err = err
+    return v
+}
+
+func (br *binaryReader) byte() byte {
+    if br.err != nil {
+        return 0
+    }
+    b, err := br.r.ReadByte()
+    br.err = err
+    return b
+}
+
+// bytes reads a length-prefixed blob, refusing lengths past the end of a
+// sane file so a corrupt length can't allocate gigabytes.
+func (br *binaryReader) bytes() []byte {
+    n := br.uvarint()
+    if br.err != nil {
+        return nil
+    }
+    if n > 64<<20 {
+        br.err = fmt.Errorf("field of %d bytes", n)
+        return nil
+    }
+    b := make([]byte, n)
+    _, br.err = io.ReadFull(br.r, b)
+    return b
+}
+
+// DecodeBinary reads a binary recording. Its checksum isn't verified and
+// it isn't upgraded; Read does both.
+func DecodeBinary(r io.Reader) (*Recording, error) {
+    br := &binaryReader{r: bufio.NewReader(r)}
+    magic := make([]byte, len(binaryMagic))
+    if _, err := io.ReadFull(br.r, magic); err != nil || !bytes.Equal(magic, binaryMagic) {
+        return nil, fmt.Errorf("not a binary recording")
+    }
+    if v := br.byte(); br.err == nil && v != binaryVersion {
+        return nil, fmt.Errorf("binary recording version %d is not supported (want %d)", v, binaryVersion)
+    }
+
+    var recording Recording
+    if hb := br.bytes(); br.err == nil {
+        if err := json.Unmarshal(hb, &recording); err != nil {
+            return nil, fmt.Errorf("header: %v", err)
+        }
+        if err := CheckVersion(recording.Version); err != nil {
+            return nil, err
+        }
+    }
+
+    // Recordings use a few dozen event names; a corrupt count mustn't
+    // allocate more than that.
+    n := br.uvarint()
+    if br.err != nil {
+        return nil, br.err
+    }
+    if n > maxBinaryEvents {
+        return nil, fmt.Errorf("%d event names, the file is damaged", n)
+    }
+    names := make([]string, n)
+    for i := range names {
+        names[i] = string(br.bytes())
+    }
+
+    count := br.uvarint()
+    if br.err != nil {
+        return nil, br.err
+    }
+    // Don't trust count for the allocation, a truncated file could claim
+    // billions of records.
+    capacity := count
+    if capacity > 1<<20 {
+        capacity = 1 << 20
+    }
+    recording.Records = make([]Record, 0, capacity)
+
+    var prevX, prevY int32
+    for i := uint64(0); i < count; i++ {
+        var rec Record
+        rec.DeltaMS = br.varint()
+        rec.X = prevX + int32(br.varint())
+        rec.Y = prevY + int32(br.varint())
+        event := br.uvarint()
+        rec.Data = int32(br.varint())
+        extras := br.byte()
+        if br.err != nil {
+            return nil, fmt.Errorf("record %d: %v", i, br.err)
+        }
+        if event >= uint64(len(names)) {
+            return nil, fmt.Errorf("record %d: event index %d out of range", i, event)
+        }
+        rec.Event = names[event]
+        prevX, prevY = rec.X, rec.Y
+
+        if extras != 0 {
+            eb := br.bytes()
+            if br.err != nil {
+                return nil, fmt.Errorf("record %d: %v", i, br.err)
+            }
+            if err := rec.UnmarshalExtras(eb); err != nil {
+                return nil, fmt.Errorf("record %d: %v", i, err)
+            }
+        }
+        recording.Records = append(recording.Records, rec)
+    }
+    return &recording, nil
+}
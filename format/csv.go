@@ -0,0 +1,183 @@
+package format
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+)
+
+// A CSV recording starts with a "#mrr" row holding the JSON of everything
+// but the records, then a column header and one row per record. Wait, Key
+// and Check cells hold JSON and are empty on plain mouse records, as is
+// Device unless recorded with --device, so a file edited in a spreadsheet
+// converts back without losing anything. The "#mrr" row is optional when
+// importing.
+const csvHeaderTag = "#mrr"
+
+var csvColumns = []string{"DeltaMS", "X", "Y", "Event", "Data", "Wait", "Key", "Check", "Device"}
+
+// IsCSV peeks at br for the "#mrr" row or the column header.
+func IsCSV(br *bufio.Reader) bool {
+    head, _ := br.Peek(len(csvHeaderTag) + 1)
+    if bytes.Equal(head, []byte(csvHeaderTag+",")) {
+        return true
+    }
+    head, _ = br.Peek(len(csvColumns[0]) + 1)
+    return bytes.Equal(head, []byte(csvColumns[0]+","))
+}
+
+// jsonCell encodes v for a cell, empty when v is nil.
+func jsonCell(v interface{}, isNil bool) (string, error) {
+    if isNil {
+        return "", nil
+    }
+    b, err := json.Marshal(v)
+    return string(b), err
+}
+
+// EncodeCSV writes recording as CSV. CSV recordings carry no checksum.
+func EncodeCSV(w io.Writer, recording *Recording) error {
+    header := *recording
+    header.Records = nil
+    header.Checksum = ""
+    hb, err := json.Marshal(header)
+    if err != nil {
+        return err
+    }
+
+    cw := csv.NewWriter(w)
+    cw.Write([]string{csvHeaderTag, string(hb)})
+    cw.Write(csvColumns)
+    for _, rec := range recording.Records {
+        wait, err := jsonCell(rec.Wait, rec.Wait == nil)
+        if err != nil {
+            return err
+        }
+        key, err := jsonCell(rec.Key, rec.Key == nil)
+        if err != nil {
+            return err
+        }
+        check, err := jsonCell(rec.Check, rec.Check == nil)
+        if err != nil {
+            return err
+        }
+        cw.Write([]string{
+            strconv.FormatInt(rec.DeltaMS, 10),
+            strconv.FormatInt(int64(rec.X), 10),
+            strconv.FormatInt(int64(rec.Y), 10),
+            rec.Event,
+            strconv.FormatInt(int64(rec.Data), 10),
+            wait, key, check, rec.Device,
+        })
+    }
+    cw.Flush()
+    return cw.Error()
+}
+
+// DecodeCSV reads a CSV recording; the "#mrr" row is optional.
+func DecodeCSV(r io.Reader) (*Recording, error) {
+    cr := csv.NewReader(r)
+    cr.FieldsPerRecord = -1
+
+    recording := &Recording{}
+    var columns map[string]int
+    for row := 1; ; row++ {
+        fields, err := cr.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        if len(fields) > 0 && fields[0] == csvHeaderTag {
+            if len(fields) < 2 {
+                return nil, fmt.Errorf("row %d: %s row without data", row, csvHeaderTag)
+            }
+            if err := json.Unmarshal([]byte(fields[1]), recording); err != nil {
+                return nil, fmt.Errorf("row %d: %v", row, err)
+            }
+            if err := CheckVersion(recording.Version); err != nil {
+                return nil, err
+            }
+            recording.Records = nil
+            continue
+        }
+        if columns == nil {
+            columns = make(map[string]int)
+            for i, name := range fields {
+                columns[name] = i
+            }
+            for _, name := range csvColumns[:5] {
+                if _, ok := columns[name]; !ok {
+                    return nil, fmt.Errorf("row %d: missing column %s", row, name)
+                }
+            }
+            continue
+        }
+
+        rec, err := csvRecord(fields, columns)
+        if err != nil {
+            return nil, fmt.Errorf("row %d: %v", row, err)
+        }
+        recording.Records = append(recording.Records, rec)
+    }
+    if columns == nil {
+        return nil, fmt.Errorf("no column header")
+    }
+    return recording, nil
+}
+
+func csvRecord(fields []string, columns map[string]int) (Record, error) {
+    var rec Record
+    cell := func(name string) string {
+        if i, ok := columns[name]; ok && i < len(fields) {
+            return fields[i]
+        }
+        return ""
+    }
+    integer := func(name string, bits int) (int64, error) {
+        s := cell(name)
+        if s == "" {
+            return 0, nil
+        }
+        v, err := strconv.ParseInt(s, 10, bits)
+        if err != nil {
+            return 0, fmt.Errorf("invalid %s %q", name, s)
+        }
+        return v, nil
+    }
+
+    v, err := integer("DeltaMS", 64)
+    if err != nil {
+        return rec, err
+    }
+    rec.DeltaMS = v
+    for _, f := range []struct {
+        name string
+        dst  *int32
+    }{{"X", &rec.X}, {"Y", &rec.Y}, {"Data", &rec.Data}} {
+        v, err := integer(f.name, 32)
+        if err != nil {
+            return rec, err
+        }
+        *f.dst = int32(v)
+    }
+    rec.Event = cell("Event")
+    rec.Device = cell("Device")
+
+    for _, f := range []struct {
+        name string
+        dst  interface{}
+    }{{"Wait", &rec.Wait}, {"Key", &rec.Key}, {"Check", &rec.Check}} {
+        if s := cell(f.name); s != "" {
+            if err := json.Unmarshal([]byte(s), f.dst); err != nil {
+                return rec, fmt.Errorf("invalid %s: %v", f.name, err)
+            }
+        }
+    }
+    return rec, nil
+}
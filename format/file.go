@@ -0,0 +1,141 @@
+package format
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// GzipMagic starts a gzipped file, whatever it is called.
+var GzipMagic = []byte{0x1f, 0x8b}
+
+// The formats a recording can be saved in.
+const (
+    FormatJSON   = "json"
+    FormatBinary = "binary"
+    FormatNDJSON = "ndjson"
+    FormatCSV    = "csv"
+)
+
+// Sniff tells which format br starts with, without consuming anything.
+// Anything that isn't binary, NDJSON or CSV is taken for JSON.
+func Sniff(br *bufio.Reader) string {
+    switch {
+    case IsBinary(br):
+        return FormatBinary
+    case IsNDJSON(br):
+        return FormatNDJSON
+    case IsCSV(br):
+        return FormatCSV
+    }
+    return FormatJSON
+}
+
+// Read decodes a recording in any of the formats, gzipped or not, and
+// checks and upgrades it as Load does. Fields a record doesn't have are
+// refused, so a typo in a hand-edited file doesn't go unnoticed.
+func Read(r io.Reader) (*Recording, error) {
+    br := bufio.NewReader(r)
+    if magic, _ := br.Peek(len(GzipMagic)); bytes.Equal(magic, GzipMagic) {
+        zr, err := gzip.NewReader(br)
+        if err != nil {
+            return nil, err
+        }
+        defer zr.Close()
+        br = bufio.NewReader(zr)
+    }
+
+    decode := DecodeJSON
+    switch Sniff(br) {
+    case FormatBinary:
+        decode = DecodeBinary
+    case FormatNDJSON:
+        decode = DecodeNDJSON
+    case FormatCSV:
+        decode = DecodeCSV
+    }
+    recording, err := decode(br)
+    if err != nil {
+        return nil, err
+    }
+    if err := VerifyChecksum(recording); err != nil {
+        return nil, err
+    }
+    if err := Migrate(recording); err != nil {
+        return nil, err
+    }
+    return recording, nil
+}
+
+// Write encodes recording as indented JSON, stamping it with the current
+// Version and its records' Checksum and summarizing it if it isn't yet.
+func Write(w io.Writer, recording *Recording) error {
+    sum, err := Checksum(recording.Records)
+    if err != nil {
+        return err
+    }
+    recording.Version = Version
+    recording.Checksum = sum
+    if recording.Summary == nil {
+        s := Summarize(recording.Records)
+        recording.Summary = &s
+    }
+    return EncodeJSON(w, recording)
+}
+
+// Load reads the recording saved at filename with Read.
+func Load(filename string) (*Recording, error) {
+    f, err := os.Open(filename)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    recording, err := Read(f)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", filename, err)
+    }
+    return recording, nil
+}
+
+// Save writes recording to filename with Write, gzipped when the name ends
+// in .gz. The file is written next to filename first and renamed over it,
+// so a save that fails halfway leaves the previous file as it was.
+func Save(filename string, recording *Recording) error {
+    f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+    if err != nil {
+        return err
+    }
+    tmp := f.Name()
+    err = func() error {
+        var w io.Writer = f
+        var zw *gzip.Writer
+        if strings.HasSuffix(strings.ToLower(filename), ".gz") {
+            zw = gzip.NewWriter(f)
+            w = zw
+        }
+        if err := Write(w, recording); err != nil {
+            return err
+        }
+        if zw != nil {
+            if err := zw.Close(); err != nil {
+                return err
+            }
+        }
+        return f.Sync()
+    }()
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err == nil {
+        err = os.Rename(tmp, filename)
+    }
+    if err != nil {
+        os.Remove(tmp)
+    }
+    return err
+}
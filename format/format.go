@@ -0,0 +1,246 @@
+// Package format is MRR's recording format: the records a capture is made
+// of, the file they are saved in, and the checks and upgrades applied when
+// one is loaded. It has no Windows dependencies, so recordings can be
+// read, generated and checked anywhere; package recorder makes them and
+// package player replays them.
+//
+// A recording file is JSON, optionally gzipped:
+//
+//     {
+//       "Version": 2,
+//       "Checksum": "sha256:...",
+//       "Metadata": {"CreatedAt": "...", "Screen": {...}},
+//       "Summary": {...},
+//       "Records": [
+//         {"DeltaMS": 0, "X": 812, "Y": 440, "Event": "MouseMove", "Data": 0},
+//         {"DeltaMS": 95, "X": 812, "Y": 440, "Event": "LeftButtonDown", "Data": 0}
+//       ]
+//     }
+//
+// Files from before Version existed are a bare array of records, and are
+// still read. Recordings can also be saved as a compact binary file, as
+// NDJSON (a header line, then a record per line) or as CSV; Read tells
+// them apart by their first bytes.
+package format
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Event names. Every record is one of these.
+const (
+    EventMouseMove        = "MouseMove"
+    EventLeftButtonDown   = "LeftButtonDown"
+    EventLeftButtonUp     = "LeftButtonUp"
+    EventRightButtonDown  = "RightButtonDown"
+    EventRightButtonUp    = "RightButtonUp"
+    EventMiddleButtonDown = "MiddleButtonDown"
+    EventMiddleButtonUp   = "MiddleButtonUp"
+    EventMouse4Down       = "Mouse4Down"
+    EventMouse4Up         = "Mouse4Up"
+    EventMouse5Down       = "Mouse5Down"
+    EventMouse5Up         = "Mouse5Up"
+    // EventMouseWheel and EventMouseHWheel carry the wheel delta in Data,
+    // 120 per notch.
+    EventMouseWheel  = "MouseWheel"
+    EventMouseHWheel = "MouseHWheel"
+
+    // Key records press or release Key; Text records type Key.Text.
+    EventKeyDown = "KeyDown"
+    EventKeyUp   = "KeyUp"
+    EventText    = "Text"
+
+    // Wait steps pause a replay until the screen shows Wait's condition.
+    EventWaitPixel  = "WaitPixel"
+    EventWaitWindow = "WaitWindow"
+
+    // Check steps assert that the screen looks as Check describes.
+    EventAssertPixel  = "AssertPixel"
+    EventAssertRegion = "AssertRegion"
+)
+
+// Recording is what gets written to disk: the captured records plus a
+// description of where and when they were captured.
+type Recording struct {
+    Version     int          `json:"Version"`
+    Checksum    string       `json:"Checksum,omitempty"`
+    Metadata    *Metadata    `json:"Metadata,omitempty"`
+    Summary     *Summary     `json:"Summary,omitempty"`
+    DPISegments []DPISegment `json:"DPISegments,omitempty"`
+    Records     []Record     `json:"Records"`
+}
+
+// Record is one captured event, or a step replays act on.
+type Record struct {
+    // DeltaMS is the time since the previous record. The first record's
+    // is the wait before the first event, which replays skip.
+    DeltaMS int64 `json:"DeltaMS"`
+    // X and Y are the cursor position in virtual-screen pixels.
+    X     int32  `json:"X"`
+    Y     int32  `json:"Y"`
+    Event string `json:"Event"`
+    // Data is the wheel delta for wheel events.
+    Data int32 `json:"Data"`
+
+    // Device is the mouse the event came from, when recording told
+    // mice apart.
+    Device string `json:"Device,omitempty"`
+    // Wait is only set on wait steps.
+    Wait *WaitStep `json:"Wait,omitempty"`
+    // Key is only set on keyboard records.
+    Key *KeyStroke `json:"Key,omitempty"`
+    // Check is only set on check steps.
+    Check *CheckStep `json:"Check,omitempty"`
+
+    // Source is the record's index in the recording it was loaded from,
+    // kept through replay transforms that add or drop records. It isn't
+    // saved.
+    Source int `json:"-"`
+}
+
+// recordExtras holds the optional parts of a record.
+type recordExtras struct {
+    Wait   *WaitStep  `json:"Wait,omitempty"`
+    Key    *KeyStroke `json:"Key,omitempty"`
+    Check  *CheckStep `json:"Check,omitempty"`
+    Device string     `json:"Device,omitempty"`
+}
+
+// MarshalExtras returns the JSON of r's Wait, Key, Check and Device, or nil
+// when it has none, as binary recordings store them apart from the rest.
+func (r Record) MarshalExtras() ([]byte, error) {
+    if r.Wait == nil && r.Key == nil && r.Check == nil && r.Device == "" {
+        return nil, nil
+    }
+    return json.Marshal(recordExtras{r.Wait, r.Key, r.Check, r.Device})
+}
+
+// UnmarshalExtras sets r's Wait, Key, Check and Device from what
+// MarshalExtras returned.
+func (r *Record) UnmarshalExtras(b []byte) error {
+    var x recordExtras
+    if err := json.Unmarshal(b, &x); err != nil {
+        return err
+    }
+    r.Wait, r.Key, r.Check, r.Device = x.Wait, x.Key, x.Check, x.Device
+    return nil
+}
+
+// Metadata describes the machine a recording was made on.
+type Metadata struct {
+    CreatedAt time.Time    `json:"CreatedAt"`
+    Screen    ScreenBounds `json:"Screen"`
+    // Window is the window the recording was made against, used to
+    // re-anchor the recording on a window that moved.
+    Window *WindowInfo `json:"Window,omitempty"`
+}
+
+// ScreenBounds is a screen area in virtual-screen pixels, typically the
+// bounding box of all monitors.
+type ScreenBounds struct {
+    X      int32 `json:"X"`
+    Y      int32 `json:"Y"`
+    Width  int32 `json:"Width"`
+    Height int32 `json:"Height"`
+}
+
+// WindowInfo identifies a window and where its client area was.
+type WindowInfo struct {
+    Title  string       `json:"Title"`
+    Client ScreenBounds `json:"Client"`
+}
+
+// DPISegment records the DPI of the monitor under the cursor from record
+// Index onwards, until the next segment starts.
+type DPISegment struct {
+    Index   int    `json:"Index"`
+    DPI     uint32 `json:"DPI"`
+    Monitor Rect   `json:"Monitor"`
+}
+
+// Rect is an inclusive pixel rectangle.
+type Rect struct {
+    MinX int32 `json:"MinX"`
+    MinY int32 `json:"MinY"`
+    MaxX int32 `json:"MaxX"`
+    MaxY int32 `json:"MaxY"`
+}
+
+// KeyStroke holds the parameters of a key or text record.
+type KeyStroke struct {
+    // VK is the virtual-key code. It is only used to look up Scan when
+    // that is missing, and to report which key is held.
+    VK uint16 `json:"VK,omitempty"`
+    // Scan is the hardware scan code, with Extended for the E0-prefixed
+    // keys (arrows, right Ctrl/Alt, the navigation block, ...).
+    Scan     uint16 `json:"Scan,omitempty"`
+    Extended bool   `json:"Extended,omitempty"`
+    // Text is what a Text record types.
+    Text string `json:"Text,omitempty"`
+}
+
+// WaitStep holds the parameters of a wait record.
+type WaitStep struct {
+    // Color is the "#RRGGBB" a WaitPixel step waits for.
+    Color string `json:"Color,omitempty"`
+    // Tolerance is how far each color channel may be off.
+    Tolerance int `json:"Tolerance,omitempty"`
+    // Title is matched against window titles by a WaitWindow step.
+    Title string `json:"Title,omitempty"`
+    // TimeoutMS fails the replay if the condition hasn't been met in time.
+    // Zero means DefaultWaitTimeout.
+    TimeoutMS int64 `json:"TimeoutMS,omitempty"`
+}
+
+// DefaultWaitTimeout applies to a wait step without TimeoutMS.
+const DefaultWaitTimeout = 30 * time.Second
+
+// Timeout is how long w may wait. A nil w has the default timeout.
+func (w *WaitStep) Timeout() time.Duration {
+    if w != nil && w.TimeoutMS > 0 {
+        return time.Duration(w.TimeoutMS) * time.Millisecond
+    }
+    return DefaultWaitTimeout
+}
+
+// CheckStep holds the parameters of a check record. Positions come from
+// the record's X and Y, the top-left corner for regions.
+type CheckStep struct {
+    // Color and Tolerance work as for WaitPixel.
+    Color     string `json:"Color,omitempty"`
+    Tolerance int    `json:"Tolerance,omitempty"`
+    // Width, Height and Hash describe an AssertRegion: Hash is the FNV-1a
+    // hash of the region's pixels, as printed by a failing check.
+    Width  int32  `json:"Width,omitempty"`
+    Height int32  `json:"Height,omitempty"`
+    Hash   string `json:"Hash,omitempty"`
+    // Retries is how often the preceding records are replayed on a
+    // mismatch before giving up.
+    Retries int `json:"Retries,omitempty"`
+    // RetryDelayMS is waited before each retry; zero means 500ms.
+    RetryDelayMS int64 `json:"RetryDelayMS,omitempty"`
+}
+
+// ParseColor reads a wait or check step's "#RRGGBB" color; the # is
+// optional.
+func ParseColor(s string) (r, g, b uint8, err error) {
+    s = strings.TrimPrefix(s, "#")
+    v, err := strconv.ParseUint(s, 16, 32)
+    if err != nil || len(s) != 6 {
+        return 0, 0, 0, fmt.Errorf("invalid color %q, want #RRGGBB", s)
+    }
+    return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
+// IsClick reports whether event presses a button down.
+func IsClick(event string) bool {
+    switch event {
+    case EventLeftButtonDown, EventRightButtonDown, EventMiddleButtonDown, EventMouse4Down, EventMouse5Down:
+        return true
+    }
+    return false
+}
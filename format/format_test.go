@@ -0,0 +1,353 @@
+package format_test
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+func sample() *format.Recording {
+    return &format.Recording{Records: []format.Record{
+        {DeltaMS: 250, X: 100, Y: 100, Event: format.EventMouseMove},
+        {DeltaMS: 40, X: 100, Y: 130, Event: format.EventMouseMove},
+        {DeltaMS: 60, X: 140, Y: 130, Event: format.EventLeftButtonDown},
+        {DeltaMS: 80, X: 140, Y: 130, Event: format.EventLeftButtonUp},
+        {DeltaMS: 20, X: 140, Y: 130, Event: format.EventKeyDown, Key: &format.KeyStroke{VK: 0x41, Scan: 0x1E}},
+    }}
+}
+
+func TestWriteRead(t *testing.T) {
+    var buf bytes.Buffer
+    if err := format.Write(&buf, sample()); err != nil {
+        t.Fatal(err)
+    }
+    got, err := format.Read(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got.Version != format.Version {
+        t.Errorf("Version = %d, want %d", got.Version, format.Version)
+    }
+    if !strings.HasPrefix(got.Checksum, "sha256:") {
+        t.Errorf("Checksum = %q, want a sha256", got.Checksum)
+    }
+    if got.Summary == nil || got.Summary.EventCounts[format.EventMouseMove] != 2 {
+        t.Errorf("Summary = %+v, want 2 moves counted", got.Summary)
+    }
+    want := sample().Records
+    if len(got.Records) != len(want) {
+        t.Fatalf("read %d records, want %d", len(got.Records), len(want))
+    }
+    for i := range want {
+        g, w := got.Records[i], want[i]
+        if g.DeltaMS != w.DeltaMS || g.X != w.X || g.Y != w.Y || g.Event != w.Event {
+            t.Errorf("record %d = %+v, want %+v", i, g, w)
+        }
+    }
+    if k := got.Records[4].Key; k == nil || k.VK != 0x41 || k.Scan != 0x1E {
+        t.Errorf("key record's Key = %+v", k)
+    }
+}
+
+func TestReadBareArray(t *testing.T) {
+    r, err := format.Read(strings.NewReader(`[{"DeltaMS": 0, "X": 5, "Y": 6, "Event": "MouseMove", "Data": 0}]`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if r.Version != format.Version || r.Summary == nil || len(r.Records) != 1 {
+        t.Errorf("got %+v, want a migrated recording with one record", r)
+    }
+}
+
+func TestReadDamaged(t *testing.T) {
+    var buf bytes.Buffer
+    if err := format.Write(&buf, sample()); err != nil {
+        t.Fatal(err)
+    }
+    damaged := strings.Replace(buf.String(), `"X": 140`, `"X": 141`, 1)
+    _, err := format.Read(strings.NewReader(damaged))
+    if !errors.Is(err, format.ErrChecksumMismatch) {
+        t.Errorf("Read = %v, want ErrChecksumMismatch", err)
+    }
+}
+
+func TestReadNewerVersion(t *testing.T) {
+    newer := fmt.Sprintf(`{"Version": %d, "Records": [], "Future": true}`, format.Version+1)
+    _, err := format.Read(strings.NewReader(newer))
+    if err == nil || !strings.Contains(err.Error(), "newer") {
+        t.Errorf("Read = %v, want the version refused", err)
+    }
+}
+
+func TestReadUnknownField(t *testing.T) {
+    _, err := format.Read(strings.NewReader(`[{"DeltaMS": 0, "X": 5, "Y": 6, "Evnet": "MouseMove"}]`))
+    if err == nil || !strings.Contains(err.Error(), "Evnet") {
+        t.Errorf("Read = %v, want the unknown field named", err)
+    }
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+    codecs := []struct {
+        name   string
+        encode func(io.Writer, *format.Recording) error
+    }{
+        {format.FormatJSON, format.EncodeJSON},
+        {format.FormatBinary, format.EncodeBinary},
+        {format.FormatNDJSON, format.EncodeNDJSON},
+        {format.FormatCSV, format.EncodeCSV},
+    }
+    for _, c := range codecs {
+        t.Run(c.name, func(t *testing.T) {
+            in := sample()
+            in.Version = format.Version
+            in.Records[0].Device = "mouse-2"
+            in.Checksum, _ = format.Checksum(in.Records)
+            var buf bytes.Buffer
+            if err := c.encode(&buf, in); err != nil {
+                t.Fatal(err)
+            }
+            if got := format.Sniff(bufio.NewReader(bytes.NewReader(buf.Bytes()))); got != c.name {
+                t.Errorf("Sniff = %q, want %q", got, c.name)
+            }
+            got, err := format.Read(&buf)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(got.Records) != len(in.Records) {
+                t.Fatalf("read %d records, want %d", len(got.Records), len(in.Records))
+            }
+            for i, w := range in.Records {
+                g := got.Records[i]
+                if g.DeltaMS != w.DeltaMS || g.X != w.X || g.Y != w.Y || g.Event != w.Event || g.Device != w.Device {
+                    t.Errorf("record %d = %+v, want %+v", i, g, w)
+                }
+            }
+            if k := got.Records[4].Key; k == nil || k.VK != 0x41 || k.Scan != 0x1E {
+                t.Errorf("key record's Key = %+v", k)
+            }
+        })
+    }
+}
+
+func TestReadUnknownFieldError(t *testing.T) {
+    _, err := format.Read(strings.NewReader(`{"Records": [{"Event": "MouseMove"}, {"Evnet": "MouseMove"}]}`))
+    var field *format.UnknownFieldError
+    if !errors.As(err, &field) || field.Field != "Evnet" {
+        t.Fatalf("Read = %v, want an UnknownFieldError for Evnet", err)
+    }
+    if !strings.HasPrefix(err.Error(), "record 1: ") {
+        t.Errorf("Read = %v, want the record named", err)
+    }
+}
+
+func TestReadSyntaxError(t *testing.T) {
+    _, err := format.Read(strings.NewReader(`{"Records": [{"Event": "MouseMove"},, ]}`))
+    if err == nil || !strings.Contains(err.Error(), "at byte 37") {
+        t.Errorf("Read = %v, want the damage located", err)
+    }
+}
+
+func TestExtras(t *testing.T) {
+    if b, err := (format.Record{Event: format.EventMouseMove}).MarshalExtras(); err != nil || b != nil {
+        t.Errorf("MarshalExtras = %s, %v, want nothing for a plain record", b, err)
+    }
+    in := sample().Records[4]
+    in.Device = "kbd-1"
+    b, err := in.MarshalExtras()
+    if err != nil {
+        t.Fatal(err)
+    }
+    var out format.Record
+    if err := out.UnmarshalExtras(b); err != nil {
+        t.Fatal(err)
+    }
+    if out.Device != "kbd-1" || out.Key == nil || out.Key.VK != 0x41 {
+        t.Errorf("UnmarshalExtras(%s) = %+v", b, out)
+    }
+}
+
+func TestSaveLoadGzip(t *testing.T) {
+    name := filepath.Join(t.TempDir(), "sample.json.gz")
+    if err := format.Save(name, sample()); err != nil {
+        t.Fatal(err)
+    }
+    r, err := format.Load(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(r.Records) != len(sample().Records) {
+        t.Errorf("loaded %d records, want %d", len(r.Records), len(sample().Records))
+    }
+    matches, _ := filepath.Glob(filepath.Join(filepath.Dir(name), "*.tmp"))
+    if len(matches) > 0 {
+        t.Errorf("Save left %v behind", matches)
+    }
+}
+
+func TestChecksumIgnoresSource(t *testing.T) {
+    a := sample().Records
+    b := sample().Records
+    for i := range b {
+        b[i].Source = i + 7
+    }
+    sa, _ := format.Checksum(a)
+    sb, _ := format.Checksum(b)
+    if sa != sb {
+        t.Error("Checksum depends on Source")
+    }
+}
+
+func TestMigrateUnversioned(t *testing.T) {
+    r := &format.Recording{Records: sample().Records}
+    if err := format.Migrate(r); err != nil {
+        t.Fatal(err)
+    }
+    if r.Version != format.Version || r.Summary == nil {
+        t.Errorf("Migrate left Version %d, Summary %v", r.Version, r.Summary)
+    }
+}
+
+// benchRecords is how many records the benchmarks' recording has, about
+// eight hours of mouse movement.
+const benchRecords = 2000000
+
+var (
+    benchOnce      sync.Once
+    benchRecording *format.Recording
+)
+
+// largeRecording is a long recording of wandering moves with a click and
+// a key now and then, stamped as Write would.
+func largeRecording() *format.Recording {
+    benchOnce.Do(func() {
+        records := make([]format.Record, benchRecords)
+        x, y := int32(960), int32(540)
+        for i := range records {
+            rec := format.Record{DeltaMS: int64(8 + i%9), Event: format.EventMouseMove}
+            x += int32(i%7) - 3
+            y += int32(i%5) - 2
+            switch i % 500 {
+            case 100:
+                rec.Event = format.EventLeftButtonDown
+            case 101:
+                rec.Event = format.EventLeftButtonUp
+            case 300:
+                rec.Event = format.EventKeyDown
+                rec.Key = &format.KeyStroke{VK: 0x41, Scan: 0x1E}
+            case 301:
+                rec.Event = format.EventKeyUp
+                rec.Key = &format.KeyStroke{VK: 0x41, Scan: 0x1E}
+            }
+            rec.X, rec.Y = x, y
+            records[i] = rec
+        }
+        benchRecording = &format.Recording{Version: format.Version, Records: records}
+        if err := format.Write(io.Discard, benchRecording); err != nil {
+            panic(err)
+        }
+    })
+    return benchRecording
+}
+
+func benchmarkWrite(b *testing.B, encode func(io.Writer, *format.Recording) error) {
+    recording := largeRecording()
+    var buf bytes.Buffer
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        buf.Reset()
+        if err := encode(&buf, recording); err != nil {
+            b.Fatal(err)
+        }
+    }
+    b.SetBytes(int64(buf.Len()))
+}
+
+func benchmarkRead(b *testing.B, encode func(io.Writer, *format.Recording) error) {
+    var buf bytes.Buffer
+    if err := encode(&buf, largeRecording()); err != nil {
+        b.Fatal(err)
+    }
+    b.SetBytes(int64(buf.Len()))
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        r, err := format.Read(bytes.NewReader(buf.Bytes()))
+        if err != nil {
+            b.Fatal(err)
+        }
+        if len(r.Records) != benchRecords {
+            b.Fatalf("read %d records, want %d", len(r.Records), benchRecords)
+        }
+    }
+}
+
+func TestReadBinaryCorrupt(t *testing.T) {
+    var buf bytes.Buffer
+    if err := format.EncodeBinary(&buf, sample()); err != nil {
+        t.Fatal(err)
+    }
+    valid := buf.Bytes()
+    // Magic, version 1 and an empty header, then the event-name count.
+    header := []byte("MRRB\x01\x02{}")
+    for _, c := range []struct {
+        name string
+        file []byte
+    }{
+        {"huge event count", append(header[:len(header):len(header)], 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)},
+        {"too many event names", append(header[:len(header):len(header)], 0x81, 0x80, 0x04)},
+        {"cut short", valid[:len(valid)-3]},
+    } {
+        if _, err := format.Read(bytes.NewReader(c.file)); err == nil {
+            t.Errorf("%s: Read succeeded", c.name)
+        }
+    }
+}
+
+func TestParseColor(t *testing.T) {
+    for _, c := range []struct {
+        s       string
+        r, g, b uint8
+        ok      bool
+    }{
+        {"#FF8000", 0xFF, 0x80, 0x00, true},
+        {"00ff7f", 0x00, 0xFF, 0x7F, true},
+        {"#FFF", 0, 0, 0, false},
+        {"#GG0000", 0, 0, 0, false},
+        {"", 0, 0, 0, false},
+    } {
+        r, g, b, err := format.ParseColor(c.s)
+        if (err == nil) != c.ok || r != c.r || g != c.g || b != c.b {
+            t.Errorf("ParseColor(%q) = %d, %d, %d, %v", c.s, r, g, b, err)
+        }
+    }
+}
+
+func TestWaitTimeout(t *testing.T) {
+    var none *format.WaitStep
+    if d := none.Timeout(); d != format.DefaultWaitTimeout {
+        t.Errorf("nil Timeout = %v", d)
+    }
+    if d := (&format.WaitStep{TimeoutMS: 1500}).Timeout(); d != 1500*time.Millisecond {
+        t.Errorf("Timeout = %v, want 1.5s", d)
+    }
+}
+
+func BenchmarkWriteBinary(b *testing.B) { benchmarkWrite(b, format.EncodeBinary) }
+func BenchmarkReadBinary(b *testing.B)  { benchmarkRead(b, format.EncodeBinary) }
+func BenchmarkWriteJSON(b *testing.B)   { benchmarkWrite(b, format.EncodeJSON) }
+func BenchmarkReadJSON(b *testing.B)    { benchmarkRead(b, format.EncodeJSON) }
+
+func ExampleSummarize() {
+    s := format.Summarize(sample().Records)
+    fmt.Printf("%dms, %.0fpx, %d clicks, box %+v\n",
+        s.DurationMS, s.Distance, s.EventCounts[format.EventLeftButtonDown], s.BoundingBox)
+    // Output: 200ms, 70px, 1 clicks, box {MinX:100 MinY:100 MaxX:140 MaxY:130}
+}
@@ -0,0 +1,115 @@
+package format
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// RecordFields are the fields a record may have.
+var RecordFields = []string{"DeltaMS", "X", "Y", "Event", "Data", "Device", "Wait", "Key", "Check"}
+
+// UnknownFieldError is the error, possibly wrapped, for a field a record
+// doesn't have, usually a typo in a hand-edited file.
+type UnknownFieldError struct {
+    Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+    return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// EncodeJSON writes recording as indented JSON, as it is, without
+// stamping it as Write does.
+func EncodeJSON(w io.Writer, recording *Recording) error {
+    b, err := json.MarshalIndent(recording, "", "  ")
+    if err != nil {
+        return err
+    }
+    _, err = w.Write(b)
+    return err
+}
+
+// DecodeJSON reads a JSON recording, or the bare array of records older
+// ones are. Fields a record doesn't have are refused, and errors name the
+// record they are in. Its checksum isn't verified and it isn't upgraded;
+// Read does both.
+func DecodeJSON(r io.Reader) (*Recording, error) {
+    b, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+
+    if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+        var records []Record
+        if err := decodeStrict(b, &records); err != nil {
+            return nil, locateJSONError(b, err)
+        }
+        return &Recording{Version: 1, Records: records}, nil
+    }
+
+    var header struct{ Version int }
+    if err := json.Unmarshal(b, &header); err == nil {
+        if err := CheckVersion(header.Version); err != nil {
+            return nil, err
+        }
+    }
+    var recording Recording
+    if err := decodeStrict(b, &recording); err != nil {
+        return nil, locateJSONError(b, err)
+    }
+    return &recording, nil
+}
+
+// decodeStrict decodes b into v, refusing fields v doesn't have.
+func decodeStrict(b []byte, v interface{}) error {
+    dec := json.NewDecoder(bytes.NewReader(b))
+    dec.DisallowUnknownFields()
+    return dec.Decode(v)
+}
+
+// describeJSONError rewrites encoding/json's errors for people editing a
+// recording by hand.
+func describeJSONError(err error) error {
+    var typeErr *json.UnmarshalTypeError
+    if errors.As(err, &typeErr) {
+        return fmt.Errorf("%s should be a %s, not a %s", typeErr.Field, typeErr.Type, typeErr.Value)
+    }
+    msg := err.Error()
+    if i := strings.Index(msg, "unknown field "); i >= 0 {
+        if name, qerr := strconv.Unquote(msg[i+len("unknown field "):]); qerr == nil {
+            return &UnknownFieldError{Field: name}
+        }
+    }
+    return errors.New(strings.TrimPrefix(msg, "json: "))
+}
+
+// locateJSONError finds the record a JSON decoding error came from by
+// decoding the records one at a time.
+func locateJSONError(b []byte, err error) error {
+    var syntax *json.SyntaxError
+    if errors.As(err, &syntax) {
+        // Usually a save that never finished.
+        return fmt.Errorf("the file is damaged or was cut short (%v at byte %d)", err, syntax.Offset)
+    }
+
+    var raw []json.RawMessage
+    if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+        json.Unmarshal(b, &raw)
+    } else {
+        var wrapper struct{ Records []json.RawMessage }
+        json.Unmarshal(b, &wrapper)
+        raw = wrapper.Records
+    }
+    for i, r := range raw {
+        var rec Record
+        if rerr := decodeStrict(r, &rec); rerr != nil {
+            return fmt.Errorf("record %d: %w", i, describeJSONError(rerr))
+        }
+    }
+    return describeJSONError(err)
+}
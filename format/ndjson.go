@@ -0,0 +1,127 @@
+package format
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+)
+
+// An NDJSON recording is a header line followed by one record per line, so
+// it can be appended to, grepped and piped into other tools a line at a
+// time, and written out while it is recorded with NDJSONWriter.
+const ndjsonFormat = "mrr-ndjson"
+
+// ndjsonHeader is the first line of an NDJSON recording. Format comes first
+// so the marker is at the very start of the file.
+type ndjsonHeader struct {
+    Format      string       `json:"Format"`
+    Version     int          `json:"Version"`
+    Metadata    *Metadata    `json:"Metadata,omitempty"`
+    Summary     *Summary     `json:"Summary,omitempty"`
+    DPISegments []DPISegment `json:"DPISegments,omitempty"`
+}
+
+// IsNDJSON peeks at the first line of br for the header's Format.
+func IsNDJSON(br *bufio.Reader) bool {
+    head, _ := br.Peek(512)
+    if i := bytes.IndexByte(head, '\n'); i >= 0 {
+        head = head[:i]
+    }
+    return bytes.Contains(head, []byte(`"`+ndjsonFormat+`"`))
+}
+
+// NDJSONWriter writes an NDJSON recording a record at a time, so a
+// recording can be saved while it is made.
+type NDJSONWriter struct {
+    enc *json.Encoder
+}
+
+// NewNDJSONWriter writes the header line of recording to w; its records
+// are left to Write.
+func NewNDJSONWriter(w io.Writer, recording *Recording) (*NDJSONWriter, error) {
+    enc := json.NewEncoder(w)
+    err := enc.Encode(ndjsonHeader{
+        Format:      ndjsonFormat,
+        Version:     recording.Version,
+        Metadata:    recording.Metadata,
+        Summary:     recording.Summary,
+        DPISegments: recording.DPISegments,
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &NDJSONWriter{enc: enc}, nil
+}
+
+// Write writes rec as the next line.
+func (nw *NDJSONWriter) Write(rec Record) error {
+    return nw.enc.Encode(rec)
+}
+
+// EncodeNDJSON writes recording as NDJSON. NDJSON recordings carry no
+// checksum.
+func EncodeNDJSON(w io.Writer, recording *Recording) error {
+    bw := bufio.NewWriter(w)
+    nw, err := NewNDJSONWriter(bw, recording)
+    if err != nil {
+        return err
+    }
+    for _, rec := range recording.Records {
+        if err := nw.Write(rec); err != nil {
+            return err
+        }
+    }
+    return bw.Flush()
+}
+
+// DecodeNDJSON reads an NDJSON recording, summarizing it when the header
+// has no summary.
+func DecodeNDJSON(r io.Reader) (*Recording, error) {
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 64*1024), 1<<20)
+
+    if !sc.Scan() {
+        if err := sc.Err(); err != nil {
+            return nil, err
+        }
+        return nil, fmt.Errorf("empty NDJSON recording")
+    }
+    var header ndjsonHeader
+    if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+        return nil, fmt.Errorf("line 1: %v", err)
+    }
+    if err := CheckVersion(header.Version); err != nil {
+        return nil, err
+    }
+    recording := &Recording{
+        Version:     header.Version,
+        Metadata:    header.Metadata,
+        Summary:     header.Summary,
+        DPISegments: header.DPISegments,
+    }
+
+    for line := 2; sc.Scan(); line++ {
+        b := bytes.TrimSpace(sc.Bytes())
+        if len(b) == 0 {
+            continue
+        }
+        var rec Record
+        if err := decodeStrict(b, &rec); err != nil {
+            return nil, fmt.Errorf("line %d: %w", line, describeJSONError(err))
+        }
+        recording.Records = append(recording.Records, rec)
+    }
+    if err := sc.Err(); err != nil {
+        return nil, err
+    }
+
+    // A file cut short while recording, or appended to by hand, has no
+    // (or a stale) summary.
+    if recording.Summary == nil || recording.Version < Version {
+        s := Summarize(recording.Records)
+        recording.Summary = &s
+    }
+    return recording, nil
+}
@@ -0,0 +1,55 @@
+package format
+
+import "math"
+
+// Summary describes a capture at a glance so it can be sanity checked
+// before it is relied on.
+type Summary struct {
+    DurationMS      int64          `json:"DurationMS"`
+    EventCounts     map[string]int `json:"EventCounts"`
+    Distance        float64        `json:"Distance"`
+    ClicksPerMinute float64        `json:"ClicksPerMinute"`
+    BoundingBox     Rect           `json:"BoundingBox"`
+}
+
+// Summarize describes records.
+func Summarize(records []Record) Summary {
+    s := Summary{EventCounts: make(map[string]int)}
+    clicks := 0
+
+    for i, rec := range records {
+        if i != 0 {
+            // The first delta is the wait before the first event, which
+            // isn't part of the replayed timeline.
+            s.DurationMS += rec.DeltaMS
+            prev := records[i-1]
+            s.Distance += math.Hypot(float64(rec.X-prev.X), float64(rec.Y-prev.Y))
+        }
+        s.EventCounts[rec.Event]++
+        if IsClick(rec.Event) {
+            clicks++
+        }
+
+        if i == 0 {
+            s.BoundingBox = Rect{rec.X, rec.Y, rec.X, rec.Y}
+            continue
+        }
+        if rec.X < s.BoundingBox.MinX {
+            s.BoundingBox.MinX = rec.X
+        }
+        if rec.Y < s.BoundingBox.MinY {
+            s.BoundingBox.MinY = rec.Y
+        }
+        if rec.X > s.BoundingBox.MaxX {
+            s.BoundingBox.MaxX = rec.X
+        }
+        if rec.Y > s.BoundingBox.MaxY {
+            s.BoundingBox.MaxY = rec.Y
+        }
+    }
+
+    if s.DurationMS > 0 {
+        s.ClicksPerMinute = float64(clicks) / (float64(s.DurationMS) / 60000)
+    }
+    return s
+}
@@ -0,0 +1,53 @@
+package format
+
+import "fmt"
+
+// Version is the format version written into every saved recording. Bump
+// it whenever the schema changes and add the step that upgrades the
+// previous version to migrations.
+//
+//     1  unversioned files: a bare array of records, or a Recording without
+//        Version
+//     2  Version field; Summary is always present
+const Version = 2
+
+// migrations[v] upgrades a recording from version v to v+1 in place.
+var migrations = map[int]func(*Recording) error{
+    1: func(r *Recording) error {
+        if r.Summary == nil {
+            s := Summarize(r.Records)
+            r.Summary = &s
+        }
+        return nil
+    },
+}
+
+// CheckVersion rejects recordings written by a newer MRR, before their
+// contents are decoded with a schema that may no longer match.
+func CheckVersion(v int) error {
+    if v > Version {
+        return fmt.Errorf("recording format version %d is newer than this MRR supports (%d), update MRR to load it", v, Version)
+    }
+    return nil
+}
+
+// Migrate upgrades a freshly loaded recording to Version.
+func Migrate(r *Recording) error {
+    if r.Version == 0 {
+        r.Version = 1
+    }
+    if err := CheckVersion(r.Version); err != nil {
+        return err
+    }
+    for r.Version < Version {
+        step, ok := migrations[r.Version]
+        if !ok {
+            return fmt.Errorf("no migration from recording format version %d", r.Version)
+        }
+        if err := step(r); err != nil {
+            return fmt.Errorf("migrating from version %d: %v", r.Version, err)
+        }
+        r.Version++
+    }
+    return nil
+}
@@ -0,0 +1,3 @@
+module github.com/onixldlc/MRR
+
+go 1.22
@@ -0,0 +1,30 @@
+// +build windows
+
+package hook_test
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onixldlc/MRR/hook"
+)
+
+// Print clicks for ten seconds, keeping right clicks from the application
+// in front.
+func ExampleInstall() {
+    h, err := hook.Install(hook.Mouse, func(ev hook.Event) bool {
+        switch ev.Message {
+        case hook.WM_LBUTTONDOWN:
+            fmt.Println("left click at", ev.X, ev.Y)
+        case hook.WM_RBUTTONDOWN, hook.WM_RBUTTONUP:
+            return !ev.Injected
+        }
+        return false
+    })
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    defer h.Close()
+    time.Sleep(10 * time.Second)
+}
@@ -0,0 +1,281 @@
+// +build windows
+
+// Package hook installs Windows' low-level mouse and keyboard hooks and
+// hands every event they see to a function, which may keep it from the
+// rest of the system. The hooks run on a locked OS thread of their own
+// with its own message loop, so the caller needs neither.
+//
+// Windows removes a low-level hook whose function takes longer than
+// LowLevelHooksTimeout (about a second) to return, so handlers should hand
+// slow work to another goroutine.
+package hook
+
+import (
+    "errors"
+    "runtime"
+    "sync"
+    "sync/atomic"
+    "syscall"
+    "time"
+    "unsafe"
+)
+
+// Kind is the kind of hook an event came from; Install takes several
+// or'ed together.
+type Kind int
+
+const (
+    Mouse Kind = 1 << iota
+    Keyboard
+)
+
+// Window messages an Event's Message is one of.
+const (
+    WM_KEYDOWN     = 0x0100
+    WM_KEYUP       = 0x0101
+    WM_SYSKEYDOWN  = 0x0104
+    WM_SYSKEYUP    = 0x0105
+    WM_MOUSEMOVE   = 0x0200
+    WM_LBUTTONDOWN = 0x0201
+    WM_LBUTTONUP   = 0x0202
+    WM_RBUTTONDOWN = 0x0204
+    WM_RBUTTONUP   = 0x0205
+    WM_MBUTTONDOWN = 0x0207
+    WM_MBUTTONUP   = 0x0208
+    WM_MOUSEWHEEL  = 0x020A
+    WM_XBUTTONDOWN = 0x020B
+    WM_XBUTTONUP   = 0x020C
+    WM_MOUSEHWHEEL = 0x020E
+
+    // XBUTTON1 and XBUTTON2 are the MouseData of the X button messages.
+    XBUTTON1 = 0x0001
+    XBUTTON2 = 0x0002
+)
+
+// Event is one mouse or keyboard event as a hook saw it.
+type Event struct {
+    Kind    Kind
+    Message uint32
+    // X and Y are where the cursor is, in physical virtual-screen pixels
+    // when the process is DPI aware.
+    X, Y int32
+    // MouseData is the high word of the mouse event's mouseData: the wheel
+    // delta as a signed 16-bit number, or which X button.
+    MouseData uint16
+    // VK, Scan and Extended identify the key of a keyboard event.
+    VK       uint16
+    Scan     uint16
+    Extended bool
+    // Injected is set for input a program made with SendInput rather than
+    // a device, such as a replay's.
+    Injected bool
+    // Time is when the hook saw the event.
+    Time time.Time
+}
+
+// Handler is called on the hook thread with every event. Returning true
+// swallows the event: the application in front never sees it.
+type Handler func(Event) bool
+
+// ErrInstalled is returned by Install while another Hook is installed; a
+// process has one.
+var ErrInstalled = errors.New("hook: already installed")
+
+// Hook is an installed set of hooks.
+type Hook struct {
+    thread uint32
+    done   chan struct{}
+    closed bool
+}
+
+const (
+    WH_KEYBOARD_LL = 13
+    WH_MOUSE_LL    = 14
+    WM_QUIT        = 0x0012
+    WM_USER        = 0x0400
+    PM_NOREMOVE    = 0x0000
+
+    LLKHF_EXTENDED = 0x01
+    LLKHF_INJECTED = 0x10
+    LLMHF_INJECTED = 0x01
+)
+
+type kbdllhookstruct struct {
+    VKCode      uint32
+    ScanCode    uint32
+    Flags       uint32
+    Time        uint32
+    DwExtraInfo uintptr
+}
+
+type msllhookstruct struct {
+    X, Y        int32
+    MouseData   uint32
+    Flags       uint32
+    Time        uint32
+    DwExtraInfo uintptr
+}
+
+type msg struct {
+    Hwnd    uintptr
+    Message uint32
+    WParam  uintptr
+    LParam  uintptr
+    Time    uint32
+    X, Y    int32
+}
+
+var (
+    user32                  = syscall.NewLazyDLL("user32.dll")
+    kernel32                = syscall.NewLazyDLL("kernel32.dll")
+    procSetWindowsHookExW   = user32.NewProc("SetWindowsHookExW")
+    procUnhookWindowsHookEx = user32.NewProc("UnhookWindowsHookEx")
+    procCallNextHookEx      = user32.NewProc("CallNextHookEx")
+    procGetMessageW         = user32.NewProc("GetMessageW")
+    procPeekMessageW        = user32.NewProc("PeekMessageW")
+    procPostThreadMessageW  = user32.NewProc("PostThreadMessageW")
+    procGetModuleHandleW    = kernel32.NewProc("GetModuleHandleW")
+    procGetCurrentThreadId  = kernel32.NewProc("GetCurrentThreadId")
+)
+
+// The callbacks are created once; syscall.NewCallback slots are a limited
+// resource. mu serializes Install and Close.
+var (
+    mu               sync.Mutex
+    handler          atomic.Pointer[Handler]
+    mouseCallback    = syscall.NewCallback(mouseProc)
+    keyboardCallback = syscall.NewCallback(keyboardProc)
+)
+
+// Install installs the hooks of kinds and calls h with their events until
+// Close is called.
+func Install(kinds Kind, h Handler) (*Hook, error) {
+    mu.Lock()
+    defer mu.Unlock()
+    if handler.Load() != nil {
+        return nil, ErrInstalled
+    }
+    if kinds&(Mouse|Keyboard) == 0 {
+        return nil, errors.New("hook: no hooks asked for")
+    }
+
+    hk := &Hook{done: make(chan struct{})}
+    installed := make(chan error, 1)
+    handler.Store(&h)
+    go hk.run(kinds, installed)
+    if err := <-installed; err != nil {
+        handler.Store(nil)
+        return nil, err
+    }
+    return hk, nil
+}
+
+// run installs the hooks on a thread of their own and pumps its messages,
+// which is what calls the hook functions, until Close posts WM_QUIT.
+func (hk *Hook) run(kinds Kind, installed chan<- error) {
+    runtime.LockOSThread()
+    defer runtime.UnlockOSThread()
+    defer close(hk.done)
+
+    tid, _, _ := procGetCurrentThreadId.Call()
+    hk.thread = uint32(tid)
+    // The thread gets a message queue, which Close posts to, on its first
+    // PeekMessage.
+    var m msg
+    procPeekMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, WM_USER, WM_USER, PM_NOREMOVE)
+    module, _, _ := procGetModuleHandleW.Call(0)
+
+    var hooks []uintptr
+    defer func() {
+        for _, h := range hooks {
+            procUnhookWindowsHookEx.Call(h)
+        }
+    }()
+    for _, k := range []struct {
+        kind     Kind
+        id       uintptr
+        callback uintptr
+    }{
+        {Mouse, WH_MOUSE_LL, mouseCallback},
+        {Keyboard, WH_KEYBOARD_LL, keyboardCallback},
+    } {
+        if kinds&k.kind == 0 {
+            continue
+        }
+        h, _, err := procSetWindowsHookExW.Call(k.id, k.callback, module, 0)
+        if h == 0 {
+            installed <- err
+            return
+        }
+        hooks = append(hooks, h)
+    }
+    installed <- nil
+
+    for {
+        // 0 is WM_QUIT and -1 an error; either ends the loop.
+        if r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0); int32(r) <= 0 {
+            return
+        }
+    }
+}
+
+// Close removes the hooks and waits until the hook thread is done, after
+// which the handler is no longer called. Closing twice does nothing.
+func (hk *Hook) Close() error {
+    mu.Lock()
+    defer mu.Unlock()
+    if hk.closed {
+        return nil
+    }
+    hk.closed = true
+    procPostThreadMessageW.Call(uintptr(hk.thread), WM_QUIT, 0, 0)
+    <-hk.done
+    handler.Store(nil)
+    return nil
+}
+
+// call hands ev to the installed handler.
+func call(ev Event) bool {
+    h := handler.Load()
+    return h != nil && (*h)(ev)
+}
+
+func mouseProc(code int, wparam uintptr, lparam uintptr) uintptr {
+    if code >= 0 {
+        ms := (*msllhookstruct)(unsafe.Pointer(lparam))
+        ev := Event{
+            Kind:      Mouse,
+            Message:   uint32(wparam),
+            X:         ms.X,
+            Y:         ms.Y,
+            MouseData: uint16(ms.MouseData >> 16),
+            Injected:  ms.Flags&LLMHF_INJECTED != 0,
+            Time:      time.Now(),
+        }
+        if call(ev) {
+            return 1
+        }
+    }
+    ret, _, _ := procCallNextHookEx.Call(0, uintptr(code), wparam, lparam)
+    return ret
+}
+
+func keyboardProc(code int, wparam uintptr, lparam uintptr) uintptr {
+    if code >= 0 {
+        kb := (*kbdllhookstruct)(unsafe.Pointer(lparam))
+        ev := Event{
+            Kind:     Keyboard,
+            Message:  uint32(wparam),
+            VK:       uint16(kb.VKCode),
+            Scan:     uint16(kb.ScanCode),
+            Extended: kb.Flags&LLKHF_EXTENDED != 0,
+            Injected: kb.Flags&LLKHF_INJECTED != 0,
+            Time:     time.Now(),
+        }
+        if call(ev) {
+            return 1
+        }
+    }
+    ret, _, _ := procCallNextHookEx.Call(0, uintptr(code), wparam, lparam)
+    return ret
+}
@@ -0,0 +1,60 @@
+// +build windows
+
+package hook
+
+import (
+    "errors"
+    "testing"
+    "unsafe"
+)
+
+// handle makes h the installed handler for the test, as Install does
+// without installing anything.
+func handle(t *testing.T, h Handler) {
+    handler.Store(&h)
+    t.Cleanup(func() { handler.Store(nil) })
+}
+
+func TestInstallRefuses(t *testing.T) {
+    if _, err := Install(0, func(Event) bool { return false }); err == nil {
+        t.Error("Install with no kinds succeeded")
+    }
+    handle(t, func(Event) bool { return false })
+    if _, err := Install(Mouse, func(Event) bool { return false }); !errors.Is(err, ErrInstalled) {
+        t.Errorf("Install while installed = %v, want ErrInstalled", err)
+    }
+}
+
+func TestMouseProc(t *testing.T) {
+    var got Event
+    handle(t, func(ev Event) bool {
+        got = ev
+        return true
+    })
+    // A downward wheel notch, injected.
+    ms := msllhookstruct{X: -10, Y: 20, MouseData: 0xFF88 << 16, Flags: LLMHF_INJECTED}
+    if r := mouseProc(0, WM_MOUSEWHEEL, uintptr(unsafe.Pointer(&ms))); r != 1 {
+        t.Errorf("mouseProc = %d, want 1 for a swallowed event", r)
+    }
+    if got.Kind != Mouse || got.Message != WM_MOUSEWHEEL || got.X != -10 || got.Y != 20 ||
+        int16(got.MouseData) != -120 || !got.Injected || got.Time.IsZero() {
+        t.Errorf("event = %+v", got)
+    }
+}
+
+func TestKeyboardProc(t *testing.T) {
+    var got Event
+    handle(t, func(ev Event) bool {
+        got = ev
+        return true
+    })
+    // Left arrow, an extended key.
+    kb := kbdllhookstruct{VKCode: 0x25, ScanCode: 0x4B, Flags: LLKHF_EXTENDED}
+    if r := keyboardProc(0, WM_KEYDOWN, uintptr(unsafe.Pointer(&kb))); r != 1 {
+        t.Errorf("keyboardProc = %d, want 1 for a swallowed event", r)
+    }
+    if got.Kind != Keyboard || got.Message != WM_KEYDOWN || got.VK != 0x25 || got.Scan != 0x4B ||
+        !got.Extended || got.Injected {
+        t.Errorf("event = %+v", got)
+    }
+}
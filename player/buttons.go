@@ -0,0 +1,96 @@
+// +build windows
+
+package player
+
+import "github.com/onixldlc/MRR/format"
+
+const (
+    VK_LBUTTON  = 0x01
+    VK_RBUTTON  = 0x02
+    VK_MBUTTON  = 0x04
+    VK_XBUTTON1 = 0x05
+    VK_XBUTTON2 = 0x06
+)
+
+// Button ties a mouse button's events to its virtual key.
+type Button struct {
+    Down, Up string
+    VK       uintptr
+}
+
+// Buttons lists the mouse buttons a recording can press.
+var Buttons = []Button{
+    {format.EventLeftButtonDown, format.EventLeftButtonUp, VK_LBUTTON},
+    {format.EventRightButtonDown, format.EventRightButtonUp, VK_RBUTTON},
+    {format.EventMiddleButtonDown, format.EventMiddleButtonUp, VK_MBUTTON},
+    {format.EventMouse4Down, format.EventMouse4Up, VK_XBUTTON1},
+    {format.EventMouse5Down, format.EventMouse5Up, VK_XBUTTON2},
+}
+
+// HeldButtons tracks which buttons were pressed and not released yet,
+// keyed by the button's up event.
+type HeldButtons map[string]bool
+
+// Track updates h for a record's event.
+func (h HeldButtons) Track(event string) {
+    for _, b := range Buttons {
+        switch event {
+        case b.Down:
+            h[b.Up] = true
+        case b.Up:
+            delete(h, b.Up)
+        }
+    }
+}
+
+// releaseAll lets go of every button the replay still holds. When the
+// replay drove the real cursor it also checks the live button state and
+// releases anything that still reads as down.
+func (h HeldButtons) releaseAll(inj Injector, logf func(string, ...interface{})) {
+    for up := range h {
+        if err := inj.Release(up); err != nil {
+            logf("could not release %s: %v", up, err)
+        }
+        delete(h, up)
+    }
+    if !inj.MovesCursor() {
+        return
+    }
+
+    for _, b := range Buttons {
+        state, _, _ := procGetAsyncKeyState.Call(b.VK)
+        if state&0x8000 != 0 {
+            logf("button still held after replay, releasing: %s", b.Up)
+            SendMouseEvent(b.Up, 0)
+        }
+    }
+}
+
+// heldKeys tracks keys a replay pressed and has not released yet, keyed
+// by scan code.
+type heldKeys map[uint16]format.KeyStroke
+
+func (h heldKeys) track(rec format.Record) {
+    if rec.Key == nil {
+        return
+    }
+    scan, _ := ScanCode(rec.Key)
+    switch rec.Event {
+    case format.EventKeyDown:
+        h[scan] = *rec.Key
+    case format.EventKeyUp:
+        delete(h, scan)
+    }
+}
+
+// releaseAll lets go of every key the replay still holds, so an aborted
+// replay can't leave Shift or W stuck down.
+func (h heldKeys) releaseAll(inj Injector, logf func(string, ...interface{})) {
+    for scan, key := range h {
+        key := key
+        if err := inj.Inject(format.Record{Event: format.EventKeyUp, Key: &key}); err != nil {
+            logf("could not release key %#x: %v", scan, err)
+        }
+        delete(h, scan)
+    }
+}
@@ -0,0 +1,138 @@
+// +build windows
+
+package player
+
+import (
+    "context"
+    "fmt"
+    "hash/fnv"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// Check steps assert that the screen looks as expected at that point of
+// the replay. On a mismatch the records since the previous check step (or
+// the start) are replayed again, up to Retries times, before the replay
+// fails. This heals macros against a click that a slow UI swallowed.
+
+// defaultRetryDelay is how long a failed check waits before retrying.
+const defaultRetryDelay = 500 * time.Millisecond
+
+// IsCheckStep reports whether rec is a check step.
+func IsCheckStep(rec format.Record) bool {
+    return rec.Event == format.EventAssertPixel || rec.Event == format.EventAssertRegion
+}
+
+// regionHash captures w x h screen pixels at x, y and hashes their colors.
+func regionHash(x, y, w, h int32) (string, error) {
+    pixels, err := desktop.CaptureScreen(x, y, w, h)
+    if err != nil {
+        return "", err
+    }
+
+    // Hash B, G and R only; the fourth byte is undefined.
+    hash := fnv.New64a()
+    for i := 0; i < len(pixels); i += 4 {
+        hash.Write(pixels[i : i+3])
+    }
+    return fmt.Sprintf("%016x", hash.Sum64()), nil
+}
+
+// evaluateCheck tests rec once and describes the outcome.
+func evaluateCheck(rec format.Record) (bool, string, error) {
+    step := rec.Check
+    if step == nil {
+        return false, "", fmt.Errorf("%s step has no Check", rec.Event)
+    }
+
+    switch rec.Event {
+    case format.EventAssertPixel:
+        wr, wg, wb, err := format.ParseColor(step.Color)
+        if err != nil {
+            return false, "", err
+        }
+        r, g, b, err := desktop.PixelAt(rec.X, rec.Y)
+        if err != nil {
+            return false, err.Error(), nil
+        }
+        ok := channelClose(r, wr, step.Tolerance) && channelClose(g, wg, step.Tolerance) && channelClose(b, wb, step.Tolerance)
+        return ok, fmt.Sprintf("pixel (%d,%d) is #%02X%02X%02X, want %s", rec.X, rec.Y, r, g, b, step.Color), nil
+    case format.EventAssertRegion:
+        got, err := regionHash(rec.X, rec.Y, step.Width, step.Height)
+        if err != nil {
+            return false, err.Error(), nil
+        }
+        return got == step.Hash, fmt.Sprintf("region %dx%d at (%d,%d) hashes to %s, want %s",
+            step.Width, step.Height, rec.X, rec.Y, got, step.Hash), nil
+    }
+    return false, "", fmt.Errorf("unknown check step %q", rec.Event)
+}
+
+// check runs check step i. segment holds the records played since the
+// previous check step, which are replayed on a mismatch.
+func (run *replayRun) check(ctx context.Context, i int, rec format.Record, segment []format.Record) error {
+    if run.p.opts.DryRun {
+        run.p.opts.OnDryRun(i, rec, fmt.Sprintf("check %s at (%d,%d)", rec.Event, rec.X, rec.Y))
+        return nil
+    }
+
+    delay := defaultRetryDelay
+    retries := 0
+    if rec.Check != nil {
+        retries = rec.Check.Retries
+        if rec.Check.RetryDelayMS > 0 {
+            delay = time.Duration(rec.Check.RetryDelayMS) * time.Millisecond
+        }
+    }
+
+    for attempt := 0; ; attempt++ {
+        ok, detail, err := evaluateCheck(rec)
+        if err != nil {
+            return fmt.Errorf("record %d: %v", i, err)
+        }
+        if ok {
+            if attempt > 0 {
+                detail += fmt.Sprintf(" (after %d retries)", attempt)
+            }
+            run.assert(i, rec.Event, true, detail)
+            return nil
+        }
+        if attempt >= retries {
+            run.assert(i, rec.Event, false, detail)
+            return fmt.Errorf("record %d: check failed: %s", i, detail)
+        }
+
+        run.p.opts.OnRetry(i, detail, len(segment), attempt+1, retries)
+        if err := sleepContext(ctx, delay); err != nil {
+            return err
+        }
+        if err := run.replaySegment(ctx, segment); err != nil {
+            return err
+        }
+    }
+}
+
+// replaySegment injects records again with their timing, for a retry.
+func (run *replayRun) replaySegment(ctx context.Context, records []format.Record) error {
+    tl := newTimeline(run.timer)
+    for k, rec := range records {
+        if k != 0 {
+            delay := time.Duration(float64(rec.DeltaMS) / run.p.Speed() * float64(time.Millisecond))
+            if err := tl.wait(ctx, delay); err != nil {
+                return err
+            }
+        }
+        if IsWaitStep(rec) {
+            if err := run.waitFor(ctx, rec.Source, rec); err != nil {
+                return err
+            }
+            continue
+        }
+        if err := run.inject(rec.Source, rec); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,90 @@
+// +build windows
+
+package player
+
+import (
+    "context"
+    "errors"
+    "sync/atomic"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+)
+
+// Slamming the cursor into a corner of a monitor aborts a replay, unless
+// Options.NoFailsafe turns it off.
+
+const (
+    // failsafeMargin is how close to a monitor corner counts as "in" it.
+    failsafeMargin = 2
+    // failsafePoll is how often the cursor is checked during a replay.
+    failsafePoll = 50 * time.Millisecond
+)
+
+// ErrFailsafe is the cause of a replay aborted by the corner failsafe.
+var ErrFailsafe = errors.New("failsafe: cursor moved into a screen corner")
+
+// lastInjected remembers the last position the player moved the cursor to,
+// packed as x<<32 | y, so the watcher can tell our moves from the user's.
+type lastInjected struct {
+    v atomic.Int64
+}
+
+func (l *lastInjected) set(x, y int32) {
+    l.v.Store(int64(x)<<32 | int64(uint32(y)))
+}
+
+func (l *lastInjected) get() (int32, int32) {
+    v := l.v.Load()
+    return int32(v >> 32), int32(uint32(v))
+}
+
+// inCorner reports whether pt is within failsafeMargin of a corner of the
+// monitor it is on.
+func inCorner(pt desktop.Point) bool {
+    r, ok := desktop.MonitorFromPoint(pt.X, pt.Y).Rect()
+    if !ok {
+        return false
+    }
+    near := func(v, edge int32) bool {
+        d := v - edge
+        return d >= -failsafeMargin && d <= failsafeMargin
+    }
+    return (near(pt.X, r.MinX) || near(pt.X, r.MaxX)) && (near(pt.Y, r.MinY) || near(pt.Y, r.MaxY))
+}
+
+func absInt32(v int32) int32 {
+    if v < 0 {
+        return -v
+    }
+    return v
+}
+
+// watchFailsafe polls the cursor until ctx is done and calls abort with
+// ErrFailsafe as soon as the cursor sits in a monitor corner that the
+// replay itself didn't put it in.
+func watchFailsafe(ctx context.Context, last *lastInjected, abort context.CancelCauseFunc, logf func(string, ...interface{})) {
+    ticker := time.NewTicker(failsafePoll)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+
+        pt, err := desktop.CursorPos()
+        if err != nil || !inCorner(pt) {
+            continue
+        }
+        // Absolute injection can land a pixel off, so allow some slack
+        // when deciding whether the replay put the cursor there.
+        if x, y := last.get(); absInt32(x-pt.X) <= failsafeMargin && absInt32(y-pt.Y) <= failsafeMargin {
+            continue
+        }
+        logf("failsafe triggered at (%d,%d)", pt.X, pt.Y)
+        abort(ErrFailsafe)
+        return
+    }
+}
@@ -0,0 +1,177 @@
+// +build windows
+
+package player
+
+import (
+    "fmt"
+    "unicode/utf16"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+    "github.com/onixldlc/MRR/hook"
+)
+
+// Injector delivers replayed records.
+type Injector interface {
+    // Inject performs rec at its coordinates.
+    Inject(rec format.Record) error
+    // Release sends a button's up event without moving anywhere.
+    Release(upEvent string) error
+    // MovesCursor reports whether injecting moves the real cursor.
+    MovesCursor() bool
+}
+
+// SendInput drives the real cursor and keyboard with SendInput. It is the
+// Injector used unless Options names another.
+var SendInput Injector = sendInputInjector{}
+
+type sendInputInjector struct{}
+
+func (sendInputInjector) Inject(rec format.Record) error {
+    if IsKey(rec) {
+        return InjectKey(rec)
+    }
+    return InjectMouseAt(rec.X, rec.Y, rec.Event, rec.Data)
+}
+
+func (sendInputInjector) Release(upEvent string) error {
+    return SendMouseEvent(upEvent, 0)
+}
+
+func (sendInputInjector) MovesCursor() bool { return true }
+
+const (
+    WM_CHAR = 0x0102
+
+    MK_LBUTTON  = 0x0001
+    MK_RBUTTON  = 0x0002
+    MK_MBUTTON  = 0x0010
+    MK_XBUTTON1 = 0x0020
+    MK_XBUTTON2 = 0x0040
+)
+
+// messageInjector posts mouse messages to a window without touching the
+// real cursor. Each event goes to the deepest visible child under the
+// point, in that child's client coordinates. Applications that read the
+// cursor or key state directly instead of the message won't notice it.
+type messageInjector struct {
+    root uintptr
+    // keys is the MK_* state reported in wParam, kept in step with the
+    // buttons this injector pressed.
+    keys uintptr
+}
+
+func newMessageInjector(title string) (*messageInjector, error) {
+    hwnd, err := desktop.FindWindow(title)
+    if err != nil {
+        return nil, err
+    }
+    return &messageInjector{root: hwnd}, nil
+}
+
+func (m *messageInjector) MovesCursor() bool { return false }
+
+func makeLParam(lo, hi int32) uintptr {
+    return uintptr(uint32(uint16(lo)) | uint32(uint16(hi))<<16)
+}
+
+// messageFor maps an event to its window message, the MK_* bit it changes
+// and the wParam high word (XBUTTON id or wheel delta).
+func messageFor(event string, data int32) (msg uint32, key uintptr, hi uint16) {
+    switch event {
+    case format.EventLeftButtonDown:
+        return hook.WM_LBUTTONDOWN, MK_LBUTTON, 0
+    case format.EventLeftButtonUp:
+        return hook.WM_LBUTTONUP, MK_LBUTTON, 0
+    case format.EventRightButtonDown:
+        return hook.WM_RBUTTONDOWN, MK_RBUTTON, 0
+    case format.EventRightButtonUp:
+        return hook.WM_RBUTTONUP, MK_RBUTTON, 0
+    case format.EventMiddleButtonDown:
+        return hook.WM_MBUTTONDOWN, MK_MBUTTON, 0
+    case format.EventMiddleButtonUp:
+        return hook.WM_MBUTTONUP, MK_MBUTTON, 0
+    case format.EventMouse4Down:
+        return hook.WM_XBUTTONDOWN, MK_XBUTTON1, hook.XBUTTON1
+    case format.EventMouse4Up:
+        return hook.WM_XBUTTONUP, MK_XBUTTON1, hook.XBUTTON1
+    case format.EventMouse5Down:
+        return hook.WM_XBUTTONDOWN, MK_XBUTTON2, hook.XBUTTON2
+    case format.EventMouse5Up:
+        return hook.WM_XBUTTONUP, MK_XBUTTON2, hook.XBUTTON2
+    case format.EventMouseWheel:
+        return hook.WM_MOUSEWHEEL, 0, uint16(data)
+    case format.EventMouseHWheel:
+        return hook.WM_MOUSEHWHEEL, 0, uint16(data)
+    }
+    return hook.WM_MOUSEMOVE, 0, 0
+}
+
+func (m *messageInjector) Inject(rec format.Record) error {
+    if ok, _, _ := procIsWindow.Call(m.root); ok == 0 {
+        return fmt.Errorf("background window is gone")
+    }
+    if IsKey(rec) {
+        return postKey(m.root, rec)
+    }
+
+    msg, key, hi := messageFor(rec.Event, rec.Data)
+    switch msg {
+    case hook.WM_LBUTTONDOWN, hook.WM_RBUTTONDOWN, hook.WM_MBUTTONDOWN, hook.WM_XBUTTONDOWN:
+        m.keys |= key
+    case hook.WM_LBUTTONUP, hook.WM_RBUTTONUP, hook.WM_MBUTTONUP, hook.WM_XBUTTONUP:
+        m.keys &^= key
+    }
+
+    hwnd, cx, cy := desktop.WindowAt(m.root, rec.X, rec.Y)
+    lparam := makeLParam(cx, cy)
+    if msg == hook.WM_MOUSEWHEEL || msg == hook.WM_MOUSEHWHEEL {
+        // Wheel messages carry screen coordinates.
+        lparam = makeLParam(rec.X, rec.Y)
+    }
+    wparam := m.keys | uintptr(hi)<<16
+    return postMessage(hwnd, msg, wparam, lparam)
+}
+
+func (m *messageInjector) Release(upEvent string) error {
+    msg, key, hi := messageFor(upEvent, 0)
+    m.keys &^= key
+    return postMessage(m.root, msg, m.keys|uintptr(hi)<<16, 0)
+}
+
+func postMessage(hwnd uintptr, msg uint32, wparam, lparam uintptr) error {
+    r, _, err := procPostMessageW.Call(hwnd, uintptr(msg), wparam, lparam)
+    if r == 0 {
+        return fmt.Errorf("PostMessageW failed: %v", err)
+    }
+    return nil
+}
+
+// postKey posts a key or text record to hwnd as WM_KEYDOWN/WM_KEYUP or
+// WM_CHAR messages.
+func postKey(hwnd uintptr, rec format.Record) error {
+    if rec.Key == nil {
+        return fmt.Errorf("%s record has no Key", rec.Event)
+    }
+
+    if rec.Event == format.EventText {
+        for _, unit := range utf16.Encode([]rune(rec.Key.Text)) {
+            if err := postMessage(hwnd, WM_CHAR, uintptr(unit), 1); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    // lParam: repeat count 1, scan code, extended bit, and for key up the
+    // previous-state and transition bits.
+    scan, extended := ScanCode(rec.Key)
+    lparam := uintptr(1) | uintptr(scan)<<16
+    if extended {
+        lparam |= 1 << 24
+    }
+    if rec.Event == format.EventKeyUp {
+        return postMessage(hwnd, hook.WM_KEYUP, uintptr(rec.Key.VK), lparam|3<<30)
+    }
+    return postMessage(hwnd, hook.WM_KEYDOWN, uintptr(rec.Key.VK), lparam)
+}
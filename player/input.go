@@ -0,0 +1,264 @@
+// +build windows
+
+package player
+
+import (
+    "fmt"
+    "syscall"
+    "unicode/utf16"
+    "unsafe"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+const (
+    INPUT_MOUSE    = 0
+    INPUT_KEYBOARD = 1
+
+    MOUSEEVENTF_MOVE        = 0x0001
+    MOUSEEVENTF_LEFTDOWN    = 0x0002
+    MOUSEEVENTF_LEFTUP      = 0x0004
+    MOUSEEVENTF_RIGHTDOWN   = 0x0008
+    MOUSEEVENTF_RIGHTUP     = 0x0010
+    MOUSEEVENTF_MIDDLEDOWN  = 0x0020
+    MOUSEEVENTF_MIDDLEUP    = 0x0040
+    MOUSEEVENTF_XDOWN       = 0x0080
+    MOUSEEVENTF_XUP         = 0x0100
+    MOUSEEVENTF_WHEEL       = 0x0800
+    MOUSEEVENTF_HWHEEL      = 0x1000
+    MOUSEEVENTF_VIRTUALDESK = 0x4000
+    MOUSEEVENTF_ABSOLUTE    = 0x8000
+
+    XBUTTON1 = 0x0001
+    XBUTTON2 = 0x0002
+
+    KEYEVENTF_EXTENDEDKEY = 0x0001
+    KEYEVENTF_KEYUP       = 0x0002
+    KEYEVENTF_UNICODE     = 0x0004
+    KEYEVENTF_SCANCODE    = 0x0008
+
+    MAPVK_VK_TO_VSC_EX = 4
+)
+
+type MOUSEINPUT struct {
+    Dx          int32
+    Dy          int32
+    MouseData   uint32
+    DwFlags     uint32
+    Time        uint32
+    DwExtraInfo uintptr
+}
+
+type KEYBDINPUT struct {
+    WVk         uint16
+    WScan       uint16
+    DwFlags     uint32
+    Time        uint32
+    DwExtraInfo uintptr
+}
+
+// mouseInput and keyboardInput are INPUTs. SendInput wants every element
+// to be sizeof(INPUT), which the mouse variant sets.
+type mouseInput struct {
+    Type uint32
+    Mi   MOUSEINPUT
+}
+
+type keyboardInput struct {
+    Type uint32
+    Ki   KEYBDINPUT
+    _    [unsafe.Sizeof(MOUSEINPUT{}) - unsafe.Sizeof(KEYBDINPUT{})]byte
+}
+
+var (
+    user32               = syscall.NewLazyDLL("user32.dll")
+    procSendInput        = user32.NewProc("SendInput")
+    procMapVirtualKeyW   = user32.NewProc("MapVirtualKeyW")
+    procGetAsyncKeyState = user32.NewProc("GetAsyncKeyState")
+    procPostMessageW     = user32.NewProc("PostMessageW")
+    procIsWindow         = user32.NewProc("IsWindow")
+)
+
+// sendInput sends the n INPUTs at first.
+func sendInput(first unsafe.Pointer, n int, size uintptr) error {
+    if n == 0 {
+        return nil
+    }
+    sent, _, err := procSendInput.Call(uintptr(n), uintptr(first), size)
+    if int(sent) != n {
+        return fmt.Errorf("SendInput injected %d of %d inputs: %v", sent, n, err)
+    }
+    return nil
+}
+
+// InjectMouseAt moves the cursor to the virtual-screen pixel x,y and
+// injects event there in a single INPUT, so nothing can slip in between
+// the move and the button.
+func InjectMouseAt(x, y int32, event string, data int32) error {
+    flags, mouseData := MouseFlags(event, data)
+    dx, dy := NormalizeAbsolute(x, y, desktop.VirtualScreen())
+    in := mouseInput{
+        Type: INPUT_MOUSE,
+        Mi: MOUSEINPUT{
+            Dx:        dx,
+            Dy:        dy,
+            MouseData: mouseData,
+            DwFlags:   MOUSEEVENTF_MOVE | MOUSEEVENTF_ABSOLUTE | MOUSEEVENTF_VIRTUALDESK | flags,
+        },
+    }
+    return sendInput(unsafe.Pointer(&in), 1, unsafe.Sizeof(in))
+}
+
+// SendMouseEvent injects event wherever the cursor is. Events without
+// flags, such as MouseMove, do nothing.
+func SendMouseEvent(event string, data int32) error {
+    flags, mouseData := MouseFlags(event, data)
+    if flags == 0 {
+        return nil
+    }
+    in := mouseInput{Type: INPUT_MOUSE, Mi: MOUSEINPUT{MouseData: mouseData, DwFlags: flags}}
+    return sendInput(unsafe.Pointer(&in), 1, unsafe.Sizeof(in))
+}
+
+// InjectKey types a key or text record.
+func InjectKey(rec format.Record) error {
+    inputs, err := keyInputs(rec)
+    if err != nil || len(inputs) == 0 {
+        return err
+    }
+    return sendInput(unsafe.Pointer(&inputs[0]), len(inputs), unsafe.Sizeof(inputs[0]))
+}
+
+// TapKey presses and releases the virtual key vk.
+func TapKey(vk uint16) error {
+    inputs := []keyboardInput{
+        {Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WVk: vk}},
+        {Type: INPUT_KEYBOARD, Ki: KEYBDINPUT{WVk: vk, DwFlags: KEYEVENTF_KEYUP}},
+    }
+    return sendInput(unsafe.Pointer(&inputs[0]), len(inputs), unsafe.Sizeof(inputs[0]))
+}
+
+// MouseFlags maps a recorded event to its SendInput flags and mouseData.
+// MouseMove and unknown events map to no flags.
+func MouseFlags(event string, data int32) (flags, mouseData uint32) {
+    switch event {
+    case format.EventLeftButtonDown:
+        return MOUSEEVENTF_LEFTDOWN, 0
+    case format.EventLeftButtonUp:
+        return MOUSEEVENTF_LEFTUP, 0
+    case format.EventRightButtonDown:
+        return MOUSEEVENTF_RIGHTDOWN, 0
+    case format.EventRightButtonUp:
+        return MOUSEEVENTF_RIGHTUP, 0
+    case format.EventMiddleButtonDown:
+        return MOUSEEVENTF_MIDDLEDOWN, 0
+    case format.EventMiddleButtonUp:
+        return MOUSEEVENTF_MIDDLEUP, 0
+    case format.EventMouseWheel:
+        // Recordings hold the hook's raw high word, so a downward scroll of
+        // -120 is 65416; sign-extend it back.
+        return MOUSEEVENTF_WHEEL, uint32(int32(int16(uint16(data))))
+    case format.EventMouseHWheel:
+        return MOUSEEVENTF_HWHEEL, uint32(int32(int16(uint16(data))))
+    case format.EventMouse4Down:
+        return MOUSEEVENTF_XDOWN, XBUTTON1
+    case format.EventMouse4Up:
+        return MOUSEEVENTF_XUP, XBUTTON1
+    case format.EventMouse5Down:
+        return MOUSEEVENTF_XDOWN, XBUTTON2
+    case format.EventMouse5Up:
+        return MOUSEEVENTF_XUP, XBUTTON2
+    }
+    return 0, 0
+}
+
+// IsKey reports whether rec is a key or text record.
+func IsKey(rec format.Record) bool {
+    return rec.Event == format.EventKeyDown || rec.Event == format.EventKeyUp || rec.Event == format.EventText
+}
+
+// KnownEvent reports whether a Player knows how to replay rec.
+func KnownEvent(rec format.Record) bool {
+    if rec.Event == format.EventMouseMove || IsKey(rec) || IsWaitStep(rec) || IsCheckStep(rec) {
+        return true
+    }
+    flags, _ := MouseFlags(rec.Event, rec.Data)
+    return flags != 0
+}
+
+// keyInputs builds the SendInput events for a key or text record: keys by
+// scan code, so they reach games and press the same physical key on any
+// layout, and text as Unicode characters.
+func keyInputs(rec format.Record) ([]keyboardInput, error) {
+    if rec.Key == nil {
+        return nil, fmt.Errorf("%s record has no Key", rec.Event)
+    }
+    if rec.Event == format.EventText {
+        var inputs []keyboardInput
+        for _, unit := range utf16.Encode([]rune(rec.Key.Text)) {
+            for _, flags := range []uint32{KEYEVENTF_UNICODE, KEYEVENTF_UNICODE | KEYEVENTF_KEYUP} {
+                inputs = append(inputs, keyboardInput{
+                    Type: INPUT_KEYBOARD,
+                    Ki:   KEYBDINPUT{WScan: unit, DwFlags: flags},
+                })
+            }
+        }
+        return inputs, nil
+    }
+
+    scan, extended := ScanCode(rec.Key)
+    if scan == 0 {
+        return nil, fmt.Errorf("%s record has neither Scan nor a mappable VK", rec.Event)
+    }
+    flags := uint32(KEYEVENTF_SCANCODE)
+    if extended {
+        flags |= KEYEVENTF_EXTENDEDKEY
+    }
+    if rec.Event == format.EventKeyUp {
+        flags |= KEYEVENTF_KEYUP
+    }
+    return []keyboardInput{{
+        Type: INPUT_KEYBOARD,
+        Ki:   KEYBDINPUT{WScan: scan, DwFlags: flags},
+    }}, nil
+}
+
+// ScanCode returns k's scan code and whether it is an extended key,
+// looking it up from VK if the record didn't carry one.
+func ScanCode(k *format.KeyStroke) (uint16, bool) {
+    if k.Scan != 0 || k.VK == 0 {
+        return k.Scan, k.Extended
+    }
+    sc, _, _ := procMapVirtualKeyW.Call(uintptr(k.VK), MAPVK_VK_TO_VSC_EX)
+    return uint16(sc & 0xFF), sc&0xFF00 == 0xE000
+}
+
+// NormalizeAbsolute converts a virtual-screen pixel into the 0..65535 range
+// SendInput expects with MOUSEEVENTF_VIRTUALDESK. The origin of the
+// virtual screen is negative when a monitor sits left of or above the
+// primary one, so positions are taken relative to it.
+//
+// Windows maps a normalized n back to origin + n*size/65536, rounding
+// down, so n is rounded up here to land on the exact pixel instead of one
+// short of it on the far side of large desktops.
+func NormalizeAbsolute(x, y int32, vs format.ScreenBounds) (int32, int32) {
+    norm := func(v, origin, size int32) int32 {
+        if size <= 1 {
+            return 0
+        }
+        rel := int64(v - origin)
+        if rel <= 0 {
+            return 0
+        }
+        if rel >= int64(size) {
+            return 65535
+        }
+        n := (rel*65536 + int64(size) - 1) / int64(size)
+        if n > 65535 {
+            n = 65535
+        }
+        return int32(n)
+    }
+    return norm(x, vs.X, vs.Width), norm(y, vs.Y, vs.Height)
+}
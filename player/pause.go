@@ -0,0 +1,138 @@
+// +build windows
+
+package player
+
+import (
+    "context"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// Pause suspends the running replay before its next event. Buttons and
+// keys the replay holds are released while paused and pressed again on
+// Resume. It returns false if the player was already paused.
+func (p *Player) Pause() bool {
+    r := p.root()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.resumed != nil {
+        return false
+    }
+    r.resumed = make(chan struct{})
+    return true
+}
+
+// Resume continues a paused replay. It returns false if the player wasn't
+// paused.
+func (p *Player) Resume() bool {
+    r := p.root()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.resumed == nil {
+        return false
+    }
+    close(r.resumed)
+    r.resumed = nil
+    return true
+}
+
+// Paused reports whether the player is paused.
+func (p *Player) Paused() bool {
+    r := p.root()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.resumed != nil
+}
+
+// pauseGate returns a channel that is closed on Resume, or nil when the
+// player isn't paused.
+func (p *Player) pauseGate() <-chan struct{} {
+    r := p.root()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.resumed
+}
+
+// waitIfPaused blocks while the player is paused, with everything the
+// replay holds released, and moves the timeline back by the time spent.
+func (run *replayRun) waitIfPaused(ctx context.Context, tl *timeline) error {
+    gate := run.p.pauseGate()
+    if gate == nil {
+        return nil
+    }
+    start := time.Now()
+    run.p.opts.OnPause(true)
+
+    buttons := make(HeldButtons)
+    for up := range run.held {
+        buttons[up] = true
+    }
+    keys := make(heldKeys)
+    for scan, key := range run.keys {
+        keys[scan] = key
+    }
+    if !run.p.opts.DryRun {
+        run.held.releaseAll(run.inj, run.p.opts.Logf)
+        run.keys.releaseAll(run.inj, run.p.opts.Logf)
+    }
+
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-gate:
+    }
+    run.p.opts.OnPause(false)
+
+    if !run.p.opts.DryRun {
+        if err := run.repress(buttons, keys); err != nil {
+            return err
+        }
+    }
+    tl.shift(time.Since(start))
+    return nil
+}
+
+// repress presses again what waitIfPaused released, buttons at the last
+// replayed position.
+func (run *replayRun) repress(buttons HeldButtons, keys heldKeys) error {
+    for _, b := range Buttons {
+        if !buttons[b.Up] {
+            continue
+        }
+        rec := format.Record{X: run.pos.X, Y: run.pos.Y, Event: b.Down}
+        if err := run.inj.Inject(rec); err != nil {
+            return err
+        }
+        run.held.Track(rec.Event)
+    }
+    for _, key := range keys {
+        key := key
+        rec := format.Record{Event: format.EventKeyDown, Key: &key}
+        if err := run.inj.Inject(rec); err != nil {
+            return err
+        }
+        run.keys.track(rec)
+    }
+    return nil
+}
+
+// Step lets a replay in step mode inject its next event. Steps made
+// before the replay asks for them are remembered.
+func (p *Player) Step() {
+    select {
+    case p.root().steps <- struct{}{}:
+    default:
+    }
+}
+
+// waitForStep reports record i and blocks until Step is called.
+func (run *replayRun) waitForStep(ctx context.Context, i int, rec format.Record) error {
+    run.p.opts.OnStep(i, rec)
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-run.p.root().steps:
+        return nil
+    }
+}
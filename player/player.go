@@ -0,0 +1,611 @@
+// +build windows
+
+// Package player replays a format.Recording. It is the replay engine of
+// mrr: positions are adapted to the current screen, its DPI and the
+// target window, the recording can be sliced, reversed, mirrored, looped
+// and sped up or down along the way, and wait and check steps watch the
+// screen. Input goes out with SendInput unless Options picks another
+// Injector. Buttons and keys still held when a replay ends, finished or
+// cancelled, are let go.
+//
+// Play replays a recording once; a Player can also be paused, stepped and
+// sped up while it runs.
+//
+// As with package recorder, positions are physical pixels, so the process
+// should be per-monitor DPI aware; see desktop.EnableDPIAwareness.
+package player
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "math/rand"
+    "sync"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// CursorEnd decides where the cursor is left once a replay ends.
+type CursorEnd int
+
+const (
+    // CursorLeave leaves the cursor wherever the recording put it.
+    CursorLeave CursorEnd = iota
+    // CursorRestore puts the cursor back where it was before the replay.
+    CursorRestore
+    // CursorPark moves the cursor to Options.Park.
+    CursorPark
+)
+
+// Options configures a Player. The zero value replays a recording exactly
+// as it was captured, with SendInput.
+type Options struct {
+    CursorEnd CursorEnd
+    Park      desktop.Point
+
+    // NoDPIScale replays coordinates as recorded even when the monitor
+    // DPI differs from the one stored in the recording.
+    NoDPIScale bool
+
+    // Rescale adapts coordinates when the recording's screen differs from
+    // the current one; Anchor places the letterboxed area for RescaleFit
+    // (the zero Anchor is the top-left corner).
+    Rescale RescaleMode
+    Anchor  Anchor
+
+    // Speed divides every recorded delay; 2 plays twice as fast. Zero
+    // means 1.
+    Speed float64
+
+    // Loop is how many times the recording is played; 0 and 1 both play
+    // it once and LoopForever repeats until the replay is aborted.
+    // LoopDelay is the pause between two iterations.
+    Loop      int
+    LoopDelay time.Duration
+
+    // InterpolateHz fills gaps between recorded positions with generated
+    // moves at this rate (moves per second). Zero disables it.
+    InterpolateHz float64
+
+    // Slice replays only part of the recording.
+    Slice Slice
+
+    // Reverse plays the recording backwards, swapping button downs and ups.
+    Reverse bool
+
+    // NoFailsafe disables aborting the replay when the user slams the
+    // cursor into a screen corner.
+    NoFailsafe bool
+
+    // DryRun walks the recording with real timing but injects nothing;
+    // OnDryRun hears about every record instead.
+    DryRun bool
+
+    // LoopStep shifts each loop iteration further than the last: pass k
+    // (from 0) is offset by k times LoopStep, e.g. to click the next row
+    // of a list every time.
+    LoopStep desktop.Point
+
+    // SpeedProfile varies the speed along the recording, e.g. to play
+    // a fragile start slowly. It multiplies Speed.
+    SpeedProfile SpeedProfile
+
+    // Mirror flips positions around the screen's middle or a given axis.
+    Mirror Mirror
+
+    // Offset shifts every position by a fixed delta, after any rescaling
+    // and mirroring.
+    Offset desktop.Point
+
+    // Verify reads the cursor back after every positioning event and
+    // fails the replay if it is more than VerifyTolerance pixels off.
+    Verify          bool
+    VerifyTolerance int32
+
+    // Step injects one event per Step call instead of following the
+    // recorded timing.
+    Step bool
+
+    // Teleport skips plain mouse moves and their timing, jumping the
+    // cursor straight to each click. Drags are kept.
+    Teleport bool
+
+    // TargetWindow re-anchors the recording onto the client area of the
+    // first visible window whose title contains it. Foreground brings that
+    // window to the front first.
+    TargetWindow string
+    Foreground   bool
+
+    // BackgroundWindow (experimental) posts mouse messages straight to
+    // the first window whose title contains it, instead of moving the
+    // real cursor, so the mouse stays usable while the replay runs. It
+    // takes precedence over Injector.
+    BackgroundWindow string
+
+    // Injector delivers the records; nil means SendInput.
+    Injector Injector
+
+    // Humanize perturbs timing and bends the path between recorded points.
+    Humanize HumanizeOptions
+
+    // Delays randomizes every event's delay, either relative to the
+    // recorded value or within a fixed range.
+    Delays DelayRange
+
+    // Seed makes the random parts of a replay reproducible. Zero picks a
+    // fresh seed for every replay.
+    Seed int64
+
+    // The callbacks below follow a replay; each is optional and runs on
+    // the replaying goroutine.
+
+    // Logf receives diagnostics, without a trailing newline.
+    Logf func(format string, args ...interface{})
+    // OnProgress is called after every record.
+    OnProgress func(progress Progress)
+    // OnPause is called with true when the replay stops for Pause and
+    // with false when Resume lets it go on.
+    OnPause func(paused bool)
+    // OnStep is called in step mode before record i waits for its Step.
+    OnStep func(i int, rec format.Record)
+    // OnRetry is called when check step i failed with detail and the n
+    // records before it are replayed again, for the attempt-th of
+    // retries times.
+    OnRetry func(i int, detail string, n, attempt, retries int)
+    // OnDryRun is called in dry-run mode for every record in place of
+    // injecting it. what describes wait and check steps and is empty
+    // for input.
+    OnDryRun func(i int, rec format.Record, what string)
+}
+
+// HumanizeOptions controls the humanization layer. The zero value turns it
+// off.
+type HumanizeOptions struct {
+    // TimingJitter scales each delay by a random factor within
+    // 1±TimingJitter, e.g. 0.15 for ±15%.
+    TimingJitter float64
+    // Curve bends jumps between recorded points into curves whose
+    // sideways offset is up to Curve times the jump length.
+    Curve float64
+}
+
+// DelayRange replaces recorded delays with random ones. The zero value
+// keeps them. Percent and an explicit Min/Max are mutually exclusive; Max
+// set means the explicit range wins.
+type DelayRange struct {
+    // Percent varies each delay within ±Percent of its recorded value,
+    // e.g. 20 for ±20%.
+    Percent float64
+    // Min and Max pick each delay uniformly from [Min, Max].
+    Min, Max time.Duration
+}
+
+// LoopForever makes a replay repeat until its context is cancelled.
+const LoopForever = -1
+
+// Player replays recordings. Its methods may be called from any
+// goroutine while Replay runs.
+type Player struct {
+    opts Options
+
+    // parent is the player this one was made from by With; pausing,
+    // stepping and progress go through the root player.
+    parent *Player
+
+    mu       sync.Mutex
+    speed    float64
+    progress *Progress
+    // resumed is non-nil while paused and closed on Resume.
+    resumed chan struct{}
+    // steps carries Step calls to a replay in step mode.
+    steps chan struct{}
+}
+
+// New returns a Player using opts.
+func New(opts Options) *Player {
+    if opts.Logf == nil {
+        opts.Logf = func(string, ...interface{}) {}
+    }
+    if opts.OnProgress == nil {
+        opts.OnProgress = func(Progress) {}
+    }
+    if opts.OnPause == nil {
+        opts.OnPause = func(bool) {}
+    }
+    if opts.OnStep == nil {
+        opts.OnStep = func(int, format.Record) {}
+    }
+    if opts.OnRetry == nil {
+        opts.OnRetry = func(int, string, int, int, int) {}
+    }
+    if opts.OnDryRun == nil {
+        opts.OnDryRun = func(int, format.Record, string) {}
+    }
+
+    p := &Player{opts: opts, steps: make(chan struct{}, 64)}
+    p.SetSpeed(opts.Speed)
+    return p
+}
+
+// With returns a player with different options that shares p's pause
+// state, steps and progress, e.g. for one item of a playlist. Its
+// opts.Speed is relative to p's speed, so speed changes on p still reach
+// it.
+func (p *Player) With(opts Options) *Player {
+    child := New(opts)
+    child.parent = p
+    return child
+}
+
+func (p *Player) root() *Player {
+    for p.parent != nil {
+        p = p.parent
+    }
+    return p
+}
+
+// SetSpeed changes the speed multiplier. It takes effect from the next
+// event, so it can be used while a replay is running. Values <= 0 reset
+// the speed to 1.
+func (p *Player) SetSpeed(speed float64) {
+    if speed <= 0 {
+        speed = 1
+    }
+    p.mu.Lock()
+    p.speed = speed
+    p.mu.Unlock()
+}
+
+// Speed returns the current speed multiplier.
+func (p *Player) Speed() float64 {
+    p.mu.Lock()
+    speed := p.speed
+    p.mu.Unlock()
+    if p.parent != nil {
+        speed *= p.parent.Speed()
+    }
+    return speed
+}
+
+// Result describes what a replay did. It is returned even when the replay
+// fails so callers can see how far it got.
+type Result struct {
+    EventsInjected int               `json:"EventsInjected"`
+    EventsTotal    int               `json:"EventsTotal"`
+    Iterations     int               `json:"Iterations"`
+    DurationMS     int64             `json:"DurationMS"`
+    Drift          DriftStats        `json:"Drift"`
+    Assertions     []AssertionResult `json:"Assertions,omitempty"`
+    Verify         *VerifyReport     `json:"Verify,omitempty"`
+    // ResumeIndex is the first record, in the recording's numbering, that
+    // a failed replay didn't play.
+    ResumeIndex int    `json:"ResumeIndex,omitempty"`
+    AbortReason string `json:"AbortReason,omitempty"`
+    Error       string `json:"Error,omitempty"`
+}
+
+// DriftStats measures how late events were injected compared to the
+// recorded timeline, in milliseconds.
+type DriftStats struct {
+    MaxMS   float64 `json:"MaxMS"`
+    MeanMS  float64 `json:"MeanMS"`
+    FinalMS float64 `json:"FinalMS"`
+}
+
+// AssertionResult is the outcome of one check made during replay.
+type AssertionResult struct {
+    Index  int    `json:"Index"`
+    Kind   string `json:"Kind"`
+    Passed bool   `json:"Passed"`
+    Detail string `json:"Detail,omitempty"`
+}
+
+// Play replays recording with a new Player until it ends or ctx is done,
+// in which case it returns ctx's error along with how far it got.
+func Play(ctx context.Context, recording *format.Recording, opts Options) (*Result, error) {
+    return New(opts).Replay(ctx, recording)
+}
+
+// replayRun is the state of a single Replay call.
+type replayRun struct {
+    p        *Player
+    result   *Result
+    held     HeldButtons
+    keys     heldKeys
+    inj      Injector
+    timer    *preciseTimer
+    last     lastInjected
+    driftSum float64
+    tracker  progressTracker
+    // pos is the last position replayed.
+    pos desktop.Point
+}
+
+// Replay injects the recording's records with their recorded timing, as
+// many times as the Loop option asks for. It stops as soon as ctx is
+// cancelled or its deadline passes and returns ctx.Err(), or
+// ErrFailsafe when the failsafe aborted it.
+func (p *Player) Replay(ctx context.Context, recording *format.Recording) (*Result, error) {
+    records, err := p.prepare(recording)
+    if err != nil {
+        return &Result{Error: err.Error()}, err
+    }
+    inj, err := p.injector()
+    if err != nil {
+        return &Result{Error: err.Error()}, err
+    }
+    // Posted messages reach windows on a locked desktop; SendInput doesn't.
+    if _, ok := inj.(sendInputInjector); ok && !p.opts.DryRun {
+        if err := desktop.CheckInputDesktop(); err != nil {
+            return &Result{Error: err.Error()}, err
+        }
+    }
+
+    run := &replayRun{
+        p:      p,
+        result: &Result{EventsTotal: len(records) - countSteps(records)},
+        held:   make(HeldButtons),
+        keys:   make(heldKeys),
+        inj:    inj,
+    }
+    result := run.result
+    origin, _ := desktop.CursorPos()
+    defer p.restore(origin, run)
+
+    ctx, abort := context.WithCancelCause(ctx)
+    defer abort(nil)
+    run.last.set(origin.X, origin.Y)
+    if !p.opts.NoFailsafe && !p.opts.DryRun {
+        go watchFailsafe(ctx, &run.last, abort, p.opts.Logf)
+    }
+
+    run.timer = newPreciseTimer(p.opts.Logf)
+    defer run.timer.Close()
+
+    start := time.Now()
+    if p.opts.Verify && inj.MovesCursor() && !p.opts.DryRun {
+        result.Verify = &VerifyReport{}
+    }
+
+    finish := func(err error) (*Result, error) {
+        run.endProgress()
+        err = run.verifyOutcome(err)
+        result.DurationMS = time.Since(start).Milliseconds()
+        if result.EventsInjected > 0 {
+            result.Drift.MeanMS = run.driftSum / float64(result.EventsInjected)
+        }
+        if err == nil {
+            result.ResumeIndex = 0
+        } else {
+            if ctx.Err() != nil {
+                err = context.Cause(ctx)
+                result.AbortReason = err.Error()
+            }
+            result.Error = err.Error()
+        }
+        return result, err
+    }
+
+    for iter := 0; p.opts.Loop == LoopForever || iter < p.opts.Loop || iter == 0; iter++ {
+        if iter > 0 {
+            p.opts.Logf("starting loop iteration %d", iter+1)
+            if err := sleepContext(ctx, p.opts.LoopDelay); err != nil {
+                return finish(err)
+            }
+        }
+        iterRecords := forIteration(records, iter, p.opts.LoopStep)
+        run.tracker.begin(iter+1, iterRecords)
+        if err := run.playOnce(ctx, iterRecords); err != nil {
+            return finish(err)
+        }
+        result.Iterations++
+    }
+
+    return finish(nil)
+}
+
+// playOnce injects records a single time, adding to the result as it goes.
+func (run *replayRun) playOnce(ctx context.Context, records []format.Record) error {
+    tl := newTimeline(run.timer)
+
+    var at time.Duration // position on the recorded timeline
+    segStart := 0        // first record after the last check step
+    for i, rec := range records {
+        run.result.ResumeIndex = rec.Source
+        if run.p.opts.Step {
+            // Stepping replaces the recorded delays.
+            if err := run.waitForStep(ctx, i, rec); err != nil {
+                return err
+            }
+            tl.restart()
+        } else if i != 0 {
+            speed := run.p.Speed() * run.p.opts.SpeedProfile.at(at)
+            at += time.Duration(rec.DeltaMS) * time.Millisecond
+            delay := time.Duration(float64(rec.DeltaMS) / speed * float64(time.Millisecond))
+            if err := tl.wait(ctx, delay); err != nil {
+                return err
+            }
+        } else if err := ctx.Err(); err != nil {
+            return err
+        }
+        if err := run.waitIfPaused(ctx, tl); err != nil {
+            return err
+        }
+
+        if IsCheckStep(rec) {
+            start := time.Now()
+            if err := run.check(ctx, i, rec, records[segStart:i]); err != nil {
+                return err
+            }
+            tl.shift(time.Since(start))
+            segStart = i + 1
+            run.progress(i+1, records)
+            continue
+        }
+        if IsWaitStep(rec) {
+            // Later events keep their spacing relative to the end of the
+            // wait rather than rushing to catch up.
+            start := time.Now()
+            if err := run.waitFor(ctx, i, rec); err != nil {
+                return err
+            }
+            tl.shift(time.Since(start))
+            run.progress(i+1, records)
+            continue
+        }
+
+        drift := float64(tl.lateness()) / float64(time.Millisecond)
+        run.driftSum += drift
+        run.result.Drift.MaxMS = math.Max(run.result.Drift.MaxMS, drift)
+        run.result.Drift.FinalMS = drift
+
+        if err := run.inject(i, rec); err != nil {
+            return err
+        }
+        run.result.EventsInjected++
+        run.progress(i+1, records)
+    }
+    return nil
+}
+
+// inject performs record i, or only reports it in dry-run mode.
+func (run *replayRun) inject(i int, rec format.Record) error {
+    if run.p.opts.DryRun {
+        run.p.opts.OnDryRun(i, rec, "")
+        return nil
+    }
+    if Positional(rec) {
+        run.pos = desktop.Point{X: rec.X, Y: rec.Y}
+        if run.inj.MovesCursor() {
+            run.last.set(rec.X, rec.Y)
+        }
+    }
+    if err := run.inj.Inject(rec); err != nil {
+        return err
+    }
+    if run.result.Verify != nil && Positional(rec) {
+        run.verify(i, rec)
+    }
+    run.held.Track(rec.Event)
+    run.keys.track(rec)
+    return nil
+}
+
+// injector picks how records reach their target for this replay.
+func (p *Player) injector() (Injector, error) {
+    if p.opts.BackgroundWindow != "" {
+        return newMessageInjector(p.opts.BackgroundWindow)
+    }
+    if p.opts.Injector != nil {
+        return p.opts.Injector, nil
+    }
+    return SendInput, nil
+}
+
+// prepare returns the records to inject, with coordinates adapted to the
+// current machine. The recording itself is left untouched.
+func (p *Player) prepare(recording *format.Recording) ([]format.Record, error) {
+    records := append([]format.Record(nil), recording.Records...)
+    for i, rec := range records {
+        records[i].Source = i
+        if !KnownEvent(rec) {
+            return nil, fmt.Errorf("record %d: unknown event %q", i, rec.Event)
+        }
+    }
+    if !p.opts.NoDPIScale {
+        rescaleDPI(records, recording.DPISegments, p.opts.Logf)
+    }
+    // Slice after DPI scaling: segments refer to the original indexes.
+    records = sliceRecords(records, p.opts.Slice)
+    if len(records) == 0 {
+        return nil, fmt.Errorf("nothing to replay in the selected range")
+    }
+    if p.opts.Reverse {
+        records = reverseRecords(records)
+    }
+    if p.opts.Teleport {
+        records = teleport(records)
+        if len(records) == 0 {
+            return nil, fmt.Errorf("nothing to replay: the recording has no clicks")
+        }
+    }
+
+    var recordedWindow *format.WindowInfo
+    if recording.Metadata != nil {
+        recordedWindow = recording.Metadata.Window
+    }
+    if p.opts.TargetWindow != "" {
+        // Window-relative positions don't depend on the screen size.
+        if err := anchorToWindow(records, recordedWindow, p.opts.TargetWindow, p.opts.Foreground, p.opts.Logf); err != nil {
+            return nil, err
+        }
+    } else if p.opts.BackgroundWindow != "" {
+        // Without a window reference the recorded screen positions are
+        // translated into the window as they are.
+        if recordedWindow != nil {
+            if err := anchorToWindow(records, recordedWindow, p.opts.BackgroundWindow, false, p.opts.Logf); err != nil {
+                return nil, err
+            }
+        }
+    } else if recording.Metadata != nil {
+        rescaleScreen(records, recording.Metadata.Screen, desktop.VirtualScreen(), p.opts.Rescale, p.opts.Anchor, p.opts.Logf)
+    }
+
+    mirrorRecords(records, p.opts.Mirror, desktop.VirtualScreen())
+    offsetRecords(records, p.opts.Offset)
+
+    rng := p.rand()
+    records = curvePaths(records, p.opts.Humanize.Curve, p.opts.InterpolateHz, rng)
+    records = interpolate(records, p.opts.InterpolateHz)
+    jitterTimings(records, p.opts.Humanize.TimingJitter, rng)
+    randomizeDelays(records, p.opts.Delays, rng)
+    return records, nil
+}
+
+// rand returns the random source for one replay.
+func (p *Player) rand() *rand.Rand {
+    seed := p.opts.Seed
+    if seed == 0 {
+        seed = time.Now().UnixNano()
+    }
+    p.opts.Logf("replay seed %d", seed)
+    return rand.New(rand.NewSource(seed))
+}
+
+// restore releases any button the replay left pressed and puts the cursor
+// where the options ask for.
+func (p *Player) restore(origin desktop.Point, run *replayRun) {
+    if p.opts.DryRun {
+        return
+    }
+    run.held.releaseAll(run.inj, p.opts.Logf)
+    run.keys.releaseAll(run.inj, p.opts.Logf)
+    if !run.inj.MovesCursor() {
+        return
+    }
+
+    switch p.opts.CursorEnd {
+    case CursorRestore:
+        desktop.SetCursorPos(origin.X, origin.Y)
+    case CursorPark:
+        desktop.SetCursorPos(p.opts.Park.X, p.opts.Park.Y)
+    }
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+    if d <= 0 {
+        return ctx.Err()
+    }
+    t := time.NewTimer(d)
+    defer t.Stop()
+
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
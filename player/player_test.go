@@ -0,0 +1,279 @@
+// +build windows
+
+package player
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+func TestKnownEvent(t *testing.T) {
+    for _, c := range []struct {
+        rec   format.Record
+        known bool
+    }{
+        {format.Record{Event: format.EventMouseMove}, true},
+        {format.Record{Event: format.EventMouse5Up}, true},
+        {format.Record{Event: format.EventText}, true},
+        {format.Record{Event: format.EventWaitPixel}, true},
+        {format.Record{Event: format.EventAssertRegion}, true},
+        {format.Record{Event: "LeftButonDown"}, false},
+    } {
+        if got := KnownEvent(c.rec); got != c.known {
+            t.Errorf("KnownEvent(%s) = %t", c.rec.Event, got)
+        }
+    }
+}
+
+func TestPrepareRefusesUnknownEvents(t *testing.T) {
+    recording := &format.Recording{Records: []format.Record{{Event: format.EventMouseMove}, {Event: "LeftButonDown"}}}
+    if _, err := Play(context.Background(), recording, Options{DryRun: true}); err == nil || !strings.Contains(err.Error(), "record 1") {
+        t.Errorf("Play = %v, want an unknown event error for record 1", err)
+    }
+}
+
+func TestSliceRecords(t *testing.T) {
+    records := []format.Record{
+        {DeltaMS: 100, X: 0}, {DeltaMS: 100, X: 1}, {DeltaMS: 100, X: 2}, {DeltaMS: 100, X: 3},
+    }
+    got := sliceRecords(records, Slice{From: 100 * time.Millisecond, To: 200 * time.Millisecond})
+    if len(got) != 2 || got[0].X != 1 || got[0].DeltaMS != 0 || got[1].X != 2 {
+        t.Errorf("sliceRecords(100ms-200ms) = %+v", got)
+    }
+    if got := sliceRecords(records, Slice{First: 3}); len(got) != 1 || got[0].X != 3 {
+        t.Errorf("sliceRecords(3:) = %+v", got)
+    }
+}
+
+func TestReverseRecords(t *testing.T) {
+    records := []format.Record{
+        {DeltaMS: 10, Event: format.EventLeftButtonDown},
+        {DeltaMS: 20, Event: format.EventMouseMove},
+        {DeltaMS: 30, Event: format.EventLeftButtonUp},
+        {DeltaMS: 40, Event: format.EventMouseWheel, Data: 120},
+    }
+    got := reverseRecords(records)
+    want := []format.Record{
+        {DeltaMS: 0, Event: format.EventMouseWheel, Data: -120},
+        {DeltaMS: 40, Event: format.EventLeftButtonDown},
+        {DeltaMS: 30, Event: format.EventMouseMove},
+        {DeltaMS: 20, Event: format.EventLeftButtonUp},
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Errorf("reversed record %d = %+v, want %+v", i, got[i], want[i])
+        }
+    }
+}
+
+func TestSpeedProfile(t *testing.T) {
+    sp := SpeedProfile{
+        {At: 0, Speed: 0.5},
+        {At: 10 * time.Second, Speed: 1.5, Ramp: true},
+        {At: 20 * time.Second, Speed: 3},
+    }
+    for _, c := range []struct {
+        at    time.Duration
+        speed float64
+    }{
+        {0, 0.5},
+        {5 * time.Second, 1},
+        {10 * time.Second, 1.5},
+        {19 * time.Second, 1.5},
+        {time.Minute, 3},
+    } {
+        if got := sp.at(c.at); got != c.speed {
+            t.Errorf("speed at %v = %g, want %g", c.at, got, c.speed)
+        }
+    }
+    if got := SpeedProfile(nil).at(time.Second); got != 1 {
+        t.Errorf("empty profile speed = %g, want 1", got)
+    }
+}
+
+func TestRescaleScreen(t *testing.T) {
+    from := format.ScreenBounds{Width: 1000, Height: 500}
+    to := format.ScreenBounds{Width: 2000, Height: 2000}
+    nolog := func(string, ...interface{}) {}
+
+    fit := []format.Record{{X: 500, Y: 250}}
+    rescaleScreen(fit, from, to, RescaleFit, AnchorCenter, nolog)
+    if fit[0].X != 1000 || fit[0].Y != 1000 {
+        t.Errorf("fit = %d,%d, want 1000,1000", fit[0].X, fit[0].Y)
+    }
+
+    stretch := []format.Record{{X: 500, Y: 250}}
+    rescaleScreen(stretch, from, to, RescaleStretch, Anchor{}, nolog)
+    if stretch[0].X != 1000 || stretch[0].Y != 1000 {
+        t.Errorf("stretch = %d,%d, want 1000,1000", stretch[0].X, stretch[0].Y)
+    }
+
+    topLeft := []format.Record{{X: 0, Y: 0}}
+    rescaleScreen(topLeft, from, to, RescaleFit, Anchor{}, nolog)
+    if topLeft[0].X != 0 || topLeft[0].Y != 0 {
+        t.Errorf("fit at the top left = %d,%d, want 0,0", topLeft[0].X, topLeft[0].Y)
+    }
+}
+
+func TestForIteration(t *testing.T) {
+    records := []format.Record{
+        {X: 10, Y: 10, Event: format.EventLeftButtonDown},
+        {Event: format.EventText, Key: &format.KeyStroke{Text: "row {i} of {i0}"}},
+    }
+    got := forIteration(records, 2, desktop.Point{Y: 24})
+    if got[0].Y != 58 || got[1].Key.Text != "row 3 of 2" {
+        t.Errorf("forIteration = %+v, %q", got[0], got[1].Key.Text)
+    }
+    if records[0].Y != 10 || records[1].Key.Text != "row {i} of {i0}" {
+        t.Error("forIteration changed its input")
+    }
+}
+
+func TestMouseFlagsWheel(t *testing.T) {
+    // A downward notch as the hook records it.
+    flags, data := MouseFlags(format.EventMouseWheel, 65416)
+    if flags != MOUSEEVENTF_WHEEL || int32(data) != -120 {
+        t.Errorf("MouseFlags = %#x, %d, want MOUSEEVENTF_WHEEL, -120", flags, int32(data))
+    }
+}
+
+func TestMouseFlagsButtons(t *testing.T) {
+    for _, c := range []struct {
+        event     string
+        flags     uint32
+        mouseData uint32
+    }{
+        {format.EventLeftButtonDown, MOUSEEVENTF_LEFTDOWN, 0},
+        {format.EventRightButtonUp, MOUSEEVENTF_RIGHTUP, 0},
+        {format.EventMouse4Down, MOUSEEVENTF_XDOWN, XBUTTON1},
+        {format.EventMouse5Up, MOUSEEVENTF_XUP, XBUTTON2},
+        {format.EventMouseMove, 0, 0},
+        {"LeftButonDown", 0, 0},
+    } {
+        if flags, data := MouseFlags(c.event, 0); flags != c.flags || data != c.mouseData {
+            t.Errorf("MouseFlags(%s) = %#x, %d, want %#x, %d", c.event, flags, data, c.flags, c.mouseData)
+        }
+    }
+}
+
+func TestKeyInputs(t *testing.T) {
+    inputs, err := keyInputs(format.Record{Event: format.EventKeyUp, Key: &format.KeyStroke{Scan: 0x4B, Extended: true}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := uint32(KEYEVENTF_SCANCODE | KEYEVENTF_EXTENDEDKEY | KEYEVENTF_KEYUP)
+    if len(inputs) != 1 || inputs[0].Ki.WScan != 0x4B || inputs[0].Ki.DwFlags != want {
+        t.Errorf("keyInputs(extended KeyUp) = %+v, want scan 0x4B, flags %#x", inputs, want)
+    }
+
+    // Characters outside the BMP are two UTF-16 units, each pressed and
+    // released.
+    inputs, err = keyInputs(format.Record{Event: format.EventText, Key: &format.KeyStroke{Text: "é😀"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(inputs) != 6 || inputs[0].Ki.WScan != 0xE9 || inputs[1].Ki.DwFlags != KEYEVENTF_UNICODE|KEYEVENTF_KEYUP {
+        t.Errorf("keyInputs(Text) = %+v", inputs)
+    }
+
+    if _, err := keyInputs(format.Record{Event: format.EventKeyDown}); err == nil {
+        t.Error("keyInputs accepted a key record without Key")
+    }
+}
+
+func TestNormalizeAbsolute(t *testing.T) {
+    // The primary monitor is 1920x1080 at 0,0 with a second one beside it.
+    var (
+        left      = format.ScreenBounds{X: -1920, Y: 0, Width: 3840, Height: 1080}
+        right     = format.ScreenBounds{X: 0, Y: 0, Width: 3840, Height: 1080}
+        above     = format.ScreenBounds{X: 0, Y: -1080, Width: 1920, Height: 2160}
+        below     = format.ScreenBounds{X: 0, Y: 0, Width: 1920, Height: 2160}
+        leftAbove = format.ScreenBounds{X: -2560, Y: -360, Width: 4480, Height: 1440}
+    )
+    for _, c := range []struct {
+        name         string
+        vs           format.ScreenBounds
+        x, y, nx, ny int32
+    }{
+        {"left: its first pixel", left, -1920, 0, 0, 0},
+        {"left: primary origin", left, 0, 0, 32768, 0},
+        {"left: last pixel left of the primary", left, -1, 1079, 32751, 65476},
+        {"left: last pixel on the right edge", left, 1919, 0, 65519, 0},
+        {"left: last pixel", left, 1919, 1079, 65519, 65476},
+
+        {"right: primary origin", right, 0, 0, 0, 0},
+        {"right: last pixel of the primary", right, 1919, 1079, 32751, 65476},
+        {"right: last pixel on the right edge", right, 3839, 0, 65519, 0},
+        {"right: last pixel", right, 3839, 1079, 65519, 65476},
+
+        {"above: its first pixel", above, 0, -1080, 0, 0},
+        {"above: primary origin", above, 0, 0, 0, 32768},
+        {"above: last pixel above the primary", above, 1919, -1, 65502, 32738},
+        {"above: last pixel on the bottom edge", above, 0, 1079, 0, 65506},
+        {"above: last pixel", above, 1919, 1079, 65502, 65506},
+
+        {"below: primary origin", below, 0, 0, 0, 0},
+        {"below: last pixel of the primary", below, 1919, 1079, 65502, 32738},
+        {"below: last pixel on the bottom edge", below, 0, 2159, 0, 65506},
+        {"below: last pixel", below, 1919, 2159, 65502, 65506},
+
+        {"left and above: its first pixel", leftAbove, -2560, -360, 0, 0},
+        {"left and above: primary origin", leftAbove, 0, 0, 37450, 16384},
+        {"left and above: last pixel before the primary", leftAbove, -1, -1, 37435, 16339},
+        {"left and above: last pixel", leftAbove, 1919, 1079, 65522, 65491},
+
+        {"off the virtual screen", left, 5000, -5000, 65535, 0},
+        {"empty virtual screen", format.ScreenBounds{}, 100, 100, 0, 0},
+    } {
+        nx, ny := NormalizeAbsolute(c.x, c.y, c.vs)
+        if nx != c.nx || ny != c.ny {
+            t.Errorf("%s: NormalizeAbsolute(%d, %d) = %d, %d, want %d, %d", c.name, c.x, c.y, nx, ny, c.nx, c.ny)
+            continue
+        }
+        // Windows maps n back to origin + n*size/65536, rounding down,
+        // which must land on the pixel itself.
+        back := func(n, origin, size int32) int32 { return origin + int32(int64(n)*int64(size)/65536) }
+        if c.vs.Width > 1 && c.x >= c.vs.X && c.x < c.vs.X+c.vs.Width && back(nx, c.vs.X, c.vs.Width) != c.x {
+            t.Errorf("%s: x %d lands on %d", c.name, c.x, back(nx, c.vs.X, c.vs.Width))
+        }
+        if c.vs.Height > 1 && c.y >= c.vs.Y && c.y < c.vs.Y+c.vs.Height && back(ny, c.vs.Y, c.vs.Height) != c.y {
+            t.Errorf("%s: y %d lands on %d", c.name, c.y, back(ny, c.vs.Y, c.vs.Height))
+        }
+    }
+}
+
+func TestHeldReleases(t *testing.T) {
+    buttons, keys := make(HeldButtons), make(heldKeys)
+    buttons.Track(format.EventLeftButtonDown)
+    keys.track(format.Record{Event: format.EventKeyDown, Key: &format.KeyStroke{Scan: 0x2A}})
+    if !buttons[format.EventLeftButtonUp] || len(keys) != 1 {
+        t.Fatalf("held %v and %v, want a button and a key", buttons, keys)
+    }
+    buttons.Track(format.EventLeftButtonUp)
+    keys.track(format.Record{Event: format.EventKeyUp, Key: &format.KeyStroke{Scan: 0x2A}})
+    if len(buttons) != 0 || len(keys) != 0 {
+        t.Errorf("held %v and %v after letting go", buttons, keys)
+    }
+}
+
+func ExamplePlay() {
+    recording, err := format.Load("login.cfg")
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+    defer cancel()
+    result, err := Play(ctx, recording, Options{Speed: 2})
+    if err != nil {
+        fmt.Println("replay failed:", err)
+        return
+    }
+    fmt.Printf("replayed %d events in %dms\n", result.EventsInjected, result.DurationMS)
+}
@@ -0,0 +1,88 @@
+// +build windows
+
+package player
+
+import (
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// Progress is a snapshot of a running replay.
+type Progress struct {
+    // Iteration counts loop iterations from 1.
+    Iteration int `json:"Iteration"`
+    // Index is how many records of this iteration have been played.
+    Index int `json:"Index"`
+    Total int `json:"Total"`
+    // Percent is based on recorded time, so long pauses count for more
+    // than a burst of moves.
+    Percent   float64       `json:"Percent"`
+    Elapsed   time.Duration `json:"Elapsed"`
+    Remaining time.Duration `json:"Remaining"`
+}
+
+// progressTracker follows one iteration of a replay.
+type progressTracker struct {
+    iteration int
+    start     time.Time
+    // totalMS and doneMS are on the recorded timeline.
+    totalMS, doneMS int64
+}
+
+func (pt *progressTracker) begin(iteration int, records []format.Record) {
+    *pt = progressTracker{iteration: iteration, start: time.Now()}
+    for i, rec := range records {
+        if i != 0 {
+            pt.totalMS += rec.DeltaMS
+        }
+    }
+}
+
+// progress records that records[:done] have been played and reports it.
+func (run *replayRun) progress(done int, records []format.Record) {
+    pt := &run.tracker
+    if done > 1 {
+        pt.doneMS += records[done-1].DeltaMS
+    }
+
+    rp := Progress{
+        Iteration: pt.iteration,
+        Index:     done,
+        Total:     len(records),
+        Percent:   100,
+        Elapsed:   time.Since(pt.start),
+    }
+    if pt.totalMS > 0 {
+        rp.Percent = float64(pt.doneMS) * 100 / float64(pt.totalMS)
+        left := time.Duration(pt.totalMS-pt.doneMS) * time.Millisecond
+        rp.Remaining = time.Duration(float64(left) / run.p.Speed())
+    }
+
+    root := run.p.root()
+    root.mu.Lock()
+    root.progress = &rp
+    root.mu.Unlock()
+    run.p.opts.OnProgress(rp)
+}
+
+// endProgress clears the snapshot once a replay is over.
+func (run *replayRun) endProgress() {
+    root := run.p.root()
+    root.mu.Lock()
+    root.progress = nil
+    root.mu.Unlock()
+}
+
+// Progress returns where the running replay is, or nil when the player
+// is idle.
+func (p *Player) Progress() *Progress {
+    r := p.root()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.progress == nil {
+        return nil
+    }
+    rp := *r.progress
+    return &rp
+}
@@ -0,0 +1,122 @@
+// +build windows
+
+package player
+
+import (
+    "fmt"
+    "math"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// RescaleMode decides how a recording made on a different screen size is
+// mapped onto the current one.
+type RescaleMode int
+
+const (
+    // RescaleFit scales uniformly so the recorded screen fits inside the
+    // current one, leaving bars on one axis (letterboxing).
+    RescaleFit RescaleMode = iota
+    // RescaleStretch scales each axis independently to fill the screen.
+    RescaleStretch
+    // RescaleNone replays coordinates unchanged.
+    RescaleNone
+)
+
+// Anchor is where the letterboxed area sits on the current screen, as
+// fractions of the spare width and height (0 = left/top, 1 = right/bottom).
+type Anchor struct {
+    X, Y float64
+}
+
+// AnchorCenter centers the letterboxed area.
+var AnchorCenter = Anchor{0.5, 0.5}
+
+// rescaleScreen maps records from the screen they were recorded on to the
+// current screen. Nothing happens when both have the same size.
+func rescaleScreen(records []format.Record, from, to format.ScreenBounds, mode RescaleMode, anchor Anchor, logf func(string, ...interface{})) {
+    if mode == RescaleNone || from.Width <= 0 || from.Height <= 0 {
+        return
+    }
+    if from.Width == to.Width && from.Height == to.Height && from.X == to.X && from.Y == to.Y {
+        return
+    }
+
+    sx := float64(to.Width) / float64(from.Width)
+    sy := float64(to.Height) / float64(from.Height)
+    var offX, offY float64
+    if mode == RescaleFit {
+        s := math.Min(sx, sy)
+        sx, sy = s, s
+        offX = (float64(to.Width) - float64(from.Width)*s) * anchor.X
+        offY = (float64(to.Height) - float64(from.Height)*s) * anchor.Y
+    }
+    logf("rescaling %dx%d -> %dx%d (%.3f, %.3f)",
+        from.Width, from.Height, to.Width, to.Height, sx, sy)
+
+    for i := range records {
+        x := float64(records[i].X-from.X)*sx + offX
+        y := float64(records[i].Y-from.Y)*sy + offY
+        records[i].X = to.X + int32(math.Round(x))
+        records[i].Y = to.Y + int32(math.Round(y))
+    }
+}
+
+// rescaleDPI scales every record relative to the origin of the monitor it
+// was recorded on, by the ratio between that monitor's DPI now and the DPI
+// stored in its segment.
+func rescaleDPI(records []format.Record, segments []format.DPISegment, logf func(string, ...interface{})) {
+    for i, seg := range segments {
+        end := len(records)
+        if i+1 < len(segments) && segments[i+1].Index < end {
+            end = segments[i+1].Index
+        }
+        if seg.DPI == 0 || seg.Index >= end {
+            continue
+        }
+
+        current := desktop.MonitorFromPoint(seg.Monitor.MinX, seg.Monitor.MinY).DPI()
+        if current == seg.DPI {
+            continue
+        }
+        logf("rescaling records %d-%d from %d to %d DPI", seg.Index, end-1, seg.DPI, current)
+
+        factor := float64(current) / float64(seg.DPI)
+        for j := seg.Index; j < end; j++ {
+            records[j].X = seg.Monitor.MinX + int32(float64(records[j].X-seg.Monitor.MinX)*factor)
+            records[j].Y = seg.Monitor.MinY + int32(float64(records[j].Y-seg.Monitor.MinY)*factor)
+        }
+    }
+}
+
+// anchorToWindow shifts records so that positions recorded relative to
+// recorded's client area land on the same spot of the window currently
+// titled title.
+func anchorToWindow(records []format.Record, recorded *format.WindowInfo, title string, foreground bool, logf func(string, ...interface{})) error {
+    if recorded == nil {
+        return fmt.Errorf("recording has no window reference to re-anchor to")
+    }
+    hwnd, err := desktop.FindWindow(title)
+    if err != nil {
+        return err
+    }
+    if foreground {
+        if err := desktop.BringToForeground(hwnd); err != nil {
+            logf("%v", err)
+        }
+    }
+    current, err := desktop.ClientBounds(hwnd)
+    if err != nil {
+        return err
+    }
+
+    dx := current.X - recorded.Client.X
+    dy := current.Y - recorded.Client.Y
+    logf("re-anchoring to %q, offset %d,%d", title, dx, dy)
+    for i := range records {
+        records[i].X += dx
+        records[i].Y += dy
+    }
+    return nil
+}
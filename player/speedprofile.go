@@ -0,0 +1,38 @@
+// +build windows
+
+package player
+
+import "time"
+
+// SpeedPoint sets the speed from At onwards, At being a position on the
+// recorded timeline of one pass.
+type SpeedPoint struct {
+    At    time.Duration
+    Speed float64
+    // Ramp approaches Speed linearly from the previous point instead of
+    // switching to it at At.
+    Ramp bool
+}
+
+// SpeedProfile varies the replay speed over a recording, on top of the
+// player's speed. Points are sorted by At; before the first point the
+// speed is 1.
+type SpeedProfile []SpeedPoint
+
+// at returns the speed factor at t.
+func (sp SpeedProfile) at(t time.Duration) float64 {
+    speed := 1.0
+    var prev *SpeedPoint
+    for i := range sp {
+        pt := &sp[i]
+        if t < pt.At {
+            if pt.Ramp && prev != nil && pt.At > prev.At {
+                f := float64(t-prev.At) / float64(pt.At-prev.At)
+                return prev.Speed + (pt.Speed-prev.Speed)*f
+            }
+            return speed
+        }
+        speed, prev = pt.Speed, pt
+    }
+    return speed
+}
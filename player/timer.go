@@ -0,0 +1,142 @@
+// +build windows
+
+package player
+
+import (
+    "context"
+    "syscall"
+    "time"
+    "unsafe"
+)
+
+const (
+    CREATE_WAITABLE_TIMER_HIGH_RESOLUTION = 0x00000002
+    TIMER_ALL_ACCESS                      = 0x001F0003
+    INFINITE                              = 0xFFFFFFFF
+
+    // preciseSlice bounds each kernel wait so cancellation is noticed
+    // promptly even during long pauses.
+    preciseSlice = 10 * time.Millisecond
+)
+
+var (
+    winmm = syscall.NewLazyDLL("winmm.dll")
+
+    procTimeBeginPeriod = winmm.NewProc("timeBeginPeriod")
+    procTimeEndPeriod   = winmm.NewProc("timeEndPeriod")
+
+    kernel32                   = syscall.NewLazyDLL("kernel32.dll")
+    procCreateWaitableTimerExW = kernel32.NewProc("CreateWaitableTimerExW")
+    procSetWaitableTimer       = kernel32.NewProc("SetWaitableTimer")
+    procWaitForSingleObject    = kernel32.NewProc("WaitForSingleObject")
+)
+
+// preciseTimer sleeps with sub-millisecond accuracy. It prefers a
+// high-resolution waitable timer (Windows 10 1803+); on older systems it
+// raises the system timer resolution to 1ms with timeBeginPeriod for as
+// long as it is open.
+type preciseTimer struct {
+    handle       uintptr
+    raisedPeriod bool
+}
+
+func newPreciseTimer(logf func(string, ...interface{})) *preciseTimer {
+    t := &preciseTimer{}
+    h, _, _ := procCreateWaitableTimerExW.Call(0, 0, CREATE_WAITABLE_TIMER_HIGH_RESOLUTION, TIMER_ALL_ACCESS)
+    if h != 0 {
+        t.handle = h
+        return t
+    }
+
+    logf("high-resolution timer unavailable, falling back to timeBeginPeriod(1)")
+    if procTimeBeginPeriod.Find() == nil {
+        if r, _, _ := procTimeBeginPeriod.Call(1); r == 0 {
+            t.raisedPeriod = true
+        }
+    }
+    h, _, _ = procCreateWaitableTimerExW.Call(0, 0, 0, TIMER_ALL_ACCESS)
+    t.handle = h
+    return t
+}
+
+// Close releases the timer and restores the system timer resolution.
+func (t *preciseTimer) Close() {
+    if t == nil {
+        return
+    }
+    if t.handle != 0 {
+        syscall.CloseHandle(syscall.Handle(t.handle))
+        t.handle = 0
+    }
+    if t.raisedPeriod {
+        procTimeEndPeriod.Call(1)
+        t.raisedPeriod = false
+    }
+}
+
+// sleepUntil waits until target or until ctx is done. Without a usable
+// timer handle it falls back to a plain Go timer.
+func (t *preciseTimer) sleepUntil(ctx context.Context, target time.Time) error {
+    if t == nil || t.handle == 0 {
+        return sleepContext(ctx, time.Until(target))
+    }
+
+    for {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        remaining := time.Until(target)
+        if remaining <= 0 {
+            return nil
+        }
+        if remaining > preciseSlice {
+            remaining = preciseSlice
+        }
+
+        // Negative due time = relative, in 100ns units.
+        due := -int64(remaining / 100)
+        r, _, _ := procSetWaitableTimer.Call(t.handle, uintptr(unsafe.Pointer(&due)), 0, 0, 0, 0)
+        if r == 0 {
+            return sleepContext(ctx, time.Until(target))
+        }
+        procWaitForSingleObject.Call(t.handle, INFINITE)
+    }
+}
+
+// timeline schedules events against a fixed start time instead of sleeping
+// each delay one after the other. A late wakeup only shortens the next
+// wait, so scheduling error doesn't pile up over thousands of events.
+type timeline struct {
+    start  time.Time
+    offset time.Duration
+    timer  *preciseTimer
+}
+
+// newTimeline starts a schedule now. timer may be nil to use plain Go
+// timers.
+func newTimeline(timer *preciseTimer) *timeline {
+    return &timeline{start: time.Now(), timer: timer}
+}
+
+// wait advances the schedule by d and sleeps until the resulting target,
+// or until ctx is done.
+func (t *timeline) wait(ctx context.Context, d time.Duration) error {
+    t.offset += d
+    return t.timer.sleepUntil(ctx, t.start.Add(t.offset))
+}
+
+// shift moves the rest of the schedule back by d, for time spent blocked
+// outside of it.
+func (t *timeline) shift(d time.Duration) {
+    t.start = t.start.Add(d)
+}
+
+// restart starts the schedule over from now.
+func (t *timeline) restart() {
+    t.start, t.offset = time.Now(), 0
+}
+
+// lateness is how far behind the schedule we are right now.
+func (t *timeline) lateness() time.Duration {
+    return time.Since(t.start) - t.offset
+}
@@ -0,0 +1,314 @@
+// +build windows
+
+package player
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "strings"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// Slice limits a replay to part of a recording. Times are measured on the
+// recorded timeline from the first event; indexes are record positions
+// with Last exclusive. Zero To or Last means "until the end".
+type Slice struct {
+    From, To    time.Duration
+    First, Last int
+}
+
+// sliceRecords returns the records selected by sl. The first selected
+// record starts immediately rather than waiting for its recorded delay.
+func sliceRecords(records []format.Record, sl Slice) []format.Record {
+    if sl == (Slice{}) {
+        return records
+    }
+
+    first, last := sl.First, sl.Last
+    if last <= 0 || last > len(records) {
+        last = len(records)
+    }
+    if first < 0 {
+        first = 0
+    }
+
+    var out []format.Record
+    var at time.Duration
+    for i, rec := range records {
+        if i != 0 {
+            at += time.Duration(rec.DeltaMS) * time.Millisecond
+        }
+        if i < first || i >= last || at < sl.From || (sl.To > 0 && at > sl.To) {
+            continue
+        }
+        if len(out) == 0 {
+            rec.DeltaMS = 0
+        }
+        out = append(out, rec)
+    }
+    return out
+}
+
+// reverseRecords plays records back to front. Button downs become ups and
+// vice versa so held buttons are pressed and released in the right order,
+// wheel scrolls turn the other way, and each record waits as long as the
+// record that originally followed it.
+func reverseRecords(records []format.Record) []format.Record {
+    n := len(records)
+    out := make([]format.Record, n)
+    for k := range out {
+        rec := records[n-1-k]
+        if k == 0 {
+            rec.DeltaMS = 0
+        } else {
+            rec.DeltaMS = records[n-k].DeltaMS
+        }
+
+        switch {
+        case strings.HasSuffix(rec.Event, "Down"):
+            rec.Event = strings.TrimSuffix(rec.Event, "Down") + "Up"
+        case strings.HasSuffix(rec.Event, "Up"):
+            rec.Event = strings.TrimSuffix(rec.Event, "Up") + "Down"
+        case rec.Event == format.EventMouseWheel || rec.Event == format.EventMouseHWheel:
+            rec.Data = int32(-int16(uint16(rec.Data)))
+        }
+        out[k] = rec
+    }
+    return out
+}
+
+// teleport drops MouseMove records so the cursor jumps straight to each
+// click, wheel or key event, and the time spent moving is skipped. Moves
+// made while a button is held are kept so drags still work.
+func teleport(records []format.Record) []format.Record {
+    held := make(HeldButtons)
+    out := make([]format.Record, 0, len(records))
+    for _, rec := range records {
+        if rec.Event == format.EventMouseMove && len(held) == 0 {
+            continue
+        }
+        held.Track(rec.Event)
+        out = append(out, rec)
+    }
+    return out
+}
+
+// Positional reports whether rec is a mouse event whose X and Y say where
+// the cursor is.
+func Positional(rec format.Record) bool {
+    return !IsWaitStep(rec) && !IsCheckStep(rec) && !IsKey(rec)
+}
+
+// interpolate inserts MouseMove records between recorded positions that are
+// further apart than one pixel, at hz moves per second, so the cursor
+// glides instead of jumping. The time between the two recorded events is
+// split across the new moves; total timing is unchanged.
+func interpolate(records []format.Record, hz float64) []format.Record {
+    if hz <= 0 || len(records) < 2 {
+        return records
+    }
+    step := int64(math.Max(1, math.Round(1000/hz)))
+
+    out := make([]format.Record, 0, len(records))
+    out = append(out, records[0])
+    prev := records[0]
+    for _, rec := range records[1:] {
+        // Keys, wait and check steps aren't positions; glide past them to the
+        // next mouse event.
+        if !Positional(rec) {
+            out = append(out, rec)
+            continue
+        }
+        if !Positional(prev) {
+            // Nothing positional before rec to start from.
+            prev = rec
+            out = append(out, rec)
+            continue
+        }
+        dist := math.Hypot(float64(rec.X-prev.X), float64(rec.Y-prev.Y))
+
+        steps := rec.DeltaMS / step
+        if dist > 1 && steps > 1 {
+            for n := int64(1); n < steps; n++ {
+                t := float64(n) / float64(steps)
+                out = append(out, format.Record{
+                    DeltaMS: step,
+                    X:       prev.X + int32(math.Round(float64(rec.X-prev.X)*t)),
+                    Y:       prev.Y + int32(math.Round(float64(rec.Y-prev.Y)*t)),
+                    Event:   format.EventMouseMove,
+                    Source:  rec.Source,
+                })
+            }
+            rec.DeltaMS -= step * (steps - 1)
+        }
+        out = append(out, rec)
+        prev = rec
+    }
+    return out
+}
+
+// humanizeCurveHz is the move rate used for curved paths when no
+// InterpolateHz was given.
+const humanizeCurveHz = 60
+
+// curvePaths is interpolate with a twist: the generated moves follow a
+// quadratic Bezier curve whose control point is pushed sideways by up to
+// amount times the jump length, so two identical jumps never trace the
+// same line. Recorded points themselves are never moved.
+func curvePaths(records []format.Record, amount, hz float64, rng *rand.Rand) []format.Record {
+    if amount <= 0 || len(records) < 2 {
+        return records
+    }
+    if hz <= 0 {
+        hz = humanizeCurveHz
+    }
+    step := int64(math.Max(1, math.Round(1000/hz)))
+
+    out := make([]format.Record, 0, len(records))
+    out = append(out, records[0])
+    prev := records[0]
+    for _, rec := range records[1:] {
+        // Keys and wait steps aren't positions; glide past them to the
+        // next mouse event.
+        if !Positional(rec) {
+            out = append(out, rec)
+            continue
+        }
+        if !Positional(prev) {
+            // Nothing positional before rec to start from.
+            prev = rec
+            out = append(out, rec)
+            continue
+        }
+        dx, dy := float64(rec.X-prev.X), float64(rec.Y-prev.Y)
+        dist := math.Hypot(dx, dy)
+
+        steps := rec.DeltaMS / step
+        if dist > 1 && steps > 1 {
+            // Control point: midpoint, pushed along the normal.
+            bend := (rng.Float64()*2 - 1) * amount * dist
+            cx := float64(prev.X) + dx/2 - dy/dist*bend
+            cy := float64(prev.Y) + dy/2 + dx/dist*bend
+
+            for n := int64(1); n < steps; n++ {
+                t := float64(n) / float64(steps)
+                u := 1 - t
+                out = append(out, format.Record{
+                    DeltaMS: step,
+                    X:       int32(math.Round(u*u*float64(prev.X) + 2*u*t*cx + t*t*float64(rec.X))),
+                    Y:       int32(math.Round(u*u*float64(prev.Y) + 2*u*t*cy + t*t*float64(rec.Y))),
+                    Event:   format.EventMouseMove,
+                    Source:  rec.Source,
+                })
+            }
+            rec.DeltaMS -= step * (steps - 1)
+        }
+        out = append(out, rec)
+        prev = rec
+    }
+    return out
+}
+
+// jitterTimings scales every delay by a random factor in [1-amount, 1+amount].
+func jitterTimings(records []format.Record, amount float64, rng *rand.Rand) {
+    if amount <= 0 {
+        return
+    }
+    for i := range records {
+        factor := 1 + (rng.Float64()*2-1)*amount
+        records[i].DeltaMS = int64(math.Round(float64(records[i].DeltaMS) * factor))
+        if records[i].DeltaMS < 0 {
+            records[i].DeltaMS = 0
+        }
+    }
+}
+
+// randomizeDelays applies a DelayRange to every delay.
+func randomizeDelays(records []format.Record, dr DelayRange, rng *rand.Rand) {
+    if dr.Max <= 0 {
+        jitterTimings(records, dr.Percent/100, rng)
+        return
+    }
+    lo, hi := dr.Min.Milliseconds(), dr.Max.Milliseconds()
+    for i := range records {
+        records[i].DeltaMS = lo + rng.Int63n(hi-lo+1)
+    }
+}
+
+// Mirror flips replayed positions. The zero value leaves them alone.
+type Mirror struct {
+    // Horizontal swaps left and right, Vertical swaps top and bottom.
+    Horizontal, Vertical bool
+    // Axis is the point both mirror axes pass through. Nil mirrors around
+    // the middle of the screen.
+    Axis *desktop.Point
+}
+
+// mirrorRecords applies m to every position, around m.Axis or the middle
+// of screen.
+func mirrorRecords(records []format.Record, m Mirror, screen format.ScreenBounds) {
+    if !m.Horizontal && !m.Vertical {
+        return
+    }
+    // Doubled axis coordinates, so mirroring around the middle of an
+    // even-sized screen maps its first pixel onto its last.
+    ax2 := 2*screen.X + screen.Width - 1
+    ay2 := 2*screen.Y + screen.Height - 1
+    if m.Axis != nil {
+        ax2, ay2 = 2*m.Axis.X, 2*m.Axis.Y
+    }
+    for i := range records {
+        if m.Horizontal {
+            records[i].X = ax2 - records[i].X
+        }
+        if m.Vertical {
+            records[i].Y = ay2 - records[i].Y
+        }
+    }
+}
+
+// offsetRecords shifts every position by d.
+func offsetRecords(records []format.Record, d desktop.Point) {
+    if d == (desktop.Point{}) {
+        return
+    }
+    for i := range records {
+        records[i].X += d.X
+        records[i].Y += d.Y
+    }
+}
+
+// forIteration adapts records for loop iteration iter (from 0): positions
+// are shifted by iter times step, and in Text records "{i}" becomes the
+// 1-based iteration number and "{i0}" the 0-based one. records is
+// returned as is when there is nothing to change.
+func forIteration(records []format.Record, iter int, step desktop.Point) []format.Record {
+    hasText := false
+    for _, rec := range records {
+        if rec.Event == format.EventText && rec.Key != nil && strings.Contains(rec.Key.Text, "{i") {
+            hasText = true
+            break
+        }
+    }
+    if step == (desktop.Point{}) && !hasText {
+        return records
+    }
+
+    out := append([]format.Record(nil), records...)
+    offsetRecords(out, desktop.Point{X: step.X * int32(iter), Y: step.Y * int32(iter)})
+    if hasText {
+        r := strings.NewReplacer("{i0}", fmt.Sprint(iter), "{i}", fmt.Sprint(iter+1))
+        for k, rec := range out {
+            if rec.Event == format.EventText && rec.Key != nil {
+                key := *rec.Key
+                key.Text = r.Replace(key.Text)
+                out[k].Key = &key
+            }
+        }
+    }
+    return out
+}
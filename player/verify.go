@@ -0,0 +1,69 @@
+// +build windows
+
+package player
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// ErrVerifyFailed is returned by a replay whose Verify check found the
+// cursor somewhere other than where a record put it.
+var ErrVerifyFailed = errors.New("verification failed")
+
+const (
+    // verifyRetries re-reads the cursor a few times before calling a
+    // position wrong, in case the move is still being processed.
+    verifyRetries = 3
+    // maxVerifyDetails caps the mismatches listed in the result; all of
+    // them are still counted.
+    maxVerifyDetails = 100
+)
+
+// VerifyReport counts the positions checked by Verify. The mismatches are
+// listed in Result.Assertions with Kind "CursorPosition".
+type VerifyReport struct {
+    Checked    int `json:"Checked"`
+    Mismatched int `json:"Mismatched"`
+}
+
+// verify reads the cursor back after record i was injected and records a
+// failed assertion when it isn't within the tolerance of rec's position,
+// e.g. because the monitor is gone or the cursor is confined.
+func (run *replayRun) verify(i int, rec format.Record) {
+    report := run.result.Verify
+    report.Checked++
+
+    tol := run.p.opts.VerifyTolerance
+    var pos desktop.Point
+    for try := 0; try < verifyRetries; try++ {
+        var err error
+        if pos, err = desktop.CursorPos(); err != nil {
+            return
+        }
+        if absInt32(pos.X-rec.X) <= tol && absInt32(pos.Y-rec.Y) <= tol {
+            return
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    report.Mismatched++
+    if report.Mismatched <= maxVerifyDetails {
+        run.assert(i, "CursorPosition", false,
+            fmt.Sprintf("%s expected at (%d,%d), cursor at (%d,%d)", rec.Event, rec.X, rec.Y, pos.X, pos.Y))
+    }
+}
+
+// verifyOutcome turns mismatches into ErrVerifyFailed for a replay that
+// otherwise succeeded.
+func (run *replayRun) verifyOutcome(err error) error {
+    report := run.result.Verify
+    if err == nil && report != nil && report.Mismatched > 0 {
+        return fmt.Errorf("%w: %d of %d positions off target", ErrVerifyFailed, report.Mismatched, report.Checked)
+    }
+    return err
+}
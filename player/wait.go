@@ -0,0 +1,117 @@
+// +build windows
+
+package player
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+)
+
+// Wait steps are records that pause the replay until something shows up on
+// screen instead of injecting input. WaitPixel uses the record's X and Y,
+// so it follows the same rescaling as the clicks around it.
+
+// waitPoll is how often a wait condition is re-checked.
+const waitPoll = 100 * time.Millisecond
+
+// IsWaitStep reports whether rec is a wait step.
+func IsWaitStep(rec format.Record) bool {
+    return rec.Event == format.EventWaitPixel || rec.Event == format.EventWaitWindow
+}
+
+// countSteps counts the wait and check steps, which inject nothing.
+func countSteps(records []format.Record) int {
+    n := 0
+    for _, rec := range records {
+        if IsWaitStep(rec) || IsCheckStep(rec) {
+            n++
+        }
+    }
+    return n
+}
+
+func channelClose(a, b uint8, tolerance int) bool {
+    d := int(a) - int(b)
+    if d < 0 {
+        d = -d
+    }
+    return d <= tolerance
+}
+
+// waitCondition returns a check for rec's condition and a description of
+// it for logs.
+func waitCondition(rec format.Record) (func() bool, string, error) {
+    step := rec.Wait
+    if step == nil {
+        step = &format.WaitStep{}
+    }
+
+    switch rec.Event {
+    case format.EventWaitPixel:
+        wr, wg, wb, err := format.ParseColor(step.Color)
+        if err != nil {
+            return nil, "", err
+        }
+        what := fmt.Sprintf("pixel (%d,%d) to be %s", rec.X, rec.Y, step.Color)
+        return func() bool {
+            r, g, b, err := desktop.PixelAt(rec.X, rec.Y)
+            return err == nil &&
+                channelClose(r, wr, step.Tolerance) &&
+                channelClose(g, wg, step.Tolerance) &&
+                channelClose(b, wb, step.Tolerance)
+        }, what, nil
+    case format.EventWaitWindow:
+        if step.Title == "" {
+            return nil, "", fmt.Errorf("%s step has no Title", rec.Event)
+        }
+        what := fmt.Sprintf("window %q", step.Title)
+        return func() bool {
+            _, err := desktop.FindWindow(step.Title)
+            return err == nil
+        }, what, nil
+    }
+    return nil, "", fmt.Errorf("unknown wait step %q", rec.Event)
+}
+
+// waitFor blocks until rec's condition holds, its timeout passes or ctx is
+// done. The outcome is recorded as an assertion on the replay result.
+func (run *replayRun) waitFor(ctx context.Context, i int, rec format.Record) error {
+    check, what, err := waitCondition(rec)
+    if err != nil {
+        return fmt.Errorf("record %d: %v", i, err)
+    }
+    if run.p.opts.DryRun {
+        run.p.opts.OnDryRun(i, rec, "wait for "+what)
+        return nil
+    }
+
+    timeout := rec.Wait.Timeout()
+    run.p.opts.Logf("waiting up to %v for %s", timeout, what)
+
+    start := time.Now()
+    for !check() {
+        if time.Since(start) >= timeout {
+            detail := fmt.Sprintf("timed out after %v waiting for %s", timeout, what)
+            run.assert(i, rec.Event, false, detail)
+            return fmt.Errorf("record %d: %s", i, detail)
+        }
+        if err := sleepContext(ctx, waitPoll); err != nil {
+            return err
+        }
+    }
+    run.assert(i, rec.Event, true, fmt.Sprintf("%s after %v", what, time.Since(start).Round(time.Millisecond)))
+    return nil
+}
+
+func (run *replayRun) assert(i int, kind string, passed bool, detail string) {
+    run.result.Assertions = append(run.result.Assertions, AssertionResult{
+        Index:  i,
+        Kind:   kind,
+        Passed: passed,
+        Detail: detail,
+    })
+}
@@ -0,0 +1,375 @@
+// +build windows
+
+// Package recorder captures mouse and, optionally, keyboard input into a
+// format.Recording, the way 'mrr record' does. Record records until a
+// context is done; a Recorder also hands out the records as they happen.
+//
+// Positions are taken as the low-level hooks report them, which is in
+// physical pixels only when the process is per-monitor DPI aware; declare
+// it so in the application manifest, or call desktop.EnableDPIAwareness
+// before recording, or recordings made on a scaled display won't replay on
+// target.
+package recorder
+
+import (
+    "context"
+    "errors"
+    "io"
+    "sync"
+    "time"
+
+    "github.com/onixldlc/MRR/desktop"
+    "github.com/onixldlc/MRR/format"
+    "github.com/onixldlc/MRR/hook"
+)
+
+// Options says what is recorded.
+type Options struct {
+    // Keyboard records keys too, as KeyDown and KeyUp records.
+    Keyboard bool
+    // SkipInjected leaves out input other programs injected, such as a
+    // replay's, and keeps what comes from the mouse and keyboard.
+    SkipInjected bool
+    // Simplify leaves out MouseMove records within this many pixels of
+    // the straight path between the moves kept around them; zero keeps
+    // every move. Kept moves may be held back until the path turns.
+    Simplify float64
+    // Window is the title, or part of it, of the window the recording is
+    // made in, whose client area goes into the metadata so replays can
+    // follow the window. Empty means the window in front at Start.
+    Window string
+    // NoHooks installs no hooks: the caller captures input itself, from
+    // hooks it already has, and passes it to Add.
+    NoHooks bool
+}
+
+// Recorder records one recording. Start begins it, Stop ends it and
+// returns it; meanwhile every record also arrives on the channel Start
+// returns, for tools that filter, show or store events as they happen.
+//
+//     r := recorder.New(recorder.Options{})
+//     events, err := r.Start(ctx)
+//     ...
+//     for rec := range events {
+//         ...
+//     }
+//     recording, err := r.Stop()
+//
+// Only one Recorder at a time installs hooks in a process; with
+// Options.NoHooks, the caller feeds it through Add instead.
+type Recorder struct {
+    opts Options
+
+    mu      sync.Mutex
+    hook    io.Closer
+    done    bool
+    meta    *format.Metadata
+    records []format.Record
+    start   time.Time
+    last    time.Time
+    // seen is when the latest record added was captured.
+    seen time.Time
+    // segments are the DPI segments so far, a new one whenever the cursor
+    // is on another monitor than monitor.
+    segments  []format.DPISegment
+    monitor   desktop.Monitor
+    coalescer *moveCoalescer
+    // added is signalled when a record is added, stopped closed when the
+    // recording stops.
+    added   chan struct{}
+    stopped chan struct{}
+    result  *format.Recording
+}
+
+var (
+    // ErrStarted is returned by Start on a Recorder that was started
+    // before.
+    ErrStarted = errors.New("recorder: already started")
+    // ErrNotStarted is returned by Stop on a Recorder that wasn't started.
+    ErrNotStarted = errors.New("recorder: not started")
+)
+
+// install installs the hooks; tests replace it.
+var install = func(kinds hook.Kind, h hook.Handler) (io.Closer, error) {
+    return hook.Install(kinds, h)
+}
+
+// New returns a Recorder that records as opts say once started.
+func New(opts Options) *Recorder {
+    return &Recorder{opts: opts}
+}
+
+// Start installs the hooks, unless Options.NoHooks, and starts recording,
+// until Stop is called or ctx is done. Records arrive on the returned
+// channel in order, and the channel is closed when recording stops;
+// records not received by then are only in the recording Stop returns. A slow reader never holds up
+// the hooks, and so never loses records from the recording. It fails if
+// the hooks can't be installed, such as while another Recorder records.
+func (r *Recorder) Start(ctx context.Context) (<-chan format.Record, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.stopped != nil {
+        return nil, ErrStarted
+    }
+    kinds := hook.Mouse
+    if r.opts.Keyboard {
+        kinds |= hook.Keyboard
+    }
+    r.start = time.Now()
+    r.last = r.start
+    r.seen = r.start
+    r.meta = &format.Metadata{
+        CreatedAt: r.start,
+        Screen:    desktop.VirtualScreen(),
+        Window:    window(r.opts.Window),
+    }
+    if r.opts.Simplify > 0 {
+        r.coalescer = newMoveCoalescer(r.opts.Simplify)
+    }
+    r.added = make(chan struct{}, 1)
+    r.stopped = make(chan struct{})
+    if !r.opts.NoHooks {
+        h, err := install(kinds, r.add)
+        if err != nil {
+            r.stopped = nil
+            return nil, err
+        }
+        r.hook = h
+    }
+
+    events := make(chan format.Record)
+    go r.forward(events)
+    go func() {
+        select {
+        case <-ctx.Done():
+            r.stop()
+        case <-r.stopped:
+        }
+    }()
+    return events, nil
+}
+
+// window describes the window titled title, or the one in front when
+// title is empty, or is nil when there is none.
+func window(title string) *format.WindowInfo {
+    if title == "" {
+        return desktop.DescribeWindow(desktop.ForegroundWindow())
+    }
+    hwnd, err := desktop.FindWindow(title)
+    if err != nil {
+        return nil
+    }
+    return desktop.DescribeWindow(hwnd)
+}
+
+// add is the hook handler: it records ev and never swallows it.
+func (r *Recorder) add(ev hook.Event) bool {
+    if ev.Injected && r.opts.SkipInjected {
+        return false
+    }
+    if rec, ok := RecordOf(ev); ok {
+        r.Add(rec, ev.Time)
+    }
+    return false
+}
+
+// Add records rec, captured at at, and returns the records it kept, with
+// DeltaMS set. With Options.Simplify, a move may be left out or only come
+// out of a later Add, or Stop. A record captured before one added earlier
+// counts as captured with it. Add does nothing unless the Recorder is
+// recording.
+func (r *Recorder) Add(rec format.Record, at time.Time) []format.Record {
+    r.mu.Lock()
+    if r.stopped == nil || r.done {
+        r.mu.Unlock()
+        return nil
+    }
+    if at.Before(r.seen) {
+        at = r.seen
+    }
+    r.seen = at
+    var kept []format.Record
+    for _, tr := range r.coalescer.add(rec, at) {
+        kept = append(kept, r.keep(tr))
+    }
+    r.mu.Unlock()
+    if len(kept) > 0 {
+        select {
+        case r.added <- struct{}{}:
+        default:
+        }
+    }
+    return kept
+}
+
+// keep appends tr to the recording and returns it as stored. r.mu must be
+// held.
+func (r *Recorder) keep(tr timedRecord) format.Record {
+    tr.rec.DeltaMS = tr.at.Sub(r.last).Milliseconds()
+    r.last = tr.at
+    if tr.rec.Event != format.EventKeyDown && tr.rec.Event != format.EventKeyUp {
+        if mon := desktop.MonitorFromPoint(tr.rec.X, tr.rec.Y); mon != r.monitor {
+            r.monitor = mon
+            r.segments = append(r.segments, mon.Segment(len(r.records)))
+        }
+    }
+    r.records = append(r.records, tr.rec)
+    return tr.rec
+}
+
+// Metadata returns what Start captured about the screen and the window
+// recorded in, or nil before Start.
+func (r *Recorder) Metadata() *format.Metadata {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.meta
+}
+
+// Len returns how many records have been kept so far.
+func (r *Recorder) Len() int {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return len(r.records)
+}
+
+// forward sends the records to events as they are added, until recording
+// stops.
+func (r *Recorder) forward(events chan<- format.Record) {
+    defer close(events)
+    sent := 0
+    for {
+        r.mu.Lock()
+        pending := r.records[sent:len(r.records):len(r.records)]
+        r.mu.Unlock()
+        for _, rec := range pending {
+            select {
+            case events <- rec:
+                sent++
+            case <-r.stopped:
+                return
+            }
+        }
+        select {
+        case <-r.added:
+        case <-r.stopped:
+            return
+        }
+    }
+}
+
+// stop ends recording and removes the hooks, once.
+func (r *Recorder) stop() {
+    r.mu.Lock()
+    if r.done {
+        r.mu.Unlock()
+        return
+    }
+    r.done = true
+    h := r.hook
+    r.hook = nil
+    r.mu.Unlock()
+    // Closing waits for the hook thread, which may be waiting for mu in
+    // add, so mu isn't held meanwhile.
+    if h != nil {
+        h.Close()
+    }
+    close(r.stopped)
+}
+
+// Stop stops recording, if ctx didn't already, and returns the recording,
+// with the moves Options.Simplify held back. Calling it again returns the
+// same recording.
+func (r *Recorder) Stop() (*format.Recording, error) {
+    r.mu.Lock()
+    started := r.stopped != nil
+    r.mu.Unlock()
+    if !started {
+        return nil, ErrNotStarted
+    }
+    r.stop()
+    <-r.stopped
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.result == nil {
+        for _, tr := range r.coalescer.flush() {
+            r.keep(tr)
+        }
+        summary := format.Summarize(r.records)
+        r.result = &format.Recording{
+            Version:     format.Version,
+            Metadata:    r.meta,
+            Summary:     &summary,
+            Records:     r.records,
+            DPISegments: r.segments,
+        }
+    }
+    return r.result, nil
+}
+
+// Record records until ctx is done and returns the recording, for callers
+// that don't need the records as they happen.
+func Record(ctx context.Context, opts Options) (*format.Recording, error) {
+    r := New(opts)
+    if _, err := r.Start(ctx); err != nil {
+        return nil, err
+    }
+    <-ctx.Done()
+    return r.Stop()
+}
+
+// RecordOf turns a hook event into a record, with ok false for events
+// that aren't recorded.
+func RecordOf(ev hook.Event) (rec format.Record, ok bool) {
+    if ev.Kind == hook.Keyboard {
+        switch ev.Message {
+        case hook.WM_KEYDOWN, hook.WM_SYSKEYDOWN:
+            rec.Event = format.EventKeyDown
+        case hook.WM_KEYUP, hook.WM_SYSKEYUP:
+            rec.Event = format.EventKeyUp
+        default:
+            return rec, false
+        }
+        rec.Key = &format.KeyStroke{VK: ev.VK, Scan: ev.Scan, Extended: ev.Extended}
+        return rec, true
+    }
+
+    rec.X, rec.Y, rec.Data = ev.X, ev.Y, int32(ev.MouseData)
+    switch ev.Message {
+    case hook.WM_MOUSEMOVE:
+        rec.Event = format.EventMouseMove
+    case hook.WM_LBUTTONDOWN:
+        rec.Event = format.EventLeftButtonDown
+    case hook.WM_LBUTTONUP:
+        rec.Event = format.EventLeftButtonUp
+    case hook.WM_RBUTTONDOWN:
+        rec.Event = format.EventRightButtonDown
+    case hook.WM_RBUTTONUP:
+        rec.Event = format.EventRightButtonUp
+    case hook.WM_MBUTTONDOWN:
+        rec.Event = format.EventMiddleButtonDown
+    case hook.WM_MBUTTONUP:
+        rec.Event = format.EventMiddleButtonUp
+    case hook.WM_MOUSEWHEEL:
+        rec.Event = format.EventMouseWheel
+    case hook.WM_MOUSEHWHEEL:
+        rec.Event = format.EventMouseHWheel
+    case hook.WM_XBUTTONDOWN, hook.WM_XBUTTONUP:
+        down := ev.Message == hook.WM_XBUTTONDOWN
+        switch {
+        case ev.MouseData == hook.XBUTTON1 && down:
+            rec.Event = format.EventMouse4Down
+        case ev.MouseData == hook.XBUTTON1:
+            rec.Event = format.EventMouse4Up
+        case ev.MouseData == hook.XBUTTON2 && down:
+            rec.Event = format.EventMouse5Down
+        case ev.MouseData == hook.XBUTTON2:
+            rec.Event = format.EventMouse5Up
+        default:
+            return rec, false
+        }
+    default:
+        return rec, false
+    }
+    return rec, true
+}
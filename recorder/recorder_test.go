@@ -0,0 +1,257 @@
+// +build windows
+
+package recorder
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "os/signal"
+    "testing"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+    "github.com/onixldlc/MRR/hook"
+)
+
+func TestRecordOf(t *testing.T) {
+    for _, c := range []struct {
+        ev   hook.Event
+        want string
+    }{
+        {hook.Event{Kind: hook.Mouse, Message: hook.WM_MOUSEMOVE}, format.EventMouseMove},
+        {hook.Event{Kind: hook.Mouse, Message: hook.WM_RBUTTONUP}, format.EventRightButtonUp},
+        {hook.Event{Kind: hook.Mouse, Message: hook.WM_XBUTTONDOWN, MouseData: hook.XBUTTON2}, format.EventMouse5Down},
+        {hook.Event{Kind: hook.Mouse, Message: hook.WM_XBUTTONUP, MouseData: 3}, ""},
+        {hook.Event{Kind: hook.Keyboard, Message: hook.WM_SYSKEYDOWN, VK: 0x12}, format.EventKeyDown},
+        {hook.Event{Kind: hook.Keyboard, Message: hook.WM_KEYUP, VK: 0x41}, format.EventKeyUp},
+    } {
+        rec, ok := RecordOf(c.ev)
+        if ok != (c.want != "") || rec.Event != c.want {
+            t.Errorf("RecordOf(%+v) = %q, %t, want %q", c.ev, rec.Event, ok, c.want)
+        }
+    }
+
+    rec, _ := RecordOf(hook.Event{Kind: hook.Mouse, Message: hook.WM_MOUSEWHEEL, X: 10, Y: 20, MouseData: 65416})
+    if rec.X != 10 || rec.Y != 20 || rec.Data != 65416 {
+        t.Errorf("wheel record = %+v, want the position and raw delta", rec)
+    }
+    rec, _ = RecordOf(hook.Event{Kind: hook.Keyboard, Message: hook.WM_KEYDOWN, VK: 0x25, Scan: 0x4B, Extended: true})
+    if k := rec.Key; k == nil || k.VK != 0x25 || k.Scan != 0x4B || !k.Extended {
+        t.Errorf("key record's Key = %+v", k)
+    }
+}
+
+// fakeHook stands in for the hooks: the test calls the handler Start
+// installed.
+type fakeHook struct {
+    handler hook.Handler
+    closed  bool
+}
+
+func (f *fakeHook) Close() error {
+    f.closed = true
+    return nil
+}
+
+func installFake(t *testing.T) *fakeHook {
+    f := &fakeHook{}
+    saved := install
+    install = func(kinds hook.Kind, h hook.Handler) (io.Closer, error) {
+        f.handler = h
+        return f, nil
+    }
+    t.Cleanup(func() { install = saved })
+    return f
+}
+
+func TestStartStop(t *testing.T) {
+    f := installFake(t)
+    r := New(Options{SkipInjected: true})
+    if _, err := r.Stop(); !errors.Is(err, ErrNotStarted) {
+        t.Errorf("Stop before Start = %v, want ErrNotStarted", err)
+    }
+    events, err := r.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := r.Start(context.Background()); !errors.Is(err, ErrStarted) {
+        t.Errorf("second Start = %v, want ErrStarted", err)
+    }
+
+    t0 := time.Now()
+    f.handler(hook.Event{Kind: hook.Mouse, Message: hook.WM_MOUSEMOVE, X: 1, Y: 2, Time: t0})
+    f.handler(hook.Event{Kind: hook.Mouse, Message: hook.WM_MOUSEMOVE, X: 9, Y: 9, Injected: true, Time: t0})
+    f.handler(hook.Event{Kind: hook.Mouse, Message: hook.WM_LBUTTONDOWN, X: 1, Y: 2, Time: t0.Add(40 * time.Millisecond)})
+    for _, want := range []string{format.EventMouseMove, format.EventLeftButtonDown} {
+        select {
+        case rec := <-events:
+            if rec.Event != want {
+                t.Errorf("received %s, want %s", rec.Event, want)
+            }
+        case <-time.After(time.Second):
+            t.Fatalf("no %s received", want)
+        }
+    }
+
+    recording, err := r.Stop()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !f.closed {
+        t.Error("Stop left the hooks installed")
+    }
+    if _, open := <-events; open {
+        t.Error("the channel is still open after Stop")
+    }
+    if n := len(recording.Records); n != 2 {
+        t.Fatalf("recorded %d records, want 2 (the injected move skipped)", n)
+    }
+    if d := recording.Records[1].DeltaMS; d != 40 {
+        t.Errorf("second record's DeltaMS = %d, want 40", d)
+    }
+    if again, _ := r.Stop(); again != recording {
+        t.Error("a second Stop returned another recording")
+    }
+}
+
+func TestStopOnContext(t *testing.T) {
+    f := installFake(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    r := New(Options{})
+    events, err := r.Start(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.handler(hook.Event{Kind: hook.Mouse, Message: hook.WM_RBUTTONDOWN, Time: time.Now()})
+    // Nothing reads events; the handler mustn't wait for a reader.
+    f.handler(hook.Event{Kind: hook.Mouse, Message: hook.WM_RBUTTONUP, Time: time.Now()})
+    cancel()
+    for range events {
+    }
+    recording, err := r.Stop()
+    if err != nil || len(recording.Records) != 2 {
+        t.Errorf("Stop = %v records, %v; want 2", recording, err)
+    }
+}
+
+func TestSimplify(t *testing.T) {
+    move := func(x, y int32) format.Record {
+        return format.Record{Event: format.EventMouseMove, X: x, Y: y, DeltaMS: 10}
+    }
+    records := []format.Record{
+        move(0, 0), move(10, 0), move(20, 1), move(30, 0),
+        move(30, 10), move(30, 20),
+        {Event: format.EventLeftButtonDown, X: 30, Y: 20, DeltaMS: 10},
+    }
+    got := Simplify(records, 2)
+    want := [][2]int32{{0, 0}, {30, 0}, {30, 20}, {30, 20}}
+    if len(got) != len(want) {
+        t.Fatalf("Simplify kept %d records, want %d: %+v", len(got), len(want), got)
+    }
+    var total int64
+    for i, rec := range got {
+        if rec.X != want[i][0] || rec.Y != want[i][1] {
+            t.Errorf("record %d at %d,%d, want %d,%d", i, rec.X, rec.Y, want[i][0], want[i][1])
+        }
+        total += rec.DeltaMS
+    }
+    if total != 70 {
+        t.Errorf("kept records last %dms, want 70", total)
+    }
+    if n := len(Simplify(records, 0)); n != len(records) {
+        t.Errorf("Simplify with no tolerance kept %d records, want all %d", n, len(records))
+    }
+}
+
+func TestAddWithoutHooks(t *testing.T) {
+    installed := false
+    saved := install
+    install = func(kinds hook.Kind, h hook.Handler) (io.Closer, error) {
+        installed = true
+        return &fakeHook{}, nil
+    }
+    defer func() { install = saved }()
+
+    r := New(Options{NoHooks: true, Simplify: 1})
+    if kept := r.Add(format.Record{Event: format.EventMouseMove}, time.Now()); kept != nil {
+        t.Errorf("Add before Start kept %+v", kept)
+    }
+    if _, err := r.Start(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if installed {
+        t.Error("Start installed hooks with NoHooks")
+    }
+    if r.Metadata() == nil {
+        t.Error("no metadata after Start")
+    }
+
+    t0 := time.Now()
+    if kept := r.Add(format.Record{Event: format.EventMouseMove, X: 0}, t0); len(kept) != 1 {
+        t.Errorf("first move kept %d records, want 1", len(kept))
+    }
+    if kept := r.Add(format.Record{Event: format.EventMouseMove, X: 5}, t0.Add(20*time.Millisecond)); len(kept) != 0 {
+        t.Errorf("a move on the straight path came out straight away: %+v", kept)
+    }
+    // Captured earlier, but kept after the first move.
+    if kept := r.Add(format.Record{Event: format.EventMouseMove, X: 10}, t0.Add(-time.Second)); len(kept) != 0 {
+        t.Errorf("a move on the straight path came out straight away: %+v", kept)
+    }
+    recording, err := r.Stop()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := len(recording.Records); n != 2 {
+        t.Fatalf("recorded %d records, want 2 (the held-back endpoint added by Stop)", n)
+    }
+    if last := recording.Records[1]; last.X != 10 || last.DeltaMS != 20 {
+        t.Errorf("last record = %+v, want X 10 and DeltaMS 20", last)
+    }
+    if len(recording.DPISegments) == 0 {
+        t.Error("no DPI segment recorded")
+    }
+    if kept := r.Add(format.Record{Event: format.EventMouseMove}, time.Now()); kept != nil {
+        t.Errorf("Add after Stop kept %+v", kept)
+    }
+}
+
+func ExampleRecorder() {
+    r := New(Options{Keyboard: true})
+    events, err := r.Start(context.Background())
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    // Show clicks as they happen; Esc ends the recording.
+    for rec := range events {
+        if format.IsClick(rec.Event) {
+            fmt.Println(rec.Event, "at", rec.X, rec.Y)
+        }
+        if rec.Event == format.EventKeyUp && rec.Key.VK == 0x1B {
+            break
+        }
+    }
+    recording, err := r.Stop()
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    fmt.Println(len(recording.Records), "records")
+}
+
+func ExampleRecord() {
+    // Record until Ctrl+C.
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    recording, err := Record(ctx, Options{Keyboard: true})
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    if err := format.Save("recording.cfg", recording); err != nil {
+        fmt.Println(err)
+    }
+}
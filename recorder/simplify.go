@@ -0,0 +1,136 @@
+// +build windows
+
+package recorder
+
+import (
+    "math"
+    "time"
+
+    "github.com/onixldlc/MRR/format"
+)
+
+// maxPendingMoves bounds how many candidate moves are held back while the
+// path stays straight, so a long drag can't grow the check without limit.
+const maxPendingMoves = 256
+
+// timedRecord is a record that still carries the wall-clock time it was
+// captured at; DeltaMS is only filled in once it is actually kept.
+type timedRecord struct {
+    rec format.Record
+    at  time.Time
+}
+
+// moveCoalescer drops MouseMove records that lie within tolerance pixels of
+// the straight line between the points kept around them. Direction changes
+// and the endpoints of every stroke survive, so the path keeps its shape
+// while long straight runs collapse to two points.
+type moveCoalescer struct {
+    tolerance float64
+
+    hasAnchor bool
+    anchor    format.Record
+    pending   []timedRecord
+}
+
+func newMoveCoalescer(tolerance float64) *moveCoalescer {
+    return &moveCoalescer{tolerance: tolerance}
+}
+
+// add feeds one captured record and returns the records that should be
+// appended to the recording, in order.
+func (c *moveCoalescer) add(rec format.Record, at time.Time) []timedRecord {
+    if c == nil || c.tolerance <= 0 {
+        return []timedRecord{{rec, at}}
+    }
+
+    if rec.Event != format.EventMouseMove {
+        out := c.flush()
+        c.keep(rec)
+        return append(out, timedRecord{rec, at})
+    }
+
+    if !c.hasAnchor {
+        c.keep(rec)
+        return []timedRecord{{rec, at}}
+    }
+
+    if len(c.pending) < maxPendingMoves && c.straight(rec) {
+        c.pending = append(c.pending, timedRecord{rec, at})
+        return nil
+    }
+
+    // The path turned: the last pending move is a corner and must be kept.
+    corner := c.pending[len(c.pending)-1]
+    c.keep(corner.rec)
+    c.pending = append(c.pending[:0], timedRecord{rec, at})
+    return []timedRecord{corner}
+}
+
+// flush returns the held-back endpoint of the current stroke, if any.
+func (c *moveCoalescer) flush() []timedRecord {
+    if c == nil || len(c.pending) == 0 {
+        return nil
+    }
+    last := c.pending[len(c.pending)-1]
+    c.keep(last.rec)
+    c.pending = c.pending[:0]
+    return []timedRecord{last}
+}
+
+func (c *moveCoalescer) keep(rec format.Record) {
+    c.hasAnchor = true
+    c.anchor = rec
+}
+
+// straight reports whether every pending move stays within tolerance of the
+// segment from the anchor to next.
+func (c *moveCoalescer) straight(next format.Record) bool {
+    for _, p := range c.pending {
+        if segmentDistance(p.rec, c.anchor, next) > c.tolerance {
+            return false
+        }
+    }
+    return true
+}
+
+// segmentDistance is the distance in pixels from p to the segment a-b.
+func segmentDistance(p, a, b format.Record) float64 {
+    px, py := float64(p.X), float64(p.Y)
+    ax, ay := float64(a.X), float64(a.Y)
+    dx, dy := float64(b.X)-ax, float64(b.Y)-ay
+    lenSq := dx*dx + dy*dy
+    if lenSq == 0 {
+        return math.Hypot(px-ax, py-ay)
+    }
+
+    t := ((px-ax)*dx + (py-ay)*dy) / lenSq
+    if t < 0 {
+        t = 0
+    } else if t > 1 {
+        t = 1
+    }
+    return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// Simplify drops the MouseMove records that Options.Simplify would have
+// left out while recording, with tolerance in pixels, and returns the
+// rest. DeltaMS is carried over so the timing is kept. records is not
+// modified.
+func Simplify(records []format.Record, tolerance float64) []format.Record {
+    c := newMoveCoalescer(tolerance)
+    kept := make([]format.Record, 0, len(records))
+    var at, last time.Time
+    keep := func(trs []timedRecord) {
+        for _, tr := range trs {
+            tr.rec.DeltaMS = tr.at.Sub(last).Milliseconds()
+            last = tr.at
+            kept = append(kept, tr.rec)
+        }
+    }
+    for _, rec := range records {
+        at = at.Add(time.Duration(rec.DeltaMS) * time.Millisecond)
+        keep(c.add(rec, at))
+    }
+    keep(c.flush())
+    return kept
+}